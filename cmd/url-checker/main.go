@@ -2,47 +2,236 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"url-checker/internal/database"
 	"url-checker/internal/handlers"
+	"url-checker/internal/models"
 	"url-checker/internal/service"
 
 	"github.com/sirupsen/logrus"
 )
 
 func main() {
+	// flags
+	startupTimeout := flag.Duration("startup-timeout", 30*time.Second, "how long opening the database and loading batches may take before startup fails")
+	maxActiveChecks := flag.Int("max-active-checks", service.DefaultMaxActiveChecks, "maximum number of link checks running at the same time")
+	idempotencyWindow := flag.Duration("idempotency-window", service.DefaultIdempotencyWindow, "how long a repeated submission reuses the original batch (0 disables)")
+	submitDebounce := flag.Duration("submit-debounce", service.DefaultSubmitDebounce, "identical submissions arriving within this window share one batch (0 disables)")
+	csvDelimiter := flag.String("csv-delimiter", ",", "delimiter for CSV output (single character or \"tab\")")
+	csvBOM := flag.Bool("csv-bom", false, "prepend a UTF-8 BOM to CSV output")
+	closeConnectionHosts := flag.String("close-connection-hosts", "", "comma-separated hosts that get \"Connection: close\" instead of keep-alive")
+	maxConcurrentPDFs := flag.Int("max-concurrent-pdfs", service.DefaultMaxConcurrentPDFs, "maximum number of PDF reports generated at the same time")
+	pdfQueueWait := flag.Duration("pdf-queue-wait", service.DefaultPDFQueueWait, "how long a report request waits for room in a full PDF queue before generating synchronously (0 disables)")
+	maxConcurrentDBWrites := flag.Int("max-concurrent-db-writes", service.DefaultMaxConcurrentDBWrites, "maximum number of link results written to the database at the same time")
+	maxConcurrentDBReads := flag.Int("max-concurrent-db-reads", service.DefaultMaxConcurrentDBReads, "maximum number of status, listing and report reads querying the database at the same time")
+	shareChecks := flag.Bool("share-concurrent-checks", false, "let checks of the same URL running at the same time, e.g. in concurrent batches, share one request and its result")
+	minRecheckInterval := flag.Duration("min-recheck-interval", 0, "reuse a URL's previous result if it was checked the same way within this interval (0 disables)")
+	dependencies := flag.String("dependencies", "", "comma-separated URLs probed by /api/health/ready")
+	dependencyTimeout := flag.Duration("dependency-timeout", service.DefaultDependencyProbeTimeout, "timeout for each dependency probe")
+	dependencyCacheTTL := flag.Duration("dependency-cache-ttl", service.DefaultDependencyProbeCacheTTL, "how long dependency probe results are cached")
+	basicAuth := flag.String("basic-auth", os.Getenv("URL_CHECKER_BASIC_AUTH"), "comma-separated host=username:password credentials for checks (defaults to $URL_CHECKER_BASIC_AUTH)")
+	allowedSchemes := flag.String("allowed-schemes", strings.Join(service.DefaultAllowedSchemes, ","), "comma-separated link schemes that may be checked; links with other schemes are marked not available")
+	var fallbackUserAgents stringList
+	flag.Var(&fallbackUserAgents, "fallback-user-agent", "user agent to retry a check with when a link answers 403; may be repeated to try several in order")
+	checkTimeout := flag.Duration("check-timeout", 10*time.Second, "default time limit of each link check request; a batch's timeout_ms or timeout_seconds overrides it")
+	transientRetries := flag.Int("transient-retries", service.DefaultTransientRetries, "how many times a check that failed to connect or got a 5xx status is repeated right away (0 disables)")
+	transientRetryDelay := flag.Duration("transient-retry-delay", service.DefaultTransientRetryDelay, "wait before the first repeat of a transiently failed check, doubled before each next one")
+	changeWebhook := flag.String("change-webhook", "", "URL that receives a JSON event whenever a retry or recheck changes a link's status")
+	changeWebhookTimeout := flag.Duration("change-webhook-timeout", service.DefaultWebhookTimeout, "time limit for delivering a change event")
+	connectionMetrics := flag.Bool("connection-metrics", service.DefaultConnectionMetrics, "report open, idle and in-use connections of the check transport and connection wait time on /metrics")
+	redirectBodyLimit := flag.Int64("redirect-body-limit", 0, "maximum bytes read from the response bodies of one check, summed over its redirects; a check exceeding it fails (0 is unlimited)")
+	metricsSnapshot := flag.Bool("metrics-snapshot", true, "serve current counters and gauges as JSON on /api/metrics/snapshot")
+	headFirst := flag.Bool("head-first", false, "check links with HEAD instead of GET, falling back to GET when a server answers 405 or 501")
+	debugMetadataSize := flag.Int("debug-metadata-size", 0, "store request and response headers of every check up to this many bytes per link, shown by GET /api/link/{id} (0 disables)")
+	availableStatuses := flag.String("available-statuses", "", "comma-separated host=status pairs counted as available for that host, e.g. \"example.com=403\"")
+	checkHeader := flag.String("check-header", "", "extra \"Name: value\" header sent with every check, e.g. \"X-Checked-By: url-checker\"")
+	reportTitle := flag.String("report-title", service.DefaultReportTitle, "heading of PDF reports")
+	checkProfiles := flag.String("check-profiles", "", "path to a JSON file of named check profiles a request can select with \"profile\"")
+	smtpHost := flag.String("smtp-host", "", "SMTP server emailed reports are sent through; reports can't be emailed without it")
+	smtpPort := flag.Int("smtp-port", service.DefaultSMTPPort, "port of the SMTP server")
+	smtpUsername := flag.String("smtp-username", "", "username for SMTP authentication (none when empty)")
+	smtpPassword := flag.String("smtp-password", os.Getenv("URL_CHECKER_SMTP_PASSWORD"), "password for SMTP authentication (defaults to $URL_CHECKER_SMTP_PASSWORD)")
+	smtpFrom := flag.String("smtp-from", "", "sender address of emailed reports")
+	reportEmailTo := flag.String("report-email-to", "", "comma-separated addresses POST /api/report/email sends reports to")
+	notifyCompletion := flag.Bool("notify-on-completion", false, "also email a summary to -report-email-to whenever a batch finishes its initial check")
+	reportLogo := flag.String("report-logo", "", "path to a PNG or JPEG logo shown at the top of PDF reports")
+	reportFont := flag.String("report-font", "", "path to a TrueType font PDF reports are set in instead of the embedded DejaVu Sans Condensed")
+	maxReportSize := flag.Int64("max-report-size", service.DefaultMaxReportSize, "maximum size of a generated report in bytes, in any format (0 is unlimited)")
+	batchListLimit := flag.Int("batch-list-limit", service.DefaultBatchListLimit, "default page size of /api/batches")
+	maxBatches := flag.Int("max-batches", 0, "maximum number of stored batches; the oldest are deleted when a new batch exceeds it (0 is unlimited)")
+	minSuccessRatio := flag.Float64("min-success-ratio", 0, "mark a batch completed_degraded when fewer than this share of its links are available (0 disables)")
+	maxLinksPerHost := flag.Int("max-links-per-host", 0, "maximum number of links in one batch that may target the same host (0 is unlimited)")
+	methodPolicy := flag.String("method-policy", string(models.MethodPolicyAll), "whether a link checked with several methods needs \"all\" or \"any\" of them to succeed")
+	processingGracePeriod := flag.Duration("processing-grace-period", service.DefaultProcessingGracePeriod, "on startup, links still processing in batches older than this are marked interrupted")
+	selfCheckInterval := flag.Duration("self-check-interval", 0, "ping the database this often in the background and report the last success in /api/health (0 disables)")
+	resultTTL := flag.Duration("result-ttl", 0, "mark a batch stale when a link result is older than this (0 disables)")
+	dbBusyRetries := flag.Int("db-busy-retries", database.DefaultBusyRetries, "how many times a database write is retried while SQLite reports it busy")
+	dbBusyBackoff := flag.Duration("db-busy-backoff", database.DefaultBusyBackoff, "base wait between retries of a busy database write")
+	dbReportConnections := flag.Int("db-report-connections", database.DefaultReportConnections, "maximum database connections used by report generation, kept apart from the ones link checks write through")
+	recreateDB := flag.Bool("recreate-db", false, "move a corrupt database file aside and start with an empty database instead of exiting")
+	flag.Parse()
+
 	// logger
 	logger := logrus.New()
 	logger.SetLevel(logrus.InfoLevel)
 
+	delimiter, err := service.ParseCSVDelimiter(*csvDelimiter)
+	if err != nil {
+		logger.Fatalf("Invalid -csv-delimiter: %v", err)
+	}
+
+	credentials, err := service.ParseBasicAuth(*basicAuth)
+	if err != nil {
+		logger.Fatalf("Invalid -basic-auth: %v", err)
+	}
+
+	overrides, err := service.ParseStatusOverrides(*availableStatuses)
+	if err != nil {
+		logger.Fatalf("Invalid -available-statuses: %v", err)
+	}
+
+	header, err := service.ParseCheckHeader(*checkHeader)
+	if err != nil {
+		logger.Fatalf("Invalid -check-header: %v", err)
+	}
+
+	var logo *service.ReportLogo
+	if *reportLogo != "" {
+		logo, err = service.LoadReportLogo(*reportLogo)
+		if err != nil {
+			logger.Fatalf("Invalid -report-logo: %v", err)
+		}
+	}
+
+	var font *service.ReportFont
+	if *reportFont != "" {
+		font, err = service.LoadReportFont(*reportFont)
+		if err != nil {
+			logger.Fatalf("Invalid -report-font: %v", err)
+		}
+	}
+
+	var profiles map[string]service.CheckProfile
+	if *checkProfiles != "" {
+		profiles, err = service.LoadCheckProfiles(*checkProfiles)
+		if err != nil {
+			logger.Fatalf("Invalid -check-profiles: %v", err)
+		}
+	}
+
+	var notifier service.Notifier
+	recipients, err := service.ParseEmailRecipients(*reportEmailTo)
+	if err != nil {
+		logger.Fatalf("Invalid -report-email-to: %v", err)
+	}
+	if *smtpHost != "" {
+		smtpNotifier, err := service.NewSMTPNotifier(service.SMTPConfig{
+			Host:     *smtpHost,
+			Port:     *smtpPort,
+			Username: *smtpUsername,
+			Password: *smtpPassword,
+			From:     *smtpFrom,
+			To:       recipients,
+		})
+		if err != nil {
+			logger.Fatalf("Invalid SMTP settings: %v", err)
+		}
+		notifier = smtpNotifier
+	}
+
+	defaultMethodPolicy, err := service.ParseMethodPolicy(*methodPolicy)
+	if err != nil {
+		logger.Fatalf("Invalid -method-policy: %v", err)
+	}
+
+	// startup steps share one deadline, so a hung database fails the boot
+	startupCtx, cancelStartup := context.WithTimeout(context.Background(), *startupTimeout)
+	defer cancelStartup()
+
 	// DB
-	db, err := database.NewDatabase("./url-checker.db")
+	db, err := database.NewDatabaseContext(startupCtx, "./url-checker.db",
+		database.WithBusyRetries(*dbBusyRetries, *dbBusyBackoff),
+		database.WithReportConnections(*dbReportConnections),
+		database.WithRecreateCorrupt(*recreateDB),
+	)
 	if err != nil {
-		logger.Fatalf("Failed to initialize database: %v", err)
+		logger.Fatalf("Failed to initialize database: %v", startupError(err, *startupTimeout))
 	}
 	defer db.Close()
 
-	// HTTP Client
-	httpClient := &http.Client{
-		Timeout: 10 * time.Second,
+	if backup := db.CorruptBackup(); backup != "" {
+		logger.Warnf("Database was corrupt and has been recreated, the old file was moved to %s", backup)
 	}
 
+	// HTTP Client, without a timeout of its own so a batch may allow its
+	// checks longer than -check-timeout
+	httpClient := &http.Client{}
+
 	// URLChecker
-	checker := service.NewURLChecker(db, logger, httpClient)
+	checker := service.NewURLChecker(db, logger, httpClient,
+		service.WithMaxActiveChecks(*maxActiveChecks),
+		service.WithMaxConcurrentPDFs(*maxConcurrentPDFs),
+		service.WithPDFQueueWait(*pdfQueueWait),
+		service.WithMaxConcurrentDBWrites(*maxConcurrentDBWrites),
+		service.WithMaxConcurrentDBReads(*maxConcurrentDBReads),
+		service.WithIdempotencyWindow(*idempotencyWindow),
+		service.WithSubmitDebounce(*submitDebounce),
+		service.WithCSVOptions(service.CSVOptions{Delimiter: delimiter, BOM: *csvBOM}),
+		service.WithCloseConnectionHosts(strings.Split(*closeConnectionHosts, ",")),
+		service.WithBasicAuth(credentials),
+		service.WithStatusOverrides(overrides),
+		service.WithCheckHeader(header),
+		service.WithFallbackUserAgents(fallbackUserAgents),
+		service.WithCheckProfiles(profiles),
+		service.WithHeadFirst(*headFirst),
+		service.WithConnectionMetrics(*connectionMetrics),
+		service.WithMetricsSnapshot(*metricsSnapshot),
+		service.WithChangeWebhook(*changeWebhook, *changeWebhookTimeout),
+		service.WithCheckTimeout(*checkTimeout),
+		service.WithRedirectBodyLimit(*redirectBodyLimit),
+		service.WithTransientRetries(*transientRetries, *transientRetryDelay),
+		service.WithDebugMetadata(*debugMetadataSize),
+		service.WithAllowedSchemes(strings.Split(*allowedSchemes, ",")),
+		service.WithMinRecheckInterval(*minRecheckInterval),
+		service.WithSharedChecks(*shareChecks),
+		service.WithResultTTL(*resultTTL),
+		service.WithSelfCheckInterval(*selfCheckInterval),
+		service.WithProcessingGracePeriod(*processingGracePeriod),
+		service.WithMaxLinksPerHost(*maxLinksPerHost),
+		service.WithMinSuccessRatio(*minSuccessRatio),
+		service.WithMaxBatches(*maxBatches),
+		service.WithMethodPolicy(defaultMethodPolicy),
+		service.WithBatchListLimit(*batchListLimit),
+		service.WithReportTitle(*reportTitle),
+		service.WithReportLogo(logo),
+		service.WithReportFont(font),
+		service.WithNotifier(notifier, *notifyCompletion),
+		service.WithMaxReportSize(*maxReportSize),
+		service.WithDependencies(strings.Split(*dependencies, ","), *dependencyTimeout, *dependencyCacheTTL),
+	)
 
-	if err := checker.LoadBatches(context.Background()); err != nil {
-		logger.Fatalf("Failed to load batches from database: %v", err)
+	if err := checker.LoadBatches(startupCtx); err != nil {
+		logger.Fatalf("Failed to load batches from database: %v", startupError(err, *startupTimeout))
 	}
+	cancelStartup()
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	go checker.StartWorker(ctx)
+	go checker.StartBatchWorker(ctx)
+	go checker.StartRetryWorker(ctx)
+	go checker.StartExpiryWorker(ctx)
+	go checker.StartSelfCheckWorker(ctx)
 
 	// Routers
 	handler := handlers.NewHandler(checker, logger)
@@ -65,6 +254,19 @@ func main() {
 	gracefulShutdown(server, checker, 30*time.Second, logger)
 }
 
+// stringList is a flag that may be repeated, collecting every value. It suits
+// values that may contain commas themselves, such as user agents.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
 func gracefulShutdown(server *http.Server, checker *service.URLChecker, shutdownTimeout time.Duration, logger *logrus.Logger) {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
@@ -72,14 +274,24 @@ func gracefulShutdown(server *http.Server, checker *service.URLChecker, shutdown
 	<-sigChan
 	logger.Info("Shutdown signal received, starting graceful shutdown...")
 
-	checker.SetShutdown(true)
-
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), shutdownTimeout)
 	defer shutdownCancel()
 
+	stats := checker.Shutdown(shutdownCtx)
+	logger.Infof("Pending at shutdown: %d in-flight batches, %d links processing, %d active checks, %d queued PDF tasks",
+		stats.InFlightBatches, stats.ProcessingLinks, stats.ActiveChecks, stats.QueuedPDFTasks)
+
 	if err := server.Shutdown(shutdownCtx); err != nil {
 		logger.Errorf("Server shutdown error: %v", err)
 	}
 
 	logger.Info("Graceful shutdown completed")
 }
+
+// startupError points at -startup-timeout when a startup step ran out of time.
+func startupError(err error, timeout time.Duration) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("startup did not finish within %s (see -startup-timeout): %w", timeout, err)
+	}
+	return err
+}
@@ -0,0 +1,85 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+const (
+	DefaultBusyRetries = 5
+	DefaultBusyBackoff = 20 * time.Millisecond
+)
+
+type Option func(*Database)
+
+// WithBusyRetries sets how many times a write is retried when SQLite reports
+// the database as busy or locked, waiting backoff longer before each attempt.
+// Zero disables retries.
+func WithBusyRetries(limit int, backoff time.Duration) Option {
+	return func(d *Database) {
+		if limit < 0 {
+			limit = 0
+		}
+		if backoff <= 0 {
+			backoff = DefaultBusyBackoff
+		}
+		d.busyRetries = limit
+		d.busyBackoff = backoff
+	}
+}
+
+func isBusy(err error) bool {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+}
+
+// exec runs a write statement, retrying transient busy errors.
+func (d *Database) exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	var result sql.Result
+	err := d.retryBusy(ctx, func() error {
+		var err error
+		result, err = d.db.ExecContext(ctx, query, args...)
+		return err
+	})
+	return result, err
+}
+
+// inTx runs fn in a transaction, retrying the whole transaction on transient
+// busy errors. fn may run more than once.
+func (d *Database) inTx(ctx context.Context, fn func(*sql.Tx) error) error {
+	return d.retryBusy(ctx, func() error {
+		tx, err := d.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+
+		if err := fn(tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		return tx.Commit()
+	})
+}
+
+func (d *Database) retryBusy(ctx context.Context, op func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := op()
+		if err == nil || !isBusy(err) || attempt >= d.busyRetries {
+			return err
+		}
+
+		select {
+		case <-time.After(d.busyBackoff * time.Duration(attempt+1)):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
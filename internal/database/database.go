@@ -3,7 +3,11 @@ package database
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/url"
+	"strings"
 	"time"
 
 	"url-checker/internal/models"
@@ -11,36 +15,133 @@ import (
 	_ "github.com/mattn/go-sqlite3"
 )
 
+var (
+	ErrBatchNotFound = errors.New("batch not found")
+	ErrLinkNotFound  = errors.New("link not found")
+)
+
+// DefaultDriver is the database/sql driver the database is opened with.
+const DefaultDriver = "sqlite3"
+
 type Database struct {
-	db *sql.DB
+	db     *sql.DB
+	driver string
+
+	// reportDB serves report queries; see WithReportConnections
+	reportDB    *sql.DB
+	reportConns int
+
+	busyRetries int
+	busyBackoff time.Duration
+
+	recreateCorrupt bool
+	corruptBackup   string
 }
 
-func NewDatabase(dbPath string) (*Database, error) {
-	db, err := sql.Open("sqlite3", dbPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+// WithDriver opens the database with the database/sql driver registered under
+// name instead of DefaultDriver. It has to be a go-sqlite3 driver, such as one
+// registered with a connect hook that traces statements.
+func WithDriver(name string) Option {
+	return func(d *Database) {
+		if name != "" {
+			d.driver = name
+		}
+	}
+}
+
+func NewDatabase(dbPath string, opts ...Option) (*Database, error) {
+	database := &Database{
+		driver:      DefaultDriver,
+		busyRetries: DefaultBusyRetries,
+		busyBackoff: DefaultBusyBackoff,
+		reportConns: DefaultReportConnections,
+	}
+
+	for _, opt := range opts {
+		opt(database)
 	}
 
-	if err := db.Ping(); err != nil {
+	db, err := openDatabase(database.driver, dbPath)
+	if errors.Is(err, ErrCorruptDatabase) && database.recreateCorrupt {
+		database.corruptBackup, err = backupCorruptFile(dbPath)
+		if err == nil {
+			db, err = openDatabase(database.driver, dbPath)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := enableWAL(db); err != nil {
 		db.Close()
-		return nil, fmt.Errorf("failed to ping database: %w", err)
+		return nil, err
 	}
+	database.db = db
 
-	database := &Database{db: db}
+	database.reportDB, err = openReportPool(database.driver, dbPath, database.reportConns)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
 
 	if err := database.createTables(); err != nil {
-		db.Close()
+		database.Close()
 		return nil, fmt.Errorf("failed to create tables: %w", err)
 	}
 
 	return database, nil
 }
 
+// NewDatabaseContext is NewDatabase bounded by ctx, so a database that hangs
+// while opening fails startup instead of blocking it. A database that finishes
+// opening after ctx is done is closed again.
+func NewDatabaseContext(ctx context.Context, dbPath string, opts ...Option) (*Database, error) {
+	type opened struct {
+		db  *Database
+		err error
+	}
+	done := make(chan opened, 1)
+
+	go func() {
+		db, err := NewDatabase(dbPath, opts...)
+		done <- opened{db, err}
+	}()
+
+	select {
+	case result := <-done:
+		return result.db, result.err
+	case <-ctx.Done():
+		go func() {
+			if result := <-done; result.err == nil {
+				result.db.Close()
+			}
+		}()
+		return nil, fmt.Errorf("database %s did not open in time: %w", dbPath, ctx.Err())
+	}
+}
+
 func (d *Database) createTables() error {
 	batchSQL := `CREATE TABLE IF NOT EXISTS batches (
 		links_num INTEGER PRIMARY KEY,
 		status TEXT NOT NULL,
-		created_at DATETIME NOT NULL
+		created_at DATETIME NOT NULL,
+		checksum TEXT NOT NULL DEFAULT '',
+		idempotency_key TEXT NOT NULL DEFAULT '',
+		retry_count INTEGER NOT NULL DEFAULT 0,
+		retry_delay_ms INTEGER NOT NULL DEFAULT 0,
+		retries_done INTEGER NOT NULL DEFAULT 0,
+		next_retry_at DATETIME,
+		timeout_ms INTEGER NOT NULL DEFAULT 0,
+		link_count INTEGER NOT NULL DEFAULT 0,
+		methods TEXT NOT NULL DEFAULT '',
+		method_policy TEXT NOT NULL DEFAULT '',
+		disable_keep_alive BOOLEAN NOT NULL DEFAULT 0,
+		server_name TEXT NOT NULL DEFAULT '',
+		discover_methods BOOLEAN NOT NULL DEFAULT 0,
+		expires_at DATETIME,
+		had_cookies BOOLEAN NOT NULL DEFAULT 0,
+		source TEXT NOT NULL DEFAULT '',
+		profile TEXT NOT NULL DEFAULT '',
+		dedup TEXT NOT NULL DEFAULT ''
 	);`
 
 	if _, err := d.db.Exec(batchSQL); err != nil {
@@ -53,6 +154,17 @@ func (d *Database) createTables() error {
 		status TEXT NOT NULL,
 		batch_num INTEGER NOT NULL,
 		time DATETIME,
+		check_source TEXT NOT NULL DEFAULT 'initial',
+		host TEXT,
+		error TEXT,
+		allow TEXT,
+		notes TEXT,
+		user_agent TEXT,
+		debug TEXT,
+		status_code INTEGER,
+		response_time_ms INTEGER,
+		status_text TEXT,
+		method_results TEXT,
 		FOREIGN KEY (batch_num) REFERENCES batches(links_num)
 	);`
 
@@ -60,31 +172,377 @@ func (d *Database) createTables() error {
 		return fmt.Errorf("failed to create links table: %w", err)
 	}
 
+	if err := d.createBatchSequence(); err != nil {
+		return fmt.Errorf("failed to create batch sequence: %w", err)
+	}
+
+	if err := d.migrate(); err != nil {
+		return err
+	}
+
+	indexSQL := `CREATE INDEX IF NOT EXISTS idx_batches_checksum ON batches (checksum);
+		CREATE INDEX IF NOT EXISTS idx_batches_idempotency_key ON batches (idempotency_key);
+		CREATE INDEX IF NOT EXISTS idx_links_host ON links (host);
+		CREATE INDEX IF NOT EXISTS idx_links_batch_num ON links (batch_num);`
+
+	if _, err := d.db.Exec(indexSQL); err != nil {
+		return fmt.Errorf("failed to create indexes: %w", err)
+	}
+
+	// counts the links of every batch, so it runs once idx_links_batch_num
+	// exists
+	if err := d.reconcileLinkCounts(); err != nil {
+		return fmt.Errorf("failed to reconcile link counts: %w", err)
+	}
+
 	return nil
 }
 
-func (d *Database) CreateBatch(ctx context.Context, linksNum int, status models.BatchStatus, createdAt time.Time) error {
-	sql := `INSERT INTO batches (links_num, status, created_at) VALUES (?, ?, ?)`
+// createBatchSequence creates the one row holding the last batch number handed
+// out, starting it from the stored batches for databases created before it
+// existed.
+func (d *Database) createBatchSequence() error {
+	sequenceSQL := `CREATE TABLE IF NOT EXISTS batch_sequence (
+		id INTEGER PRIMARY KEY CHECK (id = 1),
+		last_num INTEGER NOT NULL
+	);`
+
+	if _, err := d.db.Exec(sequenceSQL); err != nil {
+		return err
+	}
+
+	// only take the write lock when the row is actually missing
+	var rows int
+	if err := d.db.QueryRow(`SELECT COUNT(*) FROM batch_sequence`).Scan(&rows); err != nil {
+		return err
+	}
+	if rows > 0 {
+		return nil
+	}
+
+	_, err := d.db.Exec(`INSERT OR IGNORE INTO batch_sequence (id, last_num) SELECT 1, COALESCE(MAX(links_num), 0) FROM batches`)
+	return err
+}
+
+// migrate adds columns introduced after the initial schema to databases
+// created by older versions.
+func (d *Database) migrate() error {
+	columns := []struct {
+		table      string
+		column     string
+		definition string
+	}{
+		{"batches", "checksum", "TEXT NOT NULL DEFAULT ''"},
+		{"batches", "idempotency_key", "TEXT NOT NULL DEFAULT ''"},
+		{"batches", "retry_count", "INTEGER NOT NULL DEFAULT 0"},
+		{"batches", "retry_delay_ms", "INTEGER NOT NULL DEFAULT 0"},
+		{"batches", "retries_done", "INTEGER NOT NULL DEFAULT 0"},
+		{"batches", "next_retry_at", "DATETIME"},
+		{"batches", "timeout_ms", "INTEGER NOT NULL DEFAULT 0"},
+		{"batches", "link_count", "INTEGER NOT NULL DEFAULT 0"},
+		{"batches", "methods", "TEXT NOT NULL DEFAULT ''"},
+		{"batches", "method_policy", "TEXT NOT NULL DEFAULT ''"},
+		{"batches", "disable_keep_alive", "BOOLEAN NOT NULL DEFAULT 0"},
+		{"batches", "server_name", "TEXT NOT NULL DEFAULT ''"},
+		{"batches", "discover_methods", "BOOLEAN NOT NULL DEFAULT 0"},
+		{"batches", "expires_at", "DATETIME"},
+		{"batches", "source", "TEXT NOT NULL DEFAULT ''"},
+		{"batches", "profile", "TEXT NOT NULL DEFAULT ''"},
+		{"batches", "had_cookies", "BOOLEAN NOT NULL DEFAULT 0"},
+		{"batches", "dedup", "TEXT NOT NULL DEFAULT ''"},
+		{"links", "check_source", "TEXT NOT NULL DEFAULT 'initial'"},
+		{"links", "host", "TEXT"},
+		{"links", "error", "TEXT"},
+		{"links", "allow", "TEXT"},
+		{"links", "notes", "TEXT"},
+		{"links", "user_agent", "TEXT"},
+		{"links", "debug", "TEXT"},
+		{"links", "status_code", "INTEGER"},
+		{"links", "response_time_ms", "INTEGER"},
+		{"links", "status_text", "TEXT"},
+		{"links", "method_results", "TEXT"},
+	}
+
+	for _, c := range columns {
+		if err := d.addColumnIfMissing(c.table, c.column, c.definition); err != nil {
+			return fmt.Errorf("failed to migrate %s.%s: %w", c.table, c.column, err)
+		}
+	}
+
+	if err := d.backfillLinkHosts(); err != nil {
+		return fmt.Errorf("failed to backfill link hosts: %w", err)
+	}
+
+	return nil
+}
+
+// reconcileLinkCounts resets the stored link_count of every batch to the
+// actual number of link rows, repairing counts written by older versions.
+func (d *Database) reconcileLinkCounts() error {
+	const actual = `(SELECT COUNT(*) FROM links WHERE links.batch_num = batches.links_num)`
+
+	// only take the write lock when something is actually off
+	var mismatched int
+	if err := d.db.QueryRow(`SELECT COUNT(*) FROM batches WHERE link_count != ` + actual).Scan(&mismatched); err != nil {
+		return err
+	}
+	if mismatched == 0 {
+		return nil
+	}
+
+	_, err := d.db.Exec(`UPDATE batches SET link_count = ` + actual + ` WHERE link_count != ` + actual)
+	return err
+}
+
+// backfillLinkHosts fills the host column for links stored before it existed.
+func (d *Database) backfillLinkHosts() error {
+	rows, err := d.db.Query(`SELECT id, url FROM links WHERE host IS NULL`)
+	if err != nil {
+		return err
+	}
+
+	hosts := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var rawURL string
+		if err := rows.Scan(&id, &rawURL); err != nil {
+			rows.Close()
+			return err
+		}
+		hosts[id] = extractHost(rawURL)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, host := range hosts {
+		if _, err := d.db.Exec(`UPDATE links SET host = ? WHERE id = ?`, host, id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// extractHost returns the lower-cased host of a submitted link, assuming
+// http:// when no scheme is given. Unparseable links get an empty host.
+func extractHost(rawURL string) string {
+	rawURL = strings.TrimSpace(rawURL)
+	if !strings.HasPrefix(rawURL, "http://") && !strings.HasPrefix(rawURL, "https://") {
+		rawURL = "http://" + rawURL
+	}
+
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+
+	return strings.ToLower(parsedURL.Hostname())
+}
+
+func (d *Database) addColumnIfMissing(table, column, definition string) error {
+	rows, err := d.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
 
-	_, err := d.db.ExecContext(ctx, sql, linksNum, status, createdAt)
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = d.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+const batchColumns = `links_num, status, created_at, checksum, idempotency_key,
+	retry_count, retry_delay_ms, retries_done, next_retry_at, timeout_ms, link_count,
+	methods, method_policy, disable_keep_alive, server_name, discover_methods, expires_at, source, profile, had_cookies, dedup`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanBatch(row rowScanner) (*models.Batch, error) {
+	batch := &models.Batch{}
+	var methods string
+	err := row.Scan(&batch.LinksNum, &batch.Status, &batch.CreatedAt, &batch.Checksum, &batch.IdempotencyKey,
+		&batch.RetryCount, &batch.RetryDelayMs, &batch.RetriesDone, &batch.NextRetryAt, &batch.TimeoutMs, &batch.LinkCount,
+		&methods, &batch.MethodPolicy, &batch.DisableKeepAlive, &batch.ServerName, &batch.DiscoverMethods, &batch.ExpiresAt, &batch.Source, &batch.Profile, &batch.HadCookies, &batch.Dedup)
 	if err != nil {
+		return nil, err
+	}
+	batch.BatchNum = batch.LinksNum
+	if methods != "" {
+		batch.Methods = strings.Split(methods, ",")
+	}
+	return batch, nil
+}
+
+const linkColumns = `id, url, status, batch_num, time, check_source, COALESCE(host, ''), COALESCE(error, ''), COALESCE(allow, ''), COALESCE(notes, ''), COALESCE(user_agent, ''), COALESCE(status_code, 0), COALESCE(response_time_ms, 0), COALESCE(status_text, ''), COALESCE(method_results, '')`
+
+// scanLink scans linkColumns, followed by any extra columns into extra.
+func scanLink(row rowScanner, extra ...any) (*models.Link, error) {
+	link := &models.Link{}
+	var methods string
+	dest := append([]any{&link.ID, &link.URL, &link.Status, &link.BatchNum, &link.Time, &link.CheckSource, &link.Host, &link.Error, &link.Allow, &link.Notes, &link.UserAgent, &link.StatusCode, &link.ResponseTimeMs, &link.StatusText, &methods}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	if methods != "" {
+		if err := json.Unmarshal([]byte(methods), &link.Methods); err != nil {
+			return nil, fmt.Errorf("failed to decode method results of link %d: %w", link.ID, err)
+		}
+	}
+	return link, nil
+}
+
+func (d *Database) CreateBatch(ctx context.Context, linksNum int, status models.BatchStatus, createdAt time.Time) error {
+	return d.InsertBatch(ctx, &models.Batch{
+		LinksNum:  linksNum,
+		Status:    status,
+		CreatedAt: createdAt,
+	})
+}
+
+const insertBatchSQL = `INSERT INTO batches (` + batchColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+// insertBatchArgs returns the values of batchColumns for batch.
+func insertBatchArgs(batch *models.Batch) []any {
+	// stored in UTC so DeleteExpiredBatches can compare it as text
+	var expiresAt *time.Time
+	if batch.ExpiresAt != nil {
+		utc := batch.ExpiresAt.UTC()
+		expiresAt = &utc
+	}
+
+	return []any{batch.LinksNum, batch.Status, batch.CreatedAt, batch.Checksum, batch.IdempotencyKey,
+		batch.RetryCount, batch.RetryDelayMs, batch.RetriesDone, batch.NextRetryAt, batch.TimeoutMs, batch.LinkCount,
+		strings.Join(batch.Methods, ","), batch.MethodPolicy, batch.DisableKeepAlive, batch.ServerName, batch.DiscoverMethods, expiresAt, batch.Source, batch.Profile, batch.HadCookies, batch.Dedup}
+}
+
+func (d *Database) InsertBatch(ctx context.Context, batch *models.Batch) error {
+	if _, err := d.exec(ctx, insertBatchSQL, insertBatchArgs(batch)...); err != nil {
 		return fmt.Errorf("failed to create batch: %w", err)
 	}
 
 	return nil
 }
 
-func (d *Database) CreateLink(ctx context.Context, url string, status models.LinkStatus, batchNum int, time *time.Time) (int, error) {
-	sql := `INSERT INTO links (url, status, batch_num, time) VALUES (?, ?, ?, ?)`
+// InsertBatchWithLinks stores a new batch together with its links as
+// processing in one transaction, so a failure leaves neither behind. A batch
+// without a number gets the next one from the batch sequence. It sets the
+// batch's number and link count and returns the link IDs in the order of urls.
+func (d *Database) InsertBatchWithLinks(ctx context.Context, batch *models.Batch, urls []string) ([]int, error) {
+	batch.LinkCount = len(urls)
+	allocate := batch.LinksNum == 0
+
+	var ids []int
+	err := d.inTx(ctx, func(tx *sql.Tx) error {
+		ids = make([]int, 0, len(urls))
+
+		if allocate {
+			num, err := nextBatchNum(ctx, tx)
+			if err != nil {
+				return err
+			}
+			batch.LinksNum = num
+		}
+
+		if _, err := tx.ExecContext(ctx, insertBatchSQL, insertBatchArgs(batch)...); err != nil {
+			return fmt.Errorf("failed to create batch: %w", err)
+		}
+
+		stmt, err := tx.PrepareContext(ctx, `INSERT INTO links (url, status, batch_num, host) VALUES (?, ?, ?, ?)`)
+		if err != nil {
+			return fmt.Errorf("failed to prepare link insert: %w", err)
+		}
+		defer stmt.Close()
+
+		for _, url := range urls {
+			result, err := stmt.ExecContext(ctx, url, models.StatusProcessing, batch.LinksNum, extractHost(url))
+			if err != nil {
+				return fmt.Errorf("failed to create link for %s: %w", url, err)
+			}
+
+			id, err := result.LastInsertId()
+			if err != nil {
+				return fmt.Errorf("failed to get link id: %w", err)
+			}
+			ids = append(ids, int(id))
+		}
+
+		return nil
+	})
+	if err != nil {
+		if allocate {
+			batch.LinksNum = 0
+		}
+		return nil, err
+	}
+
+	return ids, nil
+}
 
-	result, err := d.db.ExecContext(ctx, sql, url, status, batchNum, time)
+// nextBatchNum takes the next batch number in tx. Numbers only grow, so the
+// number of a deleted batch is never handed out again, and they stay above
+// batches stored with a number of their own.
+func nextBatchNum(ctx context.Context, tx *sql.Tx) (int, error) {
+	_, err := tx.ExecContext(ctx, `UPDATE batch_sequence
+		SET last_num = MAX(last_num, (SELECT COALESCE(MAX(links_num), 0) FROM batches)) + 1
+		WHERE id = 1`)
 	if err != nil {
-		return 0, fmt.Errorf("failed to create link: %w", err)
+		return 0, fmt.Errorf("failed to advance batch sequence: %w", err)
+	}
+
+	var num int
+	if err := tx.QueryRowContext(ctx, `SELECT last_num FROM batch_sequence WHERE id = 1`).Scan(&num); err != nil {
+		return 0, fmt.Errorf("failed to read batch sequence: %w", err)
 	}
 
-	id, err := result.LastInsertId()
+	return num, nil
+}
+
+func (d *Database) CreateLink(ctx context.Context, url string, status models.LinkStatus, batchNum int, time *time.Time) (int, error) {
+	var id int64
+	err := d.inTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, `INSERT INTO links (url, status, batch_num, time, host) VALUES (?, ?, ?, ?, ?)`,
+			url, status, batchNum, time, extractHost(url))
+		if err != nil {
+			return fmt.Errorf("failed to create link: %w", err)
+		}
+
+		if id, err = result.LastInsertId(); err != nil {
+			return fmt.Errorf("failed to get link id: %w", err)
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE batches SET link_count = link_count + 1 WHERE links_num = ?`, batchNum); err != nil {
+			return fmt.Errorf("failed to update batch link count: %w", err)
+		}
+
+		return nil
+	})
 	if err != nil {
-		return 0, fmt.Errorf("failed to get link id: %w", err)
+		return 0, err
 	}
 
 	return int(id), nil
@@ -93,7 +551,7 @@ func (d *Database) CreateLink(ctx context.Context, url string, status models.Lin
 func (d *Database) UpdateLinkStatus(ctx context.Context, id int, status models.LinkStatus, time *time.Time) error {
 	sql := `UPDATE links SET status = ?, time = ? WHERE id = ?`
 
-	_, err := d.db.ExecContext(ctx, sql, status, time, id)
+	_, err := d.exec(ctx, sql, status, time, id)
 	if err != nil {
 		return fmt.Errorf("failed to update link status: %w", err)
 	}
@@ -101,10 +559,90 @@ func (d *Database) UpdateLinkStatus(ctx context.Context, id int, status models.L
 	return nil
 }
 
+// UpdateLinkResult stores the outcome of a check for an existing link row.
+func (d *Database) UpdateLinkResult(ctx context.Context, link *models.Link) error {
+	sql := `UPDATE links SET status = ?, time = ?, check_source = ?, error = NULLIF(?, ''), allow = NULLIF(?, ''), user_agent = NULLIF(?, ''), debug = ?, status_code = NULLIF(?, 0), response_time_ms = NULLIF(?, 0), status_text = NULLIF(?, ''), method_results = ? WHERE id = ?`
+
+	checkSource := link.CheckSource
+	if checkSource == "" {
+		checkSource = models.CheckSourceInitial
+	}
+
+	var debug []byte
+	if link.Debug != nil {
+		var err error
+		if debug, err = json.Marshal(link.Debug); err != nil {
+			return fmt.Errorf("failed to encode link debug metadata: %w", err)
+		}
+	}
+
+	// a check with a single method clears the results of an earlier one
+	var methods *string
+	if len(link.Methods) > 0 {
+		encoded, err := json.Marshal(link.Methods)
+		if err != nil {
+			return fmt.Errorf("failed to encode link method results: %w", err)
+		}
+		value := string(encoded)
+		methods = &value
+	}
+
+	_, err := d.exec(ctx, sql, link.Status, link.Time, checkSource, link.Error, link.Allow, link.UserAgent, debug, link.StatusCode, link.ResponseTimeMs, link.StatusText, methods, link.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update link result: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateLinkNotes replaces the operator notes of a link. Checks never touch
+// them, so they survive rechecks.
+func (d *Database) UpdateLinkNotes(ctx context.Context, id int, notes string) error {
+	sql := `UPDATE links SET notes = NULLIF(?, '') WHERE id = ?`
+
+	result, err := d.exec(ctx, sql, notes, id)
+	if err != nil {
+		return fmt.Errorf("failed to update link notes: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update link notes: %w", err)
+	}
+	if affected == 0 {
+		return ErrLinkNotFound
+	}
+
+	return nil
+}
+
+// GetLink returns a single link by ID.
+func (d *Database) GetLink(ctx context.Context, id int) (*models.Link, error) {
+	query := `SELECT ` + linkColumns + `, debug FROM links WHERE id = ?`
+
+	var debug []byte
+	link, err := scanLink(d.db.QueryRowContext(ctx, query, id), &debug)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrLinkNotFound
+		}
+		return nil, fmt.Errorf("failed to query link: %w", err)
+	}
+
+	if len(debug) > 0 {
+		link.Debug = &models.LinkDebug{}
+		if err := json.Unmarshal(debug, link.Debug); err != nil {
+			return nil, fmt.Errorf("failed to decode link debug metadata: %w", err)
+		}
+	}
+
+	return link, nil
+}
+
 func (d *Database) UpdateBatchStatus(ctx context.Context, linksNum int, status models.BatchStatus) error {
 	sql := `UPDATE batches SET status = ? WHERE links_num = ?`
 
-	_, err := d.db.ExecContext(ctx, sql, status, linksNum)
+	_, err := d.exec(ctx, sql, status, linksNum)
 	if err != nil {
 		return fmt.Errorf("failed to update batch status: %w", err)
 	}
@@ -112,8 +650,170 @@ func (d *Database) UpdateBatchStatus(ctx context.Context, linksNum int, status m
 	return nil
 }
 
+// UpdateBatchRetry records how many retries a batch has used and when the next
+// one is due. A nil nextRetryAt means no further retries are scheduled.
+func (d *Database) UpdateBatchRetry(ctx context.Context, linksNum int, retriesDone int, nextRetryAt *time.Time) error {
+	sql := `UPDATE batches SET retries_done = ?, next_retry_at = ? WHERE links_num = ?`
+
+	_, err := d.exec(ctx, sql, retriesDone, nextRetryAt, linksNum)
+	if err != nil {
+		return fmt.Errorf("failed to update batch retry: %w", err)
+	}
+
+	return nil
+}
+
+// GetBatchesWithProcessingLinks returns batches that still have links in the
+// processing state, whatever the batch's own status.
+func (d *Database) GetBatchesWithProcessingLinks(ctx context.Context) ([]*models.Batch, error) {
+	sql := `SELECT ` + batchColumns + ` FROM batches
+		WHERE links_num IN (SELECT DISTINCT batch_num FROM links WHERE status = ?)
+		ORDER BY links_num`
+
+	rows, err := d.db.QueryContext(ctx, sql, models.StatusProcessing)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query batches: %w", err)
+	}
+	defer rows.Close()
+
+	var batches []*models.Batch
+	for rows.Next() {
+		batch, err := scanBatch(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan batch: %w", err)
+		}
+		batches = append(batches, batch)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return batches, nil
+}
+
+// FailProcessingLinks marks the batch's links that are still processing as
+// not available with the given error note and returns how many were changed.
+func (d *Database) FailProcessingLinks(ctx context.Context, batchNum int, note string) (int, error) {
+	sql := `UPDATE links SET status = ?, error = ? WHERE batch_num = ? AND status = ?`
+
+	result, err := d.exec(ctx, sql, models.StatusNotAvailable, note, batchNum, models.StatusProcessing)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fail processing links: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get affected links: %w", err)
+	}
+
+	return int(affected), nil
+}
+
+// DeleteExpiredBatches removes batches whose expiry is at or before now,
+// together with their links, and returns how many batches were deleted.
+// Batches still processing are kept until they finish.
+func (d *Database) DeleteExpiredBatches(ctx context.Context, now time.Time) (int, error) {
+	expired := `SELECT links_num FROM batches WHERE expires_at IS NOT NULL AND expires_at <= ? AND status != ?`
+	return d.deleteBatches(ctx, expired, now.UTC(), models.BatchStatusProcessing)
+}
+
+// DeleteBatch removes a batch and all its links in a single transaction.
+func (d *Database) DeleteBatch(ctx context.Context, linksNum int) error {
+	deleted, err := d.deleteBatches(ctx, `SELECT links_num FROM batches WHERE links_num = ?`, linksNum)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrBatchNotFound
+	}
+	return nil
+}
+
+// DeleteOldestBatches removes the oldest batches beyond the newest keep,
+// together with their links, and returns how many batches were deleted.
+// Batches still processing are never removed.
+func (d *Database) DeleteOldestBatches(ctx context.Context, keep int) (int, error) {
+	oldest := `SELECT links_num FROM batches WHERE status != ? AND links_num NOT IN (
+		SELECT links_num FROM batches ORDER BY links_num DESC LIMIT ?
+	)`
+	return d.deleteBatches(ctx, oldest, models.BatchStatusProcessing, keep)
+}
+
+// deleteBatches removes the batches whose numbers the selectNums query
+// returns, along with their links.
+func (d *Database) deleteBatches(ctx context.Context, selectNums string, args ...any) (int, error) {
+	var deleted int64
+	err := d.inTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM links WHERE batch_num IN (`+selectNums+`)`, args...); err != nil {
+			return fmt.Errorf("failed to delete links: %w", err)
+		}
+
+		result, err := tx.ExecContext(ctx, `DELETE FROM batches WHERE links_num IN (`+selectNums+`)`, args...)
+		if err != nil {
+			return fmt.Errorf("failed to delete batches: %w", err)
+		}
+
+		deleted, err = result.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return int(deleted), nil
+}
+
+// GetBatchesPendingRetry returns finished batches whose retry policy has attempts left.
+func (d *Database) GetBatchesPendingRetry(ctx context.Context) ([]*models.Batch, error) {
+	sql := `SELECT ` + batchColumns + ` FROM batches
+		WHERE retries_done < retry_count AND next_retry_at IS NOT NULL AND status != ?
+		ORDER BY links_num`
+
+	rows, err := d.db.QueryContext(ctx, sql, models.BatchStatusProcessing)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query batches: %w", err)
+	}
+	defer rows.Close()
+
+	var batches []*models.Batch
+	for rows.Next() {
+		batch, err := scanBatch(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan batch: %w", err)
+		}
+		batches = append(batches, batch)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return batches, nil
+}
+
 func (d *Database) GetLinksByBatchNum(ctx context.Context, linksNum int) ([]*models.Link, error) {
-	sql := `SELECT id, url, status, batch_num, time FROM links WHERE batch_num = ? ORDER BY id`
+	return d.GetLinksByBatchNumOrdered(ctx, linksNum, models.LinkOrderID)
+}
+
+// linkOrderClauses are the ORDER BY clauses for each link order. Ties, and
+// links never checked when ordering by time, fall back to ID order.
+var linkOrderClauses = map[models.LinkOrder]string{
+	"":                     "id",
+	models.LinkOrderID:     "id",
+	models.LinkOrderStatus: "status, id",
+	models.LinkOrderURL:    "url, id",
+	models.LinkOrderTime:   "time IS NULL, time, id",
+}
+
+// GetLinksByBatchNumOrdered returns the links of a batch sorted by order.
+func (d *Database) GetLinksByBatchNumOrdered(ctx context.Context, linksNum int, order models.LinkOrder) ([]*models.Link, error) {
+	orderBy, ok := linkOrderClauses[order]
+	if !ok {
+		return nil, fmt.Errorf("unknown link order %q", order)
+	}
+
+	sql := `SELECT ` + linkColumns + ` FROM links WHERE batch_num = ? ORDER BY ` + orderBy
 
 	rows, err := d.db.QueryContext(ctx, sql, linksNum)
 	if err != nil {
@@ -123,8 +823,7 @@ func (d *Database) GetLinksByBatchNum(ctx context.Context, linksNum int) ([]*mod
 
 	var links []*models.Link
 	for rows.Next() {
-		link := &models.Link{}
-		err := rows.Scan(&link.ID, &link.URL, &link.Status, &link.BatchNum, &link.Time)
+		link, err := scanLink(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan link: %w", err)
 		}
@@ -138,14 +837,85 @@ func (d *Database) GetLinksByBatchNum(ctx context.Context, linksNum int) ([]*mod
 	return links, nil
 }
 
+// GetHostSummaries groups links by host, sorted by host, returning one page of
+// hosts with the status of their most recently checked link and the total host count.
+func (d *Database) GetHostSummaries(ctx context.Context, limit, offset int) ([]models.HostSummary, int, error) {
+	var total int
+	err := d.db.QueryRowContext(ctx, `SELECT COUNT(DISTINCT host) FROM links WHERE host != ''`).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count hosts: %w", err)
+	}
+
+	sql := `SELECT h.host, h.checks, l.status, l.time
+		FROM (
+			SELECT host, COUNT(*) AS checks FROM links
+			WHERE host != ''
+			GROUP BY host ORDER BY host LIMIT ? OFFSET ?
+		) h
+		JOIN links l ON l.id = (
+			SELECT id FROM links WHERE host = h.host
+			ORDER BY time IS NULL, time DESC, id DESC LIMIT 1
+		)
+		ORDER BY h.host`
+
+	rows, err := d.db.QueryContext(ctx, sql, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query hosts: %w", err)
+	}
+	defer rows.Close()
+
+	hosts := []models.HostSummary{}
+	for rows.Next() {
+		var summary models.HostSummary
+		if err := rows.Scan(&summary.Host, &summary.CheckCount, &summary.LatestStatus, &summary.LastChecked); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan host: %w", err)
+		}
+		hosts = append(hosts, summary)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return hosts, total, nil
+}
+
+// TopBrokenHosts returns up to limit hosts with the most not available links,
+// most broken first and by host among equal counts.
+func (d *Database) TopBrokenHosts(ctx context.Context, limit int) ([]models.HostBrokenCount, error) {
+	sql := `SELECT host, COUNT(*) AS broken FROM links
+		WHERE host != '' AND status = ?
+		GROUP BY host ORDER BY broken DESC, host LIMIT ?`
+
+	rows, err := d.db.QueryContext(ctx, sql, models.StatusNotAvailable, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query broken hosts: %w", err)
+	}
+	defer rows.Close()
+
+	hosts := []models.HostBrokenCount{}
+	for rows.Next() {
+		var count models.HostBrokenCount
+		if err := rows.Scan(&count.Host, &count.Broken); err != nil {
+			return nil, fmt.Errorf("failed to scan broken host: %w", err)
+		}
+		hosts = append(hosts, count)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return hosts, nil
+}
+
 func (d *Database) GetBatch(ctx context.Context, linksNum int) (*models.Batch, error) {
-	sql := `SELECT links_num, status, created_at FROM batches WHERE links_num = ?`
+	query := `SELECT ` + batchColumns + ` FROM batches WHERE links_num = ?`
 
-	batch := &models.Batch{}
-	err := d.db.QueryRowContext(ctx, sql, linksNum).Scan(&batch.LinksNum, &batch.Status, &batch.CreatedAt)
+	batch, err := scanBatch(d.db.QueryRowContext(ctx, query, linksNum))
 	if err != nil {
-		if err.Error() == "sql: no rows in result set" {
-			return nil, fmt.Errorf("batch not found")
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrBatchNotFound
 		}
 		return nil, fmt.Errorf("failed to query batch: %w", err)
 	}
@@ -153,10 +923,36 @@ func (d *Database) GetBatch(ctx context.Context, linksNum int) (*models.Batch, e
 	return batch, nil
 }
 
-func (d *Database) GetAllBatches(ctx context.Context) ([]*models.Batch, error) {
-	sql := `SELECT links_num, status, created_at FROM batches ORDER BY links_num`
+// GetAllBatches returns batches newest first, by descending number. A limit
+// below 1 returns every batch from offset on.
+func (d *Database) GetAllBatches(ctx context.Context, limit, offset int) ([]*models.Batch, error) {
+	return d.GetBatchesBySource(ctx, "", limit, offset)
+}
+
+// GetBatchesBySource returns a page of the batches submitted by source, or of
+// all batches when source is empty.
+func (d *Database) GetBatchesBySource(ctx context.Context, source models.BatchSource, limit, offset int) ([]*models.Batch, error) {
+	return d.queryBatches(ctx, source, 0, limit, offset)
+}
+
+// GetBatchesBySourceBefore returns up to limit batches numbered below before,
+// newest first. Paging by the last number read keeps its place while new
+// batches are submitted, unlike an offset.
+func (d *Database) GetBatchesBySourceBefore(ctx context.Context, source models.BatchSource, before, limit int) ([]*models.Batch, error) {
+	return d.queryBatches(ctx, source, before, limit, 0)
+}
+
+// queryBatches reads a page of batches, newest first, limited to those
+// numbered below before unless it is 0. A limit below 1 reads every batch
+// from offset on.
+func (d *Database) queryBatches(ctx context.Context, source models.BatchSource, before, limit, offset int) ([]*models.Batch, error) {
+	sql := `SELECT ` + batchColumns + ` FROM batches WHERE (? = '' OR source = ?) AND (? = 0 OR links_num < ?) ORDER BY links_num DESC LIMIT ? OFFSET ?`
+
+	if limit < 1 {
+		limit = -1
+	}
 
-	rows, err := d.db.QueryContext(ctx, sql)
+	rows, err := d.db.QueryContext(ctx, sql, source, source, before, before, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query batches: %w", err)
 	}
@@ -164,19 +960,147 @@ func (d *Database) GetAllBatches(ctx context.Context) ([]*models.Batch, error) {
 
 	var batches []*models.Batch
 	for rows.Next() {
-		batch := &models.Batch{}
-		err := rows.Scan(&batch.LinksNum, &batch.Status, &batch.CreatedAt)
+		batch, err := scanBatch(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan batch: %w", err)
 		}
 		batches = append(batches, batch)
 	}
 
+	return batches, rows.Err()
+}
+
+// FindLatestBatch returns the most recent batch matching the idempotency key,
+// or the URL set checksum when no key is given. Batches checked with cookies
+// are skipped. It returns nil when nothing matches.
+func (d *Database) FindLatestBatch(ctx context.Context, idempotencyKey, checksum string) (*models.Batch, error) {
+	query := `SELECT ` + batchColumns + ` FROM batches WHERE checksum = ? AND NOT had_cookies ORDER BY links_num DESC LIMIT 1`
+	arg := checksum
+	if idempotencyKey != "" {
+		query = `SELECT ` + batchColumns + ` FROM batches WHERE idempotency_key = ? AND NOT had_cookies ORDER BY links_num DESC LIMIT 1`
+		arg = idempotencyKey
+	}
+
+	batch, err := scanBatch(d.db.QueryRowContext(ctx, query, arg))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to query batch: %w", err)
+	}
+
+	return batch, nil
+}
+
+func (d *Database) CountBatches(ctx context.Context) (int, error) {
+	var count int
+	if err := d.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM batches`).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count batches: %w", err)
+	}
+	return count, nil
+}
+
+// CountBatchesBySource counts the batches submitted by source, or all batches
+// when source is empty.
+func (d *Database) CountBatchesBySource(ctx context.Context, source models.BatchSource) (int, error) {
+	var count int
+	if err := d.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM batches WHERE ? = '' OR source = ?`, source, source).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count batches: %w", err)
+	}
+	return count, nil
+}
+
+func (d *Database) CountBatchesByStatus(ctx context.Context, status models.BatchStatus) (int, error) {
+	var count int
+	if err := d.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM batches WHERE status = ?`, status).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count batches: %w", err)
+	}
+	return count, nil
+}
+
+func (d *Database) CountLinksByStatus(ctx context.Context, status models.LinkStatus) (int, error) {
+	var count int
+	if err := d.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM links WHERE status = ?`, status).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count links: %w", err)
+	}
+	return count, nil
+}
+
+// CountChecksByBucket counts available and not available links by the window
+// of width bucket their check finished in, for checks from from up to to.
+// Buckets are keyed by their index counted from from; empty ones are left out.
+func (d *Database) CountChecksByBucket(ctx context.Context, from, to time.Time, bucket time.Duration) (map[int]*models.StatsBucket, error) {
+	// strftime normalizes the stored time, including its offset, to Unix seconds
+	sql := `SELECT (CAST(strftime('%s', time) AS INTEGER) - ?) / ? AS bucket, status, COUNT(*)
+		FROM links
+		WHERE time IS NOT NULL AND status IN (?, ?)
+			AND CAST(strftime('%s', time) AS INTEGER) >= ? AND CAST(strftime('%s', time) AS INTEGER) < ?
+		GROUP BY bucket, status`
+
+	seconds := int64(bucket / time.Second)
+	rows, err := d.db.QueryContext(ctx, sql, from.Unix(), seconds,
+		models.StatusAvailable, models.StatusNotAvailable, from.Unix(), to.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query check counts: %w", err)
+	}
+	defer rows.Close()
+
+	buckets := make(map[int]*models.StatsBucket)
+	for rows.Next() {
+		var index, count int
+		var status models.LinkStatus
+		if err := rows.Scan(&index, &status, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan check count: %w", err)
+		}
+
+		b, ok := buckets[index]
+		if !ok {
+			b = &models.StatsBucket{Start: from.Add(time.Duration(index) * bucket)}
+			buckets[index] = b
+		}
+		if status == models.StatusAvailable {
+			b.Available = count
+		} else {
+			b.Broken = count
+		}
+	}
+
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
-	return batches, nil
+	return buckets, nil
+}
+
+// GetExistingBatchNums returns which of the given batch numbers are stored.
+// It serves reports, so it reads through the report pool.
+func (d *Database) GetExistingBatchNums(ctx context.Context, batchNums []int) (map[int]bool, error) {
+	existing := make(map[int]bool, len(batchNums))
+	if len(batchNums) == 0 {
+		return existing, nil
+	}
+
+	sql := `SELECT links_num FROM batches WHERE links_num IN (?` + strings.Repeat(",?", len(batchNums)-1) + `)`
+	args := make([]any, len(batchNums))
+	for i, num := range batchNums {
+		args[i] = num
+	}
+
+	rows, err := d.reportDB.QueryContext(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query batch nums: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var num int
+		if err := rows.Scan(&num); err != nil {
+			return nil, fmt.Errorf("failed to scan batch num: %w", err)
+		}
+		existing[num] = true
+	}
+
+	return existing, rows.Err()
 }
 
 func (d *Database) GetMaxBatchNum(ctx context.Context) (int, error) {
@@ -191,12 +1115,14 @@ func (d *Database) GetMaxBatchNum(ctx context.Context) (int, error) {
 	return maxID, nil
 }
 
-func (d *Database) GetBatchesByIDs(ctx context.Context, batchIDs []int) ([]*models.Batch, []*models.Link, error) {
+// GetReportBatches loads the given batches without their links through the
+// report pool.
+func (d *Database) GetReportBatches(ctx context.Context, batchIDs []int) ([]*models.Batch, error) {
 	if len(batchIDs) == 0 {
-		return nil, nil, fmt.Errorf("no batch IDs provided")
+		return nil, fmt.Errorf("no batch IDs provided")
 	}
 
-	batchSQL := `SELECT links_num, status, created_at FROM batches WHERE links_num IN (`
+	batchSQL := `SELECT ` + batchColumns + ` FROM batches WHERE links_num IN (`
 	args := make([]any, len(batchIDs))
 	for i, id := range batchIDs {
 		if i > 0 {
@@ -207,27 +1133,37 @@ func (d *Database) GetBatchesByIDs(ctx context.Context, batchIDs []int) ([]*mode
 	}
 	batchSQL += ") ORDER BY links_num"
 
-	batchRows, err := d.db.QueryContext(ctx, batchSQL, args...)
+	batchRows, err := d.reportDB.QueryContext(ctx, batchSQL, args...)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to query batches: %w", err)
+		return nil, fmt.Errorf("failed to query batches: %w", err)
 	}
 	defer batchRows.Close()
 
 	var batches []*models.Batch
 	for batchRows.Next() {
-		batch := &models.Batch{}
-		err := batchRows.Scan(&batch.LinksNum, &batch.Status, &batch.CreatedAt)
+		batch, err := scanBatch(batchRows)
 		if err != nil {
-			return nil, nil, fmt.Errorf("failed to scan batch: %w", err)
+			return nil, fmt.Errorf("failed to scan batch: %w", err)
 		}
 		batches = append(batches, batch)
 	}
 
 	if err := batchRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return batches, nil
+}
+
+// GetBatchesByIDs loads batches and their links for a report through the
+// report pool.
+func (d *Database) GetBatchesByIDs(ctx context.Context, batchIDs []int) ([]*models.Batch, []*models.Link, error) {
+	batches, err := d.GetReportBatches(ctx, batchIDs)
+	if err != nil {
 		return nil, nil, err
 	}
 
-	linkSQL := `SELECT id, url, status, batch_num, time FROM links WHERE batch_num IN (`
+	linkSQL := `SELECT ` + linkColumns + ` FROM links WHERE batch_num IN (`
 	linkArgs := make([]any, len(batchIDs))
 	for i, id := range batchIDs {
 		if i > 0 {
@@ -238,7 +1174,7 @@ func (d *Database) GetBatchesByIDs(ctx context.Context, batchIDs []int) ([]*mode
 	}
 	linkSQL += ") ORDER BY batch_num, id"
 
-	linkRows, err := d.db.QueryContext(ctx, linkSQL, linkArgs...)
+	linkRows, err := d.reportDB.QueryContext(ctx, linkSQL, linkArgs...)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to query links: %w", err)
 	}
@@ -246,8 +1182,7 @@ func (d *Database) GetBatchesByIDs(ctx context.Context, batchIDs []int) ([]*mode
 
 	var links []*models.Link
 	for linkRows.Next() {
-		link := &models.Link{}
-		err := linkRows.Scan(&link.ID, &link.URL, &link.Status, &link.BatchNum, &link.Time)
+		link, err := scanLink(linkRows)
 		if err != nil {
 			return nil, nil, fmt.Errorf("failed to scan link: %w", err)
 		}
@@ -261,6 +1196,10 @@ func (d *Database) GetBatchesByIDs(ctx context.Context, batchIDs []int) ([]*mode
 	return batches, links, nil
 }
 
+func (d *Database) Ping(ctx context.Context) error {
+	return d.db.PingContext(ctx)
+}
+
 func (d *Database) Close() error {
-	return d.db.Close()
+	return errors.Join(d.db.Close(), d.reportDB.Close())
 }
@@ -1,7 +1,10 @@
 package database
 
 import (
+	"bytes"
 	"context"
+	"database/sql"
+	"fmt"
 	"os"
 	"testing"
 	"time"
@@ -38,6 +41,46 @@ func TestNewDatabase(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestNewDatabase_CorruptFile(t *testing.T) {
+	file := "./test_corrupt.db"
+	require.NoError(t, os.WriteFile(file, bytes.Repeat([]byte("not a database "), 512), 0o644))
+	defer os.Remove(file)
+
+	_, err := NewDatabase(file)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrCorruptDatabase)
+	assert.Contains(t, err.Error(), file)
+	assert.Contains(t, err.Error(), "-recreate-db")
+
+	db, err := NewDatabase(file, WithRecreateCorrupt(true))
+	require.NoError(t, err)
+	defer db.Close()
+
+	backup := db.CorruptBackup()
+	require.NotEmpty(t, backup)
+	defer os.Remove(backup)
+
+	data, err := os.ReadFile(backup)
+	require.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(data, []byte("not a database")))
+
+	require.NoError(t, db.CreateBatch(context.Background(), 1, models.BatchStatusCompleted, time.Now()))
+}
+
+func TestNewDatabase_EmptyFile(t *testing.T) {
+	file := "./test_empty.db"
+	require.NoError(t, os.WriteFile(file, nil, 0o644))
+	defer os.Remove(file)
+
+	// SQLite treats a zero-byte file as a new database
+	db, err := NewDatabase(file)
+	require.NoError(t, err)
+	defer db.Close()
+
+	assert.Empty(t, db.CorruptBackup())
+	require.NoError(t, db.CreateBatch(context.Background(), 1, models.BatchStatusCompleted, time.Now()))
+}
+
 func TestDatabase_CreateBatch(t *testing.T) {
 	db := setupTestDB(t)
 	ctx := context.Background()
@@ -67,6 +110,78 @@ func TestDatabase_CreateLink(t *testing.T) {
 	assert.Greater(t, linkID2, linkID)
 }
 
+func TestDatabase_CreateLink_Host(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	err := db.CreateBatch(ctx, 1, models.BatchStatusProcessing, time.Now())
+	require.NoError(t, err)
+
+	tests := []struct {
+		url  string
+		host string
+	}{
+		{"http://example.com", "example.com"},
+		{"https://Sub.Example.COM:8443/path?q=1", "sub.example.com"},
+		{"example.org/page", "example.org"},
+		{"http://[::1]:8080/", "::1"},
+		{"http://bad host/%zz", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		_, err := db.CreateLink(ctx, tt.url, models.StatusProcessing, 1, nil)
+		require.NoError(t, err)
+	}
+
+	links, err := db.GetLinksByBatchNum(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, links, len(tests))
+	for i, tt := range tests {
+		assert.Equal(t, tt.host, links[i].Host, tt.url)
+	}
+}
+
+func TestDatabase_GetHostSummaries(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	err := db.CreateBatch(ctx, 1, models.BatchStatusCompleted, time.Now())
+	require.NoError(t, err)
+
+	earlier := time.Now().Add(-time.Hour)
+	later := time.Now()
+	_, err = db.CreateLink(ctx, "http://b.com/1", models.StatusAvailable, 1, &later)
+	require.NoError(t, err)
+	_, err = db.CreateLink(ctx, "http://b.com/2", models.StatusNotAvailable, 1, &earlier)
+	require.NoError(t, err)
+	_, err = db.CreateLink(ctx, "http://a.com", models.StatusProcessing, 1, nil)
+	require.NoError(t, err)
+	_, err = db.CreateLink(ctx, "http://bad host/%zz", models.StatusNotAvailable, 1, &later)
+	require.NoError(t, err)
+
+	hosts, total, err := db.GetHostSummaries(ctx, 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 2, total)
+	require.Len(t, hosts, 2)
+
+	assert.Equal(t, "a.com", hosts[0].Host)
+	assert.Equal(t, 1, hosts[0].CheckCount)
+	assert.Nil(t, hosts[0].LastChecked)
+
+	assert.Equal(t, "b.com", hosts[1].Host)
+	assert.Equal(t, 2, hosts[1].CheckCount)
+	assert.Equal(t, models.StatusAvailable, hosts[1].LatestStatus)
+	require.NotNil(t, hosts[1].LastChecked)
+	assert.WithinDuration(t, later, *hosts[1].LastChecked, time.Second)
+
+	hosts, total, err = db.GetHostSummaries(ctx, 1, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 2, total)
+	require.Len(t, hosts, 1)
+	assert.Equal(t, "b.com", hosts[0].Host)
+}
+
 func TestDatabase_UpdateLinkStatus(t *testing.T) {
 	db := setupTestDB(t)
 	ctx := context.Background()
@@ -88,6 +203,88 @@ func TestDatabase_UpdateLinkStatus(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestDatabase_InsertBatchWithLinks(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	urls := []string{"http://example.com/1", "https://example.org/2", "http://example.net/3"}
+	batch := &models.Batch{LinksNum: 1, Status: models.BatchStatusProcessing, CreatedAt: time.Now()}
+	ids, err := db.InsertBatchWithLinks(ctx, batch, urls)
+	require.NoError(t, err)
+	require.Len(t, ids, 3)
+
+	stored, err := db.GetBatch(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 3, stored.LinkCount)
+
+	links, err := db.GetLinksByBatchNum(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, links, 3)
+	for i, link := range links {
+		assert.Equal(t, ids[i], link.ID)
+		assert.Equal(t, urls[i], link.URL)
+		assert.Equal(t, models.StatusProcessing, link.Status)
+	}
+	assert.Equal(t, "example.org", links[1].Host)
+
+	// the third link insert fails, rolling back the batch and the first two
+	_, err = db.db.Exec(`CREATE TRIGGER fail_third_link BEFORE INSERT ON links
+		WHEN (SELECT COUNT(*) FROM links WHERE batch_num = NEW.batch_num) = 2
+		BEGIN SELECT RAISE(ABORT, 'simulated failure'); END;`)
+	require.NoError(t, err)
+
+	_, err = db.InsertBatchWithLinks(ctx, &models.Batch{LinksNum: 2, Status: models.BatchStatusProcessing, CreatedAt: time.Now()}, urls)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), urls[2])
+
+	_, err = db.GetBatch(ctx, 2)
+	assert.ErrorIs(t, err, ErrBatchNotFound)
+	var count int
+	require.NoError(t, db.db.QueryRow(`SELECT COUNT(*) FROM links WHERE batch_num = 2`).Scan(&count))
+	assert.Zero(t, count)
+}
+
+func TestDatabase_UpdateLinkResult_CheckSource(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	err := db.CreateBatch(ctx, 1, models.BatchStatusProcessing, time.Now())
+	require.NoError(t, err)
+
+	sources := []models.CheckSource{
+		models.CheckSourceInitial,
+		models.CheckSourceScheduled,
+		models.CheckSourceRetry,
+		models.CheckSourceOverride,
+	}
+
+	now := time.Now()
+	for _, source := range sources {
+		linkID, err := db.CreateLink(ctx, "http://example.com/"+string(source), models.StatusProcessing, 1, nil)
+		require.NoError(t, err)
+
+		err = db.UpdateLinkResult(ctx, &models.Link{ID: linkID, Status: models.StatusAvailable, Time: &now, CheckSource: source})
+		require.NoError(t, err)
+	}
+
+	links, err := db.GetLinksByBatchNum(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, links, len(sources))
+	for i, link := range links {
+		assert.Equal(t, sources[i], link.CheckSource)
+		assert.Equal(t, models.StatusAvailable, link.Status)
+	}
+
+	linkID, err := db.CreateLink(ctx, "http://example.com/default", models.StatusProcessing, 1, nil)
+	require.NoError(t, err)
+	err = db.UpdateLinkResult(ctx, &models.Link{ID: linkID, Status: models.StatusNotAvailable, Time: &now})
+	require.NoError(t, err)
+
+	links, err = db.GetLinksByBatchNum(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, models.CheckSourceInitial, links[len(links)-1].CheckSource)
+}
+
 func TestDatabase_UpdateBatchStatus(t *testing.T) {
 	db := setupTestDB(t)
 	ctx := context.Background()
@@ -102,6 +299,56 @@ func TestDatabase_UpdateBatchStatus(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestDatabase_GetLinksByBatchNumOrdered(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	require.NoError(t, db.CreateBatch(ctx, 1, models.BatchStatusCompleted, time.Now()))
+
+	base := time.Now().Add(-time.Hour)
+	t1, t2 := base.Add(2*time.Minute), base.Add(time.Minute)
+	for _, link := range []struct {
+		url    string
+		status models.LinkStatus
+		time   *time.Time
+	}{
+		{"http://c.example", models.StatusNotAvailable, &t1},
+		{"http://a.example", models.StatusAvailable, nil},
+		{"http://b.example", models.StatusAvailable, &t2},
+	} {
+		_, err := db.CreateLink(ctx, link.url, link.status, 1, link.time)
+		require.NoError(t, err)
+	}
+
+	tests := []struct {
+		order    models.LinkOrder
+		expected []string
+	}{
+		{"", []string{"http://c.example", "http://a.example", "http://b.example"}},
+		{models.LinkOrderID, []string{"http://c.example", "http://a.example", "http://b.example"}},
+		{models.LinkOrderStatus, []string{"http://a.example", "http://b.example", "http://c.example"}},
+		{models.LinkOrderURL, []string{"http://a.example", "http://b.example", "http://c.example"}},
+		// never checked links come last
+		{models.LinkOrderTime, []string{"http://b.example", "http://c.example", "http://a.example"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.order), func(t *testing.T) {
+			links, err := db.GetLinksByBatchNumOrdered(ctx, 1, tt.order)
+			require.NoError(t, err)
+
+			urls := make([]string, len(links))
+			for i, link := range links {
+				urls[i] = link.URL
+			}
+			assert.Equal(t, tt.expected, urls)
+		})
+	}
+
+	_, err := db.GetLinksByBatchNumOrdered(ctx, 1, "url; DROP TABLE links")
+	assert.Error(t, err)
+}
+
 func TestDatabase_GetLinksByBatchNum(t *testing.T) {
 	db := setupTestDB(t)
 	ctx := context.Background()
@@ -158,7 +405,7 @@ func TestDatabase_GetAllBatches(t *testing.T) {
 	db := setupTestDB(t)
 	ctx := context.Background()
 
-	batches, err := db.GetAllBatches(ctx)
+	batches, err := db.GetAllBatches(ctx, 0, 0)
 	assert.NoError(t, err)
 	assert.Empty(t, batches)
 
@@ -168,12 +415,21 @@ func TestDatabase_GetAllBatches(t *testing.T) {
 	err = db.CreateBatch(ctx, 2, models.BatchStatusCompleted, time.Now())
 	require.NoError(t, err)
 
-	batches, err = db.GetAllBatches(ctx)
+	batches, err = db.GetAllBatches(ctx, 0, 0)
 	assert.NoError(t, err)
 	assert.Len(t, batches, 2)
 
+	assert.Equal(t, 2, batches[0].LinksNum)
+	assert.Equal(t, 1, batches[1].LinksNum)
+
+	batches, err = db.GetAllBatches(ctx, 1, 1)
+	assert.NoError(t, err)
+	require.Len(t, batches, 1)
 	assert.Equal(t, 1, batches[0].LinksNum)
-	assert.Equal(t, 2, batches[1].LinksNum)
+
+	count, err := db.CountBatches(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
 }
 
 func TestDatabase_GetMaxBatchNum(t *testing.T) {
@@ -232,6 +488,308 @@ func TestDatabase_GetBatchesByIDs(t *testing.T) {
 	assert.Empty(t, links)
 }
 
+func TestDatabase_FindLatestBatch(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	batch, err := db.FindLatestBatch(ctx, "", "abc")
+	assert.NoError(t, err)
+	assert.Nil(t, batch)
+
+	err = db.InsertBatch(ctx, &models.Batch{LinksNum: 1, Status: models.BatchStatusCompleted, CreatedAt: time.Now(), Checksum: "abc"})
+	require.NoError(t, err)
+
+	err = db.InsertBatch(ctx, &models.Batch{LinksNum: 2, Status: models.BatchStatusCompleted, CreatedAt: time.Now(), Checksum: "abc", IdempotencyKey: "key"})
+	require.NoError(t, err)
+
+	batch, err = db.FindLatestBatch(ctx, "", "abc")
+	assert.NoError(t, err)
+	require.NotNil(t, batch)
+	assert.Equal(t, 2, batch.LinksNum)
+
+	batch, err = db.FindLatestBatch(ctx, "key", "other")
+	assert.NoError(t, err)
+	require.NotNil(t, batch)
+	assert.Equal(t, 2, batch.LinksNum)
+	assert.Equal(t, "key", batch.IdempotencyKey)
+
+	batch, err = db.FindLatestBatch(ctx, "missing", "abc")
+	assert.NoError(t, err)
+	assert.Nil(t, batch)
+
+	// batches checked with cookies are never matched
+	err = db.InsertBatch(ctx, &models.Batch{LinksNum: 3, Status: models.BatchStatusCompleted, CreatedAt: time.Now(), Checksum: "abc", IdempotencyKey: "key", HadCookies: true})
+	require.NoError(t, err)
+
+	batch, err = db.FindLatestBatch(ctx, "", "abc")
+	assert.NoError(t, err)
+	require.NotNil(t, batch)
+	assert.Equal(t, 2, batch.LinksNum)
+
+	batch, err = db.FindLatestBatch(ctx, "key", "abc")
+	assert.NoError(t, err)
+	require.NotNil(t, batch)
+	assert.Equal(t, 2, batch.LinksNum)
+}
+
+func TestDatabase_MigratesOldSchema(t *testing.T) {
+	file := "./test_migrate.db"
+	t.Cleanup(func() { os.Remove(file) })
+
+	raw, err := sql.Open("sqlite3", file)
+	require.NoError(t, err)
+	_, err = raw.Exec(`CREATE TABLE batches (links_num INTEGER PRIMARY KEY, status TEXT NOT NULL, created_at DATETIME NOT NULL);
+		CREATE TABLE links (id INTEGER PRIMARY KEY AUTOINCREMENT, url TEXT NOT NULL, status TEXT NOT NULL, batch_num INTEGER NOT NULL, time DATETIME);
+		INSERT INTO batches (links_num, status, created_at) VALUES (1, 'completed', CURRENT_TIMESTAMP);
+		INSERT INTO links (url, status, batch_num) VALUES ('https://Old.Example.com/page', 'available', 1);`)
+	require.NoError(t, err)
+	raw.Close()
+
+	db, err := NewDatabase(file)
+	require.NoError(t, err)
+	defer db.Close()
+
+	batch, err := db.GetBatch(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, "", batch.Checksum)
+	assert.Equal(t, 1, batch.LinkCount)
+
+	links, err := db.GetLinksByBatchNum(context.Background(), 1)
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	assert.Equal(t, "old.example.com", links[0].Host)
+	assert.Equal(t, models.CheckSourceInitial, links[0].CheckSource)
+}
+
+func TestDatabase_LinkCount(t *testing.T) {
+	file := "./test_link_count.db"
+	t.Cleanup(func() { os.Remove(file) })
+
+	db, err := NewDatabase(file)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	require.NoError(t, db.CreateBatch(ctx, 1, models.BatchStatusProcessing, time.Now()))
+	require.NoError(t, db.CreateBatch(ctx, 2, models.BatchStatusProcessing, time.Now()))
+
+	var ids []int
+	for _, url := range []string{"http://a.example", "http://b.example", "http://c.example"} {
+		id, err := db.CreateLink(ctx, url, models.StatusProcessing, 1, nil)
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+
+	actualCount := func(batchNum int) int {
+		var count int
+		require.NoError(t, db.db.QueryRow(`SELECT COUNT(*) FROM links WHERE batch_num = ?`, batchNum).Scan(&count))
+		return count
+	}
+
+	batch, err := db.GetBatch(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 3, batch.LinkCount)
+	assert.Equal(t, actualCount(1), batch.LinkCount)
+
+	now := time.Now()
+	err = db.UpdateLinkResult(ctx, &models.Link{ID: ids[0], Status: models.StatusAvailable, Time: &now, CheckSource: models.CheckSourceRetry})
+	require.NoError(t, err)
+
+	batch, err = db.GetBatch(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, actualCount(1), batch.LinkCount)
+
+	batch, err = db.GetBatch(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 0, batch.LinkCount)
+
+	// counting a batch's links looks them up by index instead of scanning
+	var id, parent, notused int
+	var detail string
+	require.NoError(t, db.db.QueryRow(`EXPLAIN QUERY PLAN SELECT COUNT(*) FROM links WHERE batch_num = ?`, 1).Scan(&id, &parent, &notused, &detail))
+	assert.Contains(t, detail, "idx_links_batch_num")
+
+	// a drifted count is repaired on the next start
+	_, err = db.db.Exec(`UPDATE batches SET link_count = 42 WHERE links_num = 1`)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	db, err = NewDatabase(file)
+	require.NoError(t, err)
+	defer db.Close()
+
+	batch, err = db.GetBatch(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 3, batch.LinkCount)
+}
+
+func TestDatabase_BatchRetry(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	next := time.Now()
+	err := db.InsertBatch(ctx, &models.Batch{LinksNum: 1, Status: models.BatchStatusCompleted, CreatedAt: time.Now(), RetryCount: 2, RetryDelayMs: 500, NextRetryAt: &next, TimeoutMs: 1500})
+	require.NoError(t, err)
+
+	err = db.InsertBatch(ctx, &models.Batch{LinksNum: 2, Status: models.BatchStatusProcessing, CreatedAt: time.Now(), RetryCount: 2, NextRetryAt: &next})
+	require.NoError(t, err)
+
+	err = db.CreateBatch(ctx, 3, models.BatchStatusCompleted, time.Now())
+	require.NoError(t, err)
+
+	batches, err := db.GetBatchesPendingRetry(ctx)
+	require.NoError(t, err)
+	require.Len(t, batches, 1)
+	assert.Equal(t, 1, batches[0].LinksNum)
+	assert.Equal(t, 2, batches[0].RetryCount)
+	assert.Equal(t, int64(500), batches[0].RetryDelayMs)
+	assert.Equal(t, int64(1500), batches[0].TimeoutMs)
+	require.NotNil(t, batches[0].NextRetryAt)
+
+	err = db.UpdateBatchRetry(ctx, 1, 2, nil)
+	require.NoError(t, err)
+
+	batches, err = db.GetBatchesPendingRetry(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, batches)
+
+	batch, err := db.GetBatch(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 2, batch.RetriesDone)
+	assert.Nil(t, batch.NextRetryAt)
+}
+
+func TestDatabase_DeleteExpiredBatches(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	now := time.Now()
+	past := now.Add(-time.Minute)
+	future := now.Add(time.Hour)
+	require.NoError(t, db.InsertBatch(ctx, &models.Batch{LinksNum: 1, Status: models.BatchStatusCompleted, CreatedAt: now, ExpiresAt: &past}))
+	require.NoError(t, db.InsertBatch(ctx, &models.Batch{LinksNum: 2, Status: models.BatchStatusCompleted, CreatedAt: now, ExpiresAt: &future}))
+	require.NoError(t, db.InsertBatch(ctx, &models.Batch{LinksNum: 3, Status: models.BatchStatusProcessing, CreatedAt: now, ExpiresAt: &past}))
+	require.NoError(t, db.CreateBatch(ctx, 4, models.BatchStatusCompleted, now))
+	for batchNum := 1; batchNum <= 4; batchNum++ {
+		_, err := db.CreateLink(ctx, "https://example.com", models.StatusAvailable, batchNum, &now)
+		require.NoError(t, err)
+	}
+
+	deleted, err := db.DeleteExpiredBatches(ctx, now)
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+
+	_, err = db.GetBatch(ctx, 1)
+	assert.ErrorIs(t, err, ErrBatchNotFound)
+	links, err := db.GetLinksByBatchNum(ctx, 1)
+	require.NoError(t, err)
+	assert.Empty(t, links)
+
+	// not yet expired, still processing, or without expiry
+	for _, batchNum := range []int{2, 3, 4} {
+		_, err := db.GetBatch(ctx, batchNum)
+		require.NoError(t, err)
+	}
+
+	batch, err := db.GetBatch(ctx, 2)
+	require.NoError(t, err)
+	require.NotNil(t, batch.ExpiresAt)
+	assert.WithinDuration(t, future, *batch.ExpiresAt, time.Millisecond)
+}
+
+func TestDatabase_DeleteOldestBatches(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	now := time.Now()
+	require.NoError(t, db.CreateBatch(ctx, 1, models.BatchStatusProcessing, now))
+	for batchNum := 2; batchNum <= 5; batchNum++ {
+		require.NoError(t, db.CreateBatch(ctx, batchNum, models.BatchStatusCompleted, now))
+	}
+	for batchNum := 1; batchNum <= 5; batchNum++ {
+		_, err := db.CreateLink(ctx, "https://example.com", models.StatusAvailable, batchNum, &now)
+		require.NoError(t, err)
+	}
+
+	deleted, err := db.DeleteOldestBatches(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+
+	for _, batchNum := range []int{2, 3} {
+		_, err := db.GetBatch(ctx, batchNum)
+		assert.ErrorIs(t, err, ErrBatchNotFound)
+		links, err := db.GetLinksByBatchNum(ctx, batchNum)
+		require.NoError(t, err)
+		assert.Empty(t, links)
+	}
+
+	// the newest batches and a batch still processing are kept
+	for _, batchNum := range []int{1, 4, 5} {
+		_, err := db.GetBatch(ctx, batchNum)
+		require.NoError(t, err)
+	}
+}
+
+func TestDatabase_DeleteBatch(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	now := time.Now()
+	for batchNum := 1; batchNum <= 2; batchNum++ {
+		require.NoError(t, db.CreateBatch(ctx, batchNum, models.BatchStatusCompleted, now))
+		_, err := db.CreateLink(ctx, "https://example.com", models.StatusAvailable, batchNum, &now)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, db.DeleteBatch(ctx, 1))
+
+	_, err := db.GetBatch(ctx, 1)
+	assert.ErrorIs(t, err, ErrBatchNotFound)
+	links, err := db.GetLinksByBatchNum(ctx, 1)
+	require.NoError(t, err)
+	assert.Empty(t, links)
+
+	links, err = db.GetLinksByBatchNum(ctx, 2)
+	require.NoError(t, err)
+	assert.Len(t, links, 1)
+
+	assert.ErrorIs(t, db.DeleteBatch(ctx, 1), ErrBatchNotFound)
+}
+
+func TestDatabase_InsertBatchWithLinks_Sequence(t *testing.T) {
+	file := "./test_" + t.Name() + ".db"
+	t.Cleanup(func() { os.Remove(file) })
+	db, err := NewDatabase(file)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	insert := func(db *Database) int {
+		batch := &models.Batch{Status: models.BatchStatusProcessing, CreatedAt: time.Now()}
+		_, err := db.InsertBatchWithLinks(ctx, batch, []string{"https://example.com"})
+		require.NoError(t, err)
+		return batch.LinksNum
+	}
+
+	assert.Equal(t, 1, insert(db))
+	assert.Equal(t, 2, insert(db))
+
+	// deleting the newest batch doesn't free its number
+	require.NoError(t, db.DeleteBatch(ctx, 2))
+	assert.Equal(t, 3, insert(db))
+
+	// numbers stay above batches stored with a number of their own
+	require.NoError(t, db.CreateBatch(ctx, 10, models.BatchStatusCompleted, time.Now()))
+	assert.Equal(t, 11, insert(db))
+
+	// and the sequence outlives the process
+	require.NoError(t, db.DeleteBatch(ctx, 11))
+	require.NoError(t, db.DeleteBatch(ctx, 10))
+	db.Close()
+	db, err = NewDatabase(file)
+	require.NoError(t, err)
+	defer db.Close()
+	assert.Equal(t, 12, insert(db))
+}
+
 func TestDatabase_ContextCancellation(t *testing.T) {
 	db := setupTestDB(t)
 
@@ -250,6 +808,39 @@ func TestDatabase_ContextCancellation(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestNewDatabaseContext_Deadline(t *testing.T) {
+	file := "./test_" + t.Name() + ".db"
+	t.Cleanup(func() { os.Remove(file) })
+
+	db, err := NewDatabaseContext(context.Background(), file)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	// an exclusive lock held elsewhere makes opening wait on SQLite's busy
+	// timeout; in WAL mode only the exclusive locking mode keeps readers out
+	locker, err := sql.Open("sqlite3", file)
+	require.NoError(t, err)
+	defer locker.Close()
+	conn, err := locker.Conn(context.Background())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.ExecContext(context.Background(), `PRAGMA locking_mode=EXCLUSIVE`)
+	require.NoError(t, err)
+	_, err = conn.ExecContext(context.Background(), `BEGIN EXCLUSIVE`)
+	require.NoError(t, err)
+	defer conn.ExecContext(context.Background(), `ROLLBACK`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	db, err = NewDatabaseContext(ctx, file)
+	assert.Nil(t, db)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Contains(t, err.Error(), "did not open in time")
+	assert.Less(t, time.Since(start), time.Second)
+}
+
 func TestDatabase_Close(t *testing.T) {
 	file := "./test_close.db"
 	db, err := NewDatabase(file)
@@ -263,3 +854,93 @@ func TestDatabase_Close(t *testing.T) {
 
 	os.Remove(file)
 }
+
+func TestDatabase_BusyRetry(t *testing.T) {
+	file := "./test_busy_retry.db"
+	locker, err := NewDatabase(file)
+	require.NoError(t, err)
+	defer os.Remove(file)
+	defer locker.Close()
+
+	// disable the driver's own busy timeout so only the retry wrapper waits
+	dsn := file + "?_busy_timeout=0"
+
+	db, err := NewDatabase(dsn, WithBusyRetries(20, 10*time.Millisecond))
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx := context.Background()
+	require.NoError(t, db.CreateBatch(ctx, 1, models.BatchStatusProcessing, time.Now()))
+
+	// hold the write lock from another connection for a while
+	tx, err := locker.db.BeginTx(ctx, nil)
+	require.NoError(t, err)
+	_, err = tx.ExecContext(ctx, `UPDATE batches SET status = ? WHERE links_num = 1`, models.BatchStatusProcessing)
+	require.NoError(t, err)
+
+	noRetry, err := NewDatabase(dsn, WithBusyRetries(0, 0))
+	require.NoError(t, err)
+	defer noRetry.Close()
+
+	_, err = noRetry.CreateLink(ctx, "http://example.com", models.StatusProcessing, 1, nil)
+	require.Error(t, err)
+	assert.True(t, isBusy(err))
+
+	errs := make(chan error, 10)
+	for i := 0; i < cap(errs); i++ {
+		go func(i int) {
+			_, err := db.CreateLink(ctx, fmt.Sprintf("http://example.com/%d", i), models.StatusProcessing, 1, nil)
+			errs <- err
+		}(i)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	require.NoError(t, tx.Commit())
+
+	for i := 0; i < cap(errs); i++ {
+		assert.NoError(t, <-errs)
+	}
+
+	links, err := db.GetLinksByBatchNum(ctx, 1)
+	require.NoError(t, err)
+	assert.Len(t, links, 10)
+}
+
+func TestDatabase_ReportPoolDoesNotStarveWrites(t *testing.T) {
+	file := "./test_report_pool.db"
+	// neither the driver nor the retry wrapper waits, so a write blocked by
+	// the open read fails right away
+	db, err := NewDatabase(file+"?_busy_timeout=0", WithReportConnections(1), WithBusyRetries(0, 0))
+	require.NoError(t, err)
+	defer os.Remove(file)
+	defer db.Close()
+
+	assert.Equal(t, 1, db.reportDB.Stats().MaxOpenConnections)
+	assert.Equal(t, 0, db.db.Stats().MaxOpenConnections)
+
+	ctx := context.Background()
+	require.NoError(t, db.CreateBatch(ctx, 1, models.BatchStatusProcessing, time.Now()))
+	for i := 0; i < 10; i++ {
+		_, err := db.CreateLink(ctx, fmt.Sprintf("http://example.com/%d", i), models.StatusAvailable, 1, nil)
+		require.NoError(t, err)
+	}
+
+	// a report part way through reading the batch
+	rows, err := db.reportDB.QueryContext(ctx, `SELECT url FROM links WHERE batch_num = ?`, 1)
+	require.NoError(t, err)
+	defer rows.Close()
+	require.True(t, rows.Next())
+
+	require.NoError(t, db.CreateBatch(ctx, 2, models.BatchStatusProcessing, time.Now()))
+	_, err = db.CreateLink(ctx, "http://example.org", models.StatusAvailable, 2, nil)
+	require.NoError(t, err)
+	require.NoError(t, db.UpdateBatchStatus(ctx, 1, models.BatchStatusCompleted))
+
+	// the read keeps its snapshot and finishes normally
+	read := 1
+	for rows.Next() {
+		read++
+	}
+	require.NoError(t, rows.Err())
+	assert.Equal(t, 10, read)
+}
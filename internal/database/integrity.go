@@ -0,0 +1,126 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+var ErrCorruptDatabase = errors.New("database file is corrupt")
+
+// WithRecreateCorrupt moves a corrupt database file aside and starts with an
+// empty database instead of failing. The moved file is reported by
+// CorruptBackup.
+func WithRecreateCorrupt(recreate bool) Option {
+	return func(d *Database) {
+		d.recreateCorrupt = recreate
+	}
+}
+
+// CorruptBackup is the path a corrupt database file was moved to when it was
+// recreated, or empty.
+func (d *Database) CorruptBackup() string {
+	return d.corruptBackup
+}
+
+// openDatabase opens dbPath and verifies that it holds an intact SQLite
+// database, so a damaged file fails here instead of on the first query.
+func openDatabase(driver, dbPath string) (*sql.DB, error) {
+	db, err := sql.Open(driver, dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		if isCorrupt(err) {
+			return nil, fmt.Errorf("%s: %w", databaseFile(dbPath), corruptionError(err.Error()))
+		}
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	if err := checkIntegrity(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %w", databaseFile(dbPath), err)
+	}
+
+	return db, nil
+}
+
+func checkIntegrity(db *sql.DB) error {
+	rows, err := db.Query(`PRAGMA integrity_check`)
+	if err != nil {
+		if isCorrupt(err) {
+			return corruptionError(err.Error())
+		}
+		return fmt.Errorf("failed to check database integrity: %w", err)
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var result string
+		if err := rows.Scan(&result); err != nil {
+			return fmt.Errorf("failed to check database integrity: %w", err)
+		}
+		if result != "ok" {
+			problems = append(problems, result)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		if isCorrupt(err) {
+			return corruptionError(err.Error())
+		}
+		return fmt.Errorf("failed to check database integrity: %w", err)
+	}
+
+	if len(problems) > 0 {
+		return corruptionError(strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+func corruptionError(detail string) error {
+	return fmt.Errorf("%w (%s); move it aside or restart with -recreate-db", ErrCorruptDatabase, detail)
+}
+
+func isCorrupt(err error) bool {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	return sqliteErr.Code == sqlite3.ErrNotADB || sqliteErr.Code == sqlite3.ErrCorrupt
+}
+
+// databaseFile strips the driver's "file:" prefix and query parameters from
+// a data source name.
+func databaseFile(dbPath string) string {
+	path, _, _ := strings.Cut(strings.TrimPrefix(dbPath, "file:"), "?")
+	return path
+}
+
+// backupCorruptFile renames the database file, and its journal or WAL file if
+// any, out of the way and returns the new path.
+func backupCorruptFile(dbPath string) (string, error) {
+	path := databaseFile(dbPath)
+	backup := fmt.Sprintf("%s.corrupt-%s", path, time.Now().Format("20060102-150405"))
+
+	if err := os.Rename(path, backup); err != nil {
+		return "", fmt.Errorf("failed to move corrupt database aside: %w", err)
+	}
+	for _, suffix := range []string{"-journal", "-wal"} {
+		if err := os.Rename(path+suffix, backup+suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("failed to move corrupt database journal aside: %w", err)
+		}
+	}
+	// the shared-memory index is rebuilt from the WAL file
+	os.Remove(path + "-shm")
+
+	return backup, nil
+}
@@ -0,0 +1,46 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+const DefaultReportConnections = 1
+
+// WithReportConnections sets how many connections report queries may hold at
+// once. Reports read through their own pool so a burst of them can't take
+// the connections link checks need to store results. The database runs in
+// WAL mode, so an open report read doesn't block those writes either. Values
+// below 1 fall back to DefaultReportConnections.
+func WithReportConnections(limit int) Option {
+	return func(d *Database) {
+		if limit < 1 {
+			limit = DefaultReportConnections
+		}
+		d.reportConns = limit
+	}
+}
+
+// enableWAL switches the database file to write-ahead logging, where readers
+// see a snapshot instead of holding a lock that makes writers wait until
+// they finish. The mode is stored in the file; in-memory databases keep
+// their own journal.
+func enableWAL(db *sql.DB) error {
+	var mode string
+	if err := db.QueryRow(`PRAGMA journal_mode=WAL`).Scan(&mode); err != nil {
+		return fmt.Errorf("failed to enable WAL mode: %w", err)
+	}
+	return nil
+}
+
+func openReportPool(driver, dbPath string, limit int) (*sql.DB, error) {
+	db, err := sql.Open(driver, dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open report pool: %w", err)
+	}
+
+	db.SetMaxOpenConns(limit)
+	db.SetMaxIdleConns(limit)
+
+	return db, nil
+}
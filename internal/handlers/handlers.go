@@ -2,8 +2,15 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"url-checker/internal/models"
 	"url-checker/internal/service"
@@ -31,8 +38,14 @@ func (h *Handler) CheckLinksHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req models.CheckRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	if isFormRequest(r) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form data", http.StatusBadRequest)
+			return
+		}
+		req.Links = r.PostForm["links"]
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, jsonDecodeError(err))
 		return
 	}
 
@@ -41,10 +54,113 @@ func (h *Handler) CheckLinksHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	response, err := h.service.CheckLinks(r.Context(), req.Links)
+	if req.RetryCount < 0 || req.RetryCount > service.MaxRetryCount || req.RetryDelayMs < 0 {
+		http.Error(w, fmt.Sprintf("retry_count must be between 0 and %d and retry_delay_ms must not be negative", service.MaxRetryCount), http.StatusBadRequest)
+		return
+	}
+
+	if req.TimeoutMs < 0 {
+		http.Error(w, "timeout_ms must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	timeout := time.Duration(req.TimeoutMs) * time.Millisecond
+	if timeout == 0 && req.TimeoutSeconds > 0 {
+		timeout = time.Duration(req.TimeoutSeconds) * time.Second
+	}
+
+	var expiresIn time.Duration
+	if req.ExpiresIn != "" {
+		var err error
+		expiresIn, err = time.ParseDuration(req.ExpiresIn)
+		if err != nil || expiresIn <= 0 {
+			http.Error(w, "expires_in must be a positive duration such as \"24h\"", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ephemeral := req.Persist != nil && !*req.Persist
+	if ephemeral && req.RetryCount > 0 {
+		http.Error(w, "retry_count requires persist to be enabled", http.StatusBadRequest)
+		return
+	}
+	if ephemeral && expiresIn > 0 {
+		http.Error(w, "expires_in requires persist to be enabled", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := service.NormalizeMethods(req.Methods); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, err := service.ParseMethodPolicy(req.MethodPolicy); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := service.ValidateServerName(req.ServerName); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, err := service.ParseDedupMode(req.Dedup); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, err := service.ParseCookies(req.Cookies); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.Cookies) > 0 && req.RetryCount > 0 {
+		http.Error(w, "cookies can't be combined with retry_count", http.StatusBadRequest)
+		return
+	}
+
+	opts := service.CheckOptions{
+		IdempotencyKey:   r.Header.Get("Idempotency-Key"),
+		RetryCount:       req.RetryCount,
+		RetryDelay:       time.Duration(req.RetryDelayMs) * time.Millisecond,
+		Timeout:          timeout,
+		Methods:          req.Methods,
+		MethodPolicy:     models.MethodPolicy(req.MethodPolicy),
+		DisableKeepAlive: req.DisableKeepAlive,
+		CorrectSchemes:   req.CorrectSchemes,
+		DiscoverMethods:  req.DiscoverMethods,
+		ServerName:       req.ServerName,
+		Cookies:          req.Cookies,
+		ExpiresIn:        expiresIn,
+		Ephemeral:        ephemeral,
+		Profile:          req.Profile,
+		Dedup:            models.DedupMode(req.Dedup),
+		Source:           models.BatchSourceAPI,
+		Priority:         req.Priority,
+	}
+	opts.Async, _ = strconv.ParseBool(r.URL.Query().Get("async"))
+	if req.Priority != 0 && !opts.Async {
+		http.Error(w, "priority requires async", http.StatusBadRequest)
+		return
+	}
+	if opts.Async && ephemeral {
+		http.Error(w, "async requires persist to be enabled", http.StatusBadRequest)
+		return
+	}
+	if opts.Async && len(req.Cookies) > 0 {
+		http.Error(w, "cookies can't be combined with async", http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.service.CheckLinksWithOptions(r.Context(), req.Links, opts)
 	if err != nil {
 		if err.Error() == "no links provided" {
 			http.Error(w, "No links provided", http.StatusBadRequest)
+		} else if errors.Is(err, service.ErrUnknownProfile) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else if errors.Is(err, service.ErrBatchQueueFull) {
+			http.Error(w, "Batch queue is full, try again later", http.StatusServiceUnavailable)
+		} else if errors.Is(err, service.ErrIdempotencyKeyReused) {
+			http.Error(w, "Idempotency-Key was already used for a different submission", http.StatusUnprocessableEntity)
 		} else {
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 		}
@@ -52,9 +168,168 @@ func (h *Handler) CheckLinksHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	if opts.Async {
+		w.Header().Set("Location", fmt.Sprintf("/api/batch/%d", response.BatchNum))
+		w.WriteHeader(http.StatusAccepted)
+	}
 	json.NewEncoder(w).Encode(response)
 }
 
+// maxCSVUploadSize bounds the size of a CSV upload.
+const maxCSVUploadSize = 10 << 20
+
+func (h *Handler) CheckCSVHandler(w http.ResponseWriter, r *http.Request) {
+	if h.service.IsShutdown() {
+		http.Error(w, "Service is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxCSVUploadSize)
+
+	var body io.Reader = r.Body
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "Missing CSV file", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	upload, err := h.service.ParseCSVLinks(body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid CSV: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if len(upload.Links) == 0 {
+		http.Error(w, "No links provided", http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.service.CheckLinksWithOptions(r.Context(), upload.Links, service.CheckOptions{
+		IdempotencyKey: r.Header.Get("Idempotency-Key"),
+		Methods:        upload.Methods,
+		Source:         models.BatchSourceAPI,
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrIdempotencyKeyReused) {
+			http.Error(w, "Idempotency-Key was already used for a different submission", http.StatusUnprocessableEntity)
+		} else {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.CSVCheckResponse{
+		CheckResponse: response,
+		Skipped:       upload.Skipped,
+	})
+}
+
+// jsonDecodeError describes a request body decoding failure, pointing at the
+// offending offset or field where the decoder reports one.
+func jsonDecodeError(err error) models.ErrorResponse {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.As(err, &syntaxErr):
+		return models.ErrorResponse{
+			Error:  fmt.Sprintf("Invalid JSON at offset %d: %s", syntaxErr.Offset, syntaxErr.Error()),
+			Offset: syntaxErr.Offset,
+		}
+	case errors.As(err, &typeErr):
+		return models.ErrorResponse{
+			Error:  fmt.Sprintf("Invalid JSON: field %q must be %s, got %s", typeErr.Field, typeErr.Type, typeErr.Value),
+			Offset: typeErr.Offset,
+			Field:  typeErr.Field,
+		}
+	case errors.Is(err, io.EOF):
+		return models.ErrorResponse{Error: "Invalid JSON: empty body"}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return models.ErrorResponse{Error: "Invalid JSON: unexpected end of input"}
+	default:
+		return models.ErrorResponse{Error: "Invalid JSON"}
+	}
+}
+
+// writeJSON encodes v as the response body, indenting it when the request
+// asks for ?pretty=true.
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v any) {
+	var data []byte
+	var err error
+	if pretty, _ := strconv.ParseBool(r.URL.Query().Get("pretty")); pretty {
+		data, err = json.MarshalIndent(v, "", "  ")
+	} else {
+		data, err = json.Marshal(v)
+	}
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(data, '\n'))
+}
+
+func writeJSONError(w http.ResponseWriter, status int, body models.ErrorResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// parsePagination reads the limit and offset query parameters.
+func parsePagination(r *http.Request, defaultLimit, maxLimit int) (int, int, error) {
+	limit, offset := defaultLimit, 0
+	query := r.URL.Query()
+
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxLimit {
+			return 0, 0, fmt.Errorf("limit must be between 1 and %d", maxLimit)
+		}
+		limit = parsed
+	}
+
+	if value := query.Get("offset"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			return 0, 0, fmt.Errorf("offset must be a non-negative integer")
+		}
+		offset = parsed
+	}
+
+	return limit, offset, nil
+}
+
+// isFormRequest reports whether the body is form-encoded; anything else is decoded as JSON.
+func isFormRequest(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "application/x-www-form-urlencoded"
+}
+
+// missingBatchesHeader lists the requested batch numbers a report left out
+// because they don't exist.
+const missingBatchesHeader = "X-Missing-Batches"
+
+func formatBatchNums(nums []int) string {
+	parts := make([]string, len(nums))
+	for i, num := range nums {
+		parts[i] = strconv.Itoa(num)
+	}
+	return strings.Join(parts, ",")
+}
+
 func (h *Handler) ReportHandler(w http.ResponseWriter, r *http.Request) {
 	if h.service.IsShutdown() {
 		http.Error(w, "Service is shutting down", http.StatusServiceUnavailable)
@@ -63,7 +338,7 @@ func (h *Handler) ReportHandler(w http.ResponseWriter, r *http.Request) {
 
 	var req models.ReportRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, jsonDecodeError(err))
 		return
 	}
 
@@ -72,32 +347,552 @@ func (h *Handler) ReportHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	pdfData, err := h.service.GeneratePDFReportAsync(r.Context(), req.LinksList)
+	renderer, err := h.service.ReportRenderer(req.Format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Stream && !service.ReportStreamable(req.Format) {
+		http.Error(w, "Only json and html reports can be streamed", http.StatusBadRequest)
+		return
+	}
+
+	groupBy, err := service.ParseReportGrouping(req.GroupBy)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	reportOpts := service.ReportOptions{GroupBy: groupBy, CSVBOM: req.BOM}
+
+	if req.Delimiter != "" || req.BOM != nil {
+		if service.ParseReportFormat(req.Format) != service.ReportFormatCSV {
+			http.Error(w, "delimiter and bom only apply to csv reports", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Delimiter != "" {
+		if reportOpts.CSVDelimiter, err = service.ParseCSVDelimiter(req.Delimiter); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	r = r.WithContext(service.WithReportOptions(r.Context(), reportOpts))
+
+	deadline := time.Duration(req.DeadlineMs) * time.Millisecond
+	if req.DeadlineMs < 0 || deadline > service.MaxReportDeadline {
+		http.Error(w, fmt.Sprintf("deadline_ms must be between 0 and %d", service.MaxReportDeadline.Milliseconds()), http.StatusBadRequest)
+		return
+	}
+
+	missing, err := h.service.MissingBatches(r.Context(), req.LinksList)
+	if err != nil {
+		h.logger.Errorf("Failed to look up report batches: %v", err)
+		http.Error(w, "Failed to generate report", http.StatusInternalServerError)
+		return
+	}
+	if len(missing) > 0 {
+		w.Header().Set(missingBatchesHeader, formatBatchNums(missing))
+	}
+
+	if deadline > 0 {
+		if _, err := h.service.WaitForBatches(r.Context(), req.LinksList, deadline); err != nil {
+			h.logger.Errorf("Failed to wait for report batches: %v", err)
+			http.Error(w, "Failed to generate report", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if req.Stream {
+		h.streamReport(w, r, renderer, req)
+		return
+	}
+
+	report, err := h.service.GenerateReportAsync(r.Context(), req.Format, req.LinksList)
+	if errors.Is(err, service.ErrReportTooLarge) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
 	if err != nil {
-		h.logger.Errorf("Failed to generate PDF: %v", err)
+		h.logger.Errorf("Failed to generate report: %v", err)
 		http.Error(w, "Failed to generate report", http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/pdf")
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=url_report_%d.pdf", h.service.GetCurrentTimestamp()))
-	w.Write(pdfData)
+	w.Header().Set("Content-Type", renderer.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=url_report_%d.%s", h.service.GetCurrentTimestamp(), renderer.FileExtension()))
+	w.Write(report)
+}
+
+// ReportEmailHandler emails a PDF report of the requested batches through the
+// service's notifier.
+func (h *Handler) ReportEmailHandler(w http.ResponseWriter, r *http.Request) {
+	if h.service.IsShutdown() {
+		http.Error(w, "Service is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req models.ReportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, jsonDecodeError(err))
+		return
+	}
+
+	if len(req.LinksList) == 0 {
+		http.Error(w, "No batch IDs provided", http.StatusBadRequest)
+		return
+	}
+
+	missing, err := h.service.MissingBatches(r.Context(), req.LinksList)
+	if err != nil {
+		h.logger.Errorf("Failed to look up report batches: %v", err)
+		http.Error(w, "Failed to email report", http.StatusInternalServerError)
+		return
+	}
+	if len(missing) > 0 {
+		w.Header().Set(missingBatchesHeader, formatBatchNums(missing))
+	}
+
+	if err := h.service.EmailReport(r.Context(), req.LinksList); err != nil {
+		switch {
+		case errors.Is(err, service.ErrEmailNotConfigured):
+			http.Error(w, "Report email is not configured", http.StatusNotImplemented)
+		case errors.Is(err, service.ErrReportTooLarge):
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		default:
+			h.logger.Errorf("Failed to email report: %v", err)
+			http.Error(w, "Failed to email report", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// streamReport writes a report to the client batch by batch. Once output has
+// started an error can only cut the report short.
+func (h *Handler) streamReport(w http.ResponseWriter, r *http.Request, renderer service.ReportRenderer, req models.ReportRequest) {
+	w.Header().Set("Content-Type", renderer.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=url_report_%d.%s", h.service.GetCurrentTimestamp(), renderer.FileExtension()))
+
+	out := &trackingWriter{ResponseWriter: w}
+	if err := h.service.StreamReport(r.Context(), req.Format, req.LinksList, out); err != nil {
+		h.logger.Errorf("Failed to stream report: %v", err)
+		if !out.wrote {
+			w.Header().Del("Content-Disposition")
+			http.Error(w, "Failed to generate report", http.StatusInternalServerError)
+		}
+	}
+}
+
+// trackingWriter records whether any response body has been written.
+type trackingWriter struct {
+	http.ResponseWriter
+	wrote bool
+}
+
+func (w *trackingWriter) Write(p []byte) (int, error) {
+	w.wrote = true
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *trackingWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// ReportEstimateHandler sizes a report request without generating the PDF.
+func (h *Handler) ReportEstimateHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.ReportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, jsonDecodeError(err))
+		return
+	}
+
+	if len(req.LinksList) == 0 {
+		http.Error(w, "No batch IDs provided", http.StatusBadRequest)
+		return
+	}
+
+	estimate, err := h.service.EstimateReport(r.Context(), req.LinksList)
+	if err != nil {
+		h.logger.Errorf("Failed to estimate report: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, estimate)
 }
 
 func (h *Handler) HealthHandler(w http.ResponseWriter, r *http.Request) {
 	status := h.service.GetHealthStatus(r.Context())
+	writeJSON(w, r, http.StatusOK, status)
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(status)
+func (h *Handler) ReadinessHandler(w http.ResponseWriter, r *http.Request) {
+	readiness := h.service.GetReadiness(r.Context())
+
+	status := http.StatusOK
+	if !readiness.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, r, status, readiness)
+}
+
+func (h *Handler) BatchesHandler(w http.ResponseWriter, r *http.Request) {
+	// a streamed listing is written as it is read, so it isn't capped
+	stream, _ := strconv.ParseBool(r.URL.Query().Get("stream"))
+	maxLimit := maxPageSize
+	if stream {
+		maxLimit = math.MaxInt32
+	}
+
+	// a missing limit leaves the choice to the service's configured default
+	limit, offset, err := parsePagination(r, 0, maxLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	source, err := service.ParseBatchSource(r.URL.Query().Get("source"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if stream {
+		w.Header().Set("Content-Type", "application/json")
+		out := &trackingWriter{ResponseWriter: w}
+		if err := h.service.StreamBatches(r.Context(), out, source, limit, offset); err != nil {
+			h.logger.Errorf("Failed to stream batches: %v", err)
+			if !out.wrote {
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+			}
+		}
+		return
+	}
+
+	response, err := h.service.ListBatchesBySource(r.Context(), source, limit, offset)
+	if err != nil {
+		h.logger.Errorf("Failed to list batches: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, response)
+}
+
+func (h *Handler) BatchHandler(w http.ResponseWriter, r *http.Request) {
+	batchNum, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || batchNum < 1 {
+		http.Error(w, "Invalid batch ID", http.StatusBadRequest)
+		return
+	}
+
+	order, err := service.ParseLinkOrder(r.URL.Query().Get("order_by"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.service.GetBatchStatus(r.Context(), batchNum, order)
+	if err != nil {
+		if errors.Is(err, service.ErrBatchNotFound) {
+			http.Error(w, "Batch not found", http.StatusNotFound)
+		} else {
+			h.logger.Errorf("Failed to get batch %d: %v", batchNum, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, response)
+}
+
+// BatchDetailsHandler returns the stored link rows of a batch as a JSON array.
+func (h *Handler) BatchDetailsHandler(w http.ResponseWriter, r *http.Request) {
+	batchNum, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || batchNum < 1 {
+		http.Error(w, "Invalid batch ID", http.StatusBadRequest)
+		return
+	}
+
+	links, err := h.service.GetBatchLinks(r.Context(), batchNum)
+	if err != nil {
+		if errors.Is(err, service.ErrBatchNotFound) {
+			http.Error(w, "Batch not found", http.StatusNotFound)
+		} else {
+			h.logger.Errorf("Failed to get links of batch %d: %v", batchNum, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, links)
+}
+
+// LinkHandler returns a link, including the debug metadata of its latest
+// check when it was stored.
+func (h *Handler) LinkHandler(w http.ResponseWriter, r *http.Request) {
+	linkID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || linkID < 1 {
+		http.Error(w, "Invalid link ID", http.StatusBadRequest)
+		return
+	}
+
+	link, err := h.service.GetLink(r.Context(), linkID)
+	if err != nil {
+		if errors.Is(err, service.ErrLinkNotFound) {
+			http.Error(w, "Link not found", http.StatusNotFound)
+		} else {
+			h.logger.Errorf("Failed to get link %d: %v", linkID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, link)
+}
+
+// LinkPatchHandler updates the operator notes of a link.
+func (h *Handler) LinkPatchHandler(w http.ResponseWriter, r *http.Request) {
+	linkID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || linkID < 1 {
+		http.Error(w, "Invalid link ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.LinkPatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, jsonDecodeError(err))
+		return
+	}
+
+	if req.Notes == nil {
+		http.Error(w, "No fields to update", http.StatusBadRequest)
+		return
+	}
+
+	if len(*req.Notes) > service.MaxLinkNotesLength {
+		http.Error(w, fmt.Sprintf("notes must not be longer than %d bytes", service.MaxLinkNotesLength), http.StatusBadRequest)
+		return
+	}
+
+	link, err := h.service.SetLinkNotes(r.Context(), linkID, *req.Notes)
+	if err != nil {
+		if errors.Is(err, service.ErrLinkNotFound) {
+			http.Error(w, "Link not found", http.StatusNotFound)
+		} else {
+			h.logger.Errorf("Failed to update link %d: %v", linkID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, link)
+}
+
+func (h *Handler) BatchRecheckHandler(w http.ResponseWriter, r *http.Request) {
+	batchNum, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || batchNum < 1 {
+		http.Error(w, "Invalid batch ID", http.StatusBadRequest)
+		return
+	}
+
+	if h.service.IsShutdown() {
+		http.Error(w, "Service is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	response, err := h.service.RecheckBatch(r.Context(), batchNum)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrBatchNotFound):
+			http.Error(w, "Batch not found", http.StatusNotFound)
+		case errors.Is(err, service.ErrBatchProcessing):
+			http.Error(w, "Batch is still processing", http.StatusConflict)
+		default:
+			h.logger.Errorf("Failed to recheck batch %d: %v", batchNum, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, response)
+}
+
+// BatchDeleteHandler removes a batch and its links.
+func (h *Handler) BatchDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	batchNum, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || batchNum < 1 {
+		http.Error(w, "Invalid batch ID", http.StatusBadRequest)
+		return
+	}
+
+	if h.service.IsShutdown() {
+		http.Error(w, "Service is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	if err := h.service.DeleteBatch(r.Context(), batchNum); err != nil {
+		switch {
+		case errors.Is(err, service.ErrBatchNotFound):
+			http.Error(w, "Batch not found", http.StatusNotFound)
+		case errors.Is(err, service.ErrBatchProcessing):
+			http.Error(w, "Batch is still processing", http.StatusConflict)
+		default:
+			h.logger.Errorf("Failed to delete batch %d: %v", batchNum, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) HostsHandler(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := parsePagination(r, defaultPageSize, maxPageSize)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.service.GetHosts(r.Context(), limit, offset)
+	if err != nil {
+		h.logger.Errorf("Failed to list hosts: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, response)
+}
+
+// StatsHandler returns the hosts with the most broken links. top caps how
+// many are returned and defaults to service.DefaultStatsTop.
+func (h *Handler) StatsHandler(w http.ResponseWriter, r *http.Request) {
+	top := service.DefaultStatsTop
+	if value := r.URL.Query().Get("top"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > service.MaxStatsTop {
+			http.Error(w, fmt.Sprintf("top must be between 1 and %d", service.MaxStatsTop), http.StatusBadRequest)
+			return
+		}
+		top = parsed
+	}
+
+	response, err := h.service.GetStats(r.Context(), top)
+	if err != nil {
+		h.logger.Errorf("Failed to get stats: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, response)
+}
+
+// StatsTimeseriesHandler returns available and broken link checks per time
+// bucket. from and to are RFC 3339 times and default to the last day; bucket
+// is a duration of whole seconds and defaults to an hour.
+func (h *Handler) StatsTimeseriesHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	to := h.service.Now()
+	if value := query.Get("to"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, "to must be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		to = parsed
+	}
+
+	from := to.Add(-service.DefaultTimeseriesWindow)
+	if value := query.Get("from"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, "from must be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		from = parsed
+	}
+
+	bucket := service.DefaultTimeseriesBucket
+	if value := query.Get("bucket"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < time.Second || parsed%time.Second != 0 {
+			http.Error(w, "bucket must be a duration of whole seconds such as \"1h\"", http.StatusBadRequest)
+			return
+		}
+		bucket = parsed
+	}
+
+	if !from.Before(to) {
+		http.Error(w, "from must be before to", http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.service.GetStatsTimeseries(r.Context(), from, to, bucket)
+	if errors.Is(err, service.ErrTooManyTimeseriesBuckets) {
+		http.Error(w, fmt.Sprintf("the range must not span more than %d buckets", service.MaxTimeseriesBuckets), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.logger.Errorf("Failed to get stats timeseries: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, response)
+}
+
+func (h *Handler) MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, metric := range h.service.CollectMetrics() {
+		fmt.Fprintf(w, "# HELP %s %s\n", metric.Name, metric.Help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", metric.Name, metric.Type)
+		fmt.Fprintf(w, "%s %g\n", metric.Name, metric.Value)
+	}
+}
+
+func (h *Handler) MetricsSnapshotHandler(w http.ResponseWriter, r *http.Request) {
+	snapshot, err := h.service.MetricsSnapshot()
+	if err != nil {
+		if errors.Is(err, service.ErrMetricsSnapshotDisabled) {
+			http.Error(w, "Metrics snapshot is disabled", http.StatusNotFound)
+			return
+		}
+		h.logger.Errorf("Failed to get metrics snapshot: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, snapshot)
 }
 
 func (h *Handler) SetupRoutes() *mux.Router {
 	router := mux.NewRouter()
+	router.HandleFunc("/metrics", h.MetricsHandler).Methods("GET")
 
 	api := router.PathPrefix("/api").Subrouter()
 	api.HandleFunc("/check", h.CheckLinksHandler).Methods("POST")
+	api.HandleFunc("/check/csv", h.CheckCSVHandler).Methods("POST")
 	api.HandleFunc("/report", h.ReportHandler).Methods("POST")
+	api.HandleFunc("/report/estimate", h.ReportEstimateHandler).Methods("POST")
+	api.HandleFunc("/report/email", h.ReportEmailHandler).Methods("POST")
 	api.HandleFunc("/health", h.HealthHandler).Methods("GET")
+	api.HandleFunc("/health/ready", h.ReadinessHandler).Methods("GET")
+	api.HandleFunc("/batches", h.BatchesHandler).Methods("GET")
+	api.HandleFunc("/batch/{id}", h.BatchHandler).Methods("GET")
+	api.HandleFunc("/batch/{id}", h.BatchDeleteHandler).Methods("DELETE")
+	api.HandleFunc("/batch/{id}/details", h.BatchDetailsHandler).Methods("GET")
+	api.HandleFunc("/batch/{id}/recheck", h.BatchRecheckHandler).Methods("POST")
+	api.HandleFunc("/link/{id}", h.LinkHandler).Methods("GET")
+	api.HandleFunc("/link/{id}", h.LinkPatchHandler).Methods("PATCH")
+	api.HandleFunc("/hosts", h.HostsHandler).Methods("GET")
+	api.HandleFunc("/stats", h.StatsHandler).Methods("GET")
+	api.HandleFunc("/stats/timeseries", h.StatsTimeseriesHandler).Methods("GET")
+	api.HandleFunc("/metrics/snapshot", h.MetricsSnapshotHandler).Methods("GET")
 
 	return router
 }
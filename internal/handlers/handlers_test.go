@@ -4,8 +4,14 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -25,6 +31,7 @@ func setupSimpleTestHandler(t *testing.T) (*Handler, *service.URLChecker, *datab
 
 	t.Cleanup(func() {
 		db.Close()
+		os.Remove(file)
 	})
 
 	logger := logrus.New()
@@ -68,6 +75,306 @@ func TestHandler_Simple_CheckLinksHandler(t *testing.T) {
 	assert.NotEmpty(t, response.Links)
 }
 
+func TestHandler_Simple_CheckLinksHandler_FormEncoded(t *testing.T) {
+	handler, _, db := setupSimpleTestHandler(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	form := url.Values{}
+	form.Add("links", server.URL+"/first")
+	form.Add("links", server.URL+"/second")
+
+	req := httptest.NewRequest("POST", "/api/check", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	handler.CheckLinksHandler(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response models.CheckResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	require.NoError(t, err)
+	assert.Len(t, response.Links, 2)
+	assert.Equal(t, "available", response.Links[server.URL+"/first"])
+	assert.Equal(t, "available", response.Links[server.URL+"/second"])
+
+	links, err := db.GetLinksByBatchNum(context.Background(), response.LinksNum)
+	require.NoError(t, err)
+	assert.Len(t, links, 2)
+}
+
+func TestHandler_Simple_CheckLinksHandler_FormEncodedNoLinks(t *testing.T) {
+	handler, _, _ := setupSimpleTestHandler(t)
+
+	req := httptest.NewRequest("POST", "/api/check", strings.NewReader("other=value"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	handler.CheckLinksHandler(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestHandler_Simple_CheckLinksHandler_UnsupportedMethod(t *testing.T) {
+	handler, _, _ := setupSimpleTestHandler(t)
+
+	jsonData, err := json.Marshal(models.CheckRequest{Links: []string{"http://example.com"}, Methods: []string{"POST"}})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("POST", "/api/check", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.CheckLinksHandler(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "unsupported method")
+}
+
+func TestHandler_Simple_CheckLinksHandler_UnknownProfile(t *testing.T) {
+	handler, _, _ := setupSimpleTestHandler(t)
+
+	jsonData, err := json.Marshal(models.CheckRequest{Links: []string{"http://example.com"}, Profile: "aggressive"})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("POST", "/api/check", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.CheckLinksHandler(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "unknown profile")
+}
+
+func TestHandler_Simple_CheckLinksHandler_IdempotencyKey(t *testing.T) {
+	handler, _, _ := setupSimpleTestHandler(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	jsonData, err := json.Marshal(models.CheckRequest{Links: []string{server.URL}})
+	require.NoError(t, err)
+
+	batchNums := make([]int, 2)
+	for i := range batchNums {
+		req := httptest.NewRequest("POST", "/api/check", bytes.NewBuffer(jsonData))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", "submission-1")
+		w := httptest.NewRecorder()
+
+		handler.CheckLinksHandler(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response models.CheckResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		batchNums[i] = response.LinksNum
+	}
+
+	assert.Equal(t, batchNums[0], batchNums[1])
+
+	// the same key with other links is refused
+	jsonData, err = json.Marshal(models.CheckRequest{Links: []string{server.URL + "/other"}})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("POST", "/api/check", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", "submission-1")
+	w := httptest.NewRecorder()
+
+	handler.CheckLinksHandler(w, req)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
+
+func TestHandler_Simple_CheckLinksHandler_InvalidRetryPolicy(t *testing.T) {
+	handler, _, _ := setupSimpleTestHandler(t)
+
+	jsonData, err := json.Marshal(models.CheckRequest{Links: []string{"http://example.com"}, RetryCount: -1})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("POST", "/api/check", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.CheckLinksHandler(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestHandler_Simple_CheckLinksHandler_TimeoutSeconds(t *testing.T) {
+	handler, _, db := setupSimpleTestHandler(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	tests := []struct {
+		name    string
+		request models.CheckRequest
+		stored  int64
+	}{
+		{"seconds", models.CheckRequest{TimeoutSeconds: 3}, 3000},
+		{"zero falls back to the default", models.CheckRequest{TimeoutSeconds: 0}, 0},
+		{"negative falls back to the default", models.CheckRequest{TimeoutSeconds: -5}, 0},
+		{"milliseconds take precedence", models.CheckRequest{TimeoutMs: 1500, TimeoutSeconds: 3}, 1500},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.request.Links = []string{fmt.Sprintf("%s/%d", server.URL, i)}
+			jsonData, err := json.Marshal(tt.request)
+			require.NoError(t, err)
+
+			req := httptest.NewRequest("POST", "/api/check", bytes.NewBuffer(jsonData))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			handler.CheckLinksHandler(w, req)
+
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+			var response models.CheckResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+			batch, err := db.GetBatch(context.Background(), response.BatchNum)
+			require.NoError(t, err)
+			assert.Equal(t, tt.stored, batch.TimeoutMs)
+		})
+	}
+}
+
+func TestHandler_Simple_CheckLinksHandler_Async(t *testing.T) {
+	handler, checker, db := setupSimpleTestHandler(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go checker.StartBatchWorker(ctx)
+
+	jsonData, err := json.Marshal(models.CheckRequest{Links: []string{server.URL}})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("POST", "/api/check?async=true", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.CheckLinksHandler(w, req)
+
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+
+	var response models.CheckResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, models.BatchStatusProcessing, response.Status)
+	assert.Equal(t, string(models.StatusProcessing), response.Links[server.URL])
+	assert.Equal(t, fmt.Sprintf("/api/batch/%d", response.BatchNum), w.Header().Get("Location"))
+
+	require.Eventually(t, func() bool {
+		batch, err := db.GetBatch(context.Background(), response.BatchNum)
+		return err == nil && batch.Status == models.BatchStatusCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+
+	persist := false
+	jsonData, err = json.Marshal(models.CheckRequest{Links: []string{server.URL}, Persist: &persist})
+	require.NoError(t, err)
+
+	req = httptest.NewRequest("POST", "/api/check?async=true", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+
+	handler.CheckLinksHandler(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// priority only orders async batches
+	jsonData, err = json.Marshal(models.CheckRequest{Links: []string{server.URL}, Priority: 1})
+	require.NoError(t, err)
+
+	req = httptest.NewRequest("POST", "/api/check", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+
+	handler.CheckLinksHandler(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Empty(t, w.Header().Get("Location"))
+}
+
+func TestHandler_Simple_CheckLinksHandler_NoPersist(t *testing.T) {
+	handler, _, db := setupSimpleTestHandler(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	persist := false
+	jsonData, err := json.Marshal(models.CheckRequest{Links: []string{server.URL}, Persist: &persist})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("POST", "/api/check", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.CheckLinksHandler(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response models.CheckResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, string(models.StatusAvailable), response.Links[server.URL])
+
+	count, err := db.CountBatches(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, count)
+}
+
+func TestHandler_Simple_CheckLinksHandler_BatchNumAlias(t *testing.T) {
+	handler, _, _ := setupSimpleTestHandler(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	jsonData, err := json.Marshal(models.CheckRequest{Links: []string{server.URL}})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("POST", "/api/check", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.CheckLinksHandler(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, float64(1), response["batch_num"])
+	assert.Equal(t, float64(1), response["links_num"])
+
+	req = httptest.NewRequest("GET", "/api/batch/1", nil)
+	w = httptest.NewRecorder()
+	handler.SetupRoutes().ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// a fresh map, so the fields can't be left over from the check response
+	var batch map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &batch))
+	assert.Equal(t, float64(1), batch["batch_num"])
+	assert.Equal(t, float64(1), batch["links_num"])
+}
+
 func TestHandler_Simple_CheckLinksHandler_EmptyLinks(t *testing.T) {
 	handler, _, _ := setupSimpleTestHandler(t)
 
@@ -102,6 +409,64 @@ func TestHandler_Simple_HealthHandler(t *testing.T) {
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	assert.NoError(t, err)
 	assert.Equal(t, "healthy", response["status"])
+	assert.Equal(t, float64(0), response["active_checks"])
+}
+
+func TestHandler_Simple_HealthHandler_Pretty(t *testing.T) {
+	handler, _, _ := setupSimpleTestHandler(t)
+
+	req := httptest.NewRequest("GET", "/api/health", nil)
+	w := httptest.NewRecorder()
+	handler.HealthHandler(w, req)
+
+	compact := strings.TrimSuffix(w.Body.String(), "\n")
+	assert.NotContains(t, compact, "\n")
+
+	req = httptest.NewRequest("GET", "/api/health?pretty=true", nil)
+	w = httptest.NewRecorder()
+	handler.HealthHandler(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "{\n  \"")
+
+	var response map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "healthy", response["status"])
+}
+
+func TestHandler_Simple_MetricsHandler(t *testing.T) {
+	handler, _, _ := setupSimpleTestHandler(t)
+
+	router := handler.SetupRoutes()
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain"))
+	assert.Contains(t, w.Body.String(), "# TYPE url_checker_active_checks gauge")
+	assert.Contains(t, w.Body.String(), "url_checker_active_checks 0")
+}
+
+func TestHandler_Simple_MetricsSnapshotHandler(t *testing.T) {
+	handler, _, _ := setupSimpleTestHandler(t)
+
+	router := handler.SetupRoutes()
+
+	req := httptest.NewRequest("GET", "/api/metrics/snapshot", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var snapshot models.MetricsSnapshot
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &snapshot))
+	assert.Zero(t, snapshot.ChecksTotal)
+	assert.Zero(t, snapshot.BatchesTotal)
+	assert.False(t, snapshot.At.IsZero())
 }
 
 func TestHandler_Simple_SetupRoutes(t *testing.T) {
@@ -312,27 +677,975 @@ func TestHandler_Simple_ReportHandler_NonExistentBatches(t *testing.T) {
 	handler.ReportHandler(w, req)
 
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "999", w.Header().Get("X-Missing-Batches"))
 }
 
-func TestHandler_Simple_ReportHandler_WithContextCancellation(t *testing.T) {
-	handler, _, _ := setupSimpleTestHandler(t)
+func TestHandler_Simple_ReportHandler_MissingBatches(t *testing.T) {
+	handler, checker, db := setupSimpleTestHandler(t)
 
 	ctx, cancel := context.WithCancel(context.Background())
-	cancel()
+	t.Cleanup(cancel)
+	go checker.StartWorker(ctx)
 
-	requestBody := models.ReportRequest{
-		LinksList: []int{1},
-	}
+	require.NoError(t, db.CreateBatch(ctx, 1, models.BatchStatusCompleted, time.Now()))
+	require.NoError(t, db.CreateBatch(ctx, 3, models.BatchStatusCompleted, time.Now()))
 
-	jsonData, err := json.Marshal(requestBody)
+	jsonData, err := json.Marshal(models.ReportRequest{LinksList: []int{7, 1, 5, 3, 7}})
 	require.NoError(t, err)
 
 	req := httptest.NewRequest("POST", "/api/report", bytes.NewBuffer(jsonData))
-	req = req.WithContext(ctx)
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 
 	handler.ReportHandler(w, req)
 
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/pdf", w.Header().Get("Content-Type"))
+	assert.Equal(t, "7,5", w.Header().Get("X-Missing-Batches"))
+
+	jsonData, err = json.Marshal(models.ReportRequest{LinksList: []int{1, 3}})
+	require.NoError(t, err)
+
+	req = httptest.NewRequest("POST", "/api/report", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+
+	handler.ReportHandler(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("X-Missing-Batches"))
+}
+
+func TestHandler_Simple_ReportHandler_Deadline(t *testing.T) {
+	handler, checker, db := setupSimpleTestHandler(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go checker.StartWorker(ctx)
+
+	require.NoError(t, db.CreateBatch(ctx, 1, models.BatchStatusProcessing, time.Now()))
+
+	for _, tt := range []struct {
+		deadlineMs int
+		code       int
+	}{
+		{100, http.StatusOK},
+		{-1, http.StatusBadRequest},
+		{int(service.MaxReportDeadline.Milliseconds()) + 1, http.StatusBadRequest},
+	} {
+		jsonData, err := json.Marshal(models.ReportRequest{LinksList: []int{1}, DeadlineMs: tt.deadlineMs})
+		require.NoError(t, err)
+
+		req := httptest.NewRequest("POST", "/api/report", bytes.NewBuffer(jsonData))
+		w := httptest.NewRecorder()
+
+		start := time.Now()
+		handler.ReportHandler(w, req)
+
+		assert.Equal(t, tt.code, w.Code, "deadline_ms=%d", tt.deadlineMs)
+		if tt.code == http.StatusOK {
+			// the batch never finishes, so the report waits out the deadline
+			assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+		}
+	}
+}
+
+func TestHandler_Simple_ReportEmailHandler(t *testing.T) {
+	handler, checker, db := setupSimpleTestHandler(t)
+	router := handler.SetupRoutes()
+
+	require.NoError(t, db.CreateBatch(context.Background(), 1, models.BatchStatusCompleted, time.Now()))
+
+	req := httptest.NewRequest("POST", "/api/report/email", strings.NewReader(`{"links_list": []}`))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// no mailer is configured
+	req = httptest.NewRequest("POST", "/api/report/email", strings.NewReader(`{"links_list": [1]}`))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotImplemented, w.Code)
+
+	checker.SetShutdown(true)
+	req = httptest.NewRequest("POST", "/api/report/email", strings.NewReader(`{"links_list": [1]}`))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func TestHandler_Simple_ReportHandler_Format(t *testing.T) {
+	handler, checker, db := setupSimpleTestHandler(t)
+	router := handler.SetupRoutes()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go checker.StartWorker(ctx)
+
+	require.NoError(t, db.CreateBatch(ctx, 1, models.BatchStatusCompleted, time.Now()))
+	_, err := db.CreateLink(ctx, "http://example.com", models.StatusAvailable, 1, nil)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("POST", "/api/report", strings.NewReader(`{"links_list": [1], "format": "csv"}`))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), ".csv")
+	assert.Contains(t, w.Body.String(), "1,completed,http://example.com,available")
+
+	// the grouping reaches the report worker
+	req = httptest.NewRequest("POST", "/api/report", strings.NewReader(`{"links_list": [1], "format": "csv", "group_by": "status_class"}`))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), ",status_class,status_class_count")
+
+	req = httptest.NewRequest("POST", "/api/report", strings.NewReader(`{"links_list": [1], "format": "csv", "group_by": "host"}`))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// the CSV encoding can be chosen per report
+	req = httptest.NewRequest("POST", "/api/report", strings.NewReader(`{"links_list": [1], "format": "csv", "delimiter": ";", "bom": true}`))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, strings.HasPrefix(w.Body.String(), "\ufeffbatch_num;batch_status;"))
+	assert.Contains(t, w.Body.String(), "1;completed;http://example.com;available")
+
+	for _, body := range []string{
+		`{"links_list": [1], "format": "csv", "delimiter": "::"}`,
+		`{"links_list": [1], "format": "json", "delimiter": ";"}`,
+		`{"links_list": [1], "format": "pdf", "bom": true}`,
+	} {
+		req = httptest.NewRequest("POST", "/api/report", strings.NewReader(body))
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+
+	req = httptest.NewRequest("POST", "/api/report", strings.NewReader(`{"links_list": [1], "format": "docx"}`))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestHandler_Simple_ReportEstimateHandler(t *testing.T) {
+	handler, _, db := setupSimpleTestHandler(t)
+
+	ctx := context.Background()
+	require.NoError(t, db.CreateBatch(ctx, 1, models.BatchStatusCompleted, time.Now()))
+	for _, link := range []string{"http://a.example", "http://b.example"} {
+		_, err := db.CreateLink(ctx, link, models.StatusAvailable, 1, nil)
+		require.NoError(t, err)
+	}
+
+	router := handler.SetupRoutes()
+
+	req := httptest.NewRequest("POST", "/api/report/estimate", strings.NewReader(`{"links_list": [1, 2]}`))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var estimate models.ReportEstimate
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &estimate))
+	assert.Equal(t, models.ReportEstimate{BatchCount: 1, LinkCount: 2, PageCount: 1, Missing: []int{2}}, estimate)
+
+	req = httptest.NewRequest("POST", "/api/report/estimate", strings.NewReader(`{"links_list": []}`))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestHandler_Simple_ReportHandler_WithContextCancellation(t *testing.T) {
+	handler, _, _ := setupSimpleTestHandler(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	requestBody := models.ReportRequest{
+		LinksList: []int{1},
+	}
+
+	jsonData, err := json.Marshal(requestBody)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("POST", "/api/report", bytes.NewBuffer(jsonData))
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.ReportHandler(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestHandler_Simple_HostsHandler(t *testing.T) {
+	handler, _, db := setupSimpleTestHandler(t)
+	ctx := context.Background()
+
+	err := db.CreateBatch(ctx, 1, models.BatchStatusCompleted, time.Now())
+	require.NoError(t, err)
+
+	now := time.Now()
+	for _, link := range []string{"http://a.com", "http://b.com", "http://c.com"} {
+		_, err := db.CreateLink(ctx, link, models.StatusAvailable, 1, &now)
+		require.NoError(t, err)
+	}
+
+	router := handler.SetupRoutes()
+
+	req := httptest.NewRequest("GET", "/api/hosts?limit=2&offset=1", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response models.HostsResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, 3, response.Total)
+	assert.Equal(t, 2, response.Limit)
+	assert.Equal(t, 1, response.Offset)
+	require.Len(t, response.Hosts, 2)
+	assert.Equal(t, "b.com", response.Hosts[0].Host)
+	assert.Equal(t, "c.com", response.Hosts[1].Host)
+
+	for _, query := range []string{"limit=0", "limit=abc", "offset=-1", "limit=100000"} {
+		req = httptest.NewRequest("GET", "/api/hosts?"+query, nil)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
+func TestHandler_Simple_CheckLinksHandler_JSONErrorDetails(t *testing.T) {
+	handler, _, _ := setupSimpleTestHandler(t)
+
+	tests := []struct {
+		name   string
+		body   string
+		field  string
+		offset bool
+	}{
+		{name: "syntax error", body: `{"links": ["a.com",]}`, offset: true},
+		{name: "type error", body: `{"links": "a.com"}`, field: "links", offset: true},
+		{name: "empty body", body: ``},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/check", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			handler.CheckLinksHandler(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+			var response models.ErrorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Contains(t, response.Error, "Invalid JSON")
+			assert.Equal(t, tt.field, response.Field)
+			if tt.offset {
+				assert.Greater(t, response.Offset, int64(0))
+			} else {
+				assert.Zero(t, response.Offset)
+			}
+		})
+	}
+}
+
+func TestHandler_Simple_ReportHandler_JSONTypeError(t *testing.T) {
+	handler, _, _ := setupSimpleTestHandler(t)
+
+	req := httptest.NewRequest("POST", "/api/report", strings.NewReader(`{"links_list": ["one"]}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.ReportHandler(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var response models.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.True(t, strings.HasPrefix(response.Field, "links_list"), response.Field)
+	assert.Contains(t, response.Error, "links_list")
+}
+
+func TestHandler_Simple_ReadinessHandler(t *testing.T) {
+	handler, checker, _ := setupSimpleTestHandler(t)
+	router := handler.SetupRoutes()
+
+	req := httptest.NewRequest("GET", "/api/health/ready", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var readiness models.Readiness
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &readiness))
+	assert.True(t, readiness.Ready)
+
+	checker.SetShutdown(true)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &readiness))
+	assert.False(t, readiness.Ready)
+	assert.True(t, readiness.Shutdown)
+}
+
+func TestHandler_Simple_BatchHandler(t *testing.T) {
+	handler, _, db := setupSimpleTestHandler(t)
+	router := handler.SetupRoutes()
+	ctx := context.Background()
+
+	now := time.Now()
+	require.NoError(t, db.CreateBatch(ctx, 1, models.BatchStatusCompleted, now))
+	_, err := db.CreateLink(ctx, "http://example.com", models.StatusAvailable, 1, &now)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("GET", "/api/batch/1", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response models.BatchStatusResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, 1, response.LinksNum)
+	require.Len(t, response.Links, 1)
+	assert.Equal(t, "http://example.com", response.Links[0].URL)
+	assert.False(t, response.Stale)
+
+	req = httptest.NewRequest("GET", "/api/batch/2", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	req = httptest.NewRequest("GET", "/api/batch/abc", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestHandler_Simple_BatchDeleteHandler(t *testing.T) {
+	handler, checker, db := setupSimpleTestHandler(t)
+	router := handler.SetupRoutes()
+	ctx := context.Background()
+
+	now := time.Now()
+	require.NoError(t, db.CreateBatch(ctx, 1, models.BatchStatusCompleted, now))
+	_, err := db.CreateLink(ctx, "http://example.com", models.StatusAvailable, 1, &now)
+	require.NoError(t, err)
+	require.NoError(t, db.CreateBatch(ctx, 2, models.BatchStatusProcessing, now))
+
+	req := httptest.NewRequest("DELETE", "/api/batch/1", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	links, err := db.GetLinksByBatchNum(ctx, 1)
+	require.NoError(t, err)
+	assert.Empty(t, links)
+
+	req = httptest.NewRequest("DELETE", "/api/batch/1", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	req = httptest.NewRequest("DELETE", "/api/batch/2", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	req = httptest.NewRequest("DELETE", "/api/batch/abc", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	checker.SetShutdown(true)
+	req = httptest.NewRequest("DELETE", "/api/batch/2", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func TestHandler_Simple_BatchHandler_OrderBy(t *testing.T) {
+	handler, _, db := setupSimpleTestHandler(t)
+	router := handler.SetupRoutes()
+	ctx := context.Background()
+
+	now := time.Now()
+	require.NoError(t, db.CreateBatch(ctx, 1, models.BatchStatusCompleted, now))
+	for _, link := range []string{"http://b.example", "http://a.example"} {
+		_, err := db.CreateLink(ctx, link, models.StatusAvailable, 1, &now)
+		require.NoError(t, err)
+	}
+
+	for order, expected := range map[string]string{"": "http://b.example", "url": "http://a.example"} {
+		req := httptest.NewRequest("GET", "/api/batch/1?order_by="+order, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response models.BatchStatusResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.Links, 2)
+		assert.Equal(t, expected, response.Links[0].URL, "order_by=%s", order)
+	}
+
+	req := httptest.NewRequest("GET", "/api/batch/1?order_by=size", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestHandler_Simple_BatchDetailsHandler(t *testing.T) {
+	handler, checker, _ := setupSimpleTestHandler(t)
+	router := handler.SetupRoutes()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	checked, err := checker.CheckLinks(context.Background(), []string{server.URL + "/a", server.URL + "/b"})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/api/batch/%d/details", checked.LinksNum), nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var raw []map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &raw))
+	require.Len(t, raw, 2)
+	// the check response only maps URLs to statuses
+	for _, field := range []string{"id", "url", "status", "batch_num", "time", "check_source", "host"} {
+		assert.Contains(t, raw[0], field)
+	}
+
+	var links []models.Link
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &links))
+	assert.Equal(t, server.URL+"/a", links[0].URL)
+	assert.NotZero(t, links[0].ID)
+	assert.NotEqual(t, links[0].ID, links[1].ID)
+	assert.Equal(t, checked.LinksNum, links[0].BatchNum)
+	assert.Equal(t, models.CheckSourceInitial, links[0].CheckSource)
+	require.NotNil(t, links[0].Time)
+
+	req = httptest.NewRequest("GET", "/api/batch/99/details", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandler_Simple_BatchRecheckHandler(t *testing.T) {
+	handler, _, db := setupSimpleTestHandler(t)
+	router := handler.SetupRoutes()
+	ctx := context.Background()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	earlier := time.Now().Add(-time.Hour)
+	require.NoError(t, db.CreateBatch(ctx, 1, models.BatchStatusCompleted, earlier))
+	_, err := db.CreateLink(ctx, server.URL, models.StatusNotAvailable, 1, &earlier)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("POST", "/api/batch/1/recheck", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response models.BatchStatusResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.Links, 1)
+	assert.Equal(t, models.StatusAvailable, response.Links[0].Status)
+	assert.Equal(t, models.CheckSourceRecheck, response.Links[0].CheckSource)
+	assert.True(t, response.Links[0].Time.After(earlier))
+
+	req = httptest.NewRequest("POST", "/api/batch/2/recheck", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	require.NoError(t, db.CreateBatch(ctx, 3, models.BatchStatusProcessing, time.Now()))
+	req = httptest.NewRequest("POST", "/api/batch/3/recheck", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestHandler_Simple_BatchesHandler(t *testing.T) {
+	handler, _, db := setupSimpleTestHandler(t)
+	router := handler.SetupRoutes()
+	ctx := context.Background()
+
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, db.CreateBatch(ctx, i, models.BatchStatusCompleted, time.Now()))
+	}
+
+	req := httptest.NewRequest("GET", "/api/batches?limit=2&offset=1", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response models.BatchesResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, 3, response.Total)
+	assert.Equal(t, 2, response.Limit)
+	require.Len(t, response.Batches, 2)
+	assert.Equal(t, 2, response.Batches[0].LinksNum)
+	assert.Equal(t, 1, response.Batches[1].LinksNum)
+
+	req = httptest.NewRequest("GET", "/api/batches", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, 50, response.Limit)
+	assert.Len(t, response.Batches, 3)
+
+	req = httptest.NewRequest("GET", "/api/batches?limit=0", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// batches submitted through the API are tagged with their source
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	req = httptest.NewRequest("POST", "/api/check", strings.NewReader(`{"links": ["`+server.URL+`"]}`))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	req = httptest.NewRequest("GET", "/api/batches?source=api", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var bySource models.BatchesResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &bySource))
+	assert.Equal(t, 1, bySource.Total)
+	require.Len(t, bySource.Batches, 1)
+	assert.Equal(t, 4, bySource.Batches[0].LinksNum)
+	assert.Equal(t, models.BatchSourceAPI, bySource.Batches[0].Source)
+
+	req = httptest.NewRequest("GET", "/api/batches?source=cron", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// a streamed listing has the same shape and isn't capped
+	req = httptest.NewRequest("GET", "/api/batches?stream=true&limit=1000&offset=1", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var streamed models.BatchesResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &streamed))
+	assert.Equal(t, 4, streamed.Total)
+	assert.Equal(t, 1000, streamed.Limit)
+	require.Len(t, streamed.Batches, 3)
+	assert.Equal(t, 3, streamed.Batches[0].LinksNum)
+}
+
+func TestHandler_Simple_CheckCSVHandler(t *testing.T) {
+	handler, _, db := setupSimpleTestHandler(t)
+	router := handler.SetupRoutes()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	body := "url,label\n" +
+		server.URL + "/a,first\n" +
+		",no url\n" +
+		server.URL + "/b,second\n"
+
+	req := httptest.NewRequest("POST", "/api/check/csv", strings.NewReader(body))
+	req.Header.Set("Content-Type", "text/csv")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response models.CSVCheckResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, 1, response.Skipped)
+	assert.Equal(t, map[string]string{
+		server.URL + "/a": string(models.StatusAvailable),
+		server.URL + "/b": string(models.StatusAvailable),
+	}, response.Links)
+
+	links, err := db.GetLinksByBatchNum(context.Background(), response.LinksNum)
+	require.NoError(t, err)
+	assert.Len(t, links, 2)
+
+	req = httptest.NewRequest("POST", "/api/check/csv", strings.NewReader("address\nhttp://a.example\n"))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestHandler_Simple_CheckCSVHandler_Method(t *testing.T) {
+	handler, _, _ := setupSimpleTestHandler(t)
+	router := handler.SetupRoutes()
+
+	var mu sync.Mutex
+	var methods []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		methods = append(methods, r.Method)
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	// semicolon-separated, while the server exports with commas
+	body := "url;method;label\n" +
+		server.URL + "/a;HEAD;first\n" +
+		server.URL + "/b;HEAD;second\n"
+
+	req := httptest.NewRequest("POST", "/api/check/csv", strings.NewReader(body))
+	req.Header.Set("Content-Type", "text/csv")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var response models.CSVCheckResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Zero(t, response.Skipped)
+	assert.Len(t, response.Links, 2)
+	assert.Equal(t, []string{"HEAD", "HEAD"}, methods)
+
+	req = httptest.NewRequest("POST", "/api/check/csv", strings.NewReader("url,method\n"+server.URL+"/a,HEAD\n"+server.URL+"/b,GET\n"))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestHandler_Simple_CheckCSVHandler_Multipart(t *testing.T) {
+	handler, _, _ := setupSimpleTestHandler(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", "links.csv")
+	require.NoError(t, err)
+	_, err = part.Write([]byte("url\n" + server.URL + "\n"))
+	require.NoError(t, err)
+	require.NoError(t, form.Close())
+
+	req := httptest.NewRequest("POST", "/api/check/csv", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	w := httptest.NewRecorder()
+	handler.CheckCSVHandler(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response models.CSVCheckResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, string(models.StatusAvailable), response.Links[server.URL])
+	assert.Zero(t, response.Skipped)
+}
+
+func TestHandler_Simple_CheckLinksHandler_InvalidExpiresIn(t *testing.T) {
+	handler, _, _ := setupSimpleTestHandler(t)
+
+	for _, body := range []string{
+		`{"links": ["example.com"], "expires_in": "soon"}`,
+		`{"links": ["example.com"], "expires_in": "-1h"}`,
+		`{"links": ["example.com"], "expires_in": "1h", "persist": false}`,
+	} {
+		req := httptest.NewRequest("POST", "/api/check", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+
+		handler.CheckLinksHandler(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+}
+
+func TestHandler_Simple_StatsTimeseriesHandler(t *testing.T) {
+	handler, _, db := setupSimpleTestHandler(t)
+	ctx := context.Background()
+
+	require.NoError(t, db.CreateBatch(ctx, 1, models.BatchStatusCompleted, time.Now()))
+
+	base := time.Date(2025, 12, 7, 12, 0, 0, 0, time.UTC)
+	seed := []struct {
+		at     time.Time
+		status models.LinkStatus
+	}{
+		{base.Add(10 * time.Minute), models.StatusAvailable},
+		{base.Add(50 * time.Minute), models.StatusAvailable},
+		{base.Add(55 * time.Minute), models.StatusNotAvailable},
+		// stored with another offset, still in the third hour
+		{base.Add(2*time.Hour + 5*time.Minute).In(time.FixedZone("UTC+3", 3*60*60)), models.StatusNotAvailable},
+		// outside the range
+		{base.Add(-time.Minute), models.StatusAvailable},
+		{base.Add(3 * time.Hour), models.StatusAvailable},
+	}
+	for _, s := range seed {
+		at := s.at
+		_, err := db.CreateLink(ctx, "http://a.com", s.status, 1, &at)
+		require.NoError(t, err)
+	}
+	_, err := db.CreateLink(ctx, "http://b.com", models.StatusProcessing, 1, nil)
+	require.NoError(t, err)
+
+	router := handler.SetupRoutes()
+
+	req := httptest.NewRequest("GET", "/api/stats/timeseries?from=2025-12-07T12:30:00Z&to=2025-12-07T15:00:00Z&bucket=1h", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var response models.StatsTimeseries
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.True(t, base.Equal(response.From))
+	assert.Equal(t, "1h0m0s", response.Bucket)
+	require.Len(t, response.Buckets, 3)
+	assert.True(t, base.Equal(response.Buckets[0].Start))
+	assert.Equal(t, 2, response.Buckets[0].Available)
+	assert.Equal(t, 1, response.Buckets[0].Broken)
+	assert.True(t, base.Add(time.Hour).Equal(response.Buckets[1].Start))
+	assert.Zero(t, response.Buckets[1].Available)
+	assert.Zero(t, response.Buckets[1].Broken)
+	assert.Zero(t, response.Buckets[2].Available)
+	assert.Equal(t, 1, response.Buckets[2].Broken)
+
+	for _, query := range []string{
+		"from=yesterday",
+		"to=2025-12-07",
+		"bucket=0s",
+		"bucket=1500ms",
+		"from=2025-12-07T15:00:00Z&to=2025-12-07T12:00:00Z",
+		"from=2025-01-01T00:00:00Z&to=2025-12-07T00:00:00Z&bucket=1m",
+		// longer than a Duration can hold
+		"from=0001-01-01T00:00:00Z&to=2025-12-07T00:00:00Z&bucket=1h",
+		"from=0001-01-01T00:00:00Z&to=2025-12-07T00:00:00Z&bucket=1s",
+	} {
+		req = httptest.NewRequest("GET", "/api/stats/timeseries?"+query, nil)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
+func TestHandler_Simple_StatsHandler(t *testing.T) {
+	handler, _, db := setupSimpleTestHandler(t)
+	ctx := context.Background()
+
+	require.NoError(t, db.CreateBatch(ctx, 1, models.BatchStatusCompleted, time.Now()))
+
+	now := time.Now()
+	seed := map[string]int{"http://alpha.com": 1, "http://beta.org": 3, "http://gamma.net": 2, "http://delta.io": 2}
+	for url, broken := range seed {
+		for i := 0; i < broken; i++ {
+			_, err := db.CreateLink(ctx, url, models.StatusNotAvailable, 1, &now)
+			require.NoError(t, err)
+		}
+		// available links don't count towards a host's broken links
+		_, err := db.CreateLink(ctx, url, models.StatusAvailable, 1, &now)
+		require.NoError(t, err)
+	}
+	_, err := db.CreateLink(ctx, "http://epsilon.dev", models.StatusAvailable, 1, &now)
+	require.NoError(t, err)
+
+	router := handler.SetupRoutes()
+
+	req := httptest.NewRequest("GET", "/api/stats?top=3", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var response models.StatsResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, 3, response.Top)
+	assert.Equal(t, []models.HostBrokenCount{
+		{Host: "beta.org", Broken: 3},
+		{Host: "delta.io", Broken: 2},
+		{Host: "gamma.net", Broken: 2},
+	}, response.TopBrokenHosts)
+
+	req = httptest.NewRequest("GET", "/api/stats", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, 10, response.Top)
+	assert.Len(t, response.TopBrokenHosts, 4)
+
+	for _, query := range []string{"top=0", "top=-1", "top=abc", "top=101"} {
+		req = httptest.NewRequest("GET", "/api/stats?"+query, nil)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
+func TestHandler_Simple_LinkPatchHandler(t *testing.T) {
+	handler, _, db := setupSimpleTestHandler(t)
+	router := handler.SetupRoutes()
+	ctx := context.Background()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(server.Close)
+
+	earlier := time.Now().Add(-time.Hour)
+	require.NoError(t, db.CreateBatch(ctx, 1, models.BatchStatusCompleted, earlier))
+	linkID, err := db.CreateLink(ctx, server.URL, models.StatusNotAvailable, 1, &earlier)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("PATCH", fmt.Sprintf("/api/link/%d", linkID), strings.NewReader(`{"notes": "vendor migration in progress"}`))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var link models.Link
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &link))
+	assert.Equal(t, linkID, link.ID)
+	assert.Equal(t, "vendor migration in progress", link.Notes)
+
+	// a recheck updates the result but keeps the notes
+	req = httptest.NewRequest("POST", "/api/batch/1/recheck", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	req = httptest.NewRequest("GET", "/api/batch/1", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response models.BatchStatusResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.Links, 1)
+	assert.Equal(t, models.CheckSourceRecheck, response.Links[0].CheckSource)
+	assert.Equal(t, "vendor migration in progress", response.Links[0].Notes)
+
+	req = httptest.NewRequest("PATCH", fmt.Sprintf("/api/link/%d", linkID), strings.NewReader(`{"notes": ""}`))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var cleared models.Link
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &cleared))
+	assert.Empty(t, cleared.Notes)
+
+	tests := []struct {
+		path string
+		body string
+		code int
+	}{
+		{"/api/link/999", `{"notes": "x"}`, http.StatusNotFound},
+		{"/api/link/abc", `{"notes": "x"}`, http.StatusBadRequest},
+		{fmt.Sprintf("/api/link/%d", linkID), `{}`, http.StatusBadRequest},
+		{fmt.Sprintf("/api/link/%d", linkID), `{"notes": "` + strings.Repeat("x", service.MaxLinkNotesLength+1) + `"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		req = httptest.NewRequest("PATCH", tt.path, strings.NewReader(tt.body))
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, tt.code, w.Code, tt.path)
+	}
+}
+
+func TestHandler_Simple_LinkHandler(t *testing.T) {
+	handler, _, db := setupSimpleTestHandler(t)
+	router := handler.SetupRoutes()
+	ctx := context.Background()
+
+	now := time.Now()
+	require.NoError(t, db.CreateBatch(ctx, 1, models.BatchStatusCompleted, now))
+	linkID, err := db.CreateLink(ctx, "https://example.com", models.StatusAvailable, 1, &now)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/api/link/%d", linkID), nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var link models.Link
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &link))
+	assert.Equal(t, linkID, link.ID)
+	assert.Equal(t, "https://example.com", link.URL)
+	assert.NotContains(t, w.Body.String(), `"debug"`)
+
+	for path, code := range map[string]int{"/api/link/999": http.StatusNotFound, "/api/link/abc": http.StatusBadRequest} {
+		req = httptest.NewRequest("GET", path, nil)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, code, w.Code, path)
+	}
+}
+
+func TestHandler_Simple_ReportHandler_Stream(t *testing.T) {
+	handler, _, db := setupSimpleTestHandler(t)
+	router := handler.SetupRoutes()
+	ctx := context.Background()
+
+	now := time.Now()
+	require.NoError(t, db.CreateBatch(ctx, 1, models.BatchStatusCompleted, now))
+	_, err := db.CreateLink(ctx, "http://a.example", models.StatusAvailable, 1, &now)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("POST", "/api/report", strings.NewReader(`{"links_list": [1, 2], "format": "json", "stream": true}`))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.True(t, w.Flushed)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Equal(t, "2", w.Header().Get("X-Missing-Batches"))
+	assert.True(t, json.Valid(w.Body.Bytes()))
+	assert.Contains(t, w.Body.String(), "http://a.example")
+
+	req = httptest.NewRequest("POST", "/api/report", strings.NewReader(`{"links_list": [1], "format": "pdf", "stream": true}`))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	req = httptest.NewRequest("POST", "/api/report", strings.NewReader(`{"links_list": [99], "format": "html", "stream": true}`))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Empty(t, w.Header().Get("Content-Disposition"))
 }
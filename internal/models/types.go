@@ -3,16 +3,207 @@ package models
 import "time"
 
 type CheckRequest struct {
-	Links []string `json:"links"`
+	Links        []string `json:"links"`
+	RetryCount   int      `json:"retry_count,omitempty"`
+	RetryDelayMs int64    `json:"retry_delay_ms,omitempty"`
+	TimeoutMs    int64    `json:"timeout_ms,omitempty"`
+
+	// TimeoutSeconds is timeout_ms in whole seconds. Zero or negative values
+	// leave the service default; timeout_ms takes precedence when both are set.
+	TimeoutSeconds int64 `json:"timeout_seconds,omitempty"`
+
+	Persist      *bool    `json:"persist,omitempty"`
+	Methods      []string `json:"methods,omitempty"`
+	MethodPolicy string   `json:"method_policy,omitempty"`
+
+	DisableKeepAlive bool   `json:"disable_keep_alive,omitempty"`
+	CorrectSchemes   bool   `json:"correct_schemes,omitempty"`
+	ServerName       string `json:"server_name,omitempty"`
+	DiscoverMethods  bool   `json:"discover_methods,omitempty"`
+	ExpiresIn        string `json:"expires_in,omitempty"`
+
+	// Profile selects a configured bundle of check settings. Settings given
+	// in the request take precedence over the profile's.
+	Profile string `json:"profile,omitempty"`
+
+	// Dedup checks links that are the same resource only once: "full"
+	// compares whole URLs, "ignore-query" ignores their query strings.
+	Dedup string `json:"dedup,omitempty"`
+
+	// Cookies are sent with every request of the batch. They are not stored.
+	Cookies []Cookie `json:"cookies,omitempty"`
+
+	// Priority orders async batches waiting to be checked, higher first.
+	Priority int `json:"priority,omitempty"`
+}
+
+// LinkPatchRequest changes the operator-editable fields of a link. Omitted
+// fields are left as they are.
+type LinkPatchRequest struct {
+	Notes *string `json:"notes"`
 }
 
+// Cookie is a name/value pair sent with checks, such as a session cookie.
+type Cookie struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// CheckResponse carries the batch number twice: batch_num is the clearer
+// name, links_num is kept for existing clients.
 type CheckResponse struct {
-	Links    map[string]string `json:"links"`
-	LinksNum int               `json:"links_num"`
+	Links    map[string]string                `json:"links"`
+	LinksNum int                              `json:"links_num"`
+	BatchNum int                              `json:"batch_num"`
+	Methods  map[string]map[string]LinkStatus `json:"methods,omitempty"`
+	Invalid  []InvalidLink                    `json:"invalid,omitempty"`
+
+	// Status is set for async checks, which return before the links are
+	// checked: the batch is processing and its links are polled with
+	// GET /api/batch/{id}.
+	Status BatchStatus `json:"status,omitempty"`
+
+	// Corrected maps submitted links to the form they were checked as when
+	// scheme correction was requested.
+	Corrected map[string]string `json:"corrected,omitempty"`
+
+	// Allow maps links to the Allow header they answered an OPTIONS request
+	// with when method discovery was requested.
+	Allow map[string]string `json:"allow,omitempty"`
+
+	// UserAgents maps links that refused the default user agent to the
+	// fallback agent they were checked with.
+	UserAgents map[string]string `json:"user_agents,omitempty"`
+
+	// Duplicates maps links dropped by de-duplication to the link they were
+	// checked as.
+	Duplicates map[string]string `json:"duplicates,omitempty"`
+}
+
+// CSVCheckResponse is the result of a CSV upload, with the number of rows
+// that were skipped as malformed.
+type CSVCheckResponse struct {
+	CheckResponse
+	Skipped int `json:"skipped"`
+}
+
+// InvalidLink is a submitted link that was rejected without being checked.
+type InvalidLink struct {
+	URL    string `json:"url"`
+	Reason string `json:"reason"`
 }
 
 type ReportRequest struct {
-	LinksList []int `json:"links_list"`
+	LinksList []int  `json:"links_list"`
+	Format    string `json:"format,omitempty"`
+
+	// Stream sends json and html reports batch by batch as they render
+	// instead of all at once.
+	Stream bool `json:"stream,omitempty"`
+
+	// DeadlineMs waits up to this long for processing batches to finish
+	// before the report is rendered. Links still unchecked by then are
+	// reported as processing.
+	DeadlineMs int `json:"deadline_ms,omitempty"`
+
+	// GroupBy lists the links of each batch in groups: status_class groups
+	// them by the class of their status code.
+	GroupBy string `json:"group_by,omitempty"`
+
+	// Delimiter and BOM encode a csv report differently from the server's
+	// configured CSV encoding.
+	Delimiter string `json:"delimiter,omitempty"`
+	BOM       *bool  `json:"bom,omitempty"`
+}
+
+// ReportGrouping decides how a report groups the links of each batch. Empty
+// lists them ungrouped.
+type ReportGrouping string
+
+const ReportGroupByStatusClass ReportGrouping = "status_class"
+
+// StatusClassGroup is the links of a batch in a report whose status codes
+// share a class, such as 2xx, or error for links that got no response.
+type StatusClassGroup struct {
+	StatusClass string  `json:"status_class"`
+	Count       int     `json:"count"`
+	Links       []*Link `json:"links"`
+}
+
+// ReportSummary counts the links of a batch in a report by status. Errors
+// count as not available.
+type ReportSummary struct {
+	Total        int `json:"total"`
+	Available    int `json:"available"`
+	NotAvailable int `json:"not_available"`
+	Processing   int `json:"processing,omitempty"`
+}
+
+// ShutdownStats is the work still pending when shutdown started.
+type ShutdownStats struct {
+	InFlightBatches int       `json:"in_flight_batches"`
+	ProcessingLinks int       `json:"processing_links"`
+	ActiveChecks    int64     `json:"active_checks"`
+	QueuedPDFTasks  int       `json:"queued_pdf_tasks"`
+	At              time.Time `json:"at"`
+}
+
+// MetricsSnapshot is the service's counters and gauges, read one after another,
+// for dashboards that don't scrape /metrics.
+type MetricsSnapshot struct {
+	At                   time.Time `json:"at"`
+	ChecksTotal          int64     `json:"checks_total"`
+	ActiveChecks         int64     `json:"active_checks"`
+	BatchesTotal         int64     `json:"batches_total"`
+	QueuedBatches        int       `json:"queued_batches"`
+	QueuedPDFTasks       int       `json:"queued_pdf_tasks"`
+	ActivePDFGenerations int64     `json:"active_pdf_generations"`
+	RequestsTotal        int64     `json:"requests_total"`
+	AvgResponseTimeMs    float64   `json:"avg_response_time_ms"`
+}
+
+// StatsBucket counts the link checks that finished within one time window.
+type StatsBucket struct {
+	Start     time.Time `json:"start"`
+	Available int       `json:"available"`
+	Broken    int       `json:"broken"`
+}
+
+// StatsTimeseries is link availability over time, one bucket per window from
+// From up to To.
+type StatsTimeseries struct {
+	From    time.Time     `json:"from"`
+	To      time.Time     `json:"to"`
+	Bucket  string        `json:"bucket"`
+	Buckets []StatsBucket `json:"buckets"`
+}
+
+// HostBrokenCount is the number of links of a host whose latest check found
+// them not available.
+type HostBrokenCount struct {
+	Host   string `json:"host"`
+	Broken int    `json:"broken"`
+}
+
+// StatsResponse lists the Top hosts with the most broken links, most broken
+// first.
+type StatsResponse struct {
+	Top            int               `json:"top"`
+	TopBrokenHosts []HostBrokenCount `json:"top_broken_hosts"`
+}
+
+// ReportEstimate describes the report a ReportRequest would produce.
+type ReportEstimate struct {
+	BatchCount int   `json:"batch_count"`
+	LinkCount  int   `json:"link_count"`
+	PageCount  int   `json:"page_count"`
+	Missing    []int `json:"missing,omitempty"`
+}
+
+type ErrorResponse struct {
+	Error  string `json:"error"`
+	Offset int64  `json:"offset,omitempty"`
+	Field  string `json:"field,omitempty"`
 }
 
 type LinkStatus string
@@ -21,6 +212,36 @@ const (
 	StatusAvailable    LinkStatus = "available"
 	StatusNotAvailable LinkStatus = "not available"
 	StatusProcessing   LinkStatus = "processing"
+	StatusError        LinkStatus = "error"
+)
+
+// MethodPolicy decides how the results of a link checked with several HTTP
+// methods combine into its status.
+type MethodPolicy string
+
+const (
+	MethodPolicyAll MethodPolicy = "all"
+	MethodPolicyAny MethodPolicy = "any"
+)
+
+// DedupMode decides which submitted links count as the same resource and
+// are checked only once.
+type DedupMode string
+
+const (
+	DedupFull        DedupMode = "full"
+	DedupIgnoreQuery DedupMode = "ignore-query"
+)
+
+// LinkOrder is the order links of a batch are listed in. The empty order is
+// by ID, the order they were submitted in.
+type LinkOrder string
+
+const (
+	LinkOrderID     LinkOrder = "id"
+	LinkOrderStatus LinkOrder = "status"
+	LinkOrderURL    LinkOrder = "url"
+	LinkOrderTime   LinkOrder = "time"
 )
 
 type BatchStatus string
@@ -29,18 +250,173 @@ const (
 	BatchStatusProcessing BatchStatus = "processing"
 	BatchStatusCompleted  BatchStatus = "completed"
 	BatchStatusFailed     BatchStatus = "failed"
+
+	// BatchStatusDegraded is a completed batch whose share of available
+	// links fell below the configured minimum success ratio.
+	BatchStatusDegraded BatchStatus = "completed_degraded"
+)
+
+// BatchSource records the entry point that submitted a batch.
+type BatchSource string
+
+const (
+	BatchSourceAPI       BatchSource = "api"
+	BatchSourceCLI       BatchSource = "cli"
+	BatchSourceScheduled BatchSource = "scheduled"
+)
+
+// CheckSource records what triggered the check that produced a link's status.
+type CheckSource string
+
+const (
+	CheckSourceInitial   CheckSource = "initial"
+	CheckSourceScheduled CheckSource = "scheduled"
+	CheckSourceRetry     CheckSource = "retry"
+	CheckSourceOverride  CheckSource = "override"
+	CheckSourceRecheck   CheckSource = "recheck"
 )
 
+const EventLinkStatusChanged = "link.status_changed"
+
+// LinkStatusChange is the event sent to the change webhook when a re-check
+// changes the status of a link.
+type LinkStatusChange struct {
+	Event       string      `json:"event"`
+	LinkID      int         `json:"link_id"`
+	URL         string      `json:"url"`
+	BatchNum    int         `json:"batch_num"`
+	OldStatus   LinkStatus  `json:"old_status"`
+	NewStatus   LinkStatus  `json:"new_status"`
+	CheckSource CheckSource `json:"check_source"`
+	ChangedAt   time.Time   `json:"changed_at"`
+}
+
 type Link struct {
-	ID       int        `json:"id"`
-	URL      string     `json:"url"`
-	Status   LinkStatus `json:"status"`
-	BatchNum int        `json:"batch_num"`
-	Time     *time.Time `json:"time"`
+	ID          int         `json:"id"`
+	URL         string      `json:"url"`
+	Status      LinkStatus  `json:"status"`
+	BatchNum    int         `json:"batch_num"`
+	Time        *time.Time  `json:"time"`
+	CheckSource CheckSource `json:"check_source,omitempty"`
+	Host        string      `json:"host,omitempty"`
+	Error       string      `json:"error,omitempty"`
+	Allow       string      `json:"allow,omitempty"`
+	Notes       string      `json:"notes,omitempty"`
+	UserAgent   string      `json:"user_agent,omitempty"`
+
+	// StatusCode is the HTTP status code of the latest check, or 0 when no
+	// response was received, e.g. on a timeout.
+	StatusCode int `json:"status_code,omitempty"`
+
+	// StatusText is the status line of the response StatusCode came from,
+	// e.g. "404 Not Found", with the reason phrase the server sent.
+	StatusText string `json:"status_text,omitempty"`
+
+	// ResponseTimeMs is how long the latest check took to get a response, or to
+	// fail, in milliseconds.
+	ResponseTimeMs int64 `json:"response_time_ms,omitempty"`
+
+	// Debug is the request and response of the latest check, stored when
+	// debug metadata is enabled. It is only read for a single link.
+	Debug *LinkDebug `json:"debug,omitempty"`
+
+	// Methods holds per-method results of the latest check when the batch
+	// was submitted with several methods.
+	Methods map[string]LinkStatus `json:"methods,omitempty"`
 }
 
+// LinkDebug records an HTTP exchange of a check. Credentials and cookies are
+// redacted. Truncated exchanges keep only the request line and status.
+type LinkDebug struct {
+	Method          string              `json:"method"`
+	URL             string              `json:"url"`
+	RequestHeaders  map[string][]string `json:"request_headers,omitempty"`
+	Status          string              `json:"status,omitempty"`
+	ResponseHeaders map[string][]string `json:"response_headers,omitempty"`
+	Error           string              `json:"error,omitempty"`
+	Truncated       bool                `json:"truncated,omitempty"`
+}
+
+// Batch.BatchNum mirrors LinksNum under the clearer name; it is filled in
+// when a batch is read from the database.
 type Batch struct {
-	LinksNum  int         `json:"links_num"`
-	Status    BatchStatus `json:"status"`
-	CreatedAt time.Time   `json:"created_at"`
+	LinksNum       int          `json:"links_num"`
+	BatchNum       int          `json:"batch_num"`
+	Status         BatchStatus  `json:"status"`
+	CreatedAt      time.Time    `json:"created_at"`
+	Checksum       string       `json:"checksum,omitempty"`
+	IdempotencyKey string       `json:"-"`
+	RetryCount     int          `json:"retry_count,omitempty"`
+	RetryDelayMs   int64        `json:"retry_delay_ms,omitempty"`
+	RetriesDone    int          `json:"retries_done,omitempty"`
+	NextRetryAt    *time.Time   `json:"next_retry_at,omitempty"`
+	TimeoutMs      int64        `json:"timeout_ms,omitempty"`
+	LinkCount      int          `json:"link_count"`
+	Methods        []string     `json:"methods,omitempty"`
+	MethodPolicy   MethodPolicy `json:"method_policy,omitempty"`
+
+	DisableKeepAlive bool   `json:"disable_keep_alive,omitempty"`
+	ServerName       string `json:"server_name,omitempty"`
+	DiscoverMethods  bool   `json:"discover_methods,omitempty"`
+
+	// ExpiresAt is when the batch is deleted automatically, if the client
+	// submitted it with expires_in.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	// Source is the entry point that submitted the batch. Batches created
+	// before sources were recorded have none.
+	Source BatchSource `json:"source,omitempty"`
+
+	// Profile is the check profile the batch was submitted with.
+	Profile string `json:"profile,omitempty"`
+
+	// Dedup is the mode duplicate links were merged under, if any.
+	Dedup DedupMode `json:"dedup,omitempty"`
+
+	// HadCookies is set when the batch was checked with client cookies, so
+	// its results may only be visible to that session.
+	HadCookies bool `json:"-"`
+}
+
+// BatchStatusResponse is a batch with its links. Stale is set when a link
+// result is older than the configured result TTL. Schemes counts the links
+// per scheme, with links without a scheme counted as http.
+type BatchStatusResponse struct {
+	Batch
+	Links   []*Link        `json:"links"`
+	Stale   bool           `json:"stale"`
+	Schemes map[string]int `json:"schemes"`
+}
+
+type BatchesResponse struct {
+	Batches []*Batch `json:"batches"`
+	Total   int      `json:"total"`
+	Limit   int      `json:"limit"`
+	Offset  int      `json:"offset"`
+}
+
+type HostSummary struct {
+	Host         string     `json:"host"`
+	LatestStatus LinkStatus `json:"latest_status"`
+	LastChecked  *time.Time `json:"last_checked"`
+	CheckCount   int        `json:"check_count"`
+}
+
+type HostsResponse struct {
+	Hosts  []HostSummary `json:"hosts"`
+	Total  int           `json:"total"`
+	Limit  int           `json:"limit"`
+	Offset int           `json:"offset"`
+}
+
+type DependencyStatus struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+	Error   string `json:"error,omitempty"`
+}
+
+type Readiness struct {
+	Ready    bool               `json:"ready"`
+	Shutdown bool               `json:"shutdown"`
+	Checks   []DependencyStatus `json:"checks"`
 }
@@ -0,0 +1,177 @@
+package service
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"url-checker/internal/models"
+)
+
+// DefaultBatchQueueSize is how many async batches may wait for the batch
+// worker.
+const DefaultBatchQueueSize = 100
+
+// ErrBatchQueueFull is returned for an async submission while the batch
+// worker has DefaultBatchQueueSize batches waiting.
+var ErrBatchQueueFull = errors.New("batch queue is full")
+
+// batchTask is an async batch whose links are stored but not checked yet.
+type batchTask struct {
+	batch      *models.Batch
+	links      []string
+	linkIDs    []int
+	retryDelay time.Duration
+	priority   int
+
+	// seq orders tasks of the same priority by submission.
+	seq uint64
+}
+
+// batchTaskHeap orders tasks by descending priority, then by submission.
+type batchTaskHeap []*batchTask
+
+func (tasks batchTaskHeap) Len() int { return len(tasks) }
+
+func (tasks batchTaskHeap) Less(i, j int) bool {
+	if tasks[i].priority != tasks[j].priority {
+		return tasks[i].priority > tasks[j].priority
+	}
+	return tasks[i].seq < tasks[j].seq
+}
+
+func (tasks batchTaskHeap) Swap(i, j int) { tasks[i], tasks[j] = tasks[j], tasks[i] }
+
+func (tasks *batchTaskHeap) Push(x any) { *tasks = append(*tasks, x.(*batchTask)) }
+
+func (tasks *batchTaskHeap) Pop() any {
+	old := *tasks
+	task := old[len(old)-1]
+	old[len(old)-1] = nil
+	*tasks = old[:len(old)-1]
+	return task
+}
+
+// batchQueue holds async batches waiting for the batch worker, handing out
+// the highest priority one first.
+type batchQueue struct {
+	mu    sync.Mutex
+	tasks batchTaskHeap
+	size  int
+	seq   uint64
+
+	// ready is signalled when a task is pushed.
+	ready chan struct{}
+}
+
+func newBatchQueue(size int) *batchQueue {
+	return &batchQueue{size: size, ready: make(chan struct{}, 1)}
+}
+
+// push queues a task, reporting false when the queue is full.
+func (queue *batchQueue) push(task *batchTask) bool {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+
+	if len(queue.tasks) >= queue.size {
+		return false
+	}
+	queue.seq++
+	task.seq = queue.seq
+	heap.Push(&queue.tasks, task)
+
+	select {
+	case queue.ready <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// pop removes the next task, or returns nil when the queue is empty.
+func (queue *batchQueue) pop() *batchTask {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+
+	if len(queue.tasks) == 0 {
+		return nil
+	}
+	return heap.Pop(&queue.tasks).(*batchTask)
+}
+
+func (queue *batchQueue) len() int {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	return len(queue.tasks)
+}
+
+// StartBatchWorker checks the links of async batches one batch at a time,
+// highest priority first and in the order they were submitted otherwise.
+func (urlchecker *URLChecker) StartBatchWorker(ctx context.Context) {
+	for {
+		for task := urlchecker.pendingBatches.pop(); task != nil; task = urlchecker.pendingBatches.pop() {
+			if ctx.Err() != nil {
+				break
+			}
+			urlchecker.processBatchTask(ctx, task)
+		}
+
+		select {
+		case <-ctx.Done():
+			urlchecker.logger.Info("Batch worker shutting down...")
+			return
+		case <-urlchecker.pendingBatches.ready:
+		}
+	}
+}
+
+func (urlchecker *URLChecker) processBatchTask(ctx context.Context, task *batchTask) {
+	batchNum := task.batch.LinksNum
+	if _, err := urlchecker.checkBatchLinks(ctx, task.links, task.linkIDs, task.batch); err != nil {
+		urlchecker.logger.Errorf("Failed to process links of batch %d: %v", batchNum, err)
+		// the worker context is cancelled on shutdown
+		urlchecker.db.UpdateBatchStatus(context.WithoutCancel(ctx), batchNum, models.BatchStatusFailed)
+		return
+	}
+
+	urlchecker.scheduleRetries(ctx, task.batch, task.retryDelay)
+}
+
+// enqueueBatch queues a new batch, stored along with its links, for the
+// batch worker, returning the links as processing.
+func (urlchecker *URLChecker) enqueueBatch(ctx context.Context, links []string, linkIDs []int, batch *models.Batch, opts CheckOptions) (models.CheckResponse, error) {
+	batchNum := batch.LinksNum
+
+	task := &batchTask{batch: batch, links: links, linkIDs: linkIDs, retryDelay: opts.RetryDelay, priority: opts.Priority}
+	if !urlchecker.pendingBatches.push(task) {
+		urlchecker.db.UpdateBatchStatus(context.WithoutCancel(ctx), batchNum, models.BatchStatusFailed)
+		return models.CheckResponse{}, ErrBatchQueueFull
+	}
+	urlchecker.logger.Infof("Queued batch %d with %d links at priority %d", batchNum, len(links), opts.Priority)
+
+	resultLinks := make(map[string]string, len(links))
+	for _, link := range links {
+		resultLinks[link] = string(models.StatusProcessing)
+	}
+
+	return models.CheckResponse{
+		Links:    resultLinks,
+		LinksNum: batchNum,
+		BatchNum: batchNum,
+		Status:   models.BatchStatusProcessing,
+	}, nil
+}
+
+// scheduleRetries sets when the background retries of a checked batch
+// start, if it was submitted with a retry policy.
+func (urlchecker *URLChecker) scheduleRetries(ctx context.Context, batch *models.Batch, retryDelay time.Duration) {
+	if batch.RetryCount <= 0 {
+		return
+	}
+
+	nextRetryAt := urlchecker.clock.Now().Add(retryDelay)
+	if err := urlchecker.db.UpdateBatchRetry(ctx, batch.LinksNum, 0, &nextRetryAt); err != nil {
+		urlchecker.logger.Errorf("Failed to schedule retries for batch %d: %v", batch.LinksNum, err)
+	}
+}
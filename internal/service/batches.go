@@ -0,0 +1,334 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"url-checker/internal/database"
+	"url-checker/internal/models"
+)
+
+var (
+	ErrBatchNotFound = database.ErrBatchNotFound
+
+	// ErrBatchProcessing is returned when a batch can't be changed because
+	// its initial check is still running.
+	ErrBatchProcessing = errors.New("batch is still processing")
+)
+
+// ParseLinkOrder validates a link order name. An empty name is allowed and
+// means ID order.
+func ParseLinkOrder(value string) (models.LinkOrder, error) {
+	switch order := models.LinkOrder(strings.ToLower(strings.TrimSpace(value))); order {
+	case "", models.LinkOrderID, models.LinkOrderStatus, models.LinkOrderURL, models.LinkOrderTime:
+		return order, nil
+	default:
+		return "", fmt.Errorf("unknown order %q, expected id, status, url or time", value)
+	}
+}
+
+// GetBatchStatus returns a batch with its links in the given order, flagged
+// stale when a result is older than the configured result TTL.
+func (urlchecker *URLChecker) GetBatchStatus(ctx context.Context, batchNum int, order models.LinkOrder) (models.BatchStatusResponse, error) {
+	if err := urlchecker.acquireReadSlot(ctx); err != nil {
+		return models.BatchStatusResponse{}, err
+	}
+	defer urlchecker.releaseReadSlot()
+
+	batch, err := urlchecker.db.GetBatch(ctx, batchNum)
+	if err != nil {
+		if errors.Is(err, database.ErrBatchNotFound) {
+			return models.BatchStatusResponse{}, err
+		}
+		return models.BatchStatusResponse{}, fmt.Errorf("failed to get batch: %w", err)
+	}
+
+	links, err := urlchecker.db.GetLinksByBatchNumOrdered(ctx, batchNum, order)
+	if err != nil {
+		return models.BatchStatusResponse{}, fmt.Errorf("failed to get batch links: %w", err)
+	}
+
+	return models.BatchStatusResponse{
+		Batch:   *batch,
+		Links:   links,
+		Stale:   isStale(links, urlchecker.resultTTL, urlchecker.clock.Now()),
+		Schemes: schemeCounts(links),
+	}, nil
+}
+
+// GetBatchLinks returns the stored link rows of a batch.
+func (urlchecker *URLChecker) GetBatchLinks(ctx context.Context, batchNum int) ([]*models.Link, error) {
+	if err := urlchecker.acquireReadSlot(ctx); err != nil {
+		return nil, err
+	}
+	defer urlchecker.releaseReadSlot()
+
+	if _, err := urlchecker.db.GetBatch(ctx, batchNum); err != nil {
+		if errors.Is(err, database.ErrBatchNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to get batch: %w", err)
+	}
+
+	links, err := urlchecker.db.GetLinksByBatchNum(ctx, batchNum)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get batch links: %w", err)
+	}
+	if links == nil {
+		links = []*models.Link{}
+	}
+
+	return links, nil
+}
+
+// RecheckBatch checks every link of a finished batch again and updates the
+// stored results in place, without creating a new batch. Links keep their
+// previous status until their new result is stored.
+func (urlchecker *URLChecker) RecheckBatch(ctx context.Context, batchNum int) (models.BatchStatusResponse, error) {
+	if urlchecker.IsShutdown() {
+		return models.BatchStatusResponse{}, fmt.Errorf("service is shutting down")
+	}
+
+	// the slot covers the reads only, not the checks that follow
+	var batch *models.Batch
+	var links []*models.Link
+	err := urlchecker.withReadSlot(ctx, func() error {
+		var err error
+		batch, err = urlchecker.db.GetBatch(ctx, batchNum)
+		if err != nil {
+			if errors.Is(err, database.ErrBatchNotFound) {
+				return err
+			}
+			return fmt.Errorf("failed to get batch: %w", err)
+		}
+
+		if batch.Status == models.BatchStatusProcessing {
+			return ErrBatchProcessing
+		}
+
+		links, err = urlchecker.db.GetLinksByBatchNum(ctx, batchNum)
+		if err != nil {
+			return fmt.Errorf("failed to get batch links: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return models.BatchStatusResponse{}, err
+	}
+
+	urlchecker.logger.Infof("Rechecking %d links of batch %d", len(links), batchNum)
+	urlchecker.recheckLinks(ctx, links, models.CheckSourceRecheck, urlchecker.batchCheckSpec(batch))
+	if err := ctx.Err(); err != nil {
+		return models.BatchStatusResponse{}, err
+	}
+	urlchecker.refreshCompletedStatus(ctx, batch, links)
+
+	return models.BatchStatusResponse{
+		Batch:   *batch,
+		Links:   links,
+		Stale:   isStale(links, urlchecker.resultTTL, urlchecker.clock.Now()),
+		Schemes: schemeCounts(links),
+	}, nil
+}
+
+// DeleteBatch removes a batch and its links. A batch whose first check is
+// still running can't be deleted.
+func (urlchecker *URLChecker) DeleteBatch(ctx context.Context, batchNum int) error {
+	batch, err := urlchecker.db.GetBatch(ctx, batchNum)
+	if err != nil {
+		if errors.Is(err, database.ErrBatchNotFound) {
+			return err
+		}
+		return fmt.Errorf("failed to get batch: %w", err)
+	}
+
+	if batch.Status == models.BatchStatusProcessing {
+		return ErrBatchProcessing
+	}
+
+	if err := urlchecker.db.DeleteBatch(ctx, batchNum); err != nil {
+		if errors.Is(err, database.ErrBatchNotFound) {
+			return err
+		}
+		return fmt.Errorf("failed to delete batch: %w", err)
+	}
+
+	urlchecker.logger.Infof("Deleted batch %d", batchNum)
+	return nil
+}
+
+// ParseBatchSource validates a batch source name. An empty name is allowed
+// and matches every source.
+func ParseBatchSource(value string) (models.BatchSource, error) {
+	switch source := models.BatchSource(strings.ToLower(strings.TrimSpace(value))); source {
+	case "", models.BatchSourceAPI, models.BatchSourceCLI, models.BatchSourceScheduled:
+		return source, nil
+	default:
+		return "", fmt.Errorf("unknown source %q, expected api, cli or scheduled", value)
+	}
+}
+
+// ListBatches returns a page of batches, newest first. A limit below 1 uses
+// the configured default.
+func (urlchecker *URLChecker) ListBatches(ctx context.Context, limit, offset int) (models.BatchesResponse, error) {
+	return urlchecker.ListBatchesBySource(ctx, "", limit, offset)
+}
+
+// ListBatchesBySource is ListBatches restricted to the batches submitted by
+// source. An empty source lists every batch.
+func (urlchecker *URLChecker) ListBatchesBySource(ctx context.Context, source models.BatchSource, limit, offset int) (models.BatchesResponse, error) {
+	if limit < 1 {
+		limit = urlchecker.batchListLimit
+	}
+
+	if err := urlchecker.acquireReadSlot(ctx); err != nil {
+		return models.BatchesResponse{}, err
+	}
+	defer urlchecker.releaseReadSlot()
+
+	total, err := urlchecker.db.CountBatchesBySource(ctx, source)
+	if err != nil {
+		return models.BatchesResponse{}, err
+	}
+
+	batches, err := urlchecker.db.GetBatchesBySource(ctx, source, limit, offset)
+	if err != nil {
+		return models.BatchesResponse{}, fmt.Errorf("failed to get batches: %w", err)
+	}
+	if batches == nil {
+		batches = []*models.Batch{}
+	}
+
+	return models.BatchesResponse{
+		Batches: batches,
+		Total:   total,
+		Limit:   limit,
+		Offset:  offset,
+	}, nil
+}
+
+// streamBatchesPageSize is how many batches StreamBatches reads at a time.
+const streamBatchesPageSize = 200
+
+// StreamBatches writes the batches listing to w as JSON, in the shape of
+// BatchesResponse, a page at a time instead of loading every batch first.
+// Each page is read under a read slot and closed before it is written, so a
+// slow client holds neither a slot nor an open query. Unlike ListBatches, a
+// limit below 1 lists every batch.
+func (urlchecker *URLChecker) StreamBatches(ctx context.Context, w io.Writer, source models.BatchSource, limit, offset int) error {
+	if limit < 0 {
+		limit = 0
+	}
+
+	var total int
+	err := urlchecker.withReadSlot(ctx, func() (err error) {
+		total, err = urlchecker.db.CountBatchesBySource(ctx, source)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, `{"batches":[`); err != nil {
+		return err
+	}
+
+	first := true
+	before := 0
+	for remaining := limit; limit < 1 || remaining > 0; {
+		size := streamBatchesPageSize
+		if limit > 0 {
+			size = min(size, remaining)
+		}
+
+		var page []*models.Batch
+		err := urlchecker.withReadSlot(ctx, func() (err error) {
+			if before == 0 {
+				page, err = urlchecker.db.GetBatchesBySource(ctx, source, size, offset)
+			} else {
+				page, err = urlchecker.db.GetBatchesBySourceBefore(ctx, source, before, size)
+			}
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to stream batches: %w", err)
+		}
+
+		for _, batch := range page {
+			data, err := json.Marshal(batch)
+			if err != nil {
+				return err
+			}
+			if !first {
+				data = append([]byte{','}, data...)
+			}
+			first = false
+			if _, err := w.Write(data); err != nil {
+				return err
+			}
+		}
+
+		if len(page) < size {
+			break
+		}
+		before = page[len(page)-1].LinksNum
+		remaining -= len(page)
+	}
+
+	_, err = fmt.Fprintf(w, "],\"total\":%d,\"limit\":%d,\"offset\":%d}\n", total, limit, offset)
+	return err
+}
+
+// withReadSlot runs read under a read slot.
+func (urlchecker *URLChecker) withReadSlot(ctx context.Context, read func() error) error {
+	if err := urlchecker.acquireReadSlot(ctx); err != nil {
+		return err
+	}
+	defer urlchecker.releaseReadSlot()
+	return read()
+}
+
+// MissingBatches returns the requested batch numbers that don't exist, in
+// request order and without duplicates.
+func (urlchecker *URLChecker) MissingBatches(ctx context.Context, batchNums []int) ([]int, error) {
+	if err := urlchecker.acquireReadSlot(ctx); err != nil {
+		return nil, err
+	}
+	defer urlchecker.releaseReadSlot()
+
+	existing, err := urlchecker.db.GetExistingBatchNums(ctx, batchNums)
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []int
+	for _, num := range batchNums {
+		if !existing[num] {
+			existing[num] = true
+			missing = append(missing, num)
+		}
+	}
+
+	return missing, nil
+}
+
+// isStale reports whether any checked link is older than ttl. Links that were
+// never checked don't count.
+func isStale(links []*models.Link, ttl time.Duration, now time.Time) bool {
+	if ttl <= 0 {
+		return false
+	}
+
+	for _, link := range links {
+		if link.Time != nil && now.Sub(*link.Time) > ttl {
+			return true
+		}
+	}
+
+	return false
+}
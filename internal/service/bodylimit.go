@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync/atomic"
+)
+
+// ErrBodyLimitExceeded is returned when the response bodies read while
+// following a check's redirects add up to more than the configured limit.
+var ErrBodyLimitExceeded = errors.New("response bodies exceeded the byte limit")
+
+// bodyBudget is what's left of the byte limit for the responses of one check,
+// shared by every hop of its redirect chain.
+type bodyBudget struct {
+	remaining atomic.Int64
+}
+
+type bodyBudgetKey struct{}
+
+// withBodyBudget limits the bytes read from all responses to requests made
+// with ctx, redirects included, to limit.
+func withBodyBudget(ctx context.Context, limit int64) context.Context {
+	budget := &bodyBudget{}
+	budget.remaining.Store(limit)
+	return context.WithValue(ctx, bodyBudgetKey{}, budget)
+}
+
+func bodyBudgetFrom(ctx context.Context) *bodyBudget {
+	budget, _ := ctx.Value(bodyBudgetKey{}).(*bodyBudget)
+	return budget
+}
+
+// bodyLimitTransport charges the bodies of responses to the budget of their
+// request and refuses to follow a redirect once the budget is spent.
+type bodyLimitTransport struct {
+	base http.RoundTripper
+}
+
+func (t *bodyLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	budget := bodyBudgetFrom(req.Context())
+	if budget == nil {
+		return t.base.RoundTrip(req)
+	}
+	if budget.remaining.Load() < 0 {
+		return nil, ErrBodyLimitExceeded
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = &limitedBody{ReadCloser: resp.Body, budget: budget}
+	return resp, nil
+}
+
+// limitedBody reads a response body until its budget is exceeded.
+type limitedBody struct {
+	io.ReadCloser
+	budget *bodyBudget
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	remaining := b.budget.remaining.Load()
+	if remaining < 0 {
+		return 0, ErrBodyLimitExceeded
+	}
+	// one byte past the budget is enough to tell it was exceeded
+	if int64(len(p)) > remaining+1 {
+		p = p[:remaining+1]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	if b.budget.remaining.Add(-int64(n)) < 0 {
+		return n, ErrBodyLimitExceeded
+	}
+	return n, err
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync/atomic"
+	"time"
+)
+
+// connStats tracks the connections opened by the checker's transport, so
+// connection exhaustion during big batches shows up in the metrics.
+type connStats struct {
+	open      atomic.Int64
+	idle      atomic.Int64
+	waits     atomic.Int64
+	waitNanos atomic.Int64
+}
+
+// trackedConn is a connection dialed by the checker's transport. It knows
+// whether it sits in the transport's idle pool so closing it keeps the idle
+// count right.
+type trackedConn struct {
+	net.Conn
+	stats  *connStats
+	idle   atomic.Bool
+	closed atomic.Bool
+}
+
+func (c *trackedConn) setIdle(idle bool) {
+	if c.closed.Load() || !c.idle.CompareAndSwap(!idle, idle) {
+		return
+	}
+	if idle {
+		c.stats.idle.Add(1)
+	} else {
+		c.stats.idle.Add(-1)
+	}
+}
+
+func (c *trackedConn) Close() error {
+	if c.closed.CompareAndSwap(false, true) {
+		if c.idle.Load() {
+			c.stats.idle.Add(-1)
+		}
+		c.stats.open.Add(-1)
+	}
+	return c.Conn.Close()
+}
+
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+func (s *connStats) dialer(dial dialFunc) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		s.open.Add(1)
+		return &trackedConn{Conn: conn, stats: s}, nil
+	}
+}
+
+// trace follows a single request: how long it waited for a connection and
+// whether that connection went back to the idle pool afterwards.
+func (s *connStats) trace() *httptrace.ClientTrace {
+	var (
+		conn  *trackedConn
+		start time.Time
+	)
+	return &httptrace.ClientTrace{
+		GetConn: func(string) {
+			start = time.Now()
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			s.waits.Add(1)
+			s.waitNanos.Add(int64(time.Since(start)))
+
+			netConn := info.Conn
+			if tlsConn, ok := netConn.(*tls.Conn); ok {
+				netConn = tlsConn.NetConn()
+			}
+			if conn, _ = netConn.(*trackedConn); conn != nil {
+				conn.setIdle(false)
+			}
+		},
+		PutIdleConn: func(err error) {
+			if err == nil && conn != nil {
+				conn.setIdle(true)
+			}
+		},
+	}
+}
+
+// withConnTrace records the connection use of requests made with ctx.
+func (urlchecker *URLChecker) withConnTrace(ctx context.Context) context.Context {
+	if urlchecker.connStats == nil {
+		return ctx
+	}
+	return httptrace.WithClientTrace(ctx, urlchecker.connStats.trace())
+}
+
+// trackConnections rebuilds the checker's client on a copy of its root
+// transport that counts the connections it dials, keeping the transport
+// layers added by options on top. Only an *http.Transport can be tracked.
+func (urlchecker *URLChecker) trackConnections() {
+	root := urlchecker.rootTransport
+	if root == nil {
+		root = http.DefaultTransport
+	}
+
+	base, ok := root.(*http.Transport)
+	if !ok {
+		urlchecker.logger.Warnf("Connection metrics need an *http.Transport, got %T; they stay at zero", root)
+		return
+	}
+
+	transport := base.Clone()
+	dial := transport.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	transport.DialContext = urlchecker.connStats.dialer(dial)
+	urlchecker.rootTransport = transport
+
+	var rt http.RoundTripper = transport
+	for _, wrap := range urlchecker.transportLayers {
+		rt = wrap(rt)
+	}
+
+	client := *urlchecker.httpClient
+	client.Transport = rt
+	urlchecker.httpClient = &client
+}
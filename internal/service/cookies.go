@@ -0,0 +1,36 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"url-checker/internal/models"
+)
+
+type cookiesKey struct{}
+
+// withCookies makes checks made with ctx send cookies, e.g. a session cookie
+// for pages behind a login.
+func withCookies(ctx context.Context, cookies []*http.Cookie) context.Context {
+	return context.WithValue(ctx, cookiesKey{}, cookies)
+}
+
+func cookiesFrom(ctx context.Context) []*http.Cookie {
+	cookies, _ := ctx.Value(cookiesKey{}).([]*http.Cookie)
+	return cookies
+}
+
+// ParseCookies validates cookies submitted with a check. Errors name the
+// cookie but never include its value.
+func ParseCookies(cookies []models.Cookie) ([]*http.Cookie, error) {
+	parsed := make([]*http.Cookie, 0, len(cookies))
+	for _, c := range cookies {
+		cookie := &http.Cookie{Name: c.Name, Value: c.Value}
+		if err := cookie.Valid(); err != nil {
+			return nil, fmt.Errorf("invalid cookie %q", c.Name)
+		}
+		parsed = append(parsed, cookie)
+	}
+	return parsed, nil
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// CSVOptions controls how CSV output is encoded. Excel in European locales
+// expects a semicolon delimiter and a UTF-8 BOM.
+type CSVOptions struct {
+	Delimiter rune
+	BOM       bool
+}
+
+func DefaultCSVOptions() CSVOptions {
+	return CSVOptions{Delimiter: ','}
+}
+
+// ParseCSVDelimiter accepts a single character or the name "tab".
+func ParseCSVDelimiter(value string) (rune, error) {
+	if value == "tab" || value == `\t` {
+		return '\t', nil
+	}
+
+	r, size := utf8.DecodeRuneInString(value)
+	if size == 0 || size != len(value) {
+		return 0, fmt.Errorf("invalid CSV delimiter %q", value)
+	}
+
+	switch r {
+	case '"', '\r', '\n', utf8.RuneError:
+		return 0, fmt.Errorf("invalid CSV delimiter %q", value)
+	}
+
+	return r, nil
+}
+
+func newCSVWriter(w io.Writer, opts CSVOptions) (*csv.Writer, error) {
+	if opts.BOM {
+		if _, err := w.Write(utf8BOM); err != nil {
+			return nil, err
+		}
+	}
+
+	writer := csv.NewWriter(w)
+	if opts.Delimiter != 0 {
+		writer.Comma = opts.Delimiter
+	}
+
+	return writer, nil
+}
+
+// csvImportColumns are the columns accepted by ParseCSVLinks. Only url is
+// required and it must come first.
+var csvImportColumns = map[string]bool{"url": true, "method": true, "label": true}
+
+// CSVUpload is what ParseCSVLinks read from a CSV upload.
+type CSVUpload struct {
+	Links []string
+
+	// Methods is the method the rows' method column asks for, ready for
+	// CheckOptions.Methods. It is empty when no row names one.
+	Methods []string
+
+	// Skipped counts the malformed rows that were left out.
+	Skipped int
+}
+
+// detectCSVDelimiter returns the character that follows the url column in a
+// header row, and a comma when url is the only column.
+func detectCSVDelimiter(header string) (rune, error) {
+	header = strings.TrimPrefix(header, "\ufeff")
+	header = strings.TrimRight(strings.TrimLeft(header, " "), "\r\n")
+
+	quoted := strings.HasPrefix(header, `"`)
+	header = strings.TrimPrefix(header, `"`)
+	if len(header) < 3 || !strings.EqualFold(header[:3], "url") {
+		return 0, fmt.Errorf("first CSV column must be url")
+	}
+	rest := header[3:]
+	if quoted {
+		rest = strings.TrimPrefix(rest, `"`)
+	}
+
+	rest = strings.TrimLeft(rest, " ")
+	if rest == "" {
+		return ',', nil
+	}
+	r, _ := utf8.DecodeRuneInString(rest)
+	return ParseCSVDelimiter(string(r))
+}
+
+// ParseCSVLinks reads links from a CSV upload with a header row. The
+// delimiter is whatever follows the url column in the header, so uploads
+// don't depend on the delimiter configured for exports. Rows without a URL,
+// with more fields than the header, with an unknown method or with broken
+// quoting are skipped and counted. Rows may name a method, which must be the
+// same for all of them as a batch is checked with one; rows without one are
+// checked with it too. Labels are accepted but not stored.
+func (urlchecker *URLChecker) ParseCSVLinks(r io.Reader) (CSVUpload, error) {
+	buffered := bufio.NewReader(r)
+	line, err := buffered.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return CSVUpload{}, fmt.Errorf("failed to read CSV: %w", err)
+	}
+	if strings.TrimSpace(line) == "" {
+		return CSVUpload{}, fmt.Errorf("empty CSV")
+	}
+	delimiter, err := detectCSVDelimiter(line)
+	if err != nil {
+		return CSVUpload{}, err
+	}
+
+	reader := csv.NewReader(io.MultiReader(strings.NewReader(line), buffered))
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return CSVUpload{}, fmt.Errorf("invalid CSV header: %w", err)
+	}
+
+	methodColumn := -1
+	for i, column := range header {
+		column = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")))
+		if i == 0 && column != "url" {
+			return CSVUpload{}, fmt.Errorf("first CSV column must be url")
+		}
+		if !csvImportColumns[column] {
+			return CSVUpload{}, fmt.Errorf("unknown CSV column %q", column)
+		}
+		if column == "method" {
+			methodColumn = i
+		}
+	}
+
+	var upload CSVUpload
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			upload.Skipped++
+			continue
+		}
+		if err != nil {
+			return CSVUpload{}, fmt.Errorf("failed to read CSV: %w", err)
+		}
+
+		link := strings.TrimSpace(record[0])
+		if link == "" || len(record) > len(header) {
+			upload.Skipped++
+			continue
+		}
+
+		if methodColumn >= 0 && methodColumn < len(record) && strings.TrimSpace(record[methodColumn]) != "" {
+			methods, err := NormalizeMethods([]string{record[methodColumn]})
+			if err != nil {
+				upload.Skipped++
+				continue
+			}
+			if upload.Methods != nil && !slices.Equal(upload.Methods, methods) {
+				return CSVUpload{}, fmt.Errorf("CSV rows ask for different methods %s and %s, upload them separately", upload.Methods[0], methods[0])
+			}
+			upload.Methods = methods
+		}
+
+		upload.Links = append(upload.Links, link)
+	}
+
+	return upload, nil
+}
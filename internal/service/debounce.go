@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"url-checker/internal/models"
+)
+
+// pendingSubmission is a batch submission other identical submissions within
+// the debounce window wait for instead of creating batches of their own.
+type pendingSubmission struct {
+	startedAt time.Time
+	done      chan struct{}
+	response  models.CheckResponse
+	err       error
+}
+
+// submissionDebouncer tracks recent submissions by submissionKey.
+type submissionDebouncer struct {
+	mu          sync.Mutex
+	submissions map[string]*pendingSubmission
+}
+
+// submissionKey identifies submissions that would produce the same batch: the
+// same idempotency key and link set, checked with every setting alike.
+func submissionKey(opts CheckOptions, checksum string, methods []string, policy models.MethodPolicy) string {
+	return fmt.Sprintf("%s|%s|%s|%s|%d|%s|%s|%t|%s|%t|%s|%s|%s|%s", opts.IdempotencyKey, checksum, strings.Join(methods, ","), policy,
+		opts.RetryCount, opts.RetryDelay, opts.Timeout, opts.DisableKeepAlive, opts.ServerName, opts.DiscoverMethods,
+		opts.ExpiresIn, opts.Profile, opts.Dedup, opts.Source)
+}
+
+// debounceSubmission runs submit, unless an identical submission started
+// within the debounce window, in which case it waits for that one and returns
+// its result, so the submissions share a single batch. An empty key is never
+// debounced.
+func (urlchecker *URLChecker) debounceSubmission(ctx context.Context, key string, submit func() (models.CheckResponse, error)) (models.CheckResponse, error) {
+	if urlchecker.submitDebounce <= 0 || key == "" {
+		return submit()
+	}
+
+	d := &urlchecker.debouncer
+	now := urlchecker.clock.Now()
+
+	d.mu.Lock()
+	for k, pending := range d.submissions {
+		if now.Sub(pending.startedAt) > urlchecker.submitDebounce && isDone(pending.done) {
+			delete(d.submissions, k)
+		}
+	}
+	if pending, ok := d.submissions[key]; ok && now.Sub(pending.startedAt) <= urlchecker.submitDebounce {
+		d.mu.Unlock()
+
+		select {
+		case <-pending.done:
+		case <-ctx.Done():
+			return models.CheckResponse{}, ctx.Err()
+		}
+		urlchecker.logger.Infof("Debounced submission into batch %d", pending.response.BatchNum)
+		return pending.response, pending.err
+	}
+
+	pending := &pendingSubmission{startedAt: now, done: make(chan struct{})}
+	if d.submissions == nil {
+		d.submissions = make(map[string]*pendingSubmission)
+	}
+	d.submissions[key] = pending
+	d.mu.Unlock()
+
+	defer close(pending.done)
+	pending.response, pending.err = submit()
+	return pending.response, pending.err
+}
+
+func isDone(done <-chan struct{}) bool {
+	select {
+	case <-done:
+		return true
+	default:
+		return false
+	}
+}
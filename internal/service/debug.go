@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"url-checker/internal/models"
+)
+
+// redactedHeaders carry credentials or cookies and are never stored.
+var redactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+const redacted = "[redacted]"
+
+type debugKey struct{}
+
+// recordingDebug makes checks made with ctx store the exchange of their last
+// request in debug.
+func recordingDebug(ctx context.Context, debug **models.LinkDebug) context.Context {
+	return context.WithValue(ctx, debugKey{}, debug)
+}
+
+// recordDebug stores the exchange of a check when debug metadata is enabled
+// and ctx records it. Exchanges over the size limit are truncated.
+func (urlchecker *URLChecker) recordDebug(ctx context.Context, req *http.Request, resp *http.Response, err error) {
+	dst, ok := ctx.Value(debugKey{}).(**models.LinkDebug)
+	if !ok || urlchecker.debugMetadataSize < 1 {
+		return
+	}
+
+	debug := &models.LinkDebug{
+		Method:         req.Method,
+		URL:            req.URL.String(),
+		RequestHeaders: redactHeaders(req.Header),
+	}
+	if err != nil {
+		debug.Error = err.Error()
+	}
+	if resp != nil {
+		debug.Status = resp.Proto + " " + resp.Status
+		debug.ResponseHeaders = redactHeaders(resp.Header)
+	}
+
+	if encoded, err := json.Marshal(debug); err != nil || len(encoded) > urlchecker.debugMetadataSize {
+		debug.RequestHeaders = nil
+		debug.ResponseHeaders = nil
+		debug.Truncated = true
+	}
+
+	*dst = debug
+}
+
+func redactHeaders(header http.Header) map[string][]string {
+	if len(header) == 0 {
+		return nil
+	}
+
+	headers := header.Clone()
+	for _, name := range redactedHeaders {
+		if values := headers.Values(name); len(values) > 0 {
+			headers[http.CanonicalHeaderKey(name)] = []string{redacted}
+		}
+	}
+	return headers
+}
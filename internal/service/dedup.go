@@ -0,0 +1,61 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"url-checker/internal/models"
+)
+
+// ParseDedupMode validates a dedup mode name. An empty name is allowed and
+// means links are not de-duplicated.
+func ParseDedupMode(value string) (models.DedupMode, error) {
+	switch mode := models.DedupMode(strings.ToLower(strings.TrimSpace(value))); mode {
+	case "", models.DedupFull, models.DedupIgnoreQuery:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown dedup mode %q, expected full or ignore-query", value)
+	}
+}
+
+// dedupKey is the form two links share when mode treats them as the same
+// resource.
+func dedupKey(link string, mode models.DedupMode) string {
+	key := normalizeURL(link)
+	if mode == models.DedupIgnoreQuery {
+		key, _, _ = strings.Cut(key, "#")
+		key, _, _ = strings.Cut(key, "?")
+	}
+	return key
+}
+
+// dedupLinks keeps the first of the links that share a dedup key, in
+// submission order, and maps every dropped link to the one it was merged
+// into. Without a mode every link is kept.
+func dedupLinks(links []string, mode models.DedupMode) ([]string, map[string]string) {
+	if mode == "" {
+		return links, nil
+	}
+
+	kept := make(map[string]string, len(links))
+	accepted := make([]string, 0, len(links))
+	var merged map[string]string
+
+	for _, link := range links {
+		key := dedupKey(link, mode)
+		if first, ok := kept[key]; ok {
+			if link != first {
+				if merged == nil {
+					merged = make(map[string]string)
+				}
+				merged[link] = first
+			}
+			continue
+		}
+
+		kept[key] = link
+		accepted = append(accepted, link)
+	}
+
+	return accepted, merged
+}
@@ -0,0 +1,236 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const DefaultSMTPPort = 587
+
+// ErrEmailNotConfigured is returned for an emailed report when no notifier
+// was configured.
+var ErrEmailNotConfigured = errors.New("report email is not configured")
+
+// ParseEmailRecipients parses a comma-separated list of email addresses,
+// rejecting any that isn't a valid address.
+func ParseEmailRecipients(value string) ([]string, error) {
+	var recipients []string
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		addr, err := mail.ParseAddress(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid recipient %q: %w", entry, err)
+		}
+		recipients = append(recipients, addr.Address)
+	}
+	return recipients, nil
+}
+
+// SMTPConfig is the server emails are sent through, the sender address and
+// the recipients. Timeout bounds each send whatever the caller's deadline;
+// zero means DefaultNotifyTimeout.
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	To       []string
+	Timeout  time.Duration
+}
+
+// SMTPNotifier emails notifications through an SMTP server, upgrading the
+// connection with STARTTLS when the server offers it.
+type SMTPNotifier struct {
+	config SMTPConfig
+}
+
+// NewSMTPNotifier validates config and returns a notifier for it. A port
+// below 1 means DefaultSMTPPort.
+func NewSMTPNotifier(config SMTPConfig) (*SMTPNotifier, error) {
+	if config.Host == "" {
+		return nil, fmt.Errorf("SMTP host is required")
+	}
+	if config.Port < 1 {
+		config.Port = DefaultSMTPPort
+	}
+	if len(config.To) == 0 {
+		return nil, fmt.Errorf("at least one recipient is required")
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultNotifyTimeout
+	}
+
+	from, err := mail.ParseAddress(config.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender %q: %w", config.From, err)
+	}
+	config.From = from.Address
+
+	return &SMTPNotifier{config: config}, nil
+}
+
+func (m *SMTPNotifier) Send(ctx context.Context, subject, body string, attachments []Attachment) error {
+	// a server that stops answering mid-session must not hold the
+	// connection forever, even for a caller without a deadline
+	ctx, cancel := context.WithTimeout(ctx, m.config.Timeout)
+	defer cancel()
+
+	to := m.config.To
+	message, err := buildMessage(m.config.From, to, subject, body, messageDateFrom(ctx), attachments)
+	if err != nil {
+		return err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(m.config.Host, strconv.Itoa(m.config.Port)))
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, m.config.Host)
+	if err != nil {
+		return fmt.Errorf("failed to start SMTP session: %w", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: m.config.Host}); err != nil {
+			return fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+	if m.config.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.config.Username, m.config.Password, m.config.Host)); err != nil {
+			return fmt.Errorf("failed to authenticate: %w", err)
+		}
+	}
+
+	if err := client.Mail(m.config.From); err != nil {
+		return fmt.Errorf("sender rejected: %w", err)
+	}
+	for _, recipient := range to {
+		if err := client.Rcpt(recipient); err != nil {
+			return fmt.Errorf("recipient %s rejected: %w", recipient, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(message); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+type messageDateKey struct{}
+
+// withMessageDate makes notifications sent with ctx dated date, so their Date
+// header follows the service clock.
+func withMessageDate(ctx context.Context, date time.Time) context.Context {
+	return context.WithValue(ctx, messageDateKey{}, date)
+}
+
+func messageDateFrom(ctx context.Context) time.Time {
+	if date, ok := ctx.Value(messageDateKey{}).(time.Time); ok {
+		return date
+	}
+	return time.Now()
+}
+
+// buildMessage encodes an email as a MIME multipart message: the body as
+// plain text followed by each attachment in base64.
+func buildMessage(from string, to []string, subject, body string, date time.Time, attachments []Attachment) ([]byte, error) {
+	var boundary [12]byte
+	if _, err := rand.Read(boundary[:]); err != nil {
+		return nil, err
+	}
+	mixed := "url-checker-" + hex.EncodeToString(boundary[:])
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/mixed; boundary=%q\r\n\r\n", mixed)
+
+	fmt.Fprintf(&msg, "--%s\r\n", mixed)
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	msg.WriteString("\r\n")
+
+	for _, attachment := range attachments {
+		fmt.Fprintf(&msg, "--%s\r\n", mixed)
+		fmt.Fprintf(&msg, "Content-Type: %s\r\n", attachment.ContentType)
+		msg.WriteString("Content-Transfer-Encoding: base64\r\n")
+		fmt.Fprintf(&msg, "Content-Disposition: %s\r\n\r\n", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Name}))
+
+		encoded := base64.StdEncoding.EncodeToString(attachment.Data)
+		for len(encoded) > 76 {
+			msg.WriteString(encoded[:76] + "\r\n")
+			encoded = encoded[76:]
+		}
+		msg.WriteString(encoded + "\r\n")
+	}
+
+	fmt.Fprintf(&msg, "--%s--\r\n", mixed)
+	return msg.Bytes(), nil
+}
+
+// EmailReport generates a PDF report of the given batches and sends it
+// through the configured notifier.
+func (urlchecker *URLChecker) EmailReport(ctx context.Context, batchIDs []int) error {
+	if urlchecker.notifier == nil {
+		return ErrEmailNotConfigured
+	}
+
+	report, err := urlchecker.GenerateReportAsync(ctx, ReportFormatPDF, batchIDs)
+	if err != nil {
+		return err
+	}
+
+	nums := make([]string, len(batchIDs))
+	for i, id := range batchIDs {
+		nums[i] = strconv.Itoa(id)
+	}
+	body := fmt.Sprintf("The attached report covers batches %s.", strings.Join(nums, ", "))
+	attachment := Attachment{
+		Name:        fmt.Sprintf("url_report_%d.pdf", urlchecker.GetCurrentTimestamp()),
+		ContentType: "application/pdf",
+		Data:        report,
+	}
+
+	sendCtx := withMessageDate(ctx, urlchecker.clock.Now())
+	if err := urlchecker.notifier.Send(sendCtx, urlchecker.reportTitle, body, []Attachment{attachment}); err != nil {
+		return fmt.Errorf("failed to send report email: %w", err)
+	}
+
+	urlchecker.logger.Infof("Emailed report for batches %v", batchIDs)
+	return nil
+}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"url-checker/internal/models"
+)
+
+// checkLinksEphemeral checks links without creating batch or link rows. The
+// response carries no batch number.
+func (urlchecker *URLChecker) checkLinksEphemeral(ctx context.Context, links []string, spec checkSpec) (models.CheckResponse, error) {
+	resultLinks := make(map[string]string, len(links))
+	var methodResults map[string]map[string]models.LinkStatus
+	var allow map[string]string
+	var userAgents map[string]string
+	var resultsMux sync.Mutex
+
+	urlchecker.checkEach(ctx, links, spec, func(i int, check linkCheck, _ time.Time) {
+		link := links[i]
+
+		resultsMux.Lock()
+		defer resultsMux.Unlock()
+		resultLinks[link] = string(check.status)
+		if check.methods != nil {
+			if methodResults == nil {
+				methodResults = make(map[string]map[string]models.LinkStatus)
+			}
+			methodResults[link] = check.methods
+		}
+		if check.allow != "" {
+			if allow == nil {
+				allow = make(map[string]string)
+			}
+			allow[link] = check.allow
+		}
+		if check.userAgent != "" {
+			if userAgents == nil {
+				userAgents = make(map[string]string)
+			}
+			userAgents[link] = check.userAgent
+		}
+	})
+
+	// cancelled checks leave no result behind, so the response is incomplete
+	if err := ctx.Err(); err != nil {
+		return models.CheckResponse{}, err
+	}
+
+	return models.CheckResponse{Links: resultLinks, Methods: methodResults, Allow: allow, UserAgents: userAgents}, nil
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"url-checker/internal/models"
+)
+
+// Page geometry of the A4 reports gofpdf lays out with its default margins.
+const (
+	reportPageTop     = 10.0
+	reportPageBreakAt = 297.0 - 20.0
+)
+
+// reportPager follows the vertical position GeneratePDFReport's cells and
+// line breaks move through, counting the pages the content spills onto.
+type reportPager struct {
+	y     float64
+	pages int
+}
+
+func newReportPager() *reportPager {
+	return &reportPager{y: reportPageTop, pages: 1}
+}
+
+func (p *reportPager) cell(height float64) {
+	if p.y+height > reportPageBreakAt {
+		p.pages++
+		p.y = reportPageTop
+	}
+}
+
+func (p *reportPager) ln(height float64) {
+	p.y += height
+}
+
+// EstimateReport returns the size of the report GeneratePDFReport would
+// produce for batchIDs without loading links or rendering anything. Links
+// are counted as one line each, so a report whose long URLs wrap, or whose
+// links are grouped under status class headings, can take more pages than
+// estimated.
+func (urlchecker *URLChecker) EstimateReport(ctx context.Context, batchIDs []int) (models.ReportEstimate, error) {
+	if err := urlchecker.acquireReadSlot(ctx); err != nil {
+		return models.ReportEstimate{}, err
+	}
+	defer urlchecker.releaseReadSlot()
+
+	batches, err := urlchecker.db.GetReportBatches(ctx, batchIDs)
+	if err != nil {
+		return models.ReportEstimate{}, fmt.Errorf("failed to get batches: %w", err)
+	}
+
+	found := make(map[int]bool, len(batches))
+	for _, batch := range batches {
+		found[batch.LinksNum] = true
+	}
+
+	estimate := models.ReportEstimate{BatchCount: len(batches)}
+	for _, num := range batchIDs {
+		if !found[num] {
+			found[num] = true
+			estimate.Missing = append(estimate.Missing, num)
+		}
+	}
+
+	if len(batches) == 0 {
+		return estimate, nil
+	}
+
+	// mirrors the layout of GeneratePDFReport
+	pager := newReportPager()
+	if urlchecker.reportLogo != nil {
+		pager.cell(15)
+		pager.ln(15)
+		pager.ln(5)
+	}
+	pager.cell(10)
+	pager.ln(15)
+	pager.cell(10)
+	pager.ln(15)
+
+	// summary table: heading, column headings, a row per batch and the total
+	pager.cell(8)
+	pager.ln(8)
+	for i := 0; i < len(batches)+2; i++ {
+		pager.cell(7)
+		pager.ln(7)
+	}
+	pager.ln(8)
+
+	for _, batch := range batches {
+		estimate.LinkCount += batch.LinkCount
+
+		pager.cell(10)
+		pager.ln(10)
+		pager.cell(10)
+		pager.ln(8)
+		for i := 0; i < batch.LinkCount; i++ {
+			pager.cell(6)
+			pager.ln(6)
+		}
+		pager.ln(10)
+	}
+
+	estimate.PageCount = pager.pages
+	return estimate, nil
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"time"
+)
+
+// StartExpiryWorker periodically deletes batches whose client-set expiry has
+// passed.
+func (urlchecker *URLChecker) StartExpiryWorker(ctx context.Context) {
+	ticker := time.NewTicker(urlchecker.expiryPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			urlchecker.logger.Info("Expiry worker shutting down...")
+			return
+		case <-ticker.C:
+			if urlchecker.IsShutdown() {
+				continue
+			}
+			urlchecker.deleteExpiredBatches(ctx)
+		}
+	}
+}
+
+func (urlchecker *URLChecker) deleteExpiredBatches(ctx context.Context) {
+	deleted, err := urlchecker.db.DeleteExpiredBatches(ctx, urlchecker.clock.Now())
+	if err != nil {
+		urlchecker.logger.Errorf("Failed to delete expired batches: %v", err)
+		return
+	}
+
+	if deleted > 0 {
+		urlchecker.logger.Infof("Deleted %d expired batches", deleted)
+	}
+}
+
+// evictOldestBatches deletes the oldest batches once more than the configured
+// maximum are stored.
+func (urlchecker *URLChecker) evictOldestBatches(ctx context.Context) {
+	if urlchecker.maxBatches < 1 {
+		return
+	}
+
+	deleted, err := urlchecker.db.DeleteOldestBatches(ctx, urlchecker.maxBatches)
+	if err != nil {
+		urlchecker.logger.Errorf("Failed to evict old batches: %v", err)
+		return
+	}
+
+	if deleted > 0 {
+		urlchecker.logger.Infof("Evicted %d old batches to stay within %d stored batches", deleted, urlchecker.maxBatches)
+	}
+}
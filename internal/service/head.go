@@ -0,0 +1,25 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"url-checker/internal/models"
+)
+
+// fetchAvailability requests a URL for a plain availability check. With
+// HEAD-first checks enabled it avoids downloading the body, and only repeats
+// the request with GET when the server doesn't support HEAD.
+func (urlchecker *URLChecker) fetchAvailability(ctx context.Context, rawURL string, timeout time.Duration) (models.LinkStatus, int) {
+	if !urlchecker.headFirst {
+		return urlchecker.fetchWithTimeout(ctx, http.MethodGet, rawURL, timeout)
+	}
+
+	status, code := urlchecker.fetchWithTimeout(ctx, http.MethodHead, rawURL, timeout)
+	if code == http.StatusMethodNotAllowed || code == http.StatusNotImplemented {
+		urlchecker.logger.Infof("HEAD %s returned status %d, retrying with GET", rawURL, code)
+		return urlchecker.fetchWithTimeout(ctx, http.MethodGet, rawURL, timeout)
+	}
+	return status, code
+}
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"fmt"
+	"net/url"
+
+	"url-checker/internal/models"
+)
+
+// limitLinksPerHost keeps at most limit links for each host, in submission
+// order, and reports the rest as invalid. A limit below 1 keeps every link.
+func limitLinksPerHost(links []string, limit int) ([]string, []models.InvalidLink) {
+	if limit < 1 {
+		return links, nil
+	}
+
+	counts := make(map[string]int)
+	accepted := make([]string, 0, len(links))
+	var rejected []models.InvalidLink
+
+	for _, link := range links {
+		parsed, err := url.Parse(normalizeURL(link))
+		if err != nil || parsed.Hostname() == "" {
+			accepted = append(accepted, link)
+			continue
+		}
+
+		host := parsed.Hostname()
+		if counts[host] >= limit {
+			rejected = append(rejected, models.InvalidLink{
+				URL:    link,
+				Reason: fmt.Sprintf("too many links to host %s (limit %d per batch)", host, limit),
+			})
+			continue
+		}
+
+		counts[host]++
+		accepted = append(accepted, link)
+	}
+
+	return accepted, rejected
+}
@@ -0,0 +1,29 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"url-checker/internal/models"
+)
+
+// GetHosts lists the distinct hosts checked across all batches, sorted by
+// host, with the status of the most recent check and the number of checks.
+func (urlchecker *URLChecker) GetHosts(ctx context.Context, limit, offset int) (models.HostsResponse, error) {
+	if err := urlchecker.acquireReadSlot(ctx); err != nil {
+		return models.HostsResponse{}, err
+	}
+	defer urlchecker.releaseReadSlot()
+
+	hosts, total, err := urlchecker.db.GetHostSummaries(ctx, limit, offset)
+	if err != nil {
+		return models.HostsResponse{}, fmt.Errorf("failed to get hosts: %w", err)
+	}
+
+	return models.HostsResponse{
+		Hosts:  hosts,
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	}, nil
+}
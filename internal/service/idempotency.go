@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"url-checker/internal/models"
+)
+
+// ErrIdempotencyKeyReused is returned when an idempotency key is submitted
+// again with other links or settings than the batch it created.
+var ErrIdempotencyKeyReused = errors.New("idempotency key was already used for a different submission")
+
+// normalizeURL brings a submitted link to the form used for comparisons:
+// trimmed, with a default scheme and a lower-case scheme and host.
+func normalizeURL(rawURL string) string {
+	rawURL = strings.TrimSpace(rawURL)
+	if !strings.HasPrefix(rawURL, "http://") && !strings.HasPrefix(rawURL, "https://") {
+		rawURL = "http://" + rawURL
+	}
+
+	scheme, rest, _ := strings.Cut(rawURL, "://")
+	host, path, hasPath := strings.Cut(rest, "/")
+
+	normalized := strings.ToLower(scheme) + "://" + strings.ToLower(host)
+	if hasPath {
+		normalized += "/" + path
+	}
+	return normalized
+}
+
+// urlSetChecksum returns a checksum of the sorted, de-duplicated set of normalized links.
+func urlSetChecksum(links []string) string {
+	seen := make(map[string]struct{}, len(links))
+	normalized := make([]string, 0, len(links))
+	for _, link := range links {
+		n := normalizeURL(link)
+		if _, ok := seen[n]; ok {
+			continue
+		}
+		seen[n] = struct{}{}
+		normalized = append(normalized, n)
+	}
+	sort.Strings(normalized)
+
+	sum := sha256.Sum256([]byte(strings.Join(normalized, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// findReusableBatch looks up a batch created within the idempotency window that
+// matches the idempotency key, or the checksum when no key is given.
+func (urlchecker *URLChecker) findReusableBatch(ctx context.Context, idempotencyKey, checksum string) (*models.Batch, error) {
+	if urlchecker.idempotencyWindow <= 0 {
+		return nil, nil
+	}
+
+	batch, err := urlchecker.db.FindLatestBatch(ctx, idempotencyKey, checksum)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up previous batch: %w", err)
+	}
+
+	if batch == nil || batch.Status == models.BatchStatusFailed {
+		return nil, nil
+	}
+
+	if urlchecker.clock.Now().Sub(batch.CreatedAt) > urlchecker.idempotencyWindow {
+		return nil, nil
+	}
+
+	return batch, nil
+}
+
+// sameBatchSettings reports whether stored was submitted with every setting
+// of batch, so its results can be returned in place of checking batch.
+func sameBatchSettings(stored, batch *models.Batch) bool {
+	return slices.Equal(stored.Methods, batch.Methods) && stored.MethodPolicy == batch.MethodPolicy &&
+		stored.RetryCount == batch.RetryCount && stored.RetryDelayMs == batch.RetryDelayMs && stored.TimeoutMs == batch.TimeoutMs &&
+		stored.DisableKeepAlive == batch.DisableKeepAlive && stored.ServerName == batch.ServerName &&
+		stored.DiscoverMethods == batch.DiscoverMethods && stored.Profile == batch.Profile && stored.Dedup == batch.Dedup &&
+		stored.Source == batch.Source && batchTTL(stored) == batchTTL(batch)
+}
+
+// batchTTL is how long after its creation batch expires, zero when it is
+// kept until removed otherwise.
+func batchTTL(batch *models.Batch) time.Duration {
+	if batch.ExpiresAt == nil {
+		return 0
+	}
+	return batch.ExpiresAt.Sub(batch.CreatedAt).Round(time.Millisecond)
+}
+
+func (urlchecker *URLChecker) batchResponse(ctx context.Context, batchNum int) (models.CheckResponse, error) {
+	links, err := urlchecker.db.GetLinksByBatchNum(ctx, batchNum)
+	if err != nil {
+		return models.CheckResponse{}, fmt.Errorf("failed to get batch links: %w", err)
+	}
+
+	resultLinks := make(map[string]string)
+	for _, link := range links {
+		resultLinks[link.URL] = string(link.Status)
+	}
+
+	return models.CheckResponse{
+		Links:    resultLinks,
+		LinksNum: batchNum,
+		BatchNum: batchNum,
+	}, nil
+}
@@ -0,0 +1,35 @@
+package service
+
+import (
+	"context"
+	"time"
+)
+
+type responseTimeKey struct{}
+
+// recordingResponseTime makes checks made with ctx store how long their last
+// request took in elapsed, up to its response or its failure.
+func recordingResponseTime(ctx context.Context, elapsed *time.Duration) context.Context {
+	return context.WithValue(ctx, responseTimeKey{}, elapsed)
+}
+
+func recordResponseTime(ctx context.Context, elapsed time.Duration) {
+	if dst, ok := ctx.Value(responseTimeKey{}).(*time.Duration); ok {
+		*dst = elapsed
+	}
+}
+
+type statusTextKey struct{}
+
+// recordingStatusText makes checks made with ctx store the status line of
+// their last response in text. A request that gets no response leaves it
+// alone.
+func recordingStatusText(ctx context.Context, text *string) context.Context {
+	return context.WithValue(ctx, statusTextKey{}, text)
+}
+
+func recordStatusText(ctx context.Context, text string) {
+	if dst, ok := ctx.Value(statusTextKey{}).(*string); ok {
+		*dst = text
+	}
+}
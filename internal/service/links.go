@@ -0,0 +1,50 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"url-checker/internal/database"
+	"url-checker/internal/models"
+)
+
+// MaxLinkNotesLength caps the notes an operator can attach to a link.
+const MaxLinkNotesLength = 1000
+
+var ErrLinkNotFound = database.ErrLinkNotFound
+
+// GetLink returns a link with its debug metadata, if any was stored.
+func (urlchecker *URLChecker) GetLink(ctx context.Context, id int) (*models.Link, error) {
+	link, err := urlchecker.db.GetLink(ctx, id)
+	if err != nil {
+		if errors.Is(err, database.ErrLinkNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to get link: %w", err)
+	}
+	return link, nil
+}
+
+// SetLinkNotes replaces the operator notes of a link, e.g. why it is known to
+// be broken, and returns the updated link. Empty notes clear them.
+func (urlchecker *URLChecker) SetLinkNotes(ctx context.Context, id int, notes string) (*models.Link, error) {
+	notes = strings.TrimSpace(notes)
+	if len(notes) > MaxLinkNotesLength {
+		return nil, fmt.Errorf("notes must not be longer than %d bytes", MaxLinkNotesLength)
+	}
+
+	if err := urlchecker.db.UpdateLinkNotes(ctx, id, notes); err != nil {
+		if errors.Is(err, database.ErrLinkNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to set link notes: %w", err)
+	}
+
+	link, err := urlchecker.db.GetLink(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get link: %w", err)
+	}
+	return link, nil
+}
@@ -0,0 +1,238 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"url-checker/internal/models"
+)
+
+// checkMethods are the HTTP methods a link may be checked with. Only safe
+// methods are allowed so a check never changes anything on the target.
+var checkMethods = map[string]bool{
+	"GET":     true,
+	"HEAD":    true,
+	"OPTIONS": true,
+}
+
+// NormalizeMethods upper-cases and de-duplicates methods, keeping their order,
+// and rejects methods a check may not use.
+func NormalizeMethods(methods []string) ([]string, error) {
+	var normalized []string
+	seen := make(map[string]bool, len(methods))
+	for _, method := range methods {
+		method = strings.ToUpper(strings.TrimSpace(method))
+		if !checkMethods[method] {
+			return nil, fmt.Errorf("unsupported method %q", method)
+		}
+		if !seen[method] {
+			seen[method] = true
+			normalized = append(normalized, method)
+		}
+	}
+	return normalized, nil
+}
+
+// ParseMethodPolicy validates a method policy name. An empty name is allowed
+// and means the service default.
+func ParseMethodPolicy(value string) (models.MethodPolicy, error) {
+	switch policy := models.MethodPolicy(strings.ToLower(strings.TrimSpace(value))); policy {
+	case "", models.MethodPolicyAll, models.MethodPolicyAny:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown method policy %q, expected all or any", value)
+	}
+}
+
+// checkSpec describes how the links of a batch are checked.
+type checkSpec struct {
+	timeout time.Duration
+	methods []string
+	policy  models.MethodPolicy
+
+	disableKeepAlive bool
+	serverName       string
+	discoverMethods  bool
+	userAgent        string
+}
+
+func (urlchecker *URLChecker) batchCheckSpec(batch *models.Batch) checkSpec {
+	return checkSpec{
+		timeout: time.Duration(batch.TimeoutMs) * time.Millisecond,
+		methods: batch.Methods,
+		policy:  batch.MethodPolicy,
+
+		disableKeepAlive: batch.DisableKeepAlive,
+		serverName:       batch.ServerName,
+		discoverMethods:  batch.DiscoverMethods,
+		userAgent:        urlchecker.checkProfiles[batch.Profile].UserAgent,
+	}
+}
+
+// linkCheck is the outcome of checking a single link.
+type linkCheck struct {
+	status  models.LinkStatus
+	methods map[string]models.LinkStatus
+	allow   string
+	note    string
+
+	// statusCode is the HTTP status code the link answered with, or 0 when
+	// no response was received. Checked with several methods, it is the code
+	// of the first.
+	statusCode int
+
+	// statusText is the status line of the response statusCode came from.
+	statusText string
+
+	// responseTime is how long the last request of the check took, up to its
+	// response or its failure.
+	responseTime time.Duration
+
+	// userAgent is the fallback user agent the link answered when it refused
+	// the default one.
+	userAgent string
+
+	// debug is the exchange of the last request of the check when debug
+	// metadata is enabled.
+	debug *models.LinkDebug
+}
+
+// checkLink checks a link according to spec. Without explicit methods it is a
+// plain GET check and no per-method results are returned. Links with a scheme
+// outside the allowlist are not requested.
+func (urlchecker *URLChecker) checkLink(ctx context.Context, rawURL string, spec checkSpec) linkCheck {
+	if !urlchecker.schemeAllowed(rawURL) {
+		urlchecker.logger.Warnf("Refusing to check %s: %s", rawURL, SchemeNotAllowedNote)
+		return linkCheck{status: models.StatusNotAvailable, note: SchemeNotAllowedNote}
+	}
+
+	if spec.disableKeepAlive {
+		ctx = withoutKeepAlive(ctx)
+	}
+	if spec.serverName != "" {
+		ctx = withServerName(ctx, spec.serverName)
+	}
+	if spec.userAgent != "" {
+		ctx = withUserAgent(ctx, spec.userAgent)
+	}
+
+	var check linkCheck
+	checkCtx := recordingDebug(recordingUserAgent(ctx, &check.userAgent), &check.debug)
+	checkCtx = recordingResponseTime(checkCtx, &check.responseTime)
+	checkCtx = recordingStatusText(checkCtx, &check.statusText)
+	check.status, check.statusCode, check.methods = urlchecker.checkStatus(checkCtx, rawURL, spec)
+	// a retry that got no response leaves the text of an earlier one behind
+	if check.statusCode == 0 {
+		check.statusText = ""
+	}
+	if spec.discoverMethods {
+		check.allow = urlchecker.discoverAllow(ctx, rawURL, spec.timeout)
+	}
+	return check
+}
+
+// CheckPanicNote is the error recorded on a link whose check panicked.
+const CheckPanicNote = "check failed unexpectedly"
+
+// safeCheckLink is checkLink for check goroutines: a panic is logged and the
+// link gets an error result, instead of taking down the process.
+func (urlchecker *URLChecker) safeCheckLink(ctx context.Context, rawURL string, spec checkSpec) (check linkCheck) {
+	defer func() {
+		if r := recover(); r != nil {
+			urlchecker.logger.Errorf("Check of %s panicked: %v\n%s", rawURL, r, debug.Stack())
+			check = linkCheck{status: models.StatusError, note: CheckPanicNote}
+		}
+	}()
+
+	return urlchecker.checkLink(ctx, rawURL, spec)
+}
+
+// checkEach checks urls concurrently, each holding a check slot, and calls
+// done from the check's goroutine with the result and the time the check
+// finished. It returns once every started check is done. Links whose turn
+// comes after ctx is done are not checked, so callers look at ctx afterwards.
+func (urlchecker *URLChecker) checkEach(ctx context.Context, urls []string, spec checkSpec, done func(i int, check linkCheck, checkedAt time.Time)) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for i, rawURL := range urls {
+		// wait for a free slot instead of spawning past the cap
+		select {
+		case urlchecker.checkSlots <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+
+		wg.Add(1)
+		go func(i int, rawURL string) {
+			defer wg.Done()
+			defer func() { <-urlchecker.checkSlots }()
+
+			urlchecker.metrics.activeChecks.Add(1)
+			defer urlchecker.metrics.activeChecks.Add(-1)
+
+			if ctx.Err() != nil {
+				return
+			}
+
+			check := urlchecker.safeCheckLink(ctx, rawURL, spec)
+			done(i, check, urlchecker.clock.Now())
+		}(i, rawURL)
+	}
+}
+
+func (urlchecker *URLChecker) checkStatus(ctx context.Context, rawURL string, spec checkSpec) (models.LinkStatus, int, map[string]models.LinkStatus) {
+	if len(spec.methods) == 0 {
+		status, code := urlchecker.checkURLAvailability(ctx, rawURL, spec.timeout)
+		return status, code, nil
+	}
+
+	urlchecker.metrics.checksTotal.Add(1)
+
+	results := make(map[string]models.LinkStatus, len(spec.methods))
+	available := 0
+	firstCode := 0
+	for i, method := range spec.methods {
+		methodCtx := ctx
+		if i > 0 {
+			// the code, and so its status text, is the first method's
+			methodCtx = recordingStatusText(ctx, new(string))
+		}
+		status, code := urlchecker.fetchWithTimeout(methodCtx, method, rawURL, spec.timeout)
+		results[method] = status
+		if status == models.StatusAvailable {
+			available++
+		}
+		if i == 0 {
+			firstCode = code
+		}
+	}
+
+	if available == len(spec.methods) || (spec.policy == models.MethodPolicyAny && available > 0) {
+		return models.StatusAvailable, firstCode, results
+	}
+	return models.StatusNotAvailable, firstCode, results
+}
+
+// discoverAllow sends an OPTIONS request and returns the Allow header of the
+// response. Servers that don't answer OPTIONS leave it empty.
+func (urlchecker *URLChecker) discoverAllow(ctx context.Context, rawURL string, timeout time.Duration) string {
+	if timeout = urlchecker.requestTimeout(timeout); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	resp, err := urlchecker.fetch(ctx, http.MethodOptions, rawURL)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+
+	return resp.Header.Get("Allow")
+}
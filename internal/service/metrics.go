@@ -0,0 +1,164 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"url-checker/internal/models"
+)
+
+// ErrMetricsSnapshotDisabled is returned for a metrics snapshot when it was
+// turned off.
+var ErrMetricsSnapshotDisabled = errors.New("metrics snapshot is disabled")
+
+type MetricType string
+
+const (
+	MetricTypeGauge   MetricType = "gauge"
+	MetricTypeCounter MetricType = "counter"
+)
+
+type Metric struct {
+	Name  string
+	Help  string
+	Type  MetricType
+	Value float64
+}
+
+type metrics struct {
+	activeChecks atomic.Int64
+	activePDFs   atomic.Int64
+	checksTotal  atomic.Int64
+	batchesTotal atomic.Int64
+	latency      latencyStats
+}
+
+// latencyStats sums up the time check requests took. The count and total
+// change together, so an average taken from them is always of whole requests.
+type latencyStats struct {
+	mu    sync.Mutex
+	count int64
+	total time.Duration
+}
+
+func (s *latencyStats) add(elapsed time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.count++
+	s.total += elapsed
+}
+
+func (s *latencyStats) read() (int64, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.count, s.total
+}
+
+func (urlchecker *URLChecker) ActiveChecks() int64 {
+	return urlchecker.metrics.activeChecks.Load()
+}
+
+// ChecksTotal is the number of link checks performed since the process started.
+func (urlchecker *URLChecker) ChecksTotal() int64 {
+	return urlchecker.metrics.checksTotal.Load()
+}
+
+func (urlchecker *URLChecker) ActivePDFGenerations() int64 {
+	return urlchecker.metrics.activePDFs.Load()
+}
+
+func (urlchecker *URLChecker) CollectMetrics() []Metric {
+	metrics := []Metric{
+		{
+			Name:  "url_checker_active_checks",
+			Help:  "Number of link checks currently in flight.",
+			Type:  MetricTypeGauge,
+			Value: float64(urlchecker.ActiveChecks()),
+		},
+		{
+			Name:  "url_checker_max_active_checks",
+			Help:  "Maximum number of link checks allowed in flight.",
+			Type:  MetricTypeGauge,
+			Value: float64(cap(urlchecker.checkSlots)),
+		},
+		{
+			Name:  "url_checker_checks_total",
+			Help:  "Total number of link checks performed since start.",
+			Type:  MetricTypeCounter,
+			Value: float64(urlchecker.ChecksTotal()),
+		},
+		{
+			Name:  "url_checker_active_pdf_generations",
+			Help:  "Number of PDF reports currently being generated.",
+			Type:  MetricTypeGauge,
+			Value: float64(urlchecker.ActivePDFGenerations()),
+		},
+	}
+
+	if stats := urlchecker.connStats; stats != nil {
+		open, idle := stats.open.Load(), stats.idle.Load()
+		metrics = append(metrics,
+			Metric{
+				Name:  "url_checker_open_connections",
+				Help:  "Number of connections the checker's transport holds open.",
+				Type:  MetricTypeGauge,
+				Value: float64(open),
+			},
+			Metric{
+				Name:  "url_checker_active_connections",
+				Help:  "Number of open connections in use by a check.",
+				Type:  MetricTypeGauge,
+				Value: float64(open - idle),
+			},
+			Metric{
+				Name:  "url_checker_idle_connections",
+				Help:  "Number of open connections idle in the transport's pool.",
+				Type:  MetricTypeGauge,
+				Value: float64(idle),
+			},
+			Metric{
+				Name:  "url_checker_connection_waits_total",
+				Help:  "Total number of connections checks obtained, new or reused.",
+				Type:  MetricTypeCounter,
+				Value: float64(stats.waits.Load()),
+			},
+			Metric{
+				Name:  "url_checker_connection_wait_seconds_total",
+				Help:  "Total time checks spent waiting to obtain a connection.",
+				Type:  MetricTypeCounter,
+				Value: time.Duration(stats.waitNanos.Load()).Seconds(),
+			},
+		)
+	}
+
+	return metrics
+}
+
+// MetricsSnapshot returns the current counters and gauges as one value. Only
+// the request count and the average response time are read together, so the
+// average is always over requests_total requests. The other fields are each
+// read on their own while checks keep running, so they are not one atomic view
+// and may disagree by the checks and batches that moved in between.
+func (urlchecker *URLChecker) MetricsSnapshot() (models.MetricsSnapshot, error) {
+	if !urlchecker.metricsSnapshot {
+		return models.MetricsSnapshot{}, ErrMetricsSnapshotDisabled
+	}
+
+	requests, total := urlchecker.metrics.latency.read()
+	snapshot := models.MetricsSnapshot{
+		At:                   urlchecker.clock.Now(),
+		ChecksTotal:          urlchecker.ChecksTotal(),
+		ActiveChecks:         urlchecker.ActiveChecks(),
+		BatchesTotal:         urlchecker.metrics.batchesTotal.Load(),
+		QueuedBatches:        urlchecker.pendingBatches.len(),
+		QueuedPDFTasks:       len(urlchecker.pendingPDFTasks),
+		ActivePDFGenerations: urlchecker.ActivePDFGenerations(),
+		RequestsTotal:        requests,
+	}
+	if requests > 0 {
+		snapshot.AvgResponseTimeMs = float64(total.Microseconds()) / float64(requests) / 1000
+	}
+	return snapshot, nil
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"url-checker/internal/models"
+)
+
+// DefaultNotifyTimeout is how long a notification, such as a batch completion
+// summary or an emailed report, may take to send.
+const DefaultNotifyTimeout = 30 * time.Second
+
+// Attachment is a file sent along with a notification.
+type Attachment struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// Notifier delivers notifications, such as emailed reports, to the recipients
+// it was configured with. SMTPNotifier is the implementation used by the
+// server.
+type Notifier interface {
+	Send(ctx context.Context, subject, body string, attachments []Attachment) error
+}
+
+// NopNotifier discards every notification.
+type NopNotifier struct{}
+
+func (NopNotifier) Send(context.Context, string, string, []Attachment) error { return nil }
+
+// notifyBatchCompleted sends a summary of a finished batch in the background
+// when completion notifications are enabled. Failed deliveries are logged and
+// not retried.
+func (urlchecker *URLChecker) notifyBatchCompleted(batchNum int, status models.BatchStatus, results []*models.Link) {
+	notifier := urlchecker.notifier
+	if notifier == nil || !urlchecker.notifyCompletion {
+		return
+	}
+
+	summary := summarizeLinks(results)
+	subject := fmt.Sprintf("Batch %d %s", batchNum, status)
+	body := fmt.Sprintf("Batch %d finished as %s: %d links checked, %d available, %d not available.",
+		batchNum, status, summary.Total, summary.Available, summary.NotAvailable)
+
+	date := urlchecker.clock.Now()
+	go func() {
+		ctx, cancel := context.WithTimeout(withMessageDate(context.Background(), date), DefaultNotifyTimeout)
+		defer cancel()
+
+		if err := notifier.Send(ctx, subject, body, nil); err != nil {
+			urlchecker.logger.Warnf("Failed to send completion notification for batch %d: %v", batchNum, err)
+		}
+	}()
+}
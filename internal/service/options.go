@@ -0,0 +1,557 @@
+package service
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"url-checker/internal/models"
+)
+
+const (
+	DefaultMaxActiveChecks       = 100
+	DefaultMaxConcurrentPDFs     = 2
+	DefaultPDFQueueWait          = 250 * time.Millisecond
+	DefaultMaxConcurrentDBWrites = 1
+	DefaultMaxConcurrentDBReads  = 8
+	DefaultIdempotencyWindow     = 5 * time.Minute
+	DefaultRetryPollInterval     = time.Second
+	DefaultExpiryPollInterval    = time.Minute
+	DefaultBatchListLimit        = 50
+	DefaultProcessingGracePeriod = time.Minute
+	DefaultSubmitDebounce        = time.Second
+
+	// DefaultConnectionMetrics is whether connection metrics are collected
+	// without WithConnectionMetrics. The -connection-metrics flag defaults to
+	// it too and, when given, wins by passing its value to the option.
+	DefaultConnectionMetrics = true
+
+	DefaultDependencyProbeTimeout  = 2 * time.Second
+	DefaultDependencyProbeCacheTTL = 10 * time.Second
+)
+
+type Option func(*URLChecker)
+
+// WithMaxActiveChecks caps the number of link checks running at the same time.
+// Values below 1 fall back to DefaultMaxActiveChecks.
+func WithMaxActiveChecks(limit int) Option {
+	return func(urlchecker *URLChecker) {
+		if limit < 1 {
+			limit = DefaultMaxActiveChecks
+		}
+		urlchecker.checkSlots = make(chan struct{}, limit)
+	}
+}
+
+// WithMaxConcurrentPDFs caps how many PDF reports are generated at the same
+// time, including the synchronous fallback used when the queue is full.
+// Values below 1 fall back to DefaultMaxConcurrentPDFs.
+func WithMaxConcurrentPDFs(limit int) Option {
+	return func(urlchecker *URLChecker) {
+		if limit < 1 {
+			limit = DefaultMaxConcurrentPDFs
+		}
+		urlchecker.pdfSlots = make(chan struct{}, limit)
+	}
+}
+
+// WithPDFQueueWait sets how long a report request waits for a slot in a full
+// PDF queue before generating the report synchronously. Zero falls back
+// immediately.
+func WithPDFQueueWait(wait time.Duration) Option {
+	return func(urlchecker *URLChecker) {
+		if wait < 0 {
+			wait = 0
+		}
+		urlchecker.pdfQueueWait = wait
+	}
+}
+
+// WithMaxConcurrentDBWrites caps how many link results are written to the
+// database at the same time, so a large batch finishing at once doesn't pile
+// up on SQLite's single writer. Values below 1 fall back to
+// DefaultMaxConcurrentDBWrites.
+func WithMaxConcurrentDBWrites(limit int) Option {
+	return func(urlchecker *URLChecker) {
+		if limit < 1 {
+			limit = DefaultMaxConcurrentDBWrites
+		}
+		urlchecker.writeSlots = make(chan struct{}, limit)
+	}
+}
+
+// WithMaxConcurrentDBReads caps how many status, listing and report reads
+// query the database at the same time, so heavy reporting can't exhaust the
+// connections health checks need. Values below 1 fall back to
+// DefaultMaxConcurrentDBReads.
+func WithMaxConcurrentDBReads(limit int) Option {
+	return func(urlchecker *URLChecker) {
+		if limit < 1 {
+			limit = DefaultMaxConcurrentDBReads
+		}
+		urlchecker.readSlots = make(chan struct{}, limit)
+	}
+}
+
+// WithIdempotencyWindow sets how long a batch can be reused for a repeated
+// submission. Zero or negative disables reuse.
+func WithIdempotencyWindow(window time.Duration) Option {
+	return func(urlchecker *URLChecker) {
+		if window < 0 {
+			window = 0
+		}
+		urlchecker.idempotencyWindow = window
+	}
+}
+
+// WithCSVOptions sets the default encoding used for CSV output.
+func WithCSVOptions(opts CSVOptions) Option {
+	return func(urlchecker *URLChecker) {
+		if opts.Delimiter == 0 {
+			opts.Delimiter = ','
+		}
+		urlchecker.csvOptions = opts
+	}
+}
+
+// WithSubmitDebounce makes identical submissions that arrive within window
+// of each other share one batch: later ones wait for the first to finish and
+// return its results instead of racing it to create a batch. Submissions are
+// identical when they have the same idempotency key, or the same links
+// without a key, and the same check settings. It defaults to
+// DefaultSubmitDebounce; zero disables it.
+func WithSubmitDebounce(window time.Duration) Option {
+	return func(urlchecker *URLChecker) {
+		if window < 0 {
+			window = 0
+		}
+		urlchecker.submitDebounce = window
+	}
+}
+
+// WithCloseConnectionHosts sends "Connection: close" to the listed hosts so
+// every check to them uses a fresh connection.
+func WithCloseConnectionHosts(hosts []string) Option {
+	return func(urlchecker *URLChecker) {
+		set := make(map[string]struct{})
+		for _, host := range hosts {
+			host = strings.ToLower(strings.TrimSpace(host))
+			if host != "" {
+				set[host] = struct{}{}
+			}
+		}
+		if len(set) == 0 {
+			return
+		}
+
+		urlchecker.wrapTransport(func(base http.RoundTripper) http.RoundTripper {
+			return &closeConnTransport{base: base, hosts: set}
+		})
+	}
+}
+
+// WithAllowedSchemes sets the link schemes that may be checked. Links with
+// other schemes are marked not available without being requested. An empty
+// list keeps DefaultAllowedSchemes.
+func WithAllowedSchemes(schemes []string) Option {
+	return func(urlchecker *URLChecker) {
+		if set := schemeSet(schemes); len(set) > 0 {
+			urlchecker.allowedSchemes = set
+		}
+	}
+}
+
+// WithFallbackUserAgents sets user agents to try in order when a link answers
+// a check with 403 Forbidden. The first agent that gets through is recorded
+// with the link. None are tried by default.
+func WithFallbackUserAgents(agents []string) Option {
+	return func(urlchecker *URLChecker) {
+		urlchecker.fallbackUserAgents = userAgentList(agents)
+	}
+}
+
+// WithCheckTimeout bounds every check request of batches that don't set
+// their own timeout. Zero, the default, leaves only the HTTP client's
+// timeout; negative values are treated as zero.
+func WithCheckTimeout(timeout time.Duration) Option {
+	return func(urlchecker *URLChecker) {
+		if timeout < 0 {
+			timeout = 0
+		}
+		urlchecker.checkTimeout = timeout
+	}
+}
+
+// WithRedirectBodyLimit caps the bytes read from the response bodies of a
+// check, counted across its whole redirect chain. A check exceeding it fails
+// with ErrBodyLimitExceeded. Zero or less removes the limit.
+func WithRedirectBodyLimit(limit int64) Option {
+	return func(urlchecker *URLChecker) {
+		if limit <= 0 {
+			return
+		}
+
+		urlchecker.redirectBodyLimit = limit
+		urlchecker.wrapTransport(func(base http.RoundTripper) http.RoundTripper {
+			return &bodyLimitTransport{base: base}
+		})
+	}
+}
+
+// WithTransientRetries repeats a check that failed without a response or
+// with a 5xx status up to retries times, waiting baseDelay before the first
+// retry and twice as long before each next one. The check keeps its slot of
+// WithMaxActiveChecks while waiting. Zero, the default, disables them; a
+// non-positive baseDelay falls back to DefaultTransientRetryDelay.
+func WithTransientRetries(retries int, baseDelay time.Duration) Option {
+	return func(urlchecker *URLChecker) {
+		if retries < 0 {
+			retries = 0
+		}
+		if baseDelay <= 0 {
+			baseDelay = DefaultTransientRetryDelay
+		}
+		urlchecker.transientRetries = retries
+		urlchecker.transientRetryDelay = baseDelay
+	}
+}
+
+// WithChangeWebhook posts a JSON event to url whenever a retry or recheck
+// changes the status of a link, e.g. when it went down, with the old and the
+// new status. Checks that leave the status as it was send nothing. Deliveries
+// time out after timeout, or DefaultWebhookTimeout when it isn't positive.
+// An empty url disables it.
+func WithChangeWebhook(url string, timeout time.Duration) Option {
+	return func(urlchecker *URLChecker) {
+		if url = strings.TrimSpace(url); url == "" {
+			urlchecker.changeWebhook = nil
+			return
+		}
+		if timeout <= 0 {
+			timeout = DefaultWebhookTimeout
+		}
+		urlchecker.changeWebhook = &changeWebhook{url: url, client: &http.Client{Timeout: timeout}}
+	}
+}
+
+// WithNotifier sends emailed reports through notifier. With notifyCompletion
+// it also gets a summary of every batch whose initial check finishes. A nil
+// notifier disables both.
+func WithNotifier(notifier Notifier, notifyCompletion bool) Option {
+	return func(urlchecker *URLChecker) {
+		urlchecker.notifier = notifier
+		urlchecker.notifyCompletion = notifyCompletion
+	}
+}
+
+// WithConnectionMetrics counts the connections opened by the checker's
+// transport and reports them with the other metrics: open and idle
+// connections, and how long checks waited to get one. It defaults to
+// DefaultConnectionMetrics.
+func WithConnectionMetrics(enabled bool) Option {
+	return func(urlchecker *URLChecker) {
+		if enabled {
+			urlchecker.connStats = &connStats{}
+		} else {
+			urlchecker.connStats = nil
+		}
+	}
+}
+
+// WithMetricsSnapshot turns the JSON metrics snapshot on or off. On by
+// default.
+func WithMetricsSnapshot(enabled bool) Option {
+	return func(urlchecker *URLChecker) {
+		urlchecker.metricsSnapshot = enabled
+	}
+}
+
+// WithHeadFirst checks links without explicit methods with a HEAD request
+// instead of GET, falling back to GET when the server answers 405 Method Not
+// Allowed or 501 Not Implemented. Off by default.
+func WithHeadFirst(enabled bool) Option {
+	return func(urlchecker *URLChecker) {
+		urlchecker.headFirst = enabled
+	}
+}
+
+// WithDebugMetadata stores the request and response headers of every check
+// with its link, for debugging. Exchanges larger than maxBytes once encoded
+// keep only the request line and status. Zero disables it.
+func WithDebugMetadata(maxBytes int) Option {
+	return func(urlchecker *URLChecker) {
+		if maxBytes < 0 {
+			maxBytes = 0
+		}
+		urlchecker.debugMetadataSize = maxBytes
+	}
+}
+
+// WithClock replaces the clock the service reads the time from, e.g. with a
+// FakeClock in tests.
+func WithClock(clock Clock) Option {
+	return func(urlchecker *URLChecker) {
+		if clock != nil {
+			urlchecker.clock = clock
+		}
+	}
+}
+
+// WithCheckProfiles sets the named profiles a check can select.
+func WithCheckProfiles(profiles map[string]CheckProfile) Option {
+	return func(urlchecker *URLChecker) {
+		urlchecker.checkProfiles = profiles
+	}
+}
+
+// WithCheckHeader sends header with every check. A header without a name is
+// ignored.
+func WithCheckHeader(header CheckHeader) Option {
+	return func(urlchecker *URLChecker) {
+		if header.Name != "" {
+			urlchecker.checkHeader = header
+		}
+	}
+}
+
+// WithBasicAuth applies HTTP basic auth to checks of the given hosts.
+func WithBasicAuth(creds map[string]BasicAuth) Option {
+	return func(urlchecker *URLChecker) {
+		normalized := make(map[string]BasicAuth, len(creds))
+		for host, auth := range creds {
+			normalized[strings.ToLower(strings.TrimSpace(host))] = auth
+		}
+		if len(normalized) == 0 {
+			return
+		}
+
+		urlchecker.wrapTransport(func(base http.RoundTripper) http.RoundTripper {
+			return &basicAuthTransport{base: base, creds: normalized}
+		})
+	}
+}
+
+// WithStatusOverrides counts the listed statuses as available for checks
+// answered by the given hosts, e.g. a host that refuses bots with 403 although
+// the page exists. Other hosts are unaffected.
+func WithStatusOverrides(overrides map[string][]int) Option {
+	return func(urlchecker *URLChecker) {
+		normalized := make(map[string]map[int]bool, len(overrides))
+		for host, statuses := range overrides {
+			host = strings.ToLower(strings.TrimSpace(host))
+			if normalized[host] == nil {
+				normalized[host] = make(map[int]bool, len(statuses))
+			}
+			for _, status := range statuses {
+				normalized[host][status] = true
+			}
+		}
+		urlchecker.statusOverrides = normalized
+	}
+}
+
+// WithReportTitle replaces the heading of PDF reports. An empty title keeps
+// DefaultReportTitle.
+func WithReportTitle(title string) Option {
+	return func(urlchecker *URLChecker) {
+		if title = strings.TrimSpace(title); title != "" {
+			urlchecker.reportTitle = title
+		}
+	}
+}
+
+// WithReportFont sets PDF reports in font instead of the embedded DejaVu Sans
+// Condensed, e.g. one covering scripts it lacks. A nil font keeps the
+// embedded one.
+func WithReportFont(font *ReportFont) Option {
+	return func(urlchecker *URLChecker) {
+		urlchecker.reportFont = font
+	}
+}
+
+// WithReportLogo places a logo above the heading of PDF reports.
+func WithReportLogo(logo *ReportLogo) Option {
+	return func(urlchecker *URLChecker) {
+		urlchecker.reportLogo = logo
+	}
+}
+
+// WithMaxReportSize caps the size of a generated report in bytes, in any
+// format. Streamed reports aren't buffered and so aren't capped. Zero or less
+// removes the limit.
+func WithMaxReportSize(size int64) Option {
+	return func(urlchecker *URLChecker) {
+		urlchecker.maxReportSize = size
+	}
+}
+
+// WithReportRenderer registers renderer for a report format, adding a format
+// or replacing a built-in one.
+func WithReportRenderer(format string, renderer ReportRenderer) Option {
+	return func(urlchecker *URLChecker) {
+		if renderer != nil {
+			urlchecker.renderers[ParseReportFormat(format)] = renderer
+		}
+	}
+}
+
+// WithRetryPollInterval sets how often the retry worker looks for batches
+// whose failed links are due for another attempt.
+func WithRetryPollInterval(interval time.Duration) Option {
+	return func(urlchecker *URLChecker) {
+		if interval <= 0 {
+			interval = DefaultRetryPollInterval
+		}
+		urlchecker.retryPollInterval = interval
+	}
+}
+
+// WithExpiryPollInterval sets how often the expiry worker deletes batches
+// whose expires_in has passed.
+func WithExpiryPollInterval(interval time.Duration) Option {
+	return func(urlchecker *URLChecker) {
+		if interval <= 0 {
+			interval = DefaultExpiryPollInterval
+		}
+		urlchecker.expiryPollInterval = interval
+	}
+}
+
+// WithSelfCheckInterval makes StartSelfCheckWorker ping the database every
+// interval and report the last successful ping in the health status. Zero
+// disables it.
+func WithSelfCheckInterval(interval time.Duration) Option {
+	return func(urlchecker *URLChecker) {
+		if interval < 0 {
+			interval = 0
+		}
+		urlchecker.selfCheckInterval = interval
+	}
+}
+
+// WithMinRecheckInterval makes a URL checked within the interval reuse its
+// previous result instead of being requested again. Zero disables the guard.
+func WithMinRecheckInterval(interval time.Duration) Option {
+	return func(urlchecker *URLChecker) {
+		urlchecker.recheckGuard = newRecheckGuard(interval)
+	}
+}
+
+// WithSharedChecks makes concurrent checks of the same URL with the same
+// request settings, e.g. from batches submitted at the same time, share one
+// request and its result. Off by default.
+func WithSharedChecks(enabled bool) Option {
+	return func(urlchecker *URLChecker) {
+		if enabled {
+			urlchecker.sharedChecks = newSharedChecks()
+		} else {
+			urlchecker.sharedChecks = nil
+		}
+	}
+}
+
+// WithBatchListLimit sets how many batches ListBatches returns when the
+// caller doesn't ask for a limit. Values below 1 fall back to
+// DefaultBatchListLimit.
+func WithBatchListLimit(limit int) Option {
+	return func(urlchecker *URLChecker) {
+		if limit < 1 {
+			limit = DefaultBatchListLimit
+		}
+		urlchecker.batchListLimit = limit
+	}
+}
+
+// WithMaxLinksPerHost caps how many links of a single batch may target the
+// same host; the excess is reported as invalid instead of being checked.
+// Zero means unlimited.
+func WithMaxLinksPerHost(limit int) Option {
+	return func(urlchecker *URLChecker) {
+		if limit < 0 {
+			limit = 0
+		}
+		urlchecker.maxLinksPerHost = limit
+	}
+}
+
+// WithMethodPolicy sets whether a link checked with several methods needs all
+// or any of them to succeed when the request doesn't say. Unknown values
+// fall back to all.
+func WithMethodPolicy(policy models.MethodPolicy) Option {
+	return func(urlchecker *URLChecker) {
+		if policy != models.MethodPolicyAny {
+			policy = models.MethodPolicyAll
+		}
+		urlchecker.methodPolicy = policy
+	}
+}
+
+// WithMaxBatches caps how many batches are stored. Creating a batch past the
+// cap deletes the oldest finished batches with their links. Zero is
+// unlimited.
+func WithMaxBatches(limit int) Option {
+	return func(urlchecker *URLChecker) {
+		if limit < 0 {
+			limit = 0
+		}
+		urlchecker.maxBatches = limit
+	}
+}
+
+// WithMinSuccessRatio marks a batch completed_degraded instead of completed
+// when fewer than ratio of its links are available after the initial check.
+// Zero disables it; values above 1 are capped at 1.
+func WithMinSuccessRatio(ratio float64) Option {
+	return func(urlchecker *URLChecker) {
+		urlchecker.minSuccessRatio = max(0, min(ratio, 1))
+	}
+}
+
+// WithProcessingGracePeriod sets how old a batch must be before LoadBatches
+// treats its links still in processing as interrupted.
+func WithProcessingGracePeriod(period time.Duration) Option {
+	return func(urlchecker *URLChecker) {
+		if period < 0 {
+			period = 0
+		}
+		urlchecker.processingGracePeriod = period
+	}
+}
+
+// WithResultTTL marks a batch as stale when any of its link results is older
+// than ttl. Zero disables staleness.
+func WithResultTTL(ttl time.Duration) Option {
+	return func(urlchecker *URLChecker) {
+		if ttl < 0 {
+			ttl = 0
+		}
+		urlchecker.resultTTL = ttl
+	}
+}
+
+// WithDependencies sets upstream URLs that must respond for the service to
+// report ready. Results are cached for cacheTTL; non-positive durations fall
+// back to the defaults.
+func WithDependencies(urls []string, timeout, cacheTTL time.Duration) Option {
+	return func(urlchecker *URLChecker) {
+		if timeout <= 0 {
+			timeout = DefaultDependencyProbeTimeout
+		}
+		if cacheTTL <= 0 {
+			cacheTTL = DefaultDependencyProbeCacheTTL
+		}
+
+		var filtered []string
+		for _, url := range urls {
+			if url = strings.TrimSpace(url); url != "" {
+				filtered = append(filtered, url)
+			}
+		}
+
+		urlchecker.dependencies = &dependencyProber{
+			urls:     filtered,
+			timeout:  timeout,
+			cacheTTL: cacheTTL,
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrUnknownProfile is returned for a check that names a profile that isn't
+// configured.
+var ErrUnknownProfile = errors.New("unknown profile")
+
+// CheckProfile is a named bundle of check settings a batch can select instead
+// of specifying each of them.
+type CheckProfile struct {
+	Timeout    time.Duration
+	UserAgent  string
+	RetryCount int
+	RetryDelay time.Duration
+}
+
+// checkProfileJSON is how a profile is written in a profiles file, with
+// durations such as "2s".
+type checkProfileJSON struct {
+	Timeout    string `json:"timeout"`
+	UserAgent  string `json:"user_agent"`
+	RetryCount int    `json:"retry_count"`
+	RetryDelay string `json:"retry_delay"`
+}
+
+// ParseCheckProfiles parses a JSON object mapping profile names to their
+// settings.
+func ParseCheckProfiles(data []byte) (map[string]CheckProfile, error) {
+	var raw map[string]checkProfileJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid profiles: %w", err)
+	}
+
+	profiles := make(map[string]CheckProfile, len(raw))
+	for name, p := range raw {
+		if strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("profile without a name")
+		}
+
+		var profile CheckProfile
+		var err error
+		if profile.Timeout, err = parseProfileDuration(p.Timeout); err != nil {
+			return nil, fmt.Errorf("invalid timeout of profile %s: %w", name, err)
+		}
+		if profile.RetryDelay, err = parseProfileDuration(p.RetryDelay); err != nil {
+			return nil, fmt.Errorf("invalid retry_delay of profile %s: %w", name, err)
+		}
+		if p.RetryCount < 0 || p.RetryCount > MaxRetryCount {
+			return nil, fmt.Errorf("retry_count of profile %s must be between 0 and %d", name, MaxRetryCount)
+		}
+		profile.RetryCount = p.RetryCount
+		profile.UserAgent = strings.TrimSpace(p.UserAgent)
+
+		profiles[name] = profile
+	}
+	return profiles, nil
+}
+
+// LoadCheckProfiles reads profiles from a JSON file.
+func LoadCheckProfiles(path string) (map[string]CheckProfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profiles: %w", err)
+	}
+	return ParseCheckProfiles(data)
+}
+
+func parseProfileDuration(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("must not be negative")
+	}
+	return d, nil
+}
+
+// applyProfile fills in the settings of the profile opts names. Settings
+// given with the request take precedence over the profile's.
+func (urlchecker *URLChecker) applyProfile(opts CheckOptions) (CheckOptions, error) {
+	if opts.Profile == "" {
+		return opts, nil
+	}
+
+	profile, ok := urlchecker.checkProfiles[opts.Profile]
+	if !ok {
+		return opts, fmt.Errorf("%w %q", ErrUnknownProfile, opts.Profile)
+	}
+
+	if opts.Timeout == 0 {
+		opts.Timeout = profile.Timeout
+	}
+	if opts.RetryCount == 0 && opts.RetryDelay == 0 {
+		opts.RetryCount = profile.RetryCount
+		opts.RetryDelay = profile.RetryDelay
+	}
+	return opts, nil
+}
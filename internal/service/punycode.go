@@ -0,0 +1,51 @@
+package service
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+// asciiURL returns rawURL the way it goes over the wire: an internationalized
+// host in its punycode form and any other non-ASCII character
+// percent-encoded. It reports false when rawURL can't be parsed or its host
+// isn't a valid domain name.
+func asciiURL(rawURL string) (string, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "", false
+	}
+
+	if hostname := u.Hostname(); !isASCII(hostname) {
+		host, err := idna.Lookup.ToASCII(hostname)
+		if err != nil {
+			return "", false
+		}
+		if port := u.Port(); port != "" {
+			host += ":" + port
+		}
+		u.Host = host
+	}
+
+	var b strings.Builder
+	for _, c := range []byte(u.String()) {
+		if c < utf8.RuneSelf {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String(), true
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
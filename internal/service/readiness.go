@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"url-checker/internal/models"
+)
+
+// dependencyProber probes the configured upstream dependencies for readiness,
+// caching results briefly so frequent readiness checks don't hammer them.
+// Probes go through a plain client on the caller's transport: the layers
+// options add for link checks, such as credentials, close-connection hosts or
+// connection metrics, don't apply to them.
+type dependencyProber struct {
+	urls     []string
+	timeout  time.Duration
+	cacheTTL time.Duration
+
+	mu       sync.Mutex
+	results  []models.DependencyStatus
+	probedAt time.Time
+}
+
+func (p *dependencyProber) probe(ctx context.Context, client *http.Client, now time.Time) []models.DependencyStatus {
+	if len(p.urls) == 0 {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.results != nil && now.Sub(p.probedAt) < p.cacheTTL {
+		return p.results
+	}
+
+	results := make([]models.DependencyStatus, len(p.urls))
+	var wg sync.WaitGroup
+	for i, url := range p.urls {
+		wg.Add(1)
+		go func(i int, url string) {
+			defer wg.Done()
+			results[i] = p.probeOne(ctx, client, url)
+		}(i, url)
+	}
+	wg.Wait()
+
+	// probes cut short by the caller say nothing about the dependencies
+	if ctx.Err() != nil {
+		return results
+	}
+	p.results = results
+	p.probedAt = now
+	return results
+}
+
+func (p *dependencyProber) probeOne(ctx context.Context, client *http.Client, url string) models.DependencyStatus {
+	status := models.DependencyStatus{Name: url}
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	req.Header.Set("User-Agent", DefaultUserAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 400 {
+		status.Healthy = true
+	} else {
+		status.Error = fmt.Sprintf("unexpected status %d", resp.StatusCode)
+	}
+	return status
+}
+
+// GetReadiness reports whether the service can take traffic: it is not
+// shutting down, the database responds and every configured dependency is up.
+func (urlchecker *URLChecker) GetReadiness(ctx context.Context) models.Readiness {
+	dbStatus := models.DependencyStatus{Name: "database", Healthy: true}
+	if err := urlchecker.db.Ping(ctx); err != nil {
+		dbStatus.Healthy = false
+		dbStatus.Error = err.Error()
+	}
+
+	checks := []models.DependencyStatus{dbStatus}
+	checks = append(checks, urlchecker.dependencies.probe(ctx, urlchecker.probeClient, urlchecker.clock.Now())...)
+
+	ready := !urlchecker.IsShutdown()
+	for _, check := range checks {
+		if !check.Healthy {
+			ready = false
+		}
+	}
+
+	return models.Readiness{
+		Ready:    ready,
+		Shutdown: urlchecker.IsShutdown(),
+		Checks:   checks,
+	}
+}
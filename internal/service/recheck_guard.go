@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"url-checker/internal/models"
+)
+
+// recheckGuard remembers recent results per checkKey so that a URL checked
+// within the minimum interval is not requested from its server again the
+// same way.
+type recheckGuard struct {
+	interval  time.Duration
+	mu        sync.Mutex
+	results   map[string]guardedResult
+	lastPrune time.Time
+}
+
+type guardedResult struct {
+	status     models.LinkStatus
+	code       int
+	statusText string
+	checkedAt  time.Time
+}
+
+func newRecheckGuard(interval time.Duration) *recheckGuard {
+	return &recheckGuard{
+		interval: interval,
+		results:  make(map[string]guardedResult),
+	}
+}
+
+func (g *recheckGuard) recent(key string, now time.Time) (guardedResult, bool) {
+	if g.interval <= 0 {
+		return guardedResult{}, false
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	result, ok := g.results[key]
+	if !ok || now.Sub(result.checkedAt) >= g.interval {
+		return guardedResult{}, false
+	}
+	return result, true
+}
+
+func (g *recheckGuard) remember(key string, result guardedResult, now time.Time) {
+	if g.interval <= 0 {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	result.checkedAt = now
+	g.results[key] = result
+
+	if now.Sub(g.lastPrune) < g.interval {
+		return
+	}
+	for key, result := range g.results {
+		if now.Sub(result.checkedAt) >= g.interval {
+			delete(g.results, key)
+		}
+	}
+	g.lastPrune = now
+}
+
+// checkKey identifies the request a check of rawURL makes: checks may only
+// share a request, or reuse a remembered result, when they would send the
+// same request with the same limits.
+func (urlchecker *URLChecker) checkKey(ctx context.Context, rawURL string, timeout time.Duration) string {
+	return fmt.Sprintf("%s\n%s\n%s\n%t\n%s", normalizeURL(rawURL), userAgentFrom(ctx), serverNameFrom(ctx),
+		keepAliveDisabled(ctx), urlchecker.requestTimeout(timeout))
+}
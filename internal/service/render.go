@@ -0,0 +1,491 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"url-checker/internal/models"
+
+	"github.com/jung-kurt/gofpdf"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	ReportFormatPDF  = "pdf"
+	ReportFormatCSV  = "csv"
+	ReportFormatJSON = "json"
+	ReportFormatHTML = "html"
+)
+
+// ReportRenderer writes a report of batches and their links in one format.
+// Links are ordered by batch and belong to the given batches.
+type ReportRenderer interface {
+	Render(ctx context.Context, batches []*models.Batch, links []*models.Link, w io.Writer) error
+	ContentType() string
+	FileExtension() string
+}
+
+// ParseReportFormat normalizes a report format name. An empty name means PDF.
+func ParseReportFormat(value string) string {
+	format := strings.ToLower(strings.TrimSpace(value))
+	if format == "" {
+		return ReportFormatPDF
+	}
+	return format
+}
+
+// ReportRenderer returns the renderer registered for format.
+func (urlchecker *URLChecker) ReportRenderer(format string) (ReportRenderer, error) {
+	renderer, ok := urlchecker.renderers[ParseReportFormat(format)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported report format %q", format)
+	}
+	return renderer, nil
+}
+
+// registerDefaultRenderers fills in the built-in formats that weren't
+// replaced by WithReportRenderer, using the configured report settings.
+func (urlchecker *URLChecker) registerDefaultRenderers() {
+	defaults := map[string]ReportRenderer{
+		ReportFormatPDF:  &pdfRenderer{title: urlchecker.reportTitle, logo: urlchecker.reportLogo, font: urlchecker.reportFont, logger: urlchecker.logger, clock: urlchecker.clock},
+		ReportFormatCSV:  &csvRenderer{opts: urlchecker.csvOptions},
+		ReportFormatJSON: &jsonRenderer{clock: urlchecker.clock},
+		ReportFormatHTML: &htmlRenderer{title: urlchecker.reportTitle, clock: urlchecker.clock},
+	}
+
+	for format, renderer := range defaults {
+		if _, ok := urlchecker.renderers[format]; !ok {
+			urlchecker.renderers[format] = renderer
+		}
+	}
+}
+
+// groupLinks maps batch numbers to their links.
+func groupLinks(links []*models.Link) map[int][]*models.Link {
+	grouped := make(map[int][]*models.Link)
+	for _, link := range links {
+		grouped[link.BatchNum] = append(grouped[link.BatchNum], link)
+	}
+	return grouped
+}
+
+func reportStatusText(status models.LinkStatus) string {
+	switch status {
+	case models.StatusAvailable:
+		return "Available"
+	case models.StatusError:
+		return "Error"
+	case models.StatusProcessing:
+		return "Still processing"
+	default:
+		return "Not Available"
+	}
+}
+
+type pdfRenderer struct {
+	title  string
+	logo   *ReportLogo
+	font   *ReportFont
+	logger *logrus.Logger
+	clock  Clock
+}
+
+func (r *pdfRenderer) ContentType() string   { return "application/pdf" }
+func (r *pdfRenderer) FileExtension() string { return "pdf" }
+
+func (r *pdfRenderer) Render(ctx context.Context, batches []*models.Batch, links []*models.Link, w io.Writer) error {
+	batchLinks := groupLinks(links)
+	opts := ReportOptionsFrom(ctx)
+
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetTitle(r.title, true)
+	pdf.AddPage()
+
+	font := r.font
+	if font == nil {
+		font = defaultReportFont()
+	}
+	// gofpdf pads the font's tables in place, so every document gets its own
+	// copy instead of writing into the one shared by concurrent reports
+	data := bytes.Clone(font.data)
+	family := reportFontFamily
+	for _, style := range []string{"", "B", "I"} {
+		pdf.AddUTF8FontFromBytes(family, style, data)
+	}
+
+	// content breaks onto a new page at the bottom margin, where the footer
+	// numbers the pages
+	pdf.AliasNbPages("")
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-15)
+		pdf.SetFont(family, "I", 8)
+		pdf.CellFormat(0, 10, fmt.Sprintf("Page %d of {nb}", pdf.PageNo()), "", 0, "C", false, 0, "")
+	})
+
+	text := func(s string) string {
+		encoded, replaced := font.encode(s)
+		if replaced > 0 {
+			r.logger.Warnf("Replaced %d characters the report font can't render in %q", replaced, s)
+		}
+		return encoded
+	}
+	// a URL the font can't print is shown the way it is requested, with a
+	// punycode host and percent-encoded path, rather than with placeholders
+	urlText := func(rawURL string) string {
+		if _, replaced := font.encode(rawURL); replaced > 0 {
+			if ascii, ok := asciiURL(rawURL); ok {
+				return ascii
+			}
+		}
+		return rawURL
+	}
+
+	if logo := r.logo; logo != nil {
+		pdf.RegisterImageOptionsReader("logo", gofpdf.ImageOptions{ImageType: logo.imageType}, bytes.NewReader(logo.data))
+		pdf.ImageOptions("logo", 10, 0, 0, 15, true, gofpdf.ImageOptions{ImageType: logo.imageType}, 0, "")
+		pdf.Ln(5)
+	}
+
+	pdf.SetFont(family, "B", 16)
+	pdf.Cell(40, 10, text(r.title))
+	pdf.Ln(15)
+
+	pdf.SetFont(family, "", 12)
+	pdf.Cell(40, 10, fmt.Sprintf("Generated: %s", r.clock.Now().Format("2006-01-02 15:04:05")))
+	pdf.Ln(15)
+
+	// a table of the link counts per batch and overall, ahead of the detail;
+	// batches without links get a row of zeros
+	pdf.SetFont(family, "B", 12)
+	pdf.Cell(40, 8, "Summary")
+	pdf.Ln(8)
+	summaryRow := func(style, label string, summary models.ReportSummary) {
+		pdf.SetFont(family, style, 10)
+		pdf.CellFormat(50, 7, label, "1", 0, "L", false, 0, "")
+		for _, count := range []int{summary.Total, summary.Available, summary.NotAvailable, summary.Processing} {
+			pdf.CellFormat(35, 7, strconv.Itoa(count), "1", 0, "R", false, 0, "")
+		}
+		pdf.Ln(7)
+	}
+	pdf.SetFont(family, "B", 10)
+	pdf.CellFormat(50, 7, "Batch", "1", 0, "L", false, 0, "")
+	for _, heading := range []string{"Links", "Available", "Not available", "Processing"} {
+		pdf.CellFormat(35, 7, heading, "1", 0, "R", false, 0, "")
+	}
+	pdf.Ln(7)
+	for _, batch := range batches {
+		summaryRow("", fmt.Sprintf("link_num #%d", batch.LinksNum), summarizeLinks(batchLinks[batch.LinksNum]))
+	}
+	summaryRow("B", "All batches", summarizeLinks(links))
+	pdf.Ln(8)
+
+	for _, batch := range batches {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		pdf.SetFont(family, "B", 14)
+		pdf.Cell(40, 10, fmt.Sprintf("link_num #%d (%s)", batch.LinksNum, batch.Status))
+		pdf.Ln(10)
+
+		pdf.SetFont(family, "", 10)
+		pdf.Cell(40, 10, fmt.Sprintf("Created: %s", batch.CreatedAt.Format("2006-01-02 15:04:05")))
+		pdf.Ln(8)
+
+		processing := 0
+		linkLine := func(link *models.Link) {
+			if link.Status == models.StatusProcessing {
+				processing++
+			}
+			status := reportStatusText(link.Status)
+			if link.StatusText != "" {
+				status += fmt.Sprintf(" (HTTP %s)", link.StatusText)
+			} else if link.StatusCode != 0 {
+				status += fmt.Sprintf(" (HTTP %d)", link.StatusCode)
+			}
+			if link.ResponseTimeMs != 0 {
+				status += fmt.Sprintf(" in %d ms", link.ResponseTimeMs)
+			}
+			line := fmt.Sprintf("%s: %s", urlText(link.URL), status)
+			if link.Notes != "" {
+				// kept on the same line so the layout matches EstimateReport
+				line += fmt.Sprintf(" (%s)", link.Notes)
+			}
+			// the text wraps within the right margin, so long URLs stay on
+			// the page, and its lines stay indented past the bullet
+			pdf.Cell(pdf.GetStringWidth("- "), 6, "-")
+			pdf.MultiCell(0, 6, text(line), "", "L", false)
+		}
+		if opts.GroupBy == models.ReportGroupByStatusClass {
+			for _, group := range groupByStatusClass(batchLinks[batch.LinksNum]) {
+				pdf.SetFont(family, "B", 10)
+				pdf.Cell(40, 8, fmt.Sprintf("%s (%d)", group.StatusClass, group.Count))
+				pdf.Ln(7)
+				pdf.SetFont(family, "", 10)
+				for _, link := range group.Links {
+					linkLine(link)
+				}
+			}
+		} else {
+			for _, link := range batchLinks[batch.LinksNum] {
+				linkLine(link)
+			}
+		}
+		if processing > 0 {
+			pdf.SetFont(family, "I", 10)
+			pdf.Cell(40, 8, fmt.Sprintf("%d of %d links were still processing when the report was generated", processing, len(batchLinks[batch.LinksNum])))
+			pdf.Ln(6)
+		}
+		pdf.Ln(10)
+	}
+
+	return pdf.Output(w)
+}
+
+// csvRenderer writes one row per link, using the configured CSV encoding
+// unless the report's options ask for another.
+type csvRenderer struct {
+	opts CSVOptions
+}
+
+func (r *csvRenderer) ContentType() string   { return "text/csv; charset=utf-8" }
+func (r *csvRenderer) FileExtension() string { return "csv" }
+
+func (r *csvRenderer) Render(ctx context.Context, batches []*models.Batch, links []*models.Link, w io.Writer) error {
+	reportOpts := ReportOptionsFrom(ctx)
+	opts := r.opts
+	if reportOpts.CSVDelimiter != 0 {
+		opts.Delimiter = reportOpts.CSVDelimiter
+	}
+	if reportOpts.CSVBOM != nil {
+		opts.BOM = *reportOpts.CSVBOM
+	}
+
+	writer, err := newCSVWriter(w, opts)
+	if err != nil {
+		return err
+	}
+
+	// grouped rows are ordered by status class, each with its class and the
+	// number of links the batch has in it
+	grouped := reportOpts.GroupBy == models.ReportGroupByStatusClass
+	header := []string{"batch_num", "batch_status", "url", "status", "checked_at", "check_source", "notes"}
+	if grouped {
+		header = append(header, "status_class", "status_class_count")
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	writeLink := func(batch *models.Batch, link *models.Link, extra ...string) error {
+		checkedAt := ""
+		if link.Time != nil {
+			checkedAt = link.Time.UTC().Format(time.RFC3339)
+		}
+
+		record := []string{strconv.Itoa(batch.LinksNum), string(batch.Status), link.URL, string(link.Status), checkedAt, string(link.CheckSource), link.Notes}
+		return writer.Write(append(record, extra...))
+	}
+
+	batchLinks := groupLinks(links)
+	for _, batch := range batches {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if !grouped {
+			for _, link := range batchLinks[batch.LinksNum] {
+				if err := writeLink(batch, link); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		for _, group := range groupByStatusClass(batchLinks[batch.LinksNum]) {
+			for _, link := range group.Links {
+				if err := writeLink(batch, link, group.StatusClass, strconv.Itoa(group.Count)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// jsonRenderer writes the batches with their links nested.
+type jsonRenderer struct {
+	clock Clock
+}
+
+type jsonReportBatch struct {
+	*models.Batch
+	Summary models.ReportSummary `json:"summary"`
+	Links   []*models.Link       `json:"links"`
+}
+
+// jsonGroupedReportBatch lists the links of a batch in their groups instead.
+type jsonGroupedReportBatch struct {
+	*models.Batch
+	Summary models.ReportSummary      `json:"summary"`
+	Groups  []models.StatusClassGroup `json:"groups"`
+}
+
+func summarizeLinks(links []*models.Link) models.ReportSummary {
+	summary := models.ReportSummary{Total: len(links)}
+	for _, link := range links {
+		switch link.Status {
+		case models.StatusAvailable:
+			summary.Available++
+		case models.StatusProcessing:
+			summary.Processing++
+		default:
+			summary.NotAvailable++
+		}
+	}
+	return summary
+}
+
+func (r *jsonRenderer) ContentType() string   { return "application/json" }
+func (r *jsonRenderer) FileExtension() string { return "json" }
+
+func (r *jsonRenderer) Render(ctx context.Context, batches []*models.Batch, links []*models.Link, w io.Writer) error {
+	batchLinks := groupLinks(links)
+	grouped := ReportOptionsFrom(ctx).GroupBy == models.ReportGroupByStatusClass
+
+	// written batch by batch so a streamed report arrives incrementally; the
+	// output is the same as encoding the whole report at once
+	generatedAt, err := json.Marshal(r.clock.Now().UTC())
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, `{"generated_at":%s,"batches":[`, generatedAt); err != nil {
+		return err
+	}
+
+	for i, batch := range batches {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		batchLinkList := batchLinks[batch.LinksNum]
+		if batchLinkList == nil {
+			batchLinkList = []*models.Link{}
+		}
+		var section any = jsonReportBatch{Batch: batch, Summary: summarizeLinks(batchLinkList), Links: batchLinkList}
+		if grouped {
+			groups := groupByStatusClass(batchLinkList)
+			if groups == nil {
+				groups = []models.StatusClassGroup{}
+			}
+			section = jsonGroupedReportBatch{Batch: batch, Summary: summarizeLinks(batchLinkList), Groups: groups}
+		}
+		data, err := json.Marshal(section)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			data = append([]byte(","), data...)
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+		flushReport(w)
+	}
+
+	_, err = io.WriteString(w, "]}\n")
+	return err
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"statusText": reportStatusText,
+	"datetime":   func(t time.Time) string { return t.Format("2006-01-02 15:04:05") },
+}).Parse(`{{define "header"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>Generated: {{datetime .GeneratedAt}}</p>
+{{end}}{{define "batch"}}<section>
+<h2>link_num #{{.LinksNum}} ({{.Status}})</h2>
+<p>Created: {{datetime .CreatedAt}}</p>
+{{if .Groups}}{{range .Groups}}<h3>{{.StatusClass}} ({{.Count}})</h3>
+<ul>
+{{template "links" .Links}}</ul>
+{{end}}{{else}}<ul>
+{{template "links" .Links}}</ul>
+{{end}}</section>
+{{end}}{{define "links"}}{{range .}}<li>{{.URL}}: {{statusText .Status}}{{with .Notes}} ({{.}}){{end}}</li>
+{{end}}{{end}}{{define "footer"}}</body>
+</html>
+{{end}}`))
+
+// htmlRenderer writes a standalone HTML page with the same layout as the PDF.
+type htmlRenderer struct {
+	title string
+	clock Clock
+}
+
+// htmlReportBatch is a batch section of the page, with its links in groups
+// when the report is grouped.
+type htmlReportBatch struct {
+	*models.Batch
+	Links  []*models.Link
+	Groups []models.StatusClassGroup
+}
+
+func (r *htmlRenderer) ContentType() string   { return "text/html; charset=utf-8" }
+func (r *htmlRenderer) FileExtension() string { return "html" }
+
+func (r *htmlRenderer) Render(ctx context.Context, batches []*models.Batch, links []*models.Link, w io.Writer) error {
+	batchLinks := groupLinks(links)
+	grouped := ReportOptionsFrom(ctx).GroupBy == models.ReportGroupByStatusClass
+
+	header := struct {
+		Title       string
+		GeneratedAt time.Time
+	}{
+		Title:       r.title,
+		GeneratedAt: r.clock.Now(),
+	}
+	if err := htmlReportTemplate.ExecuteTemplate(w, "header", header); err != nil {
+		return err
+	}
+
+	for _, batch := range batches {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		section := htmlReportBatch{Batch: batch, Links: batchLinks[batch.LinksNum]}
+		if grouped {
+			section.Groups = groupByStatusClass(section.Links)
+		}
+		if err := htmlReportTemplate.ExecuteTemplate(w, "batch", section); err != nil {
+			return err
+		}
+		flushReport(w)
+	}
+
+	return htmlReportTemplate.ExecuteTemplate(w, "footer", nil)
+}
+
+// flushReport sends what a renderer has written so far on to the client when
+// w can flush, so streamed reports arrive batch by batch.
+func flushReport(w io.Writer) {
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,191 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"url-checker/internal/models"
+
+	"github.com/jung-kurt/gofpdf"
+	"golang.org/x/image/font/sfnt"
+)
+
+const (
+	DefaultReportTitle   = "URL Availability Report"
+	DefaultMaxReportSize = 64 << 20
+)
+
+// ErrReportTooLarge is returned when a report would exceed the configured
+// maximum size.
+var ErrReportTooLarge = errors.New("report exceeds the maximum size, request fewer batches")
+
+// ReportOptions are the settings of a single report request.
+type ReportOptions struct {
+	// GroupBy lists the links of each batch in groups instead of in the
+	// order they were submitted.
+	GroupBy models.ReportGrouping
+
+	// CSVDelimiter and CSVBOM replace the configured CSV encoding of csv
+	// reports when set.
+	CSVDelimiter rune
+	CSVBOM       *bool
+}
+
+type reportOptionsKey struct{}
+
+// WithReportOptions returns a copy of ctx that makes the reports generated
+// with it use opts.
+func WithReportOptions(ctx context.Context, opts ReportOptions) context.Context {
+	return context.WithValue(ctx, reportOptionsKey{}, opts)
+}
+
+// ReportOptionsFrom returns the report options ctx carries, the zero value
+// when it carries none.
+func ReportOptionsFrom(ctx context.Context) ReportOptions {
+	opts, _ := ctx.Value(reportOptionsKey{}).(ReportOptions)
+	return opts
+}
+
+// reportWriter collects report output and fails once it grows past max bytes.
+// A max below 1 disables the limit.
+type reportWriter struct {
+	buf bytes.Buffer
+	max int64
+}
+
+func (w *reportWriter) Write(p []byte) (int, error) {
+	if w.max > 0 && int64(w.buf.Len()+len(p)) > w.max {
+		return 0, ErrReportTooLarge
+	}
+	return w.buf.Write(p)
+}
+
+// ReportLogo is an image placed at the top of PDF reports.
+type ReportLogo struct {
+	data      []byte
+	imageType string
+}
+
+// NewReportLogo validates data as a PNG or JPEG image.
+func NewReportLogo(data []byte) (*ReportLogo, error) {
+	_, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid logo image: %w", err)
+	}
+
+	switch format {
+	case "png":
+		return &ReportLogo{data: data, imageType: "PNG"}, nil
+	case "jpeg":
+		return &ReportLogo{data: data, imageType: "JPG"}, nil
+	default:
+		return nil, fmt.Errorf("unsupported logo format %q, expected PNG or JPEG", format)
+	}
+}
+
+// LoadReportLogo reads and validates a logo image file.
+func LoadReportLogo(path string) (*ReportLogo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read logo: %w", err)
+	}
+	return NewReportLogo(data)
+}
+
+// reportFontFamily is the name a ReportFont is registered under.
+const reportFontFamily = "ReportFont"
+
+// ReportFont is a TrueType font PDF reports are set in. Text is printed as
+// written as long as the font has glyphs for it, so internationalized domain
+// names don't need the Latin-1 of the core PDF fonts.
+type ReportFont struct {
+	data   []byte
+	glyphs *sfnt.Font
+}
+
+// NewReportFont validates data as a TrueType font.
+func NewReportFont(data []byte) (*ReportFont, error) {
+	// gofpdf logs an unreadable font instead of failing, so the header is
+	// checked here
+	if len(data) < 4 || (!bytes.Equal(data[:4], []byte{0, 1, 0, 0}) && !bytes.Equal(data[:4], []byte("true"))) {
+		return nil, fmt.Errorf("invalid font: not a TrueType font")
+	}
+
+	glyphs, err := sfnt.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid font: %w", err)
+	}
+
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	// a copy, as gofpdf pads the tables in place and data is kept
+	pdf.AddUTF8FontFromBytes(reportFontFamily, "", bytes.Clone(data))
+	pdf.AddPage()
+	pdf.SetFont(reportFontFamily, "", 12)
+	if err := pdf.Output(io.Discard); err != nil {
+		return nil, fmt.Errorf("invalid font: %w", err)
+	}
+
+	return &ReportFont{data: data, glyphs: glyphs}, nil
+}
+
+// LoadReportFont reads and validates a TrueType font file.
+func LoadReportFont(path string) (*ReportFont, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read font: %w", err)
+	}
+	return NewReportFont(data)
+}
+
+// DejaVu Sans Condensed, shipped with gofpdf, covers Latin, Greek and
+// Cyrillic scripts among others.
+//
+//go:embed fonts/DejaVuSansCondensed.ttf
+var defaultReportFontData []byte
+
+// defaultReportFont is the font reports are set in unless WithReportFont
+// gives another.
+var defaultReportFont = sync.OnceValue(func() *ReportFont {
+	font, err := NewReportFont(defaultReportFontData)
+	if err != nil {
+		panic(fmt.Sprintf("embedded report font: %v", err))
+	}
+	return font
+})
+
+// reportPlaceholder stands in for characters the report font can't render.
+const reportPlaceholder = "?"
+
+// hasGlyph reports whether the font can render r.
+func (font *ReportFont) hasGlyph(r rune) bool {
+	var buf sfnt.Buffer
+	index, err := font.glyphs.GlyphIndex(&buf, r)
+	return err == nil && index != 0
+}
+
+// encode returns s with the characters the font has no glyph for replaced by
+// reportPlaceholder, and how many were replaced.
+func (font *ReportFont) encode(s string) (string, int) {
+	var b strings.Builder
+	replaced := 0
+	for _, r := range s {
+		if r < utf8.RuneSelf || (r != utf8.RuneError && font.hasGlyph(r)) {
+			b.WriteRune(r)
+		} else {
+			b.WriteString(reportPlaceholder)
+			replaced++
+		}
+	}
+	return b.String(), replaced
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"url-checker/internal/models"
+)
+
+// MaxReportDeadline is the longest a report may wait for its batches.
+const MaxReportDeadline = time.Minute
+
+// reportDeadlinePoll is how often a waiting report checks whether its batches
+// have finished.
+const reportDeadlinePoll = 50 * time.Millisecond
+
+// WaitForBatches waits up to deadline for the given batches to finish their
+// checks, so a report rendered afterwards covers as many results as the time
+// budget allows. It reports whether every batch finished; batches that didn't
+// are reported with their links still processing.
+func (urlchecker *URLChecker) WaitForBatches(ctx context.Context, batchIDs []int, deadline time.Duration) (bool, error) {
+	if deadline > MaxReportDeadline {
+		deadline = MaxReportDeadline
+	}
+
+	timer := time.NewTimer(deadline)
+	defer timer.Stop()
+
+	ticker := time.NewTicker(reportDeadlinePoll)
+	defer ticker.Stop()
+
+	for {
+		done, err := urlchecker.batchesFinished(ctx, batchIDs)
+		if err != nil || done {
+			return done, err
+		}
+
+		select {
+		case <-ticker.C:
+		case <-timer.C:
+			done, err := urlchecker.batchesFinished(ctx, batchIDs)
+			if err == nil && !done {
+				urlchecker.logger.Infof("Report deadline of %v passed with batches %v still processing", deadline, batchIDs)
+			}
+			return done, err
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}
+}
+
+func (urlchecker *URLChecker) batchesFinished(ctx context.Context, batchIDs []int) (bool, error) {
+	if err := urlchecker.acquireReadSlot(ctx); err != nil {
+		return false, err
+	}
+	defer urlchecker.releaseReadSlot()
+
+	batches, err := urlchecker.db.GetReportBatches(ctx, batchIDs)
+	if err != nil {
+		return false, fmt.Errorf("failed to get batches: %w", err)
+	}
+
+	for _, batch := range batches {
+		if batch.Status == models.BatchStatusProcessing {
+			return false, nil
+		}
+	}
+	return true, nil
+}
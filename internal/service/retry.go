@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"url-checker/internal/models"
+)
+
+const MaxRetryCount = 10
+
+// StartRetryWorker periodically re-checks failed links of batches that were
+// submitted with a retry policy, until the policy's retry count is used up.
+func (urlchecker *URLChecker) StartRetryWorker(ctx context.Context) {
+	ticker := time.NewTicker(urlchecker.retryPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			urlchecker.logger.Info("Retry worker shutting down...")
+			return
+		case <-ticker.C:
+			if urlchecker.IsShutdown() {
+				continue
+			}
+			urlchecker.runDueRetries(ctx)
+		}
+	}
+}
+
+func (urlchecker *URLChecker) runDueRetries(ctx context.Context) {
+	batches, err := urlchecker.db.GetBatchesPendingRetry(ctx)
+	if err != nil {
+		urlchecker.logger.Errorf("Failed to load batches pending retry: %v", err)
+		return
+	}
+
+	now := urlchecker.clock.Now()
+	for _, batch := range batches {
+		if batch.NextRetryAt == nil || batch.NextRetryAt.After(now) {
+			continue
+		}
+		urlchecker.retryBatch(ctx, batch)
+	}
+}
+
+func (urlchecker *URLChecker) retryBatch(ctx context.Context, batch *models.Batch) {
+	links, err := urlchecker.db.GetLinksByBatchNum(ctx, batch.LinksNum)
+	if err != nil {
+		urlchecker.logger.Errorf("Failed to load links for batch %d: %v", batch.LinksNum, err)
+		return
+	}
+
+	var failed []*models.Link
+	for _, link := range links {
+		if link.Status == models.StatusNotAvailable {
+			failed = append(failed, link)
+		}
+	}
+
+	retriesDone := batch.RetriesDone + 1
+	if len(failed) == 0 {
+		retriesDone = batch.RetryCount
+	} else {
+		urlchecker.logger.Infof("Retrying %d failed links of batch %d (attempt %d/%d)", len(failed), batch.LinksNum, retriesDone, batch.RetryCount)
+		urlchecker.recheckLinks(ctx, failed, models.CheckSourceRetry, urlchecker.batchCheckSpec(batch))
+		// the failed links were updated in place, so links holds every result
+		urlchecker.refreshCompletedStatus(ctx, batch, links)
+	}
+
+	var nextRetryAt *time.Time
+	if retriesDone < batch.RetryCount {
+		next := urlchecker.clock.Now().Add(time.Duration(batch.RetryDelayMs) * time.Millisecond)
+		nextRetryAt = &next
+	}
+
+	if err := urlchecker.db.UpdateBatchRetry(ctx, batch.LinksNum, retriesDone, nextRetryAt); err != nil {
+		urlchecker.logger.Errorf("Failed to update retry state for batch %d: %v", batch.LinksNum, err)
+	}
+}
+
+// recheckLinks checks existing links again, updating them in place and in the
+// database. Links whose status changed are reported to the change webhook.
+func (urlchecker *URLChecker) recheckLinks(ctx context.Context, links []*models.Link, source models.CheckSource, spec checkSpec) {
+	urls := make([]string, len(links))
+	for i, link := range links {
+		urls[i] = link.URL
+	}
+
+	urlchecker.checkEach(ctx, urls, spec, func(i int, check linkCheck, checkedAt time.Time) {
+		link := links[i]
+
+		previous := link.Status
+		link.Status = check.status
+		link.Time = &checkedAt
+		link.CheckSource = source
+		link.Methods = check.methods
+		link.Allow = check.allow
+		link.UserAgent = check.userAgent
+		link.Debug = check.debug
+		link.StatusCode = check.statusCode
+		link.StatusText = check.statusText
+		link.ResponseTimeMs = check.responseTime.Milliseconds()
+		link.Error = check.note
+
+		if err := urlchecker.storeLinkResult(ctx, link); err != nil {
+			urlchecker.logger.Errorf("Failed to update link status for %s: %v", link.URL, err)
+			return
+		}
+		urlchecker.notifyStatusChange(link, previous)
+	})
+}
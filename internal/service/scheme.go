@@ -0,0 +1,140 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"url-checker/internal/models"
+)
+
+// schemePrefix matches a scheme-like prefix followed by a separator with at
+// least one slash, so host:port links are not mistaken for schemes.
+var schemePrefix = regexp.MustCompile(`^([A-Za-z]+)(:/+|/{2,})`)
+
+// schemeName matches the scheme of a link in any form, including ones without
+// slashes such as data: or mailto:.
+var schemeName = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9+.-]*):`)
+
+// hostPort matches links that start with host:port rather than a scheme.
+var hostPort = regexp.MustCompile(`^[^/?#:]+:[0-9]+([/?#]|$)`)
+
+// DefaultAllowedSchemes are the link schemes checked unless configured
+// otherwise.
+var DefaultAllowedSchemes = []string{"http", "https"}
+
+// SchemeNotAllowedNote is the error recorded on links whose scheme is not in
+// the allowlist. Such links are never requested.
+const SchemeNotAllowedNote = "scheme not allowed"
+
+func schemeSet(schemes []string) map[string]bool {
+	set := make(map[string]bool, len(schemes))
+	for _, scheme := range schemes {
+		scheme = strings.ToLower(strings.TrimSpace(scheme))
+		scheme = strings.TrimSuffix(strings.TrimSuffix(scheme, "//"), ":")
+		if scheme != "" {
+			set[scheme] = true
+		}
+	}
+	return set
+}
+
+// linkScheme returns the lower-cased scheme of a link, or "" when it has none
+// and is checked as http.
+func linkScheme(link string) string {
+	if hostPort.MatchString(link) {
+		return ""
+	}
+	match := schemeName.FindStringSubmatch(link)
+	if match == nil {
+		return ""
+	}
+	return strings.ToLower(match[1])
+}
+
+// schemeCounts counts links per scheme, so batches mixing e.g. internal http
+// and external https links show their distribution.
+func schemeCounts(links []*models.Link) map[string]int {
+	counts := make(map[string]int)
+	for _, link := range links {
+		scheme := linkScheme(link.URL)
+		if scheme == "" {
+			scheme = "http"
+		}
+		counts[scheme]++
+	}
+	return counts
+}
+
+// schemeAllowed reports whether a link may be requested at all. Links without
+// a scheme are checked as http.
+func (urlchecker *URLChecker) schemeAllowed(link string) bool {
+	scheme := linkScheme(link)
+	if scheme == "" {
+		scheme = "http"
+	}
+	return urlchecker.allowedSchemes[scheme]
+}
+
+// schemeTypos maps common misspellings to the scheme they were meant to be.
+var schemeTypos = map[string]string{
+	"http":   "http",
+	"htp":    "http",
+	"htt":    "http",
+	"htpp":   "http",
+	"hhtp":   "http",
+	"htttp":  "http",
+	"https":  "https",
+	"htps":   "https",
+	"htts":   "https",
+	"htpps":  "https",
+	"hhtps":  "https",
+	"htttps": "https",
+	"httsp":  "https",
+	"httpss": "https",
+}
+
+// correctScheme fixes a misspelled or malformed http(s) scheme. It reports
+// whether the link changed, and fails for schemes it can't map to http(s).
+// Links without a scheme are left alone.
+func correctScheme(link string) (string, bool, error) {
+	match := schemePrefix.FindStringSubmatch(link)
+	if match == nil {
+		return link, false, nil
+	}
+
+	scheme, ok := schemeTypos[strings.ToLower(match[1])]
+	if !ok {
+		return link, false, fmt.Errorf("unsupported scheme %q", match[1])
+	}
+
+	corrected := scheme + "://" + link[len(match[0]):]
+	return corrected, corrected != link, nil
+}
+
+// correctSchemes applies correctScheme to every link. It returns the links to
+// check, the corrections applied keyed by the submitted link, and the links
+// that were rejected.
+func correctSchemes(links []string) ([]string, map[string]string, []models.InvalidLink) {
+	accepted := make([]string, 0, len(links))
+	var corrected map[string]string
+	var rejected []models.InvalidLink
+
+	for _, link := range links {
+		fixed, changed, err := correctScheme(link)
+		if err != nil {
+			rejected = append(rejected, models.InvalidLink{URL: link, Reason: err.Error()})
+			continue
+		}
+
+		if changed {
+			if corrected == nil {
+				corrected = make(map[string]string)
+			}
+			corrected[link] = fixed
+		}
+		accepted = append(accepted, fixed)
+	}
+
+	return accepted, corrected, rejected
+}
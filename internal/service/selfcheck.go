@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultSelfCheckTimeout bounds each database ping of the self-check worker.
+const DefaultSelfCheckTimeout = 5 * time.Second
+
+// selfCheckState is the outcome of the self-check worker's pings so far.
+type selfCheckState struct {
+	mu          sync.Mutex
+	lastSuccess time.Time
+	failures    int64
+}
+
+// StartSelfCheckWorker pings the database at the configured self-check
+// interval, keeping its connection warm and noticing database trouble before
+// a request does. It returns right away when self-checks are disabled.
+func (urlchecker *URLChecker) StartSelfCheckWorker(ctx context.Context) {
+	if urlchecker.selfCheckInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(urlchecker.selfCheckInterval)
+	defer ticker.Stop()
+
+	urlchecker.selfCheck(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			urlchecker.logger.Info("Self-check worker shutting down...")
+			return
+		case <-ticker.C:
+			if urlchecker.IsShutdown() {
+				continue
+			}
+			urlchecker.selfCheck(ctx)
+		}
+	}
+}
+
+func (urlchecker *URLChecker) selfCheck(ctx context.Context) {
+	pingCtx, cancel := context.WithTimeout(ctx, DefaultSelfCheckTimeout)
+	defer cancel()
+
+	err := urlchecker.db.Ping(pingCtx)
+
+	state := &urlchecker.selfCheckState
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if err != nil {
+		state.failures++
+		urlchecker.logger.Errorf("Self-check failed to ping the database: %v", err)
+		return
+	}
+	state.lastSuccess = urlchecker.clock.Now()
+}
+
+// selfCheckStatus returns when the last self-check succeeded, zero before
+// the first success, and how many have failed.
+func (urlchecker *URLChecker) selfCheckStatus() (time.Time, int64) {
+	state := &urlchecker.selfCheckState
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	return state.lastSuccess, state.failures
+}
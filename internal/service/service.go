@@ -1,19 +1,18 @@
 package service
 
 import (
-	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
-	"strings"
 	"sync"
 	"time"
 
 	"url-checker/internal/database"
 	"url-checker/internal/models"
 
-	"github.com/jung-kurt/gofpdf"
 	"github.com/sirupsen/logrus"
 )
 
@@ -21,24 +20,197 @@ type URLChecker struct {
 	db              *database.Database
 	logger          *logrus.Logger
 	pendingPDFTasks chan *PDFTask
+	pendingBatches  *batchQueue
 	httpClient      *http.Client
+	rootTransport   http.RoundTripper
+
+	// probeClient probes readiness dependencies on the caller's transport,
+	// without the layers added for link checks
+	probeClient *http.Client
+
+	transportLayers []func(http.RoundTripper) http.RoundTripper
+	checkHeader     CheckHeader
 	shutdown        bool
 	shutdownMux     sync.RWMutex
+	shutdownStats   *models.ShutdownStats
+	checkSlots      chan struct{}
+	pdfSlots        chan struct{}
+	writeSlots      chan struct{}
+	readSlots       chan struct{}
+	metrics         metrics
+
+	idempotencyWindow time.Duration
+	csvOptions        CSVOptions
+	retryPollInterval time.Duration
+	recheckGuard      *recheckGuard
+	dependencies      *dependencyProber
+	resultTTL         time.Duration
+	batchListLimit    int
+	maxLinksPerHost   int
+	methodPolicy      models.MethodPolicy
+	reportTitle       string
+	reportLogo        *ReportLogo
+	reportFont        *ReportFont
+	maxReportSize     int64
+	renderers         map[string]ReportRenderer
+
+	processingGracePeriod time.Duration
+	allowedSchemes        map[string]bool
+	expiryPollInterval    time.Duration
+	pdfQueueWait          time.Duration
+	minSuccessRatio       float64
+	maxBatches            int
+	fallbackUserAgents    []string
+	debugMetadataSize     int
+	clock                 Clock
+	statusOverrides       map[string]map[int]bool
+	checkProfiles         map[string]CheckProfile
+	headFirst             bool
+	checkTimeout          time.Duration
+	transientRetries      int
+	transientRetryDelay   time.Duration
+	submitDebounce        time.Duration
+	debouncer             submissionDebouncer
+	changeWebhook         *changeWebhook
+	connStats             *connStats
+	notifier              Notifier
+	notifyCompletion      bool
+	selfCheckInterval     time.Duration
+	selfCheckState        selfCheckState
+	redirectBodyLimit     int64
+	metricsSnapshot       bool
+	sharedChecks          *sharedChecks
+}
+
+// CheckOptions carries per-request settings for CheckLinksWithOptions.
+type CheckOptions struct {
+	// IdempotencyKey identifies a client submission; a repeated key within the
+	// idempotency window returns the original batch.
+	IdempotencyKey string
+
+	// RetryCount is how many times failed links are re-checked in the
+	// background after the initial run, waiting RetryDelay between attempts.
+	RetryCount int
+	RetryDelay time.Duration
+
+	// Timeout bounds each link request of the batch, including background
+	// retries. Zero leaves only the HTTP client's own timeout.
+	Timeout time.Duration
+
+	// Methods lists the HTTP methods each link is checked with; empty means a
+	// single GET. MethodPolicy decides whether all or any of them must
+	// succeed, falling back to the service default.
+	Methods      []string
+	MethodPolicy models.MethodPolicy
+
+	// DisableKeepAlive opens a new connection for every request of the
+	// batch, so timings include connection setup.
+	DisableKeepAlive bool
+
+	// ServerName overrides the TLS server name (SNI) sent to every host of
+	// the batch, independently of the request host.
+	ServerName string
+
+	// CorrectSchemes fixes common typos in link schemes, such as htp:// or
+	// https//, before checking and rejects other non-http(s) schemes.
+	CorrectSchemes bool
+
+	// DiscoverMethods also sends an OPTIONS request to every link and records
+	// the Allow header it answers with.
+	DiscoverMethods bool
+
+	// Cookies are sent with every request of the batch. They are never stored
+	// or logged, so they can't be combined with retries.
+	Cookies []models.Cookie
+
+	// ExpiresIn deletes the batch once this long has passed since it was
+	// submitted. Zero keeps it until removed otherwise.
+	ExpiresIn time.Duration
+
+	// Async stores the batch and returns right away with its links
+	// processing, leaving the checks to the batch worker.
+	Async bool
+
+	// Priority orders async batches waiting for the batch worker: higher
+	// ones are checked first, equal ones in submission order. It requires
+	// Async.
+	Priority int
+
+	// Ephemeral checks the links without storing a batch, so the results
+	// are only returned to the caller. It can't be combined with retries.
+	Ephemeral bool
+
+	// Profile names a configured CheckProfile whose settings fill in the ones
+	// not given here.
+	Profile string
+
+	// Dedup checks links that are the same resource under this mode only
+	// once. Empty keeps every link.
+	Dedup models.DedupMode
+
+	// Source tags the batch with the entry point that submitted it, such as
+	// the API or a scheduled run.
+	Source models.BatchSource
 }
 
 type PDFTask struct {
 	BatchIDs []int
+	Format   string
+	Options  ReportOptions
 	Result   chan []byte
 	Error    chan error
 }
 
-func NewURLChecker(db *database.Database, logger *logrus.Logger, httpClient *http.Client) *URLChecker {
-	return &URLChecker{
+func NewURLChecker(db *database.Database, logger *logrus.Logger, httpClient *http.Client, opts ...Option) *URLChecker {
+	urlchecker := &URLChecker{
 		db:              db,
 		logger:          logger,
 		pendingPDFTasks: make(chan *PDFTask, 10),
+		pendingBatches:  newBatchQueue(DefaultBatchQueueSize),
 		httpClient:      httpClient,
+		rootTransport:   httpClient.Transport,
+		probeClient:     &http.Client{Transport: httpClient.Transport},
+		checkSlots:      make(chan struct{}, DefaultMaxActiveChecks),
+		pdfSlots:        make(chan struct{}, DefaultMaxConcurrentPDFs),
+		writeSlots:      make(chan struct{}, DefaultMaxConcurrentDBWrites),
+		readSlots:       make(chan struct{}, DefaultMaxConcurrentDBReads),
+
+		idempotencyWindow: DefaultIdempotencyWindow,
+		csvOptions:        DefaultCSVOptions(),
+		retryPollInterval: DefaultRetryPollInterval,
+		reportTitle:       DefaultReportTitle,
+		maxReportSize:     DefaultMaxReportSize,
+		renderers:         make(map[string]ReportRenderer),
+		batchListLimit:    DefaultBatchListLimit,
+		methodPolicy:      models.MethodPolicyAll,
+		recheckGuard:      newRecheckGuard(0),
+		dependencies: &dependencyProber{
+			timeout:  DefaultDependencyProbeTimeout,
+			cacheTTL: DefaultDependencyProbeCacheTTL,
+		},
+
+		processingGracePeriod: DefaultProcessingGracePeriod,
+		allowedSchemes:        schemeSet(DefaultAllowedSchemes),
+		expiryPollInterval:    DefaultExpiryPollInterval,
+		pdfQueueWait:          DefaultPDFQueueWait,
+		submitDebounce:        DefaultSubmitDebounce,
+		clock:                 realClock{},
+		transientRetryDelay:   DefaultTransientRetryDelay,
+		metricsSnapshot:       true,
+	}
+
+	if DefaultConnectionMetrics {
+		urlchecker.connStats = &connStats{}
+	}
+	for _, opt := range opts {
+		opt(urlchecker)
+	}
+	if urlchecker.connStats != nil {
+		urlchecker.trackConnections()
 	}
+	urlchecker.registerDefaultRenderers()
+
+	return urlchecker
 }
 
 func (urlchecker *URLChecker) LoadBatches(ctx context.Context) error {
@@ -48,6 +220,47 @@ func (urlchecker *URLChecker) LoadBatches(ctx context.Context) error {
 	}
 
 	urlchecker.logger.Infof("Database loaded, max batch num: %d", maxID)
+
+	if err := urlchecker.reconcileInterrupted(ctx); err != nil {
+		return fmt.Errorf("failed to reconcile interrupted batches: %w", err)
+	}
+
+	return nil
+}
+
+// InterruptedNote is the error recorded on links that were still being checked
+// when a previous run stopped.
+const InterruptedNote = "interrupted"
+
+// reconcileInterrupted fails links left processing by a previous run once
+// their batch is older than the grace period, and marks batches that were
+// still processing as failed.
+func (urlchecker *URLChecker) reconcileInterrupted(ctx context.Context) error {
+	batches, err := urlchecker.db.GetBatchesWithProcessingLinks(ctx)
+	if err != nil {
+		return err
+	}
+
+	cutoff := urlchecker.clock.Now().Add(-urlchecker.processingGracePeriod)
+	for _, batch := range batches {
+		if batch.CreatedAt.After(cutoff) {
+			continue
+		}
+
+		failed, err := urlchecker.db.FailProcessingLinks(ctx, batch.LinksNum, InterruptedNote)
+		if err != nil {
+			return err
+		}
+
+		if batch.Status == models.BatchStatusProcessing {
+			if err := urlchecker.db.UpdateBatchStatus(ctx, batch.LinksNum, models.BatchStatusFailed); err != nil {
+				return err
+			}
+		}
+
+		urlchecker.logger.Warnf("Marked %d interrupted links of batch %d as not available", failed, batch.LinksNum)
+	}
+
 	return nil
 }
 
@@ -61,114 +274,336 @@ func (urlchecker *URLChecker) SetShutdown(shutdown bool) {
 	urlchecker.shutdownMux.Lock()
 	defer urlchecker.shutdownMux.Unlock()
 	urlchecker.shutdown = shutdown
+	if !shutdown {
+		urlchecker.shutdownStats = nil
+	}
 }
 
-func (urlchecker *URLChecker) getNextID(ctx context.Context) (int, error) {
-	maxID, err := urlchecker.db.GetMaxBatchNum(ctx)
-	if err != nil {
-		return 0, fmt.Errorf("failed to get max batch num: %w", err)
+// Shutdown stops the service from accepting new work and returns what was
+// still pending at that moment. The snapshot is kept and reported by
+// GetHealthStatus.
+func (urlchecker *URLChecker) Shutdown(ctx context.Context) models.ShutdownStats {
+	urlchecker.SetShutdown(true)
+
+	stats := models.ShutdownStats{
+		ActiveChecks:   urlchecker.ActiveChecks(),
+		QueuedPDFTasks: len(urlchecker.pendingPDFTasks),
+		At:             urlchecker.clock.Now(),
+	}
+
+	var err error
+	if stats.InFlightBatches, err = urlchecker.db.CountBatchesByStatus(ctx, models.BatchStatusProcessing); err != nil {
+		urlchecker.logger.Warnf("Failed to count in-flight batches: %v", err)
+	}
+	if stats.ProcessingLinks, err = urlchecker.db.CountLinksByStatus(ctx, models.StatusProcessing); err != nil {
+		urlchecker.logger.Warnf("Failed to count processing links: %v", err)
 	}
-	return maxID + 1, nil
+
+	urlchecker.shutdownMux.Lock()
+	urlchecker.shutdownStats = &stats
+	urlchecker.shutdownMux.Unlock()
+
+	return stats
 }
 
-func (urlchecker *URLChecker) checkURLAvailability(rawURL string) models.LinkStatus {
-	if !strings.HasPrefix(rawURL, "http://") && !strings.HasPrefix(rawURL, "https://") {
-		rawURL = "http://" + rawURL
+// checkURLAvailability returns the status of a link and the HTTP status code
+// it answered with, reusing a result from within the minimum recheck
+// interval instead of requesting the URL again. The code is 0 when no
+// response was received. A positive timeout bounds the request.
+func (urlchecker *URLChecker) checkURLAvailability(ctx context.Context, rawURL string, timeout time.Duration) (models.LinkStatus, int) {
+	urlchecker.metrics.checksTotal.Add(1)
+
+	// a check with cookies may see a different page, so it neither reuses nor
+	// provides a remembered status
+	if len(cookiesFrom(ctx)) > 0 {
+		return urlchecker.fetchWithRetries(ctx, rawURL, timeout)
 	}
 
-	parsedURL, err := url.Parse(rawURL)
-	if err != nil || parsedURL.Host == "" {
-		urlchecker.logger.Warnf("Invalid URL %s: %v", rawURL, err)
-		return models.StatusNotAvailable
+	key := urlchecker.checkKey(ctx, rawURL, timeout)
+	if result, ok := urlchecker.recheckGuard.recent(key, urlchecker.clock.Now()); ok {
+		urlchecker.logger.Infof("URL %s checked recently, reusing status %s", rawURL, result.status)
+		recordStatusText(ctx, result.statusText)
+		return result.status, result.code
 	}
 
-	req, err := http.NewRequest("GET", rawURL, nil)
-	if err != nil {
-		urlchecker.logger.Warnf("Failed to create request for %s: %v", rawURL, err)
-		return models.StatusNotAvailable
+	check := func() guardedResult {
+		result := guardedResult{}
+		result.status, result.code = urlchecker.fetchWithRetries(recordingStatusText(ctx, &result.statusText), rawURL, timeout)
+		return result
+	}
+
+	var result guardedResult
+	if urlchecker.sharedChecks != nil {
+		var shared bool
+		var err error
+		result, shared, err = urlchecker.sharedChecks.do(ctx, key, check)
+		if err != nil {
+			urlchecker.logger.Warnf("Stopped waiting for the check of URL %s: %v", rawURL, err)
+			return models.StatusNotAvailable, 0
+		}
+		if shared {
+			urlchecker.logger.Infof("URL %s is being checked already, sharing its status %s", rawURL, result.status)
+		}
+	} else {
+		result = check()
+	}
+
+	recordStatusText(ctx, result.statusText)
+	// a check cut short says nothing about the URL, so later checks don't
+	// reuse it
+	if ctx.Err() == nil {
+		urlchecker.recheckGuard.remember(key, result, urlchecker.clock.Now())
 	}
+	return result.status, result.code
+}
 
-	req.Header.Set("User-Agent", "URL-Checker/1.0")
+// requestTimeout is the deadline of a single check request: the batch's own
+// timeout when it has one, otherwise the service default.
+func (urlchecker *URLChecker) requestTimeout(timeout time.Duration) time.Duration {
+	if timeout > 0 {
+		return timeout
+	}
+	return urlchecker.checkTimeout
+}
+
+// fetchWithTimeout requests a URL with the given method, bounded by a
+// positive timeout or else the service default.
+func (urlchecker *URLChecker) fetchWithTimeout(ctx context.Context, method, rawURL string, timeout time.Duration) (models.LinkStatus, int) {
+	if timeout = urlchecker.requestTimeout(timeout); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
 
-	resp, err := urlchecker.httpClient.Do(req)
+	return urlchecker.fetchURLStatus(ctx, method, rawURL)
+}
+
+func (urlchecker *URLChecker) fetchURLStatus(ctx context.Context, method, rawURL string) (models.LinkStatus, int) {
+	resp, err := urlchecker.fetch(ctx, method, rawURL)
 	if err != nil {
-		urlchecker.logger.Warnf("Failed to fetch %s: %v", rawURL, err)
-		return models.StatusNotAvailable
+		return models.StatusNotAvailable, 0
 	}
 	defer resp.Body.Close()
 
-	urlchecker.logger.Infof("URL %s returned status %d", rawURL, resp.StatusCode)
 	if resp.StatusCode >= 200 && resp.StatusCode < 400 {
-		return models.StatusAvailable
+		return models.StatusAvailable, resp.StatusCode
+	}
+
+	if urlchecker.statusOverridden(resp) {
+		urlchecker.logger.Infof("%s %s returned status %d, counted as available for its host", method, rawURL, resp.StatusCode)
+		return models.StatusAvailable, resp.StatusCode
+	}
+
+	if resp.StatusCode == http.StatusForbidden && len(urlchecker.fallbackUserAgents) > 0 {
+		resp.Body.Close()
+		return urlchecker.fetchWithFallbackAgents(ctx, method, rawURL)
 	}
 
-	return models.StatusNotAvailable
+	return models.StatusNotAvailable, resp.StatusCode
+}
+
+// requestURL returns the URL a link is requested at, assuming http:// when it
+// has no scheme. Links without a host are invalid.
+func requestURL(rawURL string) (string, error) {
+	if linkScheme(rawURL) == "" {
+		rawURL = "http://" + rawURL
+	}
+
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL %s: %w", rawURL, err)
+	}
+	if parsedURL.Host == "" {
+		return "", fmt.Errorf("invalid URL %s: no host", rawURL)
+	}
+	return rawURL, nil
 }
 
-func (urlchecker *URLChecker) processLinks(ctx context.Context, links []string, batchNum int) ([]*models.Link, error) {
-	var linkIDs []int
-	for _, link := range links {
-		linkID, err := urlchecker.db.CreateLink(ctx, link, models.StatusProcessing, batchNum, nil)
+// fetch requests a URL with the given method. Failures are logged, so callers
+// only need to decide what an error means for the link.
+func (urlchecker *URLChecker) fetch(ctx context.Context, method, rawURL string) (*http.Response, error) {
+	rawURL, err := requestURL(rawURL)
+	if err != nil {
+		urlchecker.logger.Warn(err)
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+	if err != nil {
+		urlchecker.logger.Warnf("Failed to create request for %s: %v", rawURL, err)
+		return nil, err
+	}
+
+	req.Header.Set("User-Agent", userAgentFrom(ctx))
+	if header := urlchecker.checkHeader; header.Name != "" {
+		req.Header.Set(header.Name, header.Value)
+	}
+	for _, cookie := range cookiesFrom(ctx) {
+		req.AddCookie(cookie)
+	}
+	req.Close = keepAliveDisabled(ctx)
+
+	client := urlchecker.httpClient
+	if serverName := serverNameFrom(ctx); serverName != "" {
+		client, err = urlchecker.clientWithServerName(serverName)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create link for %s: %w", link, err)
+			urlchecker.logger.Warnf("Failed to override server name for %s: %v", rawURL, err)
+			return nil, err
 		}
-		linkIDs = append(linkIDs, linkID)
 	}
 
+	if urlchecker.redirectBodyLimit > 0 {
+		ctx = withBodyBudget(ctx, urlchecker.redirectBodyLimit)
+	}
+	req = req.WithContext(urlchecker.withConnTrace(ctx))
+	start := time.Now()
+	resp, err := client.Do(req)
+	elapsed := time.Since(start)
+	recordResponseTime(ctx, elapsed)
+	urlchecker.metrics.latency.add(elapsed)
+	urlchecker.recordDebug(ctx, req, resp, err)
+	if err != nil {
+		urlchecker.logger.Warnf("Failed to fetch %s: %v", rawURL, err)
+		return nil, err
+	}
+	recordStatusText(ctx, resp.Status)
+
+	urlchecker.logger.Infof("%s %s returned status %d", method, rawURL, resp.StatusCode)
+	return resp, nil
+}
+
+// checkBatchLinks checks the stored links of a batch, stores their results
+// and completes the batch.
+func (urlchecker *URLChecker) checkBatchLinks(ctx context.Context, links []string, linkIDs []int, batch *models.Batch) ([]*models.Link, error) {
+	batchNum := batch.LinksNum
+	spec := urlchecker.batchCheckSpec(batch)
+
 	results := make([]*models.Link, len(links))
-	var wg sync.WaitGroup
 	var resultsMux sync.Mutex
 
-	for i, link := range links {
-		wg.Add(1)
-		go func(idx int, l string, linkID int) {
-			defer wg.Done()
-
-			select {
-			case <-ctx.Done():
-				return
-			default:
-			}
+	urlchecker.checkEach(ctx, links, spec, func(i int, check linkCheck, processedAt time.Time) {
+		var time *time.Time
+		if check.status == models.StatusAvailable || check.status == models.StatusNotAvailable {
+			time = &processedAt
+		}
 
-			status := urlchecker.checkURLAvailability(l)
-			processedAt := time.Now()
+		if ctx.Err() != nil {
+			return
+		}
 
-			var time *time.Time
-			if status == models.StatusAvailable || status == models.StatusNotAvailable {
-				time = &processedAt
-			}
+		result := &models.Link{
+			ID:             linkIDs[i],
+			URL:            links[i],
+			Status:         check.status,
+			BatchNum:       batchNum,
+			Time:           time,
+			CheckSource:    models.CheckSourceInitial,
+			Error:          check.note,
+			Allow:          check.allow,
+			UserAgent:      check.userAgent,
+			Debug:          check.debug,
+			StatusCode:     check.statusCode,
+			StatusText:     check.statusText,
+			ResponseTimeMs: check.responseTime.Milliseconds(),
+			Methods:        check.methods,
+		}
 
-			select {
-			case <-ctx.Done():
-				return
-			default:
-			}
+		if err := urlchecker.storeLinkResult(ctx, result); err != nil {
+			urlchecker.logger.Errorf("Failed to update link status for %s: %v", links[i], err)
+		}
 
-			if err := urlchecker.db.UpdateLinkStatus(ctx, linkID, status, time); err != nil {
-				urlchecker.logger.Errorf("Failed to update link status for %s: %v", l, err)
-			}
+		resultsMux.Lock()
+		results[i] = result
+		resultsMux.Unlock()
+	})
 
-			resultsMux.Lock()
-			results[idx] = &models.Link{
-				ID:       linkID,
-				URL:      l,
-				Status:   status,
-				BatchNum: batchNum,
-				Time:     time,
-			}
-			resultsMux.Unlock()
-		}(i, link, linkIDs[i])
+	// cancelled checks leave no result behind, so the batch is incomplete
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
-	wg.Wait()
-
-	if err := urlchecker.db.UpdateBatchStatus(ctx, batchNum, models.BatchStatusCompleted); err != nil {
+	status := urlchecker.completedStatus(results)
+	if err := urlchecker.db.UpdateBatchStatus(ctx, batchNum, status); err != nil {
 		urlchecker.logger.Errorf("Failed to update batch status: %v", err)
+	} else {
+		urlchecker.notifyBatchCompleted(batchNum, status, results)
 	}
 
 	return results, nil
 }
 
+// completedStatus is the status of a batch that finished with results. It is
+// degraded when the share of available links is below the minimum success
+// ratio.
+func (urlchecker *URLChecker) completedStatus(results []*models.Link) models.BatchStatus {
+	if urlchecker.minSuccessRatio <= 0 || len(results) == 0 {
+		return models.BatchStatusCompleted
+	}
+
+	available := 0
+	for _, link := range results {
+		if link != nil && link.Status == models.StatusAvailable {
+			available++
+		}
+	}
+
+	if float64(available)/float64(len(results)) < urlchecker.minSuccessRatio {
+		return models.BatchStatusDegraded
+	}
+	return models.BatchStatusCompleted
+}
+
+// refreshCompletedStatus stores the status a finished batch has now that its
+// links were checked again, so a degraded batch recovers once enough of its
+// links do and a completed one degrades when they fail. Batches that are
+// processing or failed keep their status, as does every batch when the
+// checks were cut short.
+func (urlchecker *URLChecker) refreshCompletedStatus(ctx context.Context, batch *models.Batch, links []*models.Link) {
+	if ctx.Err() != nil || (batch.Status != models.BatchStatusCompleted && batch.Status != models.BatchStatusDegraded) {
+		return
+	}
+
+	status := urlchecker.completedStatus(links)
+	if status == batch.Status {
+		return
+	}
+	if err := urlchecker.db.UpdateBatchStatus(ctx, batch.LinksNum, status); err != nil {
+		urlchecker.logger.Errorf("Failed to update status of batch %d: %v", batch.LinksNum, err)
+		return
+	}
+	urlchecker.logger.Infof("Batch %d is now %s", batch.LinksNum, status)
+	batch.Status = status
+}
+
+// acquireReadSlot waits for room to run a status, listing or report read, so
+// a burst of them can't take every database connection. Health checks and
+// writes don't take read slots. A successful call must be paired with
+// releaseReadSlot.
+func (urlchecker *URLChecker) acquireReadSlot(ctx context.Context) error {
+	select {
+	case urlchecker.readSlots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (urlchecker *URLChecker) releaseReadSlot() {
+	<-urlchecker.readSlots
+}
+
+// storeLinkResult persists a check result, waiting for a write slot first.
+func (urlchecker *URLChecker) storeLinkResult(ctx context.Context, link *models.Link) error {
+	select {
+	case urlchecker.writeSlots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-urlchecker.writeSlots }()
+
+	return urlchecker.db.UpdateLinkResult(ctx, link)
+}
+
 func (urlchecker *URLChecker) StartWorker(ctx context.Context) {
 	for {
 		select {
@@ -184,7 +619,7 @@ func (urlchecker *URLChecker) StartWorker(ctx context.Context) {
 }
 
 func (urlchecker *URLChecker) processPDFTask(ctx context.Context, task *PDFTask) {
-	pdfData, err := urlchecker.GeneratePDFReport(ctx, task.BatchIDs)
+	pdfData, err := urlchecker.GenerateReport(WithReportOptions(ctx, task.Options), task.Format, task.BatchIDs)
 	if err != nil {
 		task.Error <- err
 	} else {
@@ -193,6 +628,10 @@ func (urlchecker *URLChecker) processPDFTask(ctx context.Context, task *PDFTask)
 }
 
 func (urlchecker *URLChecker) CheckLinks(ctx context.Context, links []string) (models.CheckResponse, error) {
+	return urlchecker.CheckLinksWithOptions(ctx, links, CheckOptions{})
+}
+
+func (urlchecker *URLChecker) CheckLinksWithOptions(ctx context.Context, links []string, opts CheckOptions) (models.CheckResponse, error) {
 	if len(links) == 0 {
 		return models.CheckResponse{}, fmt.Errorf("no links provided")
 	}
@@ -201,139 +640,428 @@ func (urlchecker *URLChecker) CheckLinks(ctx context.Context, links []string) (m
 		return models.CheckResponse{}, fmt.Errorf("service is shutting down")
 	}
 
-	batchNum, err := urlchecker.getNextID(ctx)
+	opts, err := urlchecker.applyProfile(opts)
+	if err != nil {
+		return models.CheckResponse{}, err
+	}
+
+	if opts.RetryCount < 0 || opts.RetryCount > MaxRetryCount || opts.RetryDelay < 0 {
+		return models.CheckResponse{}, fmt.Errorf("invalid retry policy")
+	}
+
+	if opts.Timeout < 0 {
+		return models.CheckResponse{}, fmt.Errorf("invalid timeout")
+	}
+
+	if opts.ExpiresIn < 0 {
+		return models.CheckResponse{}, fmt.Errorf("invalid expiry")
+	}
+
+	// only batches waiting for the batch worker are ordered
+	if opts.Priority != 0 && !opts.Async {
+		return models.CheckResponse{}, fmt.Errorf("priority requires an async check")
+	}
+
+	methods, err := NormalizeMethods(opts.Methods)
+	if err != nil {
+		return models.CheckResponse{}, err
+	}
+
+	policy, err := ParseMethodPolicy(string(opts.MethodPolicy))
+	if err != nil {
+		return models.CheckResponse{}, err
+	}
+
+	if err := ValidateServerName(opts.ServerName); err != nil {
+		return models.CheckResponse{}, err
+	}
+
+	dedup, err := ParseDedupMode(string(opts.Dedup))
+	if err != nil {
+		return models.CheckResponse{}, err
+	}
+	opts.Dedup = dedup
+
+	cookies, err := ParseCookies(opts.Cookies)
+	if err != nil {
+		return models.CheckResponse{}, err
+	}
+	if len(cookies) > 0 {
+		if opts.RetryCount > 0 {
+			return models.CheckResponse{}, fmt.Errorf("cookies can't be combined with retries")
+		}
+		// only the checks made for this request carry them
+		ctx = withCookies(ctx, cookies)
+	}
+
+	if len(methods) == 0 {
+		policy = ""
+	} else if policy == "" {
+		policy = urlchecker.methodPolicy
+	}
+
+	var corrected map[string]string
+	var invalid []models.InvalidLink
+	if opts.CorrectSchemes {
+		links, corrected, invalid = correctSchemes(links)
+		if len(links) == 0 {
+			// nothing left to check, so no batch is created
+			return models.CheckResponse{Links: map[string]string{}, Invalid: invalid}, nil
+		}
+	}
+
+	links, duplicates := dedupLinks(links, dedup)
+
+	links, overLimit := limitLinksPerHost(links, urlchecker.maxLinksPerHost)
+	invalid = append(invalid, overLimit...)
+
+	if opts.Async && len(cookies) > 0 {
+		// cookies only live in the request context
+		return models.CheckResponse{}, fmt.Errorf("cookies can't be combined with async checks")
+	}
+
+	if opts.Ephemeral {
+		if opts.Async {
+			return models.CheckResponse{}, fmt.Errorf("async checks require a persisted batch")
+		}
+		if opts.RetryCount > 0 {
+			return models.CheckResponse{}, fmt.Errorf("retries require a persisted batch")
+		}
+		if opts.ExpiresIn > 0 {
+			return models.CheckResponse{}, fmt.Errorf("expiry requires a persisted batch")
+		}
+		spec := checkSpec{
+			timeout:          opts.Timeout,
+			methods:          methods,
+			policy:           policy,
+			disableKeepAlive: opts.DisableKeepAlive,
+			serverName:       opts.ServerName,
+			discoverMethods:  opts.DiscoverMethods,
+			userAgent:        urlchecker.checkProfiles[opts.Profile].UserAgent,
+		}
+		response, err := urlchecker.checkLinksEphemeral(ctx, links, spec)
+		response.Corrected = corrected
+		response.Duplicates = duplicates
+		response.Invalid = invalid
+		return response, err
+	}
+
+	checksum := urlSetChecksum(links)
+	submission := submissionKey(opts, checksum, methods, policy)
+	if len(cookies) > 0 {
+		// like batch reuse, checks with cookies are never shared
+		submission = ""
+	}
+
+	response, err := urlchecker.debounceSubmission(ctx, submission, func() (models.CheckResponse, error) {
+		return urlchecker.submitBatch(ctx, links, checksum, methods, policy, len(cookies) > 0, opts)
+	})
+	response.Corrected = corrected
+	response.Duplicates = duplicates
+	response.Invalid = invalid
+	return response, err
+}
+
+// submitBatch checks links as a new batch, or returns the results of a
+// matching batch still within the idempotency window.
+func (urlchecker *URLChecker) submitBatch(ctx context.Context, links []string, checksum string, methods []string, policy models.MethodPolicy, hasCookies bool, opts CheckOptions) (models.CheckResponse, error) {
+	createdAt := urlchecker.clock.Now()
+	batch := &models.Batch{
+		Status:           models.BatchStatusProcessing,
+		CreatedAt:        createdAt,
+		Checksum:         checksum,
+		IdempotencyKey:   opts.IdempotencyKey,
+		RetryCount:       opts.RetryCount,
+		RetryDelayMs:     opts.RetryDelay.Milliseconds(),
+		TimeoutMs:        opts.Timeout.Milliseconds(),
+		Methods:          methods,
+		MethodPolicy:     policy,
+		DisableKeepAlive: opts.DisableKeepAlive,
+		ServerName:       opts.ServerName,
+		DiscoverMethods:  opts.DiscoverMethods,
+		Source:           opts.Source,
+		Profile:          opts.Profile,
+		Dedup:            opts.Dedup,
+		HadCookies:       hasCookies,
+	}
+	if opts.ExpiresIn > 0 {
+		expiresAt := createdAt.Add(opts.ExpiresIn)
+		batch.ExpiresAt = &expiresAt
+	}
+
+	existing, err := urlchecker.findReusableBatch(ctx, opts.IdempotencyKey, checksum)
 	if err != nil {
-		return models.CheckResponse{}, fmt.Errorf("failed to get next batch ID: %w", err)
+		return models.CheckResponse{}, err
+	}
+	// a batch checked with cookies may have seen different pages, and the
+	// cookies aren't stored to compare against
+	if existing != nil && !hasCookies {
+		if existing.Checksum == checksum && sameBatchSettings(existing, batch) {
+			urlchecker.logger.Infof("Reusing batch %d for repeated submission", existing.LinksNum)
+			return urlchecker.batchResponse(ctx, existing.LinksNum)
+		}
+		if opts.IdempotencyKey != "" {
+			return models.CheckResponse{}, ErrIdempotencyKeyReused
+		}
 	}
 
-	if err := urlchecker.db.CreateBatch(ctx, batchNum, models.BatchStatusProcessing, time.Now()); err != nil {
+	// the batch and its links are stored together, so a failure leaves no
+	// batch with only some of its links behind, and the batch takes its number
+	// from the database's sequence in the same transaction
+	linkIDs, err := urlchecker.db.InsertBatchWithLinks(ctx, batch, links)
+	if err != nil {
 		return models.CheckResponse{}, fmt.Errorf("failed to create batch: %w", err)
 	}
+	batchNum := batch.LinksNum
+	urlchecker.metrics.batchesTotal.Add(1)
+	urlchecker.evictOldestBatches(ctx)
 
-	processedLinks, err := urlchecker.processLinks(ctx, links, batchNum)
+	if opts.Async {
+		return urlchecker.enqueueBatch(ctx, links, linkIDs, batch, opts)
+	}
+
+	processedLinks, err := urlchecker.checkBatchLinks(ctx, links, linkIDs, batch)
 	if err != nil {
-		urlchecker.db.UpdateBatchStatus(ctx, batchNum, models.BatchStatusFailed)
+		// the request context may already be cancelled
+		urlchecker.db.UpdateBatchStatus(context.WithoutCancel(ctx), batchNum, models.BatchStatusFailed)
 		return models.CheckResponse{}, fmt.Errorf("failed to process links: %w", err)
 	}
 
+	urlchecker.scheduleRetries(ctx, batch, opts.RetryDelay)
+
 	resultLinks := make(map[string]string)
+	var methodResults map[string]map[string]models.LinkStatus
+	var allow map[string]string
+	var userAgents map[string]string
 	for _, link := range processedLinks {
 		resultLinks[link.URL] = string(link.Status)
+		if link.Methods != nil {
+			if methodResults == nil {
+				methodResults = make(map[string]map[string]models.LinkStatus)
+			}
+			methodResults[link.URL] = link.Methods
+		}
+		if link.Allow != "" {
+			if allow == nil {
+				allow = make(map[string]string)
+			}
+			allow[link.URL] = link.Allow
+		}
+		if link.UserAgent != "" {
+			if userAgents == nil {
+				userAgents = make(map[string]string)
+			}
+			userAgents[link.URL] = link.UserAgent
+		}
 	}
 
 	response := models.CheckResponse{
-		Links:    resultLinks,
-		LinksNum: batchNum,
+		Links:      resultLinks,
+		LinksNum:   batchNum,
+		BatchNum:   batchNum,
+		Methods:    methodResults,
+		Allow:      allow,
+		UserAgents: userAgents,
 	}
 
 	return response, nil
 }
 
 func (urlchecker *URLChecker) GeneratePDFReportAsync(ctx context.Context, batchIDs []int) ([]byte, error) {
+	return urlchecker.GenerateReportAsync(ctx, ReportFormatPDF, batchIDs)
+}
+
+// GenerateReportAsync queues a report for the worker, or generates it
+// synchronously when the queue is full.
+func (urlchecker *URLChecker) GenerateReportAsync(ctx context.Context, format string, batchIDs []int) ([]byte, error) {
 	if urlchecker.IsShutdown() {
 		return nil, fmt.Errorf("service is shutting down")
 	}
 
 	task := &PDFTask{
 		BatchIDs: batchIDs,
+		Format:   format,
+		Options:  ReportOptionsFrom(ctx),
 		Result:   make(chan []byte, 1),
 		Error:    make(chan error, 1),
 	}
 
+	queued, err := urlchecker.enqueuePDFTask(ctx, task)
+	if err != nil {
+		return nil, err
+	}
+	if !queued {
+		urlchecker.logger.Warnf("PDF queue full, generating report synchronously for batches %v", batchIDs)
+		return urlchecker.GenerateReport(ctx, format, batchIDs)
+	}
+
+	urlchecker.logger.Infof("Queued %s report task for batches %v", ParseReportFormat(format), batchIDs)
+
 	select {
-	case urlchecker.pendingPDFTasks <- task:
-		urlchecker.logger.Infof("Queued PDF task for batches %v", batchIDs)
+	case pdfData := <-task.Result:
+		return pdfData, nil
+	case err := <-task.Error:
+		return nil, err
+	case <-time.After(30 * time.Second):
+		return nil, fmt.Errorf("PDF generation timeout")
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
 
-		select {
-		case pdfData := <-task.Result:
-			return pdfData, nil
-		case err := <-task.Error:
-			return nil, err
-		case <-time.After(30 * time.Second):
-			return nil, fmt.Errorf("PDF generation timeout")
-		case <-ctx.Done():
-			return nil, ctx.Err()
-		}
+// enqueuePDFTask queues task for the worker. A full queue is given up to the
+// configured wait to free a slot, so short bursts don't fall back to
+// generating reports in the request.
+func (urlchecker *URLChecker) enqueuePDFTask(ctx context.Context, task *PDFTask) (bool, error) {
+	select {
+	case urlchecker.pendingPDFTasks <- task:
+		return true, nil
 	default:
-		urlchecker.logger.Warnf("PDF queue full, generating report synchronously for batches %v", batchIDs)
-		return urlchecker.GeneratePDFReport(ctx, batchIDs)
+	}
+
+	if urlchecker.pdfQueueWait <= 0 {
+		return false, nil
+	}
+
+	timer := time.NewTimer(urlchecker.pdfQueueWait)
+	defer timer.Stop()
+
+	select {
+	case urlchecker.pendingPDFTasks <- task:
+		return true, nil
+	case <-timer.C:
+		return false, nil
+	case <-ctx.Done():
+		return false, ctx.Err()
 	}
 }
 
 func (urlchecker *URLChecker) GeneratePDFReport(ctx context.Context, batchIDs []int) ([]byte, error) {
-	batches, links, err := urlchecker.db.GetBatchesByIDs(ctx, batchIDs)
+	return urlchecker.GenerateReport(ctx, ReportFormatPDF, batchIDs)
+}
+
+// GenerateCSVReport renders the given batches as CSV, one row per link.
+func (urlchecker *URLChecker) GenerateCSVReport(ctx context.Context, batchIDs []int) ([]byte, error) {
+	return urlchecker.GenerateReport(ctx, ReportFormatCSV, batchIDs)
+}
+
+// GenerateJSONReport renders the given batches as JSON, each with its links
+// and a summary of their statuses.
+func (urlchecker *URLChecker) GenerateJSONReport(ctx context.Context, batchIDs []int) ([]byte, error) {
+	return urlchecker.GenerateReport(ctx, ReportFormatJSON, batchIDs)
+}
+
+// GenerateReport renders the given batches with the renderer registered for
+// format. An empty format means PDF.
+func (urlchecker *URLChecker) GenerateReport(ctx context.Context, format string, batchIDs []int) ([]byte, error) {
+	renderer, err := urlchecker.ReportRenderer(format)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get batches data: %w", err)
+		return nil, err
 	}
 
-	if len(batches) == 0 {
-		return nil, fmt.Errorf("no valid batches found")
+	out := &reportWriter{max: urlchecker.maxReportSize}
+	if err := urlchecker.renderReport(ctx, renderer, batchIDs, out); err != nil {
+		if errors.Is(err, ErrReportTooLarge) {
+			return nil, fmt.Errorf("%w (limit %d bytes)", ErrReportTooLarge, urlchecker.maxReportSize)
+		}
+		return nil, err
+	}
+
+	return out.buf.Bytes(), nil
+}
+
+// StreamReport renders a JSON or HTML report straight to w, flushing after
+// every batch when w supports it. Nothing is buffered, so the report size
+// limit doesn't apply, and an error after output started leaves the report
+// cut short.
+func (urlchecker *URLChecker) StreamReport(ctx context.Context, format string, batchIDs []int, w io.Writer) error {
+	if urlchecker.IsShutdown() {
+		return fmt.Errorf("service is shutting down")
 	}
 
-	batchLinks := make(map[int][]*models.Link)
-	for _, link := range links {
-		batchLinks[link.BatchNum] = append(batchLinks[link.BatchNum], link)
+	if !ReportStreamable(format) {
+		return fmt.Errorf("%s reports can't be streamed", ParseReportFormat(format))
 	}
 
-	pdf := gofpdf.New("P", "mm", "A4", "")
-	pdf.AddPage()
-	pdf.SetFont("Arial", "B", 16)
-	pdf.Cell(40, 10, "URL Availability Report")
-	pdf.Ln(15)
+	renderer, err := urlchecker.ReportRenderer(format)
+	if err != nil {
+		return err
+	}
 
-	pdf.SetFont("Arial", "", 12)
-	pdf.Cell(40, 10, fmt.Sprintf("Generated: %s", time.Now().Format("2006-01-02 15:04:05")))
-	pdf.Ln(15)
+	return urlchecker.renderReport(ctx, renderer, batchIDs, w)
+}
 
-	for _, batch := range batches {
-		pdf.SetFont("Arial", "B", 14)
-		pdf.Cell(40, 10, fmt.Sprintf("link_num #%d (%s)", batch.LinksNum, batch.Status))
-		pdf.Ln(10)
-
-		pdf.SetFont("Arial", "", 10)
-		pdf.Cell(40, 10, fmt.Sprintf("Created: %s", batch.CreatedAt.Format("2006-01-02 15:04:05")))
-		pdf.Ln(8)
-
-		if batchLinks, exists := batchLinks[batch.LinksNum]; exists {
-			for _, link := range batchLinks {
-				statusText := string(link.Status)
-				if link.Status == models.StatusAvailable {
-					statusText = "Available"
-				} else {
-					statusText = "Not Available"
-				}
-
-				pdf.Cell(40, 8, fmt.Sprintf("- %s: %s", link.URL, statusText))
-				pdf.Ln(6)
-			}
-		}
-		pdf.Ln(10)
+// ReportStreamable reports whether reports in format can be streamed batch
+// by batch.
+func ReportStreamable(format string) bool {
+	switch ParseReportFormat(format) {
+	case ReportFormatJSON, ReportFormatHTML:
+		return true
+	default:
+		return false
 	}
+}
 
-	var buf bytes.Buffer
-	err = pdf.Output(&buf)
+func (urlchecker *URLChecker) renderReport(ctx context.Context, renderer ReportRenderer, batchIDs []int, w io.Writer) error {
+	// bounds memory for both the worker and the synchronous fallback
+	select {
+	case urlchecker.pdfSlots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-urlchecker.pdfSlots }()
+
+	urlchecker.metrics.activePDFs.Add(1)
+	defer urlchecker.metrics.activePDFs.Add(-1)
+
+	if err := urlchecker.acquireReadSlot(ctx); err != nil {
+		return err
+	}
+	batches, links, err := urlchecker.db.GetBatchesByIDs(ctx, batchIDs)
+	urlchecker.releaseReadSlot()
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("failed to get batches data: %w", err)
+	}
+
+	if len(batches) == 0 {
+		return fmt.Errorf("no valid batches found")
 	}
 
-	return buf.Bytes(), nil
+	return renderer.Render(ctx, batches, links, w)
 }
 
 func (urlchecker *URLChecker) GetHealthStatus(ctx context.Context) map[string]any {
-	batches, err := urlchecker.db.GetAllBatches(ctx)
-	batchCount := 0
-	if err == nil {
-		batchCount = len(batches)
+	batchCount, err := urlchecker.db.CountBatches(ctx)
+	if err != nil {
+		urlchecker.logger.Warnf("Failed to count batches: %v", err)
+	}
+
+	status := map[string]any{
+		"status":        "healthy",
+		"shutdown":      urlchecker.IsShutdown(),
+		"batches":       batchCount,
+		"active_checks": urlchecker.ActiveChecks(),
+		"checks_total":  urlchecker.ChecksTotal(),
+		"timestamp":     urlchecker.clock.Now().Unix(),
+	}
+
+	if urlchecker.selfCheckInterval > 0 {
+		lastSuccess, failures := urlchecker.selfCheckStatus()
+		if !lastSuccess.IsZero() {
+			status["last_self_check"] = lastSuccess
+		}
+		status["self_check_failures"] = failures
 	}
 
-	return map[string]any{
-		"status":    "healthy",
-		"shutdown":  urlchecker.IsShutdown(),
-		"batches":   batchCount,
-		"timestamp": time.Now().Unix(),
+	urlchecker.shutdownMux.RLock()
+	if urlchecker.shutdownStats != nil {
+		status["shutdown_stats"] = *urlchecker.shutdownStats
 	}
+	urlchecker.shutdownMux.RUnlock()
+
+	return status
 }
 
 func (urlchecker *URLChecker) GetCurrentTimestamp() int64 {
-	return time.Now().Unix()
+	return urlchecker.Now().Unix()
 }
@@ -1,30 +1,66 @@
 package service
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"crypto/tls"
+	"database/sql"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/mail"
+	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+	"unicode/utf16"
 
 	"url-checker/internal/database"
 	"url-checker/internal/models"
 
+	"github.com/jung-kurt/gofpdf"
+	"github.com/mattn/go-sqlite3"
 	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
-func setupTestService(t *testing.T) (*URLChecker, *database.Database) {
-	file := "./test_service_" + t.Name() + ".db"
-	db, err := database.NewDatabase(file)
+func setupTestService(t *testing.T, opts ...Option) (*URLChecker, *database.Database) {
+	return setupTestServiceWithDB(t, nil, opts...)
+}
+
+// setupTestServiceWithDB is setupTestService with the database opened with
+// dbOpts.
+func setupTestServiceWithDB(t *testing.T, dbOpts []database.Option, opts ...Option) (*URLChecker, *database.Database) {
+	file := "./test_service_" + strings.ReplaceAll(t.Name(), "/", "_") + ".db"
+	db, err := database.NewDatabase(file, dbOpts...)
 	require.NoError(t, err)
 
 	t.Cleanup(func() {
 		db.Close()
-		os.Remove(file)
+		// a test may share the file with a second service, leaving the WAL
+		// files behind when the first one closes after the file was removed
+		for _, suffix := range []string{"", "-wal", "-shm"} {
+			os.Remove(file + suffix)
+		}
 	})
 
 	logger := logrus.New()
@@ -34,7 +70,7 @@ func setupTestService(t *testing.T) (*URLChecker, *database.Database) {
 		Timeout: 5 * time.Second,
 	}
 
-	checker := NewURLChecker(db, logger, httpClient)
+	checker := NewURLChecker(db, logger, httpClient, opts...)
 
 	return checker, db
 }
@@ -64,20 +100,29 @@ func setupMockHTTPServer(t *testing.T) *httptest.Server {
 func TestNewURLChecker(t *testing.T) {
 	db, err := database.NewDatabase("./test_new_checker.db")
 	require.NoError(t, err)
-	defer db.Close()
 	defer os.Remove("./test_new_checker.db")
+	defer db.Close()
 
 	logger := logrus.New()
 	httpClient := &http.Client{}
 
-	checker := NewURLChecker(db, logger, httpClient)
+	// connection metrics wrap the client's transport
+	checker := NewURLChecker(db, logger, httpClient, WithConnectionMetrics(false))
 
 	assert.NotNil(t, checker)
 	assert.Equal(t, db, checker.db)
 	assert.Equal(t, logger, checker.logger)
 	assert.Equal(t, httpClient, checker.httpClient)
 	assert.NotNil(t, checker.pendingPDFTasks)
+	assert.Equal(t, DefaultMaxActiveChecks, cap(checker.checkSlots))
 	assert.False(t, checker.IsShutdown())
+
+	checker = NewURLChecker(db, logger, httpClient, WithMaxActiveChecks(3))
+	assert.Equal(t, 3, cap(checker.checkSlots))
+
+	checker = NewURLChecker(db, logger, httpClient, WithMaxActiveChecks(0))
+	assert.Equal(t, DefaultMaxActiveChecks, cap(checker.checkSlots))
+	assert.Equal(t, DefaultConnectionMetrics, checker.connStats != nil)
 }
 
 func TestURLChecker_LoadBatches(t *testing.T) {
@@ -94,6 +139,45 @@ func TestURLChecker_LoadBatches(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestURLChecker_LoadBatches_ReconcilesInterruptedLinks(t *testing.T) {
+	checker, db := setupTestService(t)
+	checker.processingGracePeriod = time.Minute
+	ctx := context.Background()
+
+	require.NoError(t, db.CreateBatch(ctx, 1, models.BatchStatusProcessing, time.Now().Add(-time.Hour)))
+	_, err := db.CreateLink(ctx, "https://stale.example", models.StatusProcessing, 1, nil)
+	require.NoError(t, err)
+	_, err = db.CreateLink(ctx, "https://done.example", models.StatusAvailable, 1, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, db.CreateBatch(ctx, 2, models.BatchStatusProcessing, time.Now()))
+	_, err = db.CreateLink(ctx, "https://recent.example", models.StatusProcessing, 2, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, checker.LoadBatches(ctx))
+
+	links, err := db.GetLinksByBatchNum(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, links, 2)
+	assert.Equal(t, models.StatusNotAvailable, links[0].Status)
+	assert.Equal(t, InterruptedNote, links[0].Error)
+	assert.Equal(t, models.StatusAvailable, links[1].Status)
+	assert.Empty(t, links[1].Error)
+
+	batch, err := db.GetBatch(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, models.BatchStatusFailed, batch.Status)
+
+	links, err = db.GetLinksByBatchNum(ctx, 2)
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	assert.Equal(t, models.StatusProcessing, links[0].Status)
+
+	batch, err = db.GetBatch(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, models.BatchStatusProcessing, batch.Status)
+}
+
 func TestURLChecker_IsShutdown_SetShutdown(t *testing.T) {
 	checker, _ := setupTestService(t)
 
@@ -106,6 +190,11 @@ func TestURLChecker_IsShutdown_SetShutdown(t *testing.T) {
 	assert.False(t, checker.IsShutdown())
 }
 
+// statusOf drops the status code from a check result.
+func statusOf(status models.LinkStatus, _ int) models.LinkStatus {
+	return status
+}
+
 func TestURLChecker_checkURLAvailability(t *testing.T) {
 	checker, _ := setupTestService(t)
 	server := setupMockHTTPServer(t)
@@ -114,21 +203,25 @@ func TestURLChecker_checkURLAvailability(t *testing.T) {
 		name     string
 		url      string
 		expected models.LinkStatus
+		code     int
 	}{
 		{
 			name:     "valid URL - success",
 			url:      server.URL + "/ok",
 			expected: models.StatusAvailable,
+			code:     http.StatusOK,
 		},
 		{
 			name:     "valid URL - not found",
 			url:      server.URL + "/notfound",
 			expected: models.StatusNotAvailable,
+			code:     http.StatusNotFound,
 		},
 		{
 			name:     "valid URL - server error",
 			url:      server.URL + "/error",
 			expected: models.StatusNotAvailable,
+			code:     http.StatusInternalServerError,
 		},
 		{
 			name:     "URL without protocol - example.com should resolve to localhost",
@@ -149,11 +242,12 @@ func TestURLChecker_checkURLAvailability(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := checker.checkURLAvailability(tt.url)
+			result, code := checker.checkURLAvailability(context.Background(), tt.url, 0)
 			if tt.url == "example.com" {
 				assert.True(t, result == models.StatusAvailable || result == models.StatusNotAvailable)
 			} else {
 				assert.Equal(t, tt.expected, result)
+				assert.Equal(t, tt.code, code)
 			}
 		})
 	}
@@ -229,6 +323,47 @@ func TestURLChecker_CheckLinks_ContextCancellation(t *testing.T) {
 	assert.Contains(t, err.Error(), "context canceled")
 }
 
+func TestURLChecker_CheckLinks_CancelAbortsInFlightRequests(t *testing.T) {
+	checker, db := setupTestService(t)
+
+	started := make(chan struct{}, 2)
+	aborted := make(chan struct{}, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		select {
+		case <-r.Context().Done():
+			aborted <- struct{}{}
+		case <-time.After(5 * time.Second):
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		<-started
+		cancel()
+	}()
+
+	start := time.Now()
+	_, err := checker.CheckLinks(ctx, []string{server.URL + "/a", server.URL + "/b"})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(start), 2*time.Second)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-aborted:
+		case <-time.After(2 * time.Second):
+			t.Fatal("request was not aborted")
+		}
+	}
+
+	batch, err := db.GetBatch(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, models.BatchStatusFailed, batch.Status)
+}
+
 func TestURLChecker_CheckLinks_Shutdown(t *testing.T) {
 	checker, _ := setupTestService(t)
 	server := setupMockHTTPServer(t)
@@ -243,6 +378,50 @@ func TestURLChecker_CheckLinks_Shutdown(t *testing.T) {
 	assert.Equal(t, models.CheckResponse{}, response)
 }
 
+// pdfTextObject is a piece of text drawn in a PDF, at horizontal position x.
+type pdfTextObject struct {
+	x    string
+	text string
+}
+
+var pdfTextPattern = regexp.MustCompile(`(?s)BT ([\d.]+) [\d.]+ Td \(((?:[^\\)]|\\.)*)\) ?Tj ET`)
+
+// pdfTextObjects returns the text an uncompressed PDF set in a UTF-8 font
+// draws, in order. gofpdf writes that text as escaped UTF-16.
+func pdfTextObjects(data []byte) []pdfTextObject {
+	var objects []pdfTextObject
+	for _, match := range pdfTextPattern.FindAllSubmatch(data, -1) {
+		var raw []byte
+		for i := 0; i < len(match[2]); i++ {
+			c := match[2][i]
+			if c == '\\' && i+1 < len(match[2]) {
+				i++
+				if c = match[2][i]; c == 'r' {
+					c = '\r'
+				}
+			}
+			raw = append(raw, c)
+		}
+
+		units := make([]uint16, len(raw)/2)
+		for i := range units {
+			units[i] = uint16(raw[2*i])<<8 | uint16(raw[2*i+1])
+		}
+		objects = append(objects, pdfTextObject{x: string(match[1]), text: string(utf16.Decode(units))})
+	}
+	return objects
+}
+
+// pdfTexts returns the text an uncompressed PDF draws, one entry per text
+// object.
+func pdfTexts(data []byte) []string {
+	var texts []string
+	for _, object := range pdfTextObjects(data) {
+		texts = append(texts, object.text)
+	}
+	return texts
+}
+
 func TestURLChecker_GeneratePDFReport(t *testing.T) {
 	checker, db := setupTestService(t)
 	ctx := context.Background()
@@ -264,169 +443,4098 @@ func TestURLChecker_GeneratePDFReport(t *testing.T) {
 	assert.True(t, strings.HasPrefix(string(pdfData), "%PDF"))
 }
 
-func TestURLChecker_GeneratePDFReport_EmptyBatches(t *testing.T) {
-	checker, _ := setupTestService(t)
+func TestURLChecker_GeneratePDFReport_Branding(t *testing.T) {
+	var logoData bytes.Buffer
+	require.NoError(t, png.Encode(&logoData, image.NewRGBA(image.Rect(0, 0, 40, 20))))
+
+	logo, err := NewReportLogo(logoData.Bytes())
+	require.NoError(t, err)
+
+	checker, db := setupTestService(t, WithReportTitle("Acme Uptime Report"), WithReportLogo(logo))
 	ctx := context.Background()
 
-	_, err := checker.GeneratePDFReport(ctx, []int{999})
-	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "no valid batches found")
+	require.NoError(t, db.CreateBatch(ctx, 1, models.BatchStatusCompleted, time.Now()))
 
-	_, err = checker.GeneratePDFReport(ctx, []int{})
-	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "no batch IDs provided")
+	// keep page content readable so the heading can be found in the output
+	gofpdf.SetDefaultCompression(false)
+	defer gofpdf.SetDefaultCompression(true)
+
+	pdfData, err := checker.GeneratePDFReport(ctx, []int{1})
+	require.NoError(t, err)
+
+	assert.Contains(t, pdfTexts(pdfData), "Acme Uptime Report")
+	assert.NotContains(t, pdfTexts(pdfData), DefaultReportTitle)
+	assert.Contains(t, string(pdfData), "/Subtype /Image")
 }
 
-func TestURLChecker_GeneratePDFReportAsync(t *testing.T) {
-	checker, db := setupTestService(t)
+func TestURLChecker_GeneratePDFReport_UnsupportedCharacters(t *testing.T) {
+	checker, db := setupTestService(t, WithReportTitle("Uptime 🚀"))
+	checker.logger.SetLevel(logrus.WarnLevel)
+	hook := logtest.NewLocal(checker.logger)
 	ctx := context.Background()
 
-	err := db.CreateBatch(ctx, 1, models.BatchStatusCompleted, time.Now())
-	require.NoError(t, err)
-
+	require.NoError(t, db.CreateBatch(ctx, 1, models.BatchStatusCompleted, time.Now()))
 	now := time.Now()
-	_, err = db.CreateLink(ctx, "http://example.com", models.StatusAvailable, 1, &now)
+	_, err := db.CreateLink(ctx, "http://example.com/🚀launch", models.StatusAvailable, 1, &now)
+	require.NoError(t, err)
+	_, err = db.CreateLink(ctx, "http://example.com/café", models.StatusAvailable, 1, &now)
+	require.NoError(t, err)
+	_, err = db.CreateLink(ctx, "https://пример.рф:8443/путь?q=да", models.StatusAvailable, 1, &now)
+	require.NoError(t, err)
+	_, err = db.CreateLink(ctx, "http://例え.jp/", models.StatusAvailable, 1, &now)
 	require.NoError(t, err)
 
-	workerCtx, workerCancel := context.WithCancel(context.Background())
-	defer workerCancel()
-	go checker.StartWorker(workerCtx)
+	gofpdf.SetDefaultCompression(false)
+	defer gofpdf.SetDefaultCompression(true)
 
-	pdfData, err := checker.GeneratePDFReportAsync(ctx, []int{1})
-	assert.NoError(t, err)
-	assert.NotEmpty(t, pdfData)
+	pdfData, err := checker.GeneratePDFReport(ctx, []int{1})
+	require.NoError(t, err)
 	assert.True(t, strings.HasPrefix(string(pdfData), "%PDF"))
+
+	texts := pdfTexts(pdfData)
+	assert.Contains(t, texts, "Uptime ?")
+	// URLs the embedded font covers are printed as written
+	assert.Contains(t, texts, "https://пример.рф:8443/путь?q=да: Available")
+	assert.Contains(t, texts, "http://example.com/café: Available")
+	// others are shown as they are requested
+	assert.Contains(t, texts, "http://example.com/%F0%9F%9A%80launch: Available")
+	assert.Contains(t, texts, "http://xn--r8jz45g.jp/: Available")
+
+	var warned bool
+	for _, entry := range hook.AllEntries() {
+		if entry.Level == logrus.WarnLevel && strings.Contains(entry.Message, "🚀") {
+			warned = true
+		}
+	}
+	assert.True(t, warned)
 }
 
-func TestURLChecker_GeneratePDFReportAsync_Shutdown(t *testing.T) {
-	checker, _ := setupTestService(t)
+func TestURLChecker_GeneratePDFReport_LongURL(t *testing.T) {
+	checker, db := setupTestService(t)
 	ctx := context.Background()
 
-	checker.SetShutdown(true)
+	longURL := "http://example.com/" + strings.Repeat("a", 300-len("http://example.com/"))
+	require.NoError(t, db.CreateBatch(ctx, 1, models.BatchStatusCompleted, time.Now()))
+	now := time.Now()
+	_, err := db.CreateLink(ctx, longURL, models.StatusAvailable, 1, &now)
+	require.NoError(t, err)
 
-	_, err := checker.GeneratePDFReportAsync(ctx, []int{1})
-	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "service is shutting down")
+	gofpdf.SetDefaultCompression(false)
+	defer gofpdf.SetDefaultCompression(true)
+
+	pdfData, err := checker.GeneratePDFReport(ctx, []int{1})
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(pdfData), "%PDF"))
+
+	// the line is split across several text objects indented the same way
+	var (
+		pieces []string
+		xs     = map[string]bool{}
+	)
+	for _, object := range pdfTextObjects(pdfData) {
+		if strings.Contains(object.text, "aaaa") {
+			pieces = append(pieces, object.text)
+			xs[object.x] = true
+		}
+	}
+	assert.Greater(t, len(pieces), 1)
+	assert.Len(t, xs, 1)
+	assert.Equal(t, longURL+": Available", strings.Join(pieces, ""))
 }
 
-func TestURLChecker_GeneratePDFReportAsync_Timeout(t *testing.T) {
-	checker, _ := setupTestService(t)
+func TestASCIIURL(t *testing.T) {
+	for rawURL, expected := range map[string]string{
+		"https://пример.рф:8443/путь": "https://xn--e1afmkfd.xn--p1ai:8443/%D0%BF%D1%83%D1%82%D1%8C",
+		"http://München.de/":          "http://xn--mnchen-3ya.de/",
+		"http://例え.jp/?q=ü":           "http://xn--r8jz45g.jp/?q=%C3%BC",
+		"http://[::1]:8080/ü":         "http://[::1]:8080/%C3%BC",
+	} {
+		ascii, ok := asciiURL(rawURL)
+		require.True(t, ok, rawURL)
+		assert.Equal(t, expected, ascii, rawURL)
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Nanosecond)
-	defer cancel()
-	time.Sleep(1 * time.Millisecond)
+	_, ok := asciiURL("not a url")
+	assert.False(t, ok)
+}
 
-	_, err := checker.GeneratePDFReportAsync(ctx, []int{1})
+func TestURLChecker_GeneratePDFReport_UnicodeFont(t *testing.T) {
+	_, err := NewReportFont([]byte("not a font"))
 	assert.Error(t, err)
+
+	path := filepath.Join(t.TempDir(), "font.ttf")
+	require.NoError(t, os.WriteFile(path, defaultReportFontData, 0o644))
+	font, err := LoadReportFont(path)
+	require.NoError(t, err)
+
+	checker, db := setupTestService(t, WithReportFont(font))
+	checker.logger.SetLevel(logrus.WarnLevel)
+	hook := logtest.NewLocal(checker.logger)
+	ctx := context.Background()
+
+	require.NoError(t, db.CreateBatch(ctx, 1, models.BatchStatusCompleted, time.Now()))
+	now := time.Now()
+	_, err = db.CreateLink(ctx, "https://пример.рф/путь", models.StatusAvailable, 1, &now)
+	require.NoError(t, err)
+
+	pdfData, err := checker.GeneratePDFReport(ctx, []int{1})
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(pdfData), "%PDF"))
+	assert.Contains(t, string(pdfData), "/FontFile2")
+	// nothing had to be replaced
+	assert.Empty(t, hook.AllEntries())
 }
 
-func TestURLChecker_GetHealthStatus(t *testing.T) {
+func TestURLChecker_GeneratePDFReport_Deadline(t *testing.T) {
 	checker, db := setupTestService(t)
 	ctx := context.Background()
 
-	status := checker.GetHealthStatus(ctx)
-	assert.Equal(t, "healthy", status["status"])
-	assert.Equal(t, false, status["shutdown"])
-	assert.Equal(t, 0, status["batches"])
-	assert.NotNil(t, status["timestamp"])
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-release
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
 
-	err := db.CreateBatch(ctx, 1, models.BatchStatusCompleted, time.Now())
+	workerCtx, workerCancel := context.WithCancel(ctx)
+	defer workerCancel()
+	go checker.StartBatchWorker(workerCtx)
+
+	response, err := checker.CheckLinksWithOptions(ctx, []string{server.URL + "/ok", server.URL + "/slow"}, CheckOptions{Async: true})
 	require.NoError(t, err)
 
-	status = checker.GetHealthStatus(ctx)
-	assert.Equal(t, 1, status["batches"])
+	require.Eventually(t, func() bool {
+		links, err := db.GetLinksByBatchNum(ctx, response.BatchNum)
+		return err == nil && len(links) == 2 && links[0].Status == models.StatusAvailable
+	}, 5*time.Second, 10*time.Millisecond)
 
-	checker.SetShutdown(true)
-	status = checker.GetHealthStatus(ctx)
-	assert.Equal(t, true, status["shutdown"])
-}
+	start := time.Now()
+	done, err := checker.WaitForBatches(ctx, []int{response.BatchNum}, 200*time.Millisecond)
+	require.NoError(t, err)
+	assert.False(t, done)
+	assert.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
 
-func TestURLChecker_GetCurrentTimestamp(t *testing.T) {
-	checker, _ := setupTestService(t)
+	gofpdf.SetDefaultCompression(false)
+	defer gofpdf.SetDefaultCompression(true)
 
-	before := time.Now().Unix()
-	timestamp := checker.GetCurrentTimestamp()
-	after := time.Now().Unix()
+	pdfData, err := checker.GeneratePDFReport(ctx, []int{response.BatchNum})
+	require.NoError(t, err)
 
-	assert.GreaterOrEqual(t, timestamp, before)
-	assert.LessOrEqual(t, timestamp, after)
+	text := strings.Join(pdfTexts(pdfData), "\n")
+	assert.Contains(t, text, server.URL+"/ok: Available (HTTP 200 OK)")
+	assert.Contains(t, text, server.URL+"/slow: Still processing\n")
+	assert.Contains(t, text, "1 of 2 links were still processing when the report was generated")
+
+	// finished batches don't wait
+	require.NoError(t, db.CreateBatch(ctx, 100, models.BatchStatusCompleted, time.Now()))
+	done, err = checker.WaitForBatches(ctx, []int{100}, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, done)
 }
 
-func TestURLChecker_StartWorker(t *testing.T) {
-	checker, _ := setupTestService(t)
+func TestURLChecker_EstimateReport(t *testing.T) {
+	var logoData bytes.Buffer
+	require.NoError(t, png.Encode(&logoData, image.NewRGBA(image.Rect(0, 0, 40, 20))))
+	logo, err := NewReportLogo(logoData.Bytes())
+	require.NoError(t, err)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
-	defer cancel()
+	pageObject := regexp.MustCompile(`/Type /Page\b`)
 
-	assert.NotPanics(t, func() {
-		checker.StartWorker(ctx)
-	})
+	for _, tt := range []struct {
+		name string
+		opts []Option
+	}{
+		{name: "plain"},
+		{name: "with logo", opts: []Option{WithReportLogo(logo)}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			checker, db := setupTestService(t, tt.opts...)
+			ctx := context.Background()
+
+			for batchNum, size := range map[int]int{1: 75, 2: 3} {
+				require.NoError(t, db.CreateBatch(ctx, batchNum, models.BatchStatusCompleted, time.Now()))
+				for i := 0; i < size; i++ {
+					_, err := db.CreateLink(ctx, fmt.Sprintf("http://example.com/%d/%d", batchNum, i), models.StatusAvailable, batchNum, nil)
+					require.NoError(t, err)
+				}
+			}
+
+			estimate, err := checker.EstimateReport(ctx, []int{1, 9, 2})
+			require.NoError(t, err)
+
+			pdfData, err := checker.GeneratePDFReport(ctx, []int{1, 9, 2})
+			require.NoError(t, err)
+
+			assert.Equal(t, 2, estimate.BatchCount)
+			assert.Equal(t, 78, estimate.LinkCount)
+			assert.Equal(t, []int{9}, estimate.Missing)
+			assert.Greater(t, estimate.PageCount, 1)
+			assert.Equal(t, len(pageObject.FindAllIndex(pdfData, -1)), estimate.PageCount)
+		})
+	}
+
+	checker, _ := setupTestService(t)
+	estimate, err := checker.EstimateReport(context.Background(), []int{5})
+	require.NoError(t, err)
+	assert.Equal(t, models.ReportEstimate{Missing: []int{5}}, estimate)
 }
 
-func TestURLChecker_processPDFTask(t *testing.T) {
+func TestURLChecker_GeneratePDFReport_PageNumbers(t *testing.T) {
 	checker, db := setupTestService(t)
 	ctx := context.Background()
 
-	err := db.CreateBatch(ctx, 1, models.BatchStatusCompleted, time.Now())
+	require.NoError(t, db.CreateBatch(ctx, 1, models.BatchStatusCompleted, time.Now()))
+	for i := 0; i < 200; i++ {
+		_, err := db.CreateLink(ctx, fmt.Sprintf("http://example.com/page/%d", i), models.StatusAvailable, 1, nil)
+		require.NoError(t, err)
+	}
+
+	gofpdf.SetDefaultCompression(false)
+	defer gofpdf.SetDefaultCompression(true)
+
+	pdfData, err := checker.GeneratePDFReport(ctx, []int{1})
 	require.NoError(t, err)
 
+	pages := len(regexp.MustCompile(`/Type /Page\b`).FindAllIndex(pdfData, -1))
+	assert.Greater(t, pages, 1)
+	texts := pdfTexts(pdfData)
+	for page := 1; page <= pages; page++ {
+		assert.Contains(t, texts, fmt.Sprintf("Page %d of %d", page, pages))
+	}
+	// every link made it into the report
+	assert.Contains(t, texts, "http://example.com/page/0: Available")
+	assert.Contains(t, texts, "http://example.com/page/199: Available")
+}
+
+func TestURLChecker_GeneratePDFReport_Summary(t *testing.T) {
+	checker, db := setupTestService(t)
+	ctx := context.Background()
+
 	now := time.Now()
-	_, err = db.CreateLink(ctx, "http://example.com", models.StatusAvailable, 1, &now)
+	require.NoError(t, db.CreateBatch(ctx, 1, models.BatchStatusCompleted, now))
+	for i, status := range []models.LinkStatus{models.StatusAvailable, models.StatusAvailable, models.StatusNotAvailable, models.StatusProcessing} {
+		_, err := db.CreateLink(ctx, fmt.Sprintf("http://example.com/%d", i), status, 1, &now)
+		require.NoError(t, err)
+	}
+	require.NoError(t, db.CreateBatch(ctx, 2, models.BatchStatusCompleted, now))
+
+	gofpdf.SetDefaultCompression(false)
+	defer gofpdf.SetDefaultCompression(true)
+
+	pdfData, err := checker.GeneratePDFReport(ctx, []int{1, 2})
 	require.NoError(t, err)
 
-	task := &PDFTask{
-		BatchIDs: []int{1},
-		Result:   make(chan []byte, 1),
-		Error:    make(chan error, 1),
+	texts := pdfTexts(pdfData)
+	row := func(label string) []string {
+		for i, text := range texts {
+			if text == label && i+4 < len(texts) {
+				return texts[i+1 : i+5]
+			}
+		}
+		return nil
 	}
 
-	checker.processPDFTask(ctx, task)
+	assert.Equal(t, []string{"Links", "Available", "Not available", "Processing"}, row("Batch"))
+	assert.Equal(t, []string{"4", "2", "1", "1"}, row("link_num #1"))
+	// a batch without links still gets its row
+	assert.Equal(t, []string{"0", "0", "0", "0"}, row("link_num #2"))
+	assert.Equal(t, []string{"4", "2", "1", "1"}, row("All batches"))
 
-	select {
-	case pdfData := <-task.Result:
-		assert.NotEmpty(t, pdfData)
-		assert.True(t, strings.HasPrefix(string(pdfData), "%PDF"))
-	case err := <-task.Error:
-		t.Fatalf("Unexpected error: %v", err)
-	case <-time.After(5 * time.Second):
-		t.Fatal("Timeout waiting for PDF generation")
-	}
+	// the summary comes before the per-link detail
+	text := strings.Join(texts, "\n")
+	assert.Less(t, strings.Index(text, "All batches"), strings.Index(text, "http://example.com/0"))
 }
 
-func TestURLChecker_processLinks(t *testing.T) {
+func TestURLChecker_GenerateReport_GroupByStatusClass(t *testing.T) {
 	checker, db := setupTestService(t)
-	server := setupMockHTTPServer(t)
 	ctx := context.Background()
 
-	err := db.CreateBatch(ctx, 1, models.BatchStatusProcessing, time.Now())
+	now := time.Now()
+	require.NoError(t, db.CreateBatch(ctx, 1, models.BatchStatusCompleted, now))
+	results := []struct {
+		url    string
+		status models.LinkStatus
+		code   int
+	}{
+		{"http://example.com/ok", models.StatusAvailable, 200},
+		{"http://example.com/missing", models.StatusNotAvailable, 404},
+		{"http://example.com/created", models.StatusAvailable, 201},
+		{"http://example.com/unchanged", models.StatusAvailable, 304},
+		{"http://example.com/broken", models.StatusNotAvailable, 503},
+		{"http://unreachable.invalid", models.StatusError, 0},
+		{"http://example.com/gone", models.StatusNotAvailable, 410},
+	}
+	for _, result := range results {
+		id, err := db.CreateLink(ctx, result.url, models.StatusProcessing, 1, nil)
+		require.NoError(t, err)
+		require.NoError(t, db.UpdateLinkResult(ctx, &models.Link{ID: id, Status: result.status, Time: &now, StatusCode: result.code}))
+	}
+
+	grouped := WithReportOptions(ctx, ReportOptions{GroupBy: models.ReportGroupByStatusClass})
+
+	data, err := checker.GenerateReport(grouped, ReportFormatJSON, []int{1})
 	require.NoError(t, err)
 
-	links := []string{server.URL + "/ok", server.URL + "/notfound"}
-	results, err := checker.processLinks(ctx, links, 1)
-	assert.NoError(t, err)
-	assert.Len(t, results, 2)
+	var report struct {
+		Batches []struct {
+			Groups []struct {
+				StatusClass string         `json:"status_class"`
+				Count       int            `json:"count"`
+				Links       []*models.Link `json:"links"`
+			} `json:"groups"`
+		} `json:"batches"`
+	}
+	require.NoError(t, json.Unmarshal(data, &report))
+	require.Len(t, report.Batches, 1)
 
-	for _, result := range results {
-		assert.Equal(t, 1, result.BatchNum)
-		assert.NotNil(t, result.Time)
-		assert.Contains(t, links, result.URL)
-		assert.True(t, result.Status == models.StatusAvailable || result.Status == models.StatusNotAvailable)
+	buckets := make(map[string][]string)
+	var order []string
+	for _, group := range report.Batches[0].Groups {
+		order = append(order, group.StatusClass)
+		assert.Len(t, group.Links, group.Count)
+		for _, link := range group.Links {
+			buckets[group.StatusClass] = append(buckets[group.StatusClass], link.URL)
+		}
 	}
+	assert.Equal(t, []string{"2xx", "3xx", "4xx", "5xx", "error"}, order)
+	assert.Equal(t, map[string][]string{
+		"2xx":   {"http://example.com/ok", "http://example.com/created"},
+		"3xx":   {"http://example.com/unchanged"},
+		"4xx":   {"http://example.com/missing", "http://example.com/gone"},
+		"5xx":   {"http://example.com/broken"},
+		"error": {"http://unreachable.invalid"},
+	}, buckets)
+
+	data, err = checker.GenerateReport(grouped, ReportFormatCSV, []int{1})
+	require.NoError(t, err)
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, len(results)+1)
+	assert.Equal(t, []string{"status_class", "status_class_count"}, records[0][7:])
+	assert.Equal(t, []string{"http://example.com/missing", "4xx", "2"}, []string{records[4][2], records[4][7], records[4][8]})
+	assert.Equal(t, []string{"http://unreachable.invalid", "error", "1"}, []string{records[7][2], records[7][7], records[7][8]})
+
+	data, err = checker.GenerateReport(grouped, ReportFormatHTML, []int{1})
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "<h3>2xx (2)</h3>")
+	assert.Contains(t, string(data), "<h3>error (1)</h3>")
+
+	gofpdf.SetDefaultCompression(false)
+	defer gofpdf.SetDefaultCompression(true)
+
+	data, err = checker.GenerateReport(grouped, ReportFormatPDF, []int{1})
+	require.NoError(t, err)
+	texts := pdfTexts(data)
+	assert.Contains(t, texts, "4xx (2)")
+	require.Contains(t, texts, "5xx (1)")
+	text := strings.Join(texts, "\n")
+	assert.Less(t, strings.Index(text, "5xx (1)"), strings.Index(text, "http://example.com/broken"))
+
+	// without the option the links keep their order and no groups are added
+	data, err = checker.GenerateReport(ctx, ReportFormatJSON, []int{1})
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "status_class")
 }
 
-func TestURLChecker_processLinks_ContextCancellation(t *testing.T) {
-	checker, db := setupTestService(t)
-	server := setupMockHTTPServer(t)
+func TestURLChecker_GenerateReport_MaxSize(t *testing.T) {
+	// every report carries a subset of the embedded font, about 35KB
+	checker, db := setupTestService(t, WithMaxReportSize(48<<10))
+	ctx := context.Background()
 
-	ctx, cancel := context.WithCancel(context.Background())
-	cancel()
+	require.NoError(t, db.CreateBatch(ctx, 1, models.BatchStatusCompleted, time.Now()))
+	require.NoError(t, db.CreateBatch(ctx, 2, models.BatchStatusCompleted, time.Now()))
+	for i := 0; i < 1000; i++ {
+		_, err := db.CreateLink(ctx, fmt.Sprintf("http://example.com/docs/reference/page/%d", i), models.StatusAvailable, 1, nil)
+		require.NoError(t, err)
+	}
 
-	err := db.CreateBatch(context.Background(), 1, models.BatchStatusProcessing, time.Now())
+	_, err := checker.GeneratePDFReport(ctx, []int{1})
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrReportTooLarge)
+	assert.Contains(t, err.Error(), "request fewer batches")
+
+	// a small report still fits
+	pdfData, err := checker.GeneratePDFReport(ctx, []int{2})
 	require.NoError(t, err)
+	assert.Less(t, len(pdfData), 48<<10)
 
-	links := []string{server.URL + "/ok"}
-	results, err := checker.processLinks(ctx, links, 1)
-	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "context canceled")
-	assert.Empty(t, results)
+	// the limit applies to every format
+	for _, format := range []string{ReportFormatCSV, ReportFormatJSON, ReportFormatHTML} {
+		_, err := checker.GenerateReport(ctx, format, []int{1})
+		assert.ErrorIs(t, err, ErrReportTooLarge, format)
+
+		_, err = checker.GenerateReport(ctx, format, []int{2})
+		assert.NoError(t, err, format)
+	}
+}
+
+type upperRenderer struct{}
+
+func (upperRenderer) ContentType() string   { return "text/plain" }
+func (upperRenderer) FileExtension() string { return "txt" }
+
+func (upperRenderer) Render(ctx context.Context, batches []*models.Batch, links []*models.Link, w io.Writer) error {
+	for _, link := range links {
+		fmt.Fprintln(w, strings.ToUpper(link.URL))
+	}
+	return nil
+}
+
+func TestReportRenderers(t *testing.T) {
+	checker, _ := setupTestService(t, WithReportTitle("Uptime <Weekly>"))
+	ctx := context.Background()
+
+	checkedAt := time.Date(2025, 12, 7, 14, 56, 5, 0, time.UTC)
+	batches := []*models.Batch{
+		{LinksNum: 1, BatchNum: 1, Status: models.BatchStatusCompleted, CreatedAt: checkedAt},
+		{LinksNum: 2, BatchNum: 2, Status: models.BatchStatusFailed, CreatedAt: checkedAt},
+	}
+	links := []*models.Link{
+		{ID: 1, URL: "http://a.example/?q=1&r=2", Status: models.StatusAvailable, BatchNum: 1, Time: &checkedAt, CheckSource: models.CheckSourceInitial},
+		{ID: 2, URL: "http://b.example", Status: models.StatusNotAvailable, BatchNum: 1, Time: &checkedAt, CheckSource: models.CheckSourceRetry, Notes: "vendor migration"},
+	}
+
+	tests := []struct {
+		format      string
+		contentType string
+		check       func(t *testing.T, output []byte)
+	}{
+		{
+			format:      ReportFormatPDF,
+			contentType: "application/pdf",
+			check: func(t *testing.T, output []byte) {
+				assert.True(t, bytes.HasPrefix(output, []byte("%PDF-")))
+			},
+		},
+		{
+			format:      ReportFormatCSV,
+			contentType: "text/csv; charset=utf-8",
+			check: func(t *testing.T, output []byte) {
+				assert.Equal(t, "batch_num,batch_status,url,status,checked_at,check_source,notes\n"+
+					"1,completed,http://a.example/?q=1&r=2,available,2025-12-07T14:56:05Z,initial,\n"+
+					"1,completed,http://b.example,not available,2025-12-07T14:56:05Z,retry,vendor migration\n", string(output))
+			},
+		},
+		{
+			format:      ReportFormatJSON,
+			contentType: "application/json",
+			check: func(t *testing.T, output []byte) {
+				var report struct {
+					Batches []struct {
+						models.Batch
+						Summary models.ReportSummary `json:"summary"`
+						Links   []models.Link        `json:"links"`
+					} `json:"batches"`
+				}
+				require.NoError(t, json.Unmarshal(output, &report))
+				require.Len(t, report.Batches, 2)
+				assert.Equal(t, 1, report.Batches[0].LinksNum)
+				require.Len(t, report.Batches[0].Links, 2)
+				assert.Equal(t, "http://b.example", report.Batches[0].Links[1].URL)
+				assert.Equal(t, models.ReportSummary{Total: 2, Available: 1, NotAvailable: 1}, report.Batches[0].Summary)
+				assert.Empty(t, report.Batches[1].Links)
+				assert.Equal(t, models.ReportSummary{}, report.Batches[1].Summary)
+			},
+		},
+		{
+			format:      ReportFormatHTML,
+			contentType: "text/html; charset=utf-8",
+			check: func(t *testing.T, output []byte) {
+				html := string(output)
+				assert.Contains(t, html, "<h1>Uptime &lt;Weekly&gt;</h1>")
+				assert.Contains(t, html, "link_num #2 (failed)")
+				assert.Contains(t, html, "<li>http://a.example/?q=1&amp;r=2: Available</li>")
+				assert.Contains(t, html, "<li>http://b.example: Not Available (vendor migration)</li>")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			renderer, err := checker.ReportRenderer(tt.format)
+			require.NoError(t, err)
+			assert.Equal(t, tt.contentType, renderer.ContentType())
+			assert.Equal(t, tt.format, renderer.FileExtension())
+
+			var buf bytes.Buffer
+			require.NoError(t, renderer.Render(ctx, batches, links, &buf))
+			tt.check(t, buf.Bytes())
+		})
+	}
+
+	_, err := checker.ReportRenderer("docx")
+	assert.Error(t, err)
+
+	renderer, err := checker.ReportRenderer("")
+	require.NoError(t, err)
+	assert.Equal(t, "application/pdf", renderer.ContentType())
+}
+
+func TestCSVRenderer_ReportOptions(t *testing.T) {
+	renderer := &csvRenderer{opts: CSVOptions{Delimiter: ';', BOM: true}}
+	batches := []*models.Batch{{LinksNum: 1, Status: models.BatchStatusCompleted}}
+	links := []*models.Link{{URL: "http://a.example", Status: models.StatusAvailable, BatchNum: 1, CheckSource: models.CheckSourceInitial}}
+
+	var buf bytes.Buffer
+	require.NoError(t, renderer.Render(context.Background(), batches, links, &buf))
+	assert.Equal(t, "\ufeffbatch_num;batch_status;url;status;checked_at;check_source;notes\n1;completed;http://a.example;available;;initial;\n", buf.String())
+
+	// a report's own encoding replaces the configured one
+	noBOM := false
+	ctx := WithReportOptions(context.Background(), ReportOptions{CSVDelimiter: '\t', CSVBOM: &noBOM})
+	buf.Reset()
+	require.NoError(t, renderer.Render(ctx, batches, links, &buf))
+	assert.Equal(t, "batch_num\tbatch_status\turl\tstatus\tchecked_at\tcheck_source\tnotes\n1\tcompleted\thttp://a.example\tavailable\t\tinitial\t\n", buf.String())
+}
+
+func TestURLChecker_GenerateReport_CustomRenderer(t *testing.T) {
+	checker, db := setupTestService(t, WithReportRenderer("TXT", upperRenderer{}))
+	ctx := context.Background()
+
+	require.NoError(t, db.CreateBatch(ctx, 1, models.BatchStatusCompleted, time.Now()))
+	_, err := db.CreateLink(ctx, "http://example.com", models.StatusAvailable, 1, nil)
+	require.NoError(t, err)
+
+	report, err := checker.GenerateReport(ctx, "txt", []int{1})
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP://EXAMPLE.COM\n", string(report))
+
+	report, err = checker.GenerateCSVReport(ctx, []int{1})
+	require.NoError(t, err)
+	assert.Contains(t, string(report), "http://example.com,available")
+
+	report, err = checker.GenerateJSONReport(ctx, []int{1})
+	require.NoError(t, err)
+	assert.Contains(t, string(report), `"summary":{"total":1,"available":1,"not_available":0}`)
+}
+
+func TestNewReportLogo_Invalid(t *testing.T) {
+	_, err := NewReportLogo([]byte("not an image"))
+	assert.Error(t, err)
+
+	_, err = LoadReportLogo("./missing-logo.png")
+	assert.Error(t, err)
+}
+
+func TestURLChecker_GeneratePDFReport_EmptyBatches(t *testing.T) {
+	checker, _ := setupTestService(t)
+	ctx := context.Background()
+
+	_, err := checker.GeneratePDFReport(ctx, []int{999})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no valid batches found")
+
+	_, err = checker.GeneratePDFReport(ctx, []int{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no batch IDs provided")
+}
+
+// flushRecorder keeps a copy of the output at every flush.
+type flushRecorder struct {
+	bytes.Buffer
+	flushes []string
+}
+
+func (r *flushRecorder) Flush() {
+	r.flushes = append(r.flushes, r.String())
+}
+
+func TestURLChecker_StreamReport(t *testing.T) {
+	checker, db := setupTestService(t)
+	ctx := context.Background()
+
+	now := time.Now()
+	for batchNum := 1; batchNum <= 3; batchNum++ {
+		require.NoError(t, db.CreateBatch(ctx, batchNum, models.BatchStatusCompleted, now))
+		_, err := db.CreateLink(ctx, fmt.Sprintf("http://batch%d.example", batchNum), models.StatusAvailable, batchNum, &now)
+		require.NoError(t, err)
+	}
+
+	out := &flushRecorder{}
+	require.NoError(t, checker.StreamReport(ctx, ReportFormatJSON, []int{1, 2, 3}, out))
+
+	// each batch is flushed on its own, before the next one is rendered
+	require.Len(t, out.flushes, 3)
+	assert.Contains(t, out.flushes[0], "batch1.example")
+	assert.NotContains(t, out.flushes[0], "batch2.example")
+	assert.Contains(t, out.flushes[1], "batch2.example")
+	assert.NotContains(t, out.flushes[1], "batch3.example")
+	assert.False(t, strings.HasSuffix(out.flushes[2], "]}\n"))
+
+	var report struct {
+		Batches []struct {
+			models.Batch
+			Links []models.Link `json:"links"`
+		} `json:"batches"`
+	}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &report))
+	require.Len(t, report.Batches, 3)
+	assert.Equal(t, "http://batch3.example", report.Batches[2].Links[0].URL)
+
+	out = &flushRecorder{}
+	require.NoError(t, checker.StreamReport(ctx, ReportFormatHTML, []int{1, 2}, out))
+	require.Len(t, out.flushes, 2)
+	assert.NotContains(t, out.flushes[0], "batch2.example")
+	assert.True(t, strings.HasSuffix(out.String(), "</html>\n"))
+
+	assert.Error(t, checker.StreamReport(ctx, ReportFormatPDF, []int{1}, &flushRecorder{}))
+	assert.Error(t, checker.StreamReport(ctx, ReportFormatJSON, []int{99}, &flushRecorder{}))
+}
+
+func TestURLChecker_GeneratePDFReportAsync(t *testing.T) {
+	checker, db := setupTestService(t)
+	ctx := context.Background()
+
+	err := db.CreateBatch(ctx, 1, models.BatchStatusCompleted, time.Now())
+	require.NoError(t, err)
+
+	now := time.Now()
+	_, err = db.CreateLink(ctx, "http://example.com", models.StatusAvailable, 1, &now)
+	require.NoError(t, err)
+
+	workerCtx, workerCancel := context.WithCancel(context.Background())
+	defer workerCancel()
+	go checker.StartWorker(workerCtx)
+
+	pdfData, err := checker.GeneratePDFReportAsync(ctx, []int{1})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, pdfData)
+	assert.True(t, strings.HasPrefix(string(pdfData), "%PDF"))
+}
+
+func TestURLChecker_GeneratePDFReportAsync_Shutdown(t *testing.T) {
+	checker, _ := setupTestService(t)
+	ctx := context.Background()
+
+	checker.SetShutdown(true)
+
+	_, err := checker.GeneratePDFReportAsync(ctx, []int{1})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "service is shutting down")
+}
+
+func TestURLChecker_GeneratePDFReportAsync_Timeout(t *testing.T) {
+	checker, _ := setupTestService(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Nanosecond)
+	defer cancel()
+	time.Sleep(1 * time.Millisecond)
+
+	_, err := checker.GeneratePDFReportAsync(ctx, []int{1})
+	assert.Error(t, err)
+}
+
+func TestURLChecker_GeneratePDFReportAsync_WaitsForQueue(t *testing.T) {
+	checker, _ := setupTestService(t, WithPDFQueueWait(5*time.Second))
+	ctx := context.Background()
+
+	// no worker is running, so the queue stays full until a slot is freed
+	for i := 0; i < cap(checker.pendingPDFTasks); i++ {
+		checker.pendingPDFTasks <- &PDFTask{BatchIDs: []int{1}}
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		<-checker.pendingPDFTasks
+
+		// answer the request's task once it reaches the front of the queue
+		for task := range checker.pendingPDFTasks {
+			if task.Result != nil {
+				task.Result <- []byte("queued")
+				return
+			}
+		}
+	}()
+
+	data, err := checker.GeneratePDFReportAsync(ctx, []int{42})
+	require.NoError(t, err)
+	assert.Equal(t, "queued", string(data))
+}
+
+func TestURLChecker_GeneratePDFReportAsync_QueueFull(t *testing.T) {
+	checker, db := setupTestService(t, WithPDFQueueWait(0))
+	ctx := context.Background()
+
+	require.NoError(t, db.CreateBatch(ctx, 1, models.BatchStatusCompleted, time.Now()))
+
+	for i := 0; i < cap(checker.pendingPDFTasks); i++ {
+		checker.pendingPDFTasks <- &PDFTask{BatchIDs: []int{1}}
+	}
+
+	// without a wait the report is generated in the request
+	data, err := checker.GeneratePDFReportAsync(ctx, []int{1})
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "%PDF"))
+	assert.Len(t, checker.pendingPDFTasks, cap(checker.pendingPDFTasks))
+}
+
+func TestURLChecker_GetHealthStatus(t *testing.T) {
+	checker, db := setupTestService(t)
+	ctx := context.Background()
+
+	status := checker.GetHealthStatus(ctx)
+	assert.Equal(t, "healthy", status["status"])
+	assert.Equal(t, false, status["shutdown"])
+	assert.Equal(t, 0, status["batches"])
+	assert.NotNil(t, status["timestamp"])
+
+	err := db.CreateBatch(ctx, 1, models.BatchStatusCompleted, time.Now())
+	require.NoError(t, err)
+
+	status = checker.GetHealthStatus(ctx)
+	assert.Equal(t, 1, status["batches"])
+
+	checker.SetShutdown(true)
+	status = checker.GetHealthStatus(ctx)
+	assert.Equal(t, true, status["shutdown"])
+}
+
+func TestURLChecker_Shutdown(t *testing.T) {
+	checker, db := setupTestService(t)
+	ctx := context.Background()
+
+	require.NoError(t, db.CreateBatch(ctx, 1, models.BatchStatusCompleted, time.Now()))
+	_, err := db.CreateLink(ctx, "http://done.example", models.StatusAvailable, 1, nil)
+	require.NoError(t, err)
+
+	for batchNum := 2; batchNum <= 3; batchNum++ {
+		require.NoError(t, db.CreateBatch(ctx, batchNum, models.BatchStatusProcessing, time.Now()))
+		for i := 0; i < 2; i++ {
+			_, err := db.CreateLink(ctx, fmt.Sprintf("http://pending.example/%d/%d", batchNum, i), models.StatusProcessing, batchNum, nil)
+			require.NoError(t, err)
+		}
+	}
+
+	// no worker is running, so the tasks stay queued
+	for i := 0; i < 3; i++ {
+		checker.pendingPDFTasks <- &PDFTask{BatchIDs: []int{1}}
+	}
+
+	assert.NotContains(t, checker.GetHealthStatus(ctx), "shutdown_stats")
+
+	stats := checker.Shutdown(ctx)
+	assert.True(t, checker.IsShutdown())
+	assert.Equal(t, 2, stats.InFlightBatches)
+	assert.Equal(t, 4, stats.ProcessingLinks)
+	assert.Equal(t, 3, stats.QueuedPDFTasks)
+	assert.Equal(t, int64(0), stats.ActiveChecks)
+	assert.False(t, stats.At.IsZero())
+
+	status := checker.GetHealthStatus(ctx)
+	assert.Equal(t, stats, status["shutdown_stats"])
+
+	checker.SetShutdown(false)
+	assert.NotContains(t, checker.GetHealthStatus(ctx), "shutdown_stats")
+}
+
+func TestURLChecker_GetCurrentTimestamp(t *testing.T) {
+	checker, _ := setupTestService(t)
+
+	before := time.Now().Unix()
+	timestamp := checker.GetCurrentTimestamp()
+	after := time.Now().Unix()
+
+	assert.GreaterOrEqual(t, timestamp, before)
+	assert.LessOrEqual(t, timestamp, after)
+}
+
+func TestURLChecker_StartWorker(t *testing.T) {
+	checker, _ := setupTestService(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	assert.NotPanics(t, func() {
+		checker.StartWorker(ctx)
+	})
+}
+
+func TestURLChecker_processPDFTask(t *testing.T) {
+	checker, db := setupTestService(t)
+	ctx := context.Background()
+
+	err := db.CreateBatch(ctx, 1, models.BatchStatusCompleted, time.Now())
+	require.NoError(t, err)
+
+	now := time.Now()
+	_, err = db.CreateLink(ctx, "http://example.com", models.StatusAvailable, 1, &now)
+	require.NoError(t, err)
+
+	task := &PDFTask{
+		BatchIDs: []int{1},
+		Result:   make(chan []byte, 1),
+		Error:    make(chan error, 1),
+	}
+
+	checker.processPDFTask(ctx, task)
+
+	select {
+	case pdfData := <-task.Result:
+		assert.NotEmpty(t, pdfData)
+		assert.True(t, strings.HasPrefix(string(pdfData), "%PDF"))
+	case err := <-task.Error:
+		t.Fatalf("Unexpected error: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for PDF generation")
+	}
+}
+
+// insertTestBatch stores batch 1 with links as processing, the way CheckLinks
+// does before checking them.
+func insertTestBatch(t *testing.T, db *database.Database, links []string) (*models.Batch, []int) {
+	batch := &models.Batch{LinksNum: 1, Status: models.BatchStatusProcessing, CreatedAt: time.Now()}
+	linkIDs, err := db.InsertBatchWithLinks(context.Background(), batch, links)
+	require.NoError(t, err)
+	return batch, linkIDs
+}
+
+func TestURLChecker_checkBatchLinks(t *testing.T) {
+	checker, db := setupTestService(t)
+	server := setupMockHTTPServer(t)
+	ctx := context.Background()
+
+	links := []string{server.URL + "/ok", server.URL + "/notfound"}
+	batch, linkIDs := insertTestBatch(t, db, links)
+	results, err := checker.checkBatchLinks(ctx, links, linkIDs, batch)
+	assert.NoError(t, err)
+	assert.Len(t, results, 2)
+
+	for _, result := range results {
+		assert.Equal(t, 1, result.BatchNum)
+		assert.NotNil(t, result.Time)
+		assert.Contains(t, links, result.URL)
+		assert.True(t, result.Status == models.StatusAvailable || result.Status == models.StatusNotAvailable)
+		assert.Equal(t, models.CheckSourceInitial, result.CheckSource)
+	}
+
+	stored, err := db.GetLinksByBatchNum(ctx, 1)
+	require.NoError(t, err)
+	for _, link := range stored {
+		assert.Equal(t, models.CheckSourceInitial, link.CheckSource)
+	}
+}
+
+func TestURLChecker_checkBatchLinks_ContextCancellation(t *testing.T) {
+	checker, db := setupTestService(t)
+	server := setupMockHTTPServer(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	links := []string{server.URL + "/ok"}
+	batch, linkIDs := insertTestBatch(t, db, links)
+	results, err := checker.checkBatchLinks(ctx, links, linkIDs, batch)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "context canceled")
+	assert.Empty(t, results)
+}
+
+func TestURLChecker_checkBatchLinks_MaxActiveChecks(t *testing.T) {
+	checker, db := setupTestService(t, WithMaxActiveChecks(2))
+	ctx := context.Background()
+
+	var peak atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		active := checker.ActiveChecks()
+		for {
+			current := peak.Load()
+			if active <= current || peak.CompareAndSwap(current, active) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	links := make([]string, 10)
+	for i := range links {
+		links[i] = fmt.Sprintf("%s/ok/%d", server.URL, i)
+	}
+
+	batch, linkIDs := insertTestBatch(t, db, links)
+	results, err := checker.checkBatchLinks(ctx, links, linkIDs, batch)
+	assert.NoError(t, err)
+	assert.Len(t, results, 10)
+
+	assert.Greater(t, peak.Load(), int64(0))
+	assert.LessOrEqual(t, peak.Load(), int64(2))
+	assert.Equal(t, int64(0), checker.ActiveChecks())
+}
+
+func TestURLChecker_CollectMetrics(t *testing.T) {
+	checker, _ := setupTestService(t, WithMaxActiveChecks(7))
+
+	values := make(map[string]float64)
+	for _, metric := range checker.CollectMetrics() {
+		values[metric.Name] = metric.Value
+	}
+
+	assert.Equal(t, float64(0), values["url_checker_active_checks"])
+	assert.Equal(t, float64(7), values["url_checker_max_active_checks"])
+	assert.Equal(t, float64(0), values["url_checker_checks_total"])
+}
+
+func TestURLChecker_MetricsSnapshot(t *testing.T) {
+	checker, _ := setupTestService(t)
+	ctx := context.Background()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	snapshot, err := checker.MetricsSnapshot()
+	require.NoError(t, err)
+	assert.Zero(t, snapshot.ChecksTotal)
+	assert.Zero(t, snapshot.AvgResponseTimeMs)
+
+	// snapshots taken while checks run never show an average without requests
+	done := make(chan struct{})
+	var readers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				snapshot, err := checker.MetricsSnapshot()
+				assert.NoError(t, err)
+				assert.Equal(t, snapshot.RequestsTotal == 0, snapshot.AvgResponseTimeMs == 0)
+			}
+		}()
+	}
+
+	_, err = checker.CheckLinks(ctx, []string{server.URL + "/a", server.URL + "/b"})
+	require.NoError(t, err)
+	close(done)
+	readers.Wait()
+
+	snapshot, err = checker.MetricsSnapshot()
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), snapshot.ChecksTotal)
+	assert.Equal(t, int64(1), snapshot.BatchesTotal)
+	assert.Equal(t, int64(2), snapshot.RequestsTotal)
+	assert.GreaterOrEqual(t, snapshot.AvgResponseTimeMs, 20.0)
+	assert.Zero(t, snapshot.ActiveChecks)
+	assert.Zero(t, snapshot.QueuedBatches)
+
+	disabled, _ := setupTestService(t, WithMetricsSnapshot(false))
+	_, err = disabled.MetricsSnapshot()
+	assert.ErrorIs(t, err, ErrMetricsSnapshotDisabled)
+}
+
+func TestURLChecker_ConnectionMetrics(t *testing.T) {
+	checker, _ := setupTestService(t, WithConnectionMetrics(true))
+	server := setupMockHTTPServer(t)
+	ctx := context.Background()
+
+	links := []string{server.URL + "/ok", server.URL + "/notfound", server.URL + "/error", server.URL + "/ok?again"}
+	_, err := checker.CheckLinks(ctx, links)
+	require.NoError(t, err)
+
+	collect := func() map[string]float64 {
+		values := make(map[string]float64)
+		for _, metric := range checker.CollectMetrics() {
+			values[metric.Name] = metric.Value
+		}
+		return values
+	}
+
+	values := collect()
+	for _, name := range []string{
+		"url_checker_open_connections",
+		"url_checker_active_connections",
+		"url_checker_idle_connections",
+		"url_checker_connection_waits_total",
+		"url_checker_connection_wait_seconds_total",
+	} {
+		require.Contains(t, values, name)
+		assert.GreaterOrEqual(t, values[name], float64(0), name)
+	}
+	assert.Greater(t, values["url_checker_open_connections"], float64(0))
+	assert.Equal(t, float64(len(links)), values["url_checker_connection_waits_total"])
+	// every check is done, so the connections kept alive go back to the pool
+	assert.Eventually(t, func() bool {
+		values := collect()
+		return values["url_checker_active_connections"] == 0 && values["url_checker_idle_connections"] > 0
+	}, time.Second, 10*time.Millisecond)
+
+	checker, _ = setupTestService(t, WithConnectionMetrics(false))
+	for _, metric := range checker.CollectMetrics() {
+		assert.NotEqual(t, "url_checker_open_connections", metric.Name)
+	}
+}
+
+func TestURLChecker_SelfCheckWorker(t *testing.T) {
+	checker, db := setupTestService(t, WithSelfCheckInterval(10*time.Millisecond))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	lastSelfCheck := func() time.Time {
+		checked, _ := checker.GetHealthStatus(ctx)["last_self_check"].(time.Time)
+		return checked
+	}
+
+	assert.NotContains(t, checker.GetHealthStatus(ctx), "last_self_check")
+
+	go checker.StartSelfCheckWorker(ctx)
+
+	require.Eventually(t, func() bool { return !lastSelfCheck().IsZero() }, 5*time.Second, 5*time.Millisecond)
+	first := lastSelfCheck()
+	require.Eventually(t, func() bool { return lastSelfCheck().After(first) }, 5*time.Second, 5*time.Millisecond)
+	assert.Equal(t, int64(0), checker.GetHealthStatus(ctx)["self_check_failures"])
+
+	// failed pings are counted and leave the last success as it was
+	require.NoError(t, db.Close())
+	require.Eventually(t, func() bool {
+		failures, _ := checker.GetHealthStatus(ctx)["self_check_failures"].(int64)
+		return failures > 0
+	}, 5*time.Second, 5*time.Millisecond)
+
+	// disabled by default
+	checker, _ = setupTestService(t)
+	assert.NotContains(t, checker.GetHealthStatus(ctx), "self_check_failures")
+}
+
+func TestURLChecker_ChecksTotal(t *testing.T) {
+	checker, _ := setupTestService(t)
+	server := setupMockHTTPServer(t)
+	ctx := context.Background()
+
+	assert.Equal(t, int64(0), checker.ChecksTotal())
+
+	_, err := checker.CheckLinks(ctx, []string{server.URL + "/ok", server.URL + "/notfound"})
+	require.NoError(t, err)
+
+	_, err = checker.CheckLinks(ctx, []string{server.URL + "/ok?second", server.URL + "/error", server.URL + "/ok?third"})
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(5), checker.ChecksTotal())
+	assert.Equal(t, int64(5), checker.GetHealthStatus(ctx)["checks_total"])
+}
+
+func TestURLSetChecksum(t *testing.T) {
+	a := urlSetChecksum([]string{"example.com", "https://Test.com/Path"})
+	b := urlSetChecksum([]string{"https://test.com/Path", " http://EXAMPLE.com", "example.com"})
+	assert.Equal(t, a, b)
+
+	c := urlSetChecksum([]string{"https://test.com/path", "example.com"})
+	assert.NotEqual(t, a, c)
+}
+
+func TestURLChecker_CheckLinks_IdempotencyKey(t *testing.T) {
+	checker, _ := setupTestService(t)
+	server := setupMockHTTPServer(t)
+	ctx := context.Background()
+
+	links := []string{server.URL + "/ok", server.URL + "/notfound"}
+
+	first, err := checker.CheckLinksWithOptions(ctx, links, CheckOptions{IdempotencyKey: "key-1"})
+	require.NoError(t, err)
+
+	second, err := checker.CheckLinksWithOptions(ctx, links, CheckOptions{IdempotencyKey: "key-1"})
+	require.NoError(t, err)
+	assert.Equal(t, first.LinksNum, second.LinksNum)
+	assert.Equal(t, first.Links, second.Links)
+
+	third, err := checker.CheckLinksWithOptions(ctx, links, CheckOptions{IdempotencyKey: "key-2"})
+	require.NoError(t, err)
+	assert.NotEqual(t, first.LinksNum, third.LinksNum)
+
+	// a key reused for other links or settings is refused
+	_, err = checker.CheckLinksWithOptions(ctx, links[:1], CheckOptions{IdempotencyKey: "key-1"})
+	assert.ErrorIs(t, err, ErrIdempotencyKeyReused)
+
+	_, err = checker.CheckLinksWithOptions(ctx, links, CheckOptions{IdempotencyKey: "key-1", DisableKeepAlive: true})
+	assert.ErrorIs(t, err, ErrIdempotencyKeyReused)
+}
+
+func TestURLChecker_CheckLinks_ChecksumReuse(t *testing.T) {
+	checker, _ := setupTestService(t)
+	server := setupMockHTTPServer(t)
+	ctx := context.Background()
+
+	first, err := checker.CheckLinks(ctx, []string{server.URL + "/ok", server.URL + "/error"})
+	require.NoError(t, err)
+
+	second, err := checker.CheckLinks(ctx, []string{server.URL + "/error", server.URL + "/ok"})
+	require.NoError(t, err)
+	assert.Equal(t, first.LinksNum, second.LinksNum)
+
+	// the same links submitted with other settings are checked again
+	links := []string{server.URL + "/ok", server.URL + "/error"}
+	for _, opts := range []CheckOptions{
+		{DisableKeepAlive: true},
+		{Timeout: time.Second},
+		{RetryCount: 1, RetryDelay: time.Minute},
+		{ExpiresIn: time.Hour},
+		{Dedup: models.DedupFull},
+		{Source: models.BatchSourceScheduled},
+	} {
+		response, err := checker.CheckLinksWithOptions(ctx, links, opts)
+		require.NoError(t, err)
+		assert.NotEqual(t, first.LinksNum, response.LinksNum, "%+v", opts)
+
+		repeated, err := checker.CheckLinksWithOptions(ctx, links, opts)
+		require.NoError(t, err)
+		assert.Equal(t, response.LinksNum, repeated.LinksNum, "%+v", opts)
+	}
+}
+
+func TestURLChecker_CheckLinks_IdempotencyDisabled(t *testing.T) {
+	// debouncing would share the batch of the back-to-back submissions too
+	checker, _ := setupTestService(t, WithIdempotencyWindow(0), WithSubmitDebounce(0))
+	server := setupMockHTTPServer(t)
+	ctx := context.Background()
+
+	links := []string{server.URL + "/ok"}
+
+	first, err := checker.CheckLinksWithOptions(ctx, links, CheckOptions{IdempotencyKey: "key-1"})
+	require.NoError(t, err)
+
+	second, err := checker.CheckLinksWithOptions(ctx, links, CheckOptions{IdempotencyKey: "key-1"})
+	require.NoError(t, err)
+	assert.NotEqual(t, first.LinksNum, second.LinksNum)
+}
+
+func TestURLChecker_CheckLinks_SubmitDebounce(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	// the idempotency window is off so only the debounce can share the batch
+	checker, db := setupTestService(t, WithIdempotencyWindow(0), WithSubmitDebounce(time.Second), WithClock(clock))
+	ctx := context.Background()
+
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		time.Sleep(100 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	links := []string{server.URL + "/a", server.URL + "/b"}
+
+	var wg sync.WaitGroup
+	responses := make([]models.CheckResponse, 3)
+	for i := range responses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			response, err := checker.CheckLinks(ctx, links)
+			assert.NoError(t, err)
+			responses[i] = response
+		}(i)
+	}
+	wg.Wait()
+
+	for _, response := range responses {
+		assert.Equal(t, responses[0].BatchNum, response.BatchNum)
+		assert.Equal(t, string(models.StatusAvailable), response.Links[server.URL+"/a"])
+	}
+	assert.Equal(t, int64(2), requests.Load())
+
+	count, err := db.CountBatches(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	// after the window a submission gets a batch of its own
+	clock.Advance(2 * time.Second)
+	response, err := checker.CheckLinks(ctx, links)
+	require.NoError(t, err)
+	assert.NotEqual(t, responses[0].BatchNum, response.BatchNum)
+}
+
+func TestURLChecker_CheckLinks_Async(t *testing.T) {
+	checker, db := setupTestService(t)
+	ctx := context.Background()
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() {
+		select {
+		case <-release:
+		default:
+			close(release)
+		}
+	})
+
+	workerCtx, workerCancel := context.WithCancel(ctx)
+	defer workerCancel()
+	go checker.StartBatchWorker(workerCtx)
+
+	links := []string{server.URL + "/ok", server.URL + "/missing"}
+	response, err := checker.CheckLinksWithOptions(ctx, links, CheckOptions{Async: true})
+	require.NoError(t, err)
+	assert.Equal(t, models.BatchStatusProcessing, response.Status)
+	assert.Equal(t, map[string]string{
+		server.URL + "/ok":      string(models.StatusProcessing),
+		server.URL + "/missing": string(models.StatusProcessing),
+	}, response.Links)
+
+	status, err := checker.GetBatchStatus(ctx, response.BatchNum, "")
+	require.NoError(t, err)
+	assert.Equal(t, models.BatchStatusProcessing, status.Status)
+	assert.Len(t, status.Links, 2)
+
+	close(release)
+	require.Eventually(t, func() bool {
+		batch, err := db.GetBatch(ctx, response.BatchNum)
+		return err == nil && batch.Status == models.BatchStatusCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+
+	status, err = checker.GetBatchStatus(ctx, response.BatchNum, "")
+	require.NoError(t, err)
+	results := make(map[string]models.LinkStatus)
+	for _, link := range status.Links {
+		results[link.URL] = link.Status
+	}
+	assert.Equal(t, map[string]models.LinkStatus{
+		server.URL + "/ok":      models.StatusAvailable,
+		server.URL + "/missing": models.StatusNotAvailable,
+	}, results)
+
+	_, err = checker.CheckLinksWithOptions(ctx, links, CheckOptions{Async: true, Ephemeral: true})
+	assert.Error(t, err)
+}
+
+func TestURLChecker_CheckLinks_AsyncPriority(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	checker, db := setupTestService(t)
+	ctx := context.Background()
+
+	// queued before the worker starts, so only priority decides the order
+	large := make([]string, 20)
+	for i := range large {
+		large[i] = fmt.Sprintf("%s/low/%d", server.URL, i)
+	}
+	low, err := checker.CheckLinksWithOptions(ctx, large, CheckOptions{Async: true})
+	require.NoError(t, err)
+	high, err := checker.CheckLinksWithOptions(ctx, []string{server.URL + "/high"}, CheckOptions{Async: true, Priority: 10})
+	require.NoError(t, err)
+
+	// a synchronous check has no queue to jump, so it is refused unchecked
+	_, err = checker.CheckLinksWithOptions(ctx, []string{server.URL + "/sync"}, CheckOptions{Priority: 10})
+	assert.ErrorContains(t, err, "priority requires an async check")
+
+	workerCtx, workerCancel := context.WithCancel(ctx)
+	defer workerCancel()
+	go checker.StartBatchWorker(workerCtx)
+
+	require.Eventually(t, func() bool {
+		batch, err := db.GetBatch(ctx, low.BatchNum)
+		return err == nil && batch.Status == models.BatchStatusCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+
+	batch, err := db.GetBatch(ctx, high.BatchNum)
+	require.NoError(t, err)
+	assert.Equal(t, models.BatchStatusCompleted, batch.Status)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, paths, len(large)+1)
+	assert.Equal(t, "/high", paths[0])
+}
+
+func TestBatchQueue_Order(t *testing.T) {
+	queue := newBatchQueue(3)
+	require.True(t, queue.push(&batchTask{links: []string{"first"}}))
+	require.True(t, queue.push(&batchTask{links: []string{"urgent"}, priority: 5}))
+	require.True(t, queue.push(&batchTask{links: []string{"second"}}))
+	assert.False(t, queue.push(&batchTask{links: []string{"overflow"}}))
+	assert.Equal(t, 3, queue.len())
+
+	var order []string
+	for task := queue.pop(); task != nil; task = queue.pop() {
+		order = append(order, task.links[0])
+	}
+	assert.Equal(t, []string{"urgent", "first", "second"}, order)
+}
+
+func TestURLChecker_CheckLinks_AsyncQueueFull(t *testing.T) {
+	checker, db := setupTestService(t)
+	ctx := context.Background()
+
+	// no worker runs, so the queue stays full
+	for i := 0; i < DefaultBatchQueueSize; i++ {
+		require.True(t, checker.pendingBatches.push(&batchTask{}))
+	}
+
+	_, err := checker.CheckLinksWithOptions(ctx, []string{"http://example.com"}, CheckOptions{Async: true})
+	require.ErrorIs(t, err, ErrBatchQueueFull)
+
+	batch, err := db.GetBatch(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, models.BatchStatusFailed, batch.Status)
+}
+
+func TestURLChecker_CheckLinks_CreateFailure(t *testing.T) {
+	checker, db := setupTestService(t)
+	server := setupMockHTTPServer(t)
+	ctx := context.Background()
+
+	links := make([]string, 10)
+	for i := range links {
+		links[i] = fmt.Sprintf("%s/ok?n=%d", server.URL, i)
+	}
+	badLink := links[4]
+
+	raw, err := sql.Open("sqlite3", "./test_service_"+t.Name()+".db")
+	require.NoError(t, err)
+	defer raw.Close()
+	_, err = raw.Exec(`CREATE TRIGGER fail_bad_link BEFORE INSERT ON links
+		WHEN NEW.url = '` + badLink + `'
+		BEGIN SELECT RAISE(ABORT, 'simulated failure'); END;`)
+	require.NoError(t, err)
+
+	// one link that can't be stored fails the submission and leaves nothing behind
+	for _, async := range []bool{false, true} {
+		_, err = checker.CheckLinksWithOptions(ctx, links, CheckOptions{Async: async})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "simulated failure")
+
+		_, err = db.GetBatch(ctx, 1)
+		assert.ErrorIs(t, err, database.ErrBatchNotFound)
+		stored, err := db.GetLinksByBatchNum(ctx, 1)
+		require.NoError(t, err)
+		assert.Empty(t, stored)
+	}
+}
+
+func TestParseCSVDelimiter(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected rune
+		wantErr  bool
+	}{
+		{value: ",", expected: ','},
+		{value: ";", expected: ';'},
+		{value: "tab", expected: '\t'},
+		{value: "", wantErr: true},
+		{value: ";;", wantErr: true},
+		{value: "\"", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		delimiter, err := ParseCSVDelimiter(tt.value)
+		if tt.wantErr {
+			assert.Error(t, err, tt.value)
+			continue
+		}
+		assert.NoError(t, err, tt.value)
+		assert.Equal(t, tt.expected, delimiter)
+	}
+}
+
+func TestURLChecker_ParseCSVLinks(t *testing.T) {
+	checker, _ := setupTestService(t)
+
+	input := "\ufeffurl,method,label\n" +
+		"http://a.example,GET,first\n" +
+		",GET,missing url\n" +
+		"http://b.example\n" +
+		"http://c.example,GET,label,extra\n" +
+		"\"http://d.example,GET\n"
+
+	upload, err := checker.ParseCSVLinks(strings.NewReader(input))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"http://a.example", "http://b.example"}, upload.Links)
+	assert.Equal(t, []string{"GET"}, upload.Methods)
+	assert.Equal(t, 3, upload.Skipped)
+
+	_, err = checker.ParseCSVLinks(strings.NewReader("label,url\nx,http://a.example\n"))
+	assert.Error(t, err)
+
+	_, err = checker.ParseCSVLinks(strings.NewReader("url,owner\nhttp://a.example,me\n"))
+	assert.Error(t, err)
+
+	_, err = checker.ParseCSVLinks(strings.NewReader(""))
+	assert.Error(t, err)
+
+	// the method column sets how the batch is checked
+	upload, err = checker.ParseCSVLinks(strings.NewReader("url,method\nhttp://a.example,head\nhttp://b.example,\nhttp://c.example,FETCH\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"http://a.example", "http://b.example"}, upload.Links)
+	assert.Equal(t, []string{"HEAD"}, upload.Methods)
+	assert.Equal(t, 1, upload.Skipped)
+
+	_, err = checker.ParseCSVLinks(strings.NewReader("url,method\nhttp://a.example,HEAD\nhttp://b.example,GET\n"))
+	assert.Error(t, err)
+
+	// the delimiter comes from the header, whatever exports are set to
+	semicolon, _ := setupTestService(t, WithCSVOptions(CSVOptions{Delimiter: ';'}))
+	for _, input := range []string{"url;label\nhttp://a.example;x\n", "\"URL\"\tlabel\r\nhttp://a.example\tx\r\n", "url,label\nhttp://a.example,x\n", "url\nhttp://a.example"} {
+		upload, err = semicolon.ParseCSVLinks(strings.NewReader(input))
+		require.NoError(t, err, input)
+		assert.Equal(t, []string{"http://a.example"}, upload.Links, input)
+		assert.Zero(t, upload.Skipped, input)
+	}
+}
+
+func TestNewCSVWriter(t *testing.T) {
+	var buf bytes.Buffer
+	writer, err := newCSVWriter(&buf, DefaultCSVOptions())
+	require.NoError(t, err)
+	require.NoError(t, writer.Write([]string{"url", "status"}))
+	writer.Flush()
+	assert.Equal(t, "url,status\n", buf.String())
+
+	buf.Reset()
+	writer, err = newCSVWriter(&buf, CSVOptions{Delimiter: ';', BOM: true})
+	require.NoError(t, err)
+	require.NoError(t, writer.Write([]string{"url", "status"}))
+	writer.Flush()
+	assert.True(t, bytes.HasPrefix(buf.Bytes(), []byte{0xEF, 0xBB, 0xBF}))
+	assert.Equal(t, "url;status\n", string(buf.Bytes()[3:]))
+}
+
+func TestURLChecker_CloseConnectionHosts(t *testing.T) {
+	var closeRequested atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		closeRequested.Store(r.Close)
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	t.Run("listed host", func(t *testing.T) {
+		checker, _ := setupTestService(t, WithCloseConnectionHosts([]string{serverURL.Hostname()}))
+		assert.Equal(t, models.StatusAvailable, statusOf(checker.checkURLAvailability(context.Background(), server.URL, 0)))
+		assert.True(t, closeRequested.Load())
+	})
+
+	t.Run("other host", func(t *testing.T) {
+		checker, _ := setupTestService(t, WithCloseConnectionHosts([]string{"legacy.example"}))
+		assert.Equal(t, models.StatusAvailable, statusOf(checker.checkURLAvailability(context.Background(), server.URL, 0)))
+		assert.False(t, closeRequested.Load())
+	})
+}
+
+func TestURLChecker_BasicAuth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok || username != "monitor" || password != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	t.Run("configured host", func(t *testing.T) {
+		checker, _ := setupTestService(t, WithBasicAuth(map[string]BasicAuth{
+			serverURL.Hostname(): {Username: "monitor", Password: "s3cret"},
+		}))
+		assert.Equal(t, models.StatusAvailable, statusOf(checker.checkURLAvailability(context.Background(), server.URL+"/dashboard", 0)))
+	})
+
+	t.Run("without credentials", func(t *testing.T) {
+		checker, _ := setupTestService(t, WithBasicAuth(map[string]BasicAuth{
+			"other.example": {Username: "monitor", Password: "s3cret"},
+		}))
+		assert.Equal(t, models.StatusNotAvailable, statusOf(checker.checkURLAvailability(context.Background(), server.URL+"/dashboard", 0)))
+	})
+}
+
+func TestURLChecker_RedirectBodyLimit(t *testing.T) {
+	var finalRequested atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var hop int
+		if _, err := fmt.Sscanf(r.URL.Path, "/hop/%d", &hop); err == nil {
+			// each hop sends a body the client reads before following it
+			w.Header().Set("Location", fmt.Sprintf("/hop/%d", hop+1))
+			if hop == 4 {
+				w.Header().Set("Location", "/final")
+			}
+			w.WriteHeader(http.StatusFound)
+			w.Write(bytes.Repeat([]byte("x"), 1000))
+			return
+		}
+		finalRequested.Store(true)
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	t.Run("exceeded across hops", func(t *testing.T) {
+		finalRequested.Store(false)
+		checker, _ := setupTestService(t, WithRedirectBodyLimit(2500))
+
+		resp, err := checker.fetch(context.Background(), http.MethodGet, server.URL+"/hop/1")
+		if resp != nil {
+			resp.Body.Close()
+		}
+		require.ErrorIs(t, err, ErrBodyLimitExceeded)
+		assert.False(t, finalRequested.Load())
+
+		assert.Equal(t, models.StatusNotAvailable, statusOf(checker.checkURLAvailability(context.Background(), server.URL+"/hop/1", 0)))
+	})
+
+	t.Run("within limit", func(t *testing.T) {
+		finalRequested.Store(false)
+		checker, _ := setupTestService(t, WithRedirectBodyLimit(10000))
+		assert.Equal(t, models.StatusAvailable, statusOf(checker.checkURLAvailability(context.Background(), server.URL+"/hop/1", 0)))
+		assert.True(t, finalRequested.Load())
+	})
+}
+
+func TestParseBasicAuth(t *testing.T) {
+	creds, err := ParseBasicAuth("intranet.local=monitor:s3cret, grafana.local=admin:pa:ss")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]BasicAuth{
+		"intranet.local": {Username: "monitor", Password: "s3cret"},
+		"grafana.local":  {Username: "admin", Password: "pa:ss"},
+	}, creds)
+
+	creds, err = ParseBasicAuth("")
+	require.NoError(t, err)
+	assert.Empty(t, creds)
+
+	_, err = ParseBasicAuth("intranet.local")
+	assert.Error(t, err)
+
+	_, err = ParseBasicAuth("intranet.local=monitor")
+	assert.Error(t, err)
+}
+
+func TestURLChecker_CheckHeader(t *testing.T) {
+	// echoes the header back and only accepts marked checks
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		marker := r.Header.Get("X-Checked-By")
+		w.Header().Set("X-Checked-By", marker)
+		if marker != "url-checker" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	t.Run("configured", func(t *testing.T) {
+		checker, _ := setupTestService(t, WithCheckHeader(CheckHeader{Name: "X-Checked-By", Value: "url-checker"}))
+		assert.Equal(t, models.StatusAvailable, statusOf(checker.checkURLAvailability(context.Background(), server.URL+"/ping", 0)))
+	})
+
+	t.Run("default off", func(t *testing.T) {
+		checker, _ := setupTestService(t)
+		assert.Equal(t, models.StatusNotAvailable, statusOf(checker.checkURLAvailability(context.Background(), server.URL+"/ping", 0)))
+	})
+}
+
+func TestParseCheckHeader(t *testing.T) {
+	header, err := ParseCheckHeader("X-Checked-By: url-checker")
+	require.NoError(t, err)
+	assert.Equal(t, CheckHeader{Name: "X-Checked-By", Value: "url-checker"}, header)
+
+	header, err = ParseCheckHeader("")
+	require.NoError(t, err)
+	assert.Empty(t, header)
+
+	_, err = ParseCheckHeader("X-Checked-By")
+	assert.Error(t, err)
+
+	_, err = ParseCheckHeader("X Checked: yes")
+	assert.Error(t, err)
+}
+
+func TestURLChecker_RetryPolicy(t *testing.T) {
+	checker, db := setupTestService(t, WithRetryPollInterval(10*time.Millisecond))
+	ctx := context.Background()
+
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/flaky" && requests.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	flaky := server.URL + "/flaky"
+	response, err := checker.CheckLinksWithOptions(ctx, []string{flaky, server.URL + "/ok"}, CheckOptions{
+		RetryCount: 2,
+		RetryDelay: 10 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, string(models.StatusNotAvailable), response.Links[flaky])
+
+	workerCtx, workerCancel := context.WithCancel(context.Background())
+	defer workerCancel()
+	go checker.StartRetryWorker(workerCtx)
+
+	require.Eventually(t, func() bool {
+		links, err := db.GetLinksByBatchNum(ctx, response.LinksNum)
+		if err != nil {
+			return false
+		}
+		for _, link := range links {
+			if link.URL == flaky {
+				return link.Status == models.StatusAvailable && link.CheckSource == models.CheckSourceRetry
+			}
+		}
+		return false
+	}, 2*time.Second, 10*time.Millisecond)
+
+	require.Eventually(t, func() bool {
+		batch, err := db.GetBatch(ctx, response.LinksNum)
+		return err == nil && batch.RetriesDone == batch.RetryCount && batch.NextRetryAt == nil
+	}, 2*time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, int64(2), requests.Load())
+}
+
+func TestURLChecker_CheckLinks_LargeBatchPersistsAllResults(t *testing.T) {
+	checker, db := setupTestService(t, WithMaxActiveChecks(50), WithMaxConcurrentDBWrites(1))
+	hook := logtest.NewLocal(checker.logger)
+	server := setupMockHTTPServer(t)
+	ctx := context.Background()
+
+	links := make([]string, 300)
+	for i := range links {
+		links[i] = fmt.Sprintf("%s/ok?n=%d", server.URL, i)
+	}
+
+	response, err := checker.CheckLinks(ctx, links)
+	require.NoError(t, err)
+	assert.Len(t, response.Links, len(links))
+
+	stored, err := db.GetLinksByBatchNum(ctx, response.LinksNum)
+	require.NoError(t, err)
+	require.Len(t, stored, len(links))
+	for _, link := range stored {
+		assert.Equal(t, models.StatusAvailable, link.Status, link.URL)
+		assert.NotNil(t, link.Time, link.URL)
+	}
+
+	for _, entry := range hook.AllEntries() {
+		assert.NotEqual(t, logrus.ErrorLevel, entry.Level, entry.Message)
+	}
+}
+
+func TestURLChecker_CheckLinks_Ephemeral(t *testing.T) {
+	checker, db := setupTestService(t)
+	server := setupMockHTTPServer(t)
+	ctx := context.Background()
+
+	links := []string{server.URL + "/ok", server.URL + "/notfound"}
+	response, err := checker.CheckLinksWithOptions(ctx, links, CheckOptions{Ephemeral: true})
+	require.NoError(t, err)
+
+	assert.Equal(t, 0, response.LinksNum)
+	assert.Equal(t, map[string]string{
+		server.URL + "/ok":       string(models.StatusAvailable),
+		server.URL + "/notfound": string(models.StatusNotAvailable),
+	}, response.Links)
+
+	count, err := db.CountBatches(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, count)
+
+	maxID, err := db.GetMaxBatchNum(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, maxID)
+
+	_, err = checker.CheckLinksWithOptions(ctx, links, CheckOptions{Ephemeral: true, RetryCount: 1})
+	assert.Error(t, err)
+}
+
+func TestURLChecker_StoredBatchTimeout(t *testing.T) {
+	checker, db := setupTestService(t)
+	ctx := context.Background()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(2 * time.Second):
+		case <-r.Context().Done():
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	next := time.Now()
+	err := db.InsertBatch(ctx, &models.Batch{
+		LinksNum:    1,
+		Status:      models.BatchStatusCompleted,
+		CreatedAt:   time.Now(),
+		RetryCount:  1,
+		NextRetryAt: &next,
+		TimeoutMs:   50,
+	})
+	require.NoError(t, err)
+
+	_, err = db.CreateLink(ctx, server.URL+"/slow", models.StatusNotAvailable, 1, &next)
+	require.NoError(t, err)
+
+	batch, err := db.GetBatch(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, int64(50), batch.TimeoutMs)
+
+	start := time.Now()
+	checker.retryBatch(ctx, batch)
+	assert.Less(t, time.Since(start), time.Second)
+
+	links, err := db.GetLinksByBatchNum(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	assert.Equal(t, models.StatusNotAvailable, links[0].Status)
+	assert.Equal(t, models.CheckSourceRetry, links[0].CheckSource)
+}
+
+func TestURLChecker_CheckTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(300 * time.Millisecond):
+		case <-r.Context().Done():
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	checker, _ := setupTestService(t, WithCheckTimeout(50*time.Millisecond))
+	ctx := context.Background()
+
+	// the service default applies to batches without a timeout
+	response, err := checker.CheckLinks(ctx, []string{server.URL + "/default"})
+	require.NoError(t, err)
+	assert.Equal(t, string(models.StatusNotAvailable), response.Links[server.URL+"/default"])
+
+	// a batch may allow its checks longer than the default
+	response, err = checker.CheckLinksWithOptions(ctx, []string{server.URL + "/slow"}, CheckOptions{Timeout: 2 * time.Second})
+	require.NoError(t, err)
+	assert.Equal(t, string(models.StatusAvailable), response.Links[server.URL+"/slow"])
+}
+
+func TestURLChecker_TransientRetries(t *testing.T) {
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		count := requests[r.URL.Path]
+		mu.Unlock()
+
+		switch {
+		case r.URL.Path == "/flaky" && count <= 2:
+			w.WriteHeader(http.StatusBadGateway)
+		case strings.HasPrefix(r.URL.Path, "/down"):
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case r.URL.Path == "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	requestCount := func(path string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests[path]
+	}
+
+	checker, _ := setupTestService(t, WithTransientRetries(3, 10*time.Millisecond))
+	ctx := context.Background()
+
+	t.Run("succeeds after two failures", func(t *testing.T) {
+		status, code := checker.checkURLAvailability(ctx, server.URL+"/flaky", 0)
+		assert.Equal(t, models.StatusAvailable, status)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, 3, requestCount("/flaky"))
+	})
+
+	t.Run("gives up after the last retry", func(t *testing.T) {
+		status, code := checker.checkURLAvailability(ctx, server.URL+"/down", 0)
+		assert.Equal(t, models.StatusNotAvailable, status)
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, 4, requestCount("/down"))
+	})
+
+	t.Run("client errors are not retried", func(t *testing.T) {
+		status, _ := checker.checkURLAvailability(ctx, server.URL+"/missing", 0)
+		assert.Equal(t, models.StatusNotAvailable, status)
+		assert.Equal(t, 1, requestCount("/missing"))
+	})
+
+	t.Run("backoff waits on the service clock", func(t *testing.T) {
+		clock := NewFakeClock(time.Now())
+		timed, _ := setupTestService(t, WithTransientRetries(3, time.Hour), WithClock(clock))
+
+		done := make(chan models.LinkStatus, 1)
+		go func() {
+			status, _ := timed.checkURLAvailability(ctx, server.URL+"/down/clocked", 0)
+			done <- status
+		}()
+
+		for retry, delay := range []time.Duration{time.Hour, 2 * time.Hour, 4 * time.Hour} {
+			require.Eventually(t, func() bool { return clock.Waiters() == 1 }, 5*time.Second, time.Millisecond)
+			assert.Equal(t, retry+1, requestCount("/down/clocked"))
+			// just short of the delay the retry keeps waiting
+			clock.Advance(delay - time.Second)
+			assert.Equal(t, 1, clock.Waiters())
+			clock.Advance(time.Second)
+		}
+		assert.Equal(t, models.StatusNotAvailable, <-done)
+		assert.Equal(t, 4, requestCount("/down/clocked"))
+	})
+
+	t.Run("cancellation stops retrying", func(t *testing.T) {
+		slow, _ := setupTestService(t, WithTransientRetries(3, time.Minute))
+
+		cancelCtx, cancel := context.WithCancel(ctx)
+		time.AfterFunc(50*time.Millisecond, cancel)
+
+		start := time.Now()
+		status, _ := slow.checkURLAvailability(cancelCtx, "http://127.0.0.1:1/refused", 0)
+		assert.Equal(t, models.StatusNotAvailable, status)
+		assert.Less(t, time.Since(start), 5*time.Second)
+	})
+}
+
+func TestURLChecker_CheckLinks_InvalidTimeout(t *testing.T) {
+	checker, _ := setupTestService(t)
+
+	_, err := checker.CheckLinksWithOptions(context.Background(), []string{"http://example.com"}, CheckOptions{Timeout: -time.Second})
+	assert.Error(t, err)
+}
+
+func TestURLChecker_CheckLinks_InvalidRetryPolicy(t *testing.T) {
+	checker, _ := setupTestService(t)
+	ctx := context.Background()
+
+	_, err := checker.CheckLinksWithOptions(ctx, []string{"http://example.com"}, CheckOptions{RetryCount: MaxRetryCount + 1})
+	assert.Error(t, err)
+
+	_, err = checker.CheckLinksWithOptions(ctx, []string{"http://example.com"}, CheckOptions{RetryCount: 1, RetryDelay: -time.Second})
+	assert.Error(t, err)
+}
+
+func TestURLChecker_GeneratePDFReport_ConcurrencyLimit(t *testing.T) {
+	checker, db := setupTestService(t, WithMaxConcurrentPDFs(1))
+	ctx := context.Background()
+
+	err := db.CreateBatch(ctx, 1, models.BatchStatusCompleted, time.Now())
+	require.NoError(t, err)
+
+	now := time.Now()
+	for i := 0; i < 50; i++ {
+		_, err = db.CreateLink(ctx, fmt.Sprintf("http://example.com/%d", i), models.StatusAvailable, 1, &now)
+		require.NoError(t, err)
+	}
+
+	workerCtx, workerCancel := context.WithCancel(context.Background())
+	defer workerCancel()
+	go checker.StartWorker(workerCtx)
+
+	// hold the only slot so every generation has to wait for it
+	checker.pdfSlots <- struct{}{}
+
+	var peak atomic.Int64
+	var completed atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(async bool) {
+			defer wg.Done()
+			generate := checker.GeneratePDFReport
+			if async {
+				generate = checker.GeneratePDFReportAsync
+			}
+			pdfData, err := generate(ctx, []int{1})
+			assert.NoError(t, err)
+			assert.True(t, strings.HasPrefix(string(pdfData), "%PDF"))
+			completed.Add(1)
+		}(i%2 == 0)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int64(0), completed.Load())
+	assert.Equal(t, int64(0), checker.ActivePDFGenerations())
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	<-checker.pdfSlots
+
+	for {
+		if active := checker.ActivePDFGenerations(); active > peak.Load() {
+			peak.Store(active)
+		}
+		select {
+		case <-done:
+			assert.Equal(t, int64(8), completed.Load())
+			assert.LessOrEqual(t, peak.Load(), int64(1))
+			assert.Equal(t, int64(0), checker.ActivePDFGenerations())
+			return
+		default:
+			runtime.Gosched()
+		}
+	}
+}
+
+func TestURLChecker_ReadConcurrencyLimit(t *testing.T) {
+	checker, db := setupTestService(t, WithMaxConcurrentDBReads(1), WithMaxConcurrentPDFs(8))
+	ctx := context.Background()
+
+	require.NoError(t, db.CreateBatch(ctx, 1, models.BatchStatusCompleted, time.Now()))
+	now := time.Now()
+	for i := 0; i < 20; i++ {
+		_, err := db.CreateLink(ctx, fmt.Sprintf("http://example.com/%d", i), models.StatusAvailable, 1, &now)
+		require.NoError(t, err)
+	}
+
+	// hold the only read slot so every report and status read has to wait
+	checker.readSlots <- struct{}{}
+
+	var completed atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(report bool) {
+			defer wg.Done()
+			if report {
+				_, err := checker.GeneratePDFReport(ctx, []int{1})
+				assert.NoError(t, err)
+			} else {
+				_, err := checker.GetBatchStatus(ctx, 1, "")
+				assert.NoError(t, err)
+			}
+			completed.Add(1)
+		}(i%2 == 0)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Zero(t, completed.Load())
+
+	start := time.Now()
+	health := checker.GetHealthStatus(ctx)
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+	assert.Equal(t, 1, health["batches"])
+
+	// a waiting read gives up with its context
+	cancelled, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	_, err := checker.GetBatchStatus(cancelled, 1, "")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	_, err = checker.MissingBatches(cancelled, []int{1, 2})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	_, err = checker.RecheckBatch(cancelled, 1)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	<-checker.readSlots
+	wg.Wait()
+	assert.Equal(t, int64(16), completed.Load())
+	assert.Zero(t, len(checker.readSlots))
+}
+
+func TestURLChecker_GetHosts(t *testing.T) {
+	checker, db := setupTestService(t)
+	ctx := context.Background()
+
+	err := db.CreateBatch(ctx, 1, models.BatchStatusCompleted, time.Now())
+	require.NoError(t, err)
+	err = db.CreateBatch(ctx, 2, models.BatchStatusCompleted, time.Now())
+	require.NoError(t, err)
+
+	earlier := time.Now().Add(-time.Hour)
+	later := time.Now()
+
+	seed := []struct {
+		url    string
+		status models.LinkStatus
+		batch  int
+		time   *time.Time
+	}{
+		{"http://alpha.com/a", models.StatusAvailable, 1, &earlier},
+		{"https://ALPHA.com/b", models.StatusNotAvailable, 2, &later},
+		{"beta.org", models.StatusAvailable, 1, &earlier},
+		{"http://gamma.net:8080/x", models.StatusNotAvailable, 1, &earlier},
+		{"http://gamma.net/y", models.StatusAvailable, 2, &later},
+		{"http://gamma.net/z", models.StatusProcessing, 2, nil},
+	}
+	for _, link := range seed {
+		_, err := db.CreateLink(ctx, link.url, link.status, link.batch, link.time)
+		require.NoError(t, err)
+	}
+
+	response, err := checker.GetHosts(ctx, 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 3, response.Total)
+	require.Len(t, response.Hosts, 3)
+
+	assert.Equal(t, "alpha.com", response.Hosts[0].Host)
+	assert.Equal(t, 2, response.Hosts[0].CheckCount)
+	assert.Equal(t, models.StatusNotAvailable, response.Hosts[0].LatestStatus)
+
+	assert.Equal(t, "beta.org", response.Hosts[1].Host)
+	assert.Equal(t, 1, response.Hosts[1].CheckCount)
+	assert.Equal(t, models.StatusAvailable, response.Hosts[1].LatestStatus)
+
+	assert.Equal(t, "gamma.net", response.Hosts[2].Host)
+	assert.Equal(t, 3, response.Hosts[2].CheckCount)
+	assert.Equal(t, models.StatusAvailable, response.Hosts[2].LatestStatus)
+
+	page, err := checker.GetHosts(ctx, 2, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 3, page.Total)
+	require.Len(t, page.Hosts, 1)
+	assert.Equal(t, "gamma.net", page.Hosts[0].Host)
+
+	page, err = checker.GetHosts(ctx, 2, 10)
+	require.NoError(t, err)
+	assert.Empty(t, page.Hosts)
+}
+
+func TestURLChecker_MinRecheckInterval(t *testing.T) {
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	t.Run("within interval", func(t *testing.T) {
+		requests.Store(0)
+		checker, _ := setupTestService(t, WithMinRecheckInterval(time.Minute))
+
+		assert.Equal(t, models.StatusAvailable, statusOf(checker.checkURLAvailability(context.Background(), server.URL+"/page", 0)))
+		assert.Equal(t, models.StatusAvailable, statusOf(checker.checkURLAvailability(context.Background(), server.URL+"/page", 0)))
+		assert.Equal(t, int64(1), requests.Load())
+
+		assert.Equal(t, models.StatusAvailable, statusOf(checker.checkURLAvailability(context.Background(), server.URL+"/other", 0)))
+		assert.Equal(t, int64(2), requests.Load())
+	})
+
+	t.Run("other request settings", func(t *testing.T) {
+		requests.Store(0)
+		checker, _ := setupTestService(t, WithMinRecheckInterval(time.Minute))
+		ctx := context.Background()
+
+		checker.checkURLAvailability(ctx, server.URL+"/page", 0)
+		// each differs from the first check in what it sends or waits for
+		checker.checkURLAvailability(withUserAgent(ctx, "profile-agent/1.0"), server.URL+"/page", 0)
+		checker.checkURLAvailability(withoutKeepAlive(ctx), server.URL+"/page", 0)
+		checker.checkURLAvailability(withServerName(ctx, "www.example.com"), server.URL+"/page", 0)
+		checker.checkURLAvailability(ctx, server.URL+"/page", time.Second)
+		assert.Equal(t, int64(5), requests.Load())
+
+		checker.checkURLAvailability(withoutKeepAlive(ctx), server.URL+"/page", 0)
+		assert.Equal(t, int64(5), requests.Load())
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		requests.Store(0)
+		checker, _ := setupTestService(t, WithMinRecheckInterval(time.Minute))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		assert.Equal(t, models.StatusNotAvailable, statusOf(checker.checkURLAvailability(ctx, server.URL+"/page", 0)))
+
+		assert.Equal(t, models.StatusAvailable, statusOf(checker.checkURLAvailability(context.Background(), server.URL+"/page", 0)))
+		assert.Equal(t, int64(1), requests.Load())
+	})
+
+	t.Run("after interval", func(t *testing.T) {
+		requests.Store(0)
+		checker, _ := setupTestService(t, WithMinRecheckInterval(20*time.Millisecond))
+
+		checker.checkURLAvailability(context.Background(), server.URL+"/page", 0)
+		time.Sleep(30 * time.Millisecond)
+		checker.checkURLAvailability(context.Background(), server.URL+"/page", 0)
+		assert.Equal(t, int64(2), requests.Load())
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		requests.Store(0)
+		checker, _ := setupTestService(t)
+
+		checker.checkURLAvailability(context.Background(), server.URL+"/page", 0)
+		checker.checkURLAvailability(context.Background(), server.URL+"/page", 0)
+		assert.Equal(t, int64(2), requests.Load())
+	})
+}
+
+func TestURLChecker_SharedChecks(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests = map[string]int{}
+		release  chan struct{}
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		released := release
+		mu.Unlock()
+		if r.URL.Path == "/shared" {
+			select {
+			case <-released:
+			case <-r.Context().Done():
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	requested := func(path string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests[path]
+	}
+
+	// checks two batches submitted together that share a link, releasing
+	// the shared link once both batches are being checked
+	checkConcurrently := func(t *testing.T, checker *URLChecker) []models.CheckResponse {
+		released := make(chan struct{})
+		mu.Lock()
+		clear(requests)
+		release = released
+		mu.Unlock()
+
+		responses := make([]models.CheckResponse, 2)
+		var wg sync.WaitGroup
+		for i, own := range []string{"/a", "/b"} {
+			wg.Add(1)
+			go func(i int, own string) {
+				defer wg.Done()
+				response, err := checker.CheckLinks(context.Background(), []string{server.URL + own, server.URL + "/shared"})
+				assert.NoError(t, err)
+				responses[i] = response
+			}(i, own)
+		}
+
+		require.Eventually(t, func() bool {
+			return requested("/a") == 1 && requested("/b") == 1
+		}, 5*time.Second, 5*time.Millisecond)
+		time.Sleep(50 * time.Millisecond)
+		close(released)
+		wg.Wait()
+		return responses
+	}
+
+	t.Run("shared", func(t *testing.T) {
+		checker, _ := setupTestService(t, WithSharedChecks(true))
+
+		responses := checkConcurrently(t, checker)
+		assert.Equal(t, 1, requested("/shared"))
+		for _, response := range responses {
+			assert.Equal(t, string(models.StatusAvailable), response.Links[server.URL+"/shared"])
+		}
+		assert.NotEqual(t, responses[0].BatchNum, responses[1].BatchNum)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		checker, _ := setupTestService(t)
+
+		checkConcurrently(t, checker)
+		assert.Equal(t, 2, requested("/shared"))
+	})
+
+	t.Run("cancelled waiter", func(t *testing.T) {
+		checker, _ := setupTestService(t, WithSharedChecks(true), WithMinRecheckInterval(time.Minute))
+		link := server.URL + "/shared"
+
+		released := make(chan struct{})
+		mu.Lock()
+		clear(requests)
+		release = released
+		mu.Unlock()
+
+		leader := make(chan models.LinkStatus, 1)
+		go func() {
+			status, _ := checker.checkURLAvailability(context.Background(), link, 0)
+			leader <- status
+		}()
+		require.Eventually(t, func() bool { return requested("/shared") == 1 }, 5*time.Second, 5*time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		status, _ := checker.checkURLAvailability(ctx, link, 0)
+		assert.Equal(t, models.StatusNotAvailable, status)
+
+		// the waiter's failure isn't remembered for other batches
+		_, ok := checker.recheckGuard.recent(checker.checkKey(context.Background(), link, 0), checker.clock.Now())
+		assert.False(t, ok)
+
+		close(released)
+		assert.Equal(t, models.StatusAvailable, <-leader)
+		result, ok := checker.recheckGuard.recent(checker.checkKey(context.Background(), link, 0), checker.clock.Now())
+		require.True(t, ok)
+		assert.Equal(t, models.StatusAvailable, result.status)
+	})
+}
+
+func TestURLChecker_GetReadiness(t *testing.T) {
+	var healthy atomic.Bool
+	var probes atomic.Int64
+	dependency := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probes.Add(1)
+		if healthy.Load() {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(dependency.Close)
+
+	t.Run("no dependencies", func(t *testing.T) {
+		checker, _ := setupTestService(t)
+		readiness := checker.GetReadiness(context.Background())
+		assert.True(t, readiness.Ready)
+		require.Len(t, readiness.Checks, 1)
+		assert.Equal(t, "database", readiness.Checks[0].Name)
+
+		checker.SetShutdown(true)
+		assert.False(t, checker.GetReadiness(context.Background()).Ready)
+	})
+
+	t.Run("dependency down", func(t *testing.T) {
+		healthy.Store(false)
+		checker, _ := setupTestService(t, WithDependencies([]string{dependency.URL}, time.Second, time.Minute))
+
+		readiness := checker.GetReadiness(context.Background())
+		assert.False(t, readiness.Ready)
+		require.Len(t, readiness.Checks, 2)
+		assert.Equal(t, dependency.URL, readiness.Checks[1].Name)
+		assert.False(t, readiness.Checks[1].Healthy)
+		assert.Contains(t, readiness.Checks[1].Error, "503")
+	})
+
+	t.Run("cached results", func(t *testing.T) {
+		healthy.Store(true)
+		probes.Store(0)
+		checker, _ := setupTestService(t, WithDependencies([]string{dependency.URL}, time.Second, time.Minute))
+
+		assert.True(t, checker.GetReadiness(context.Background()).Ready)
+		assert.True(t, checker.GetReadiness(context.Background()).Ready)
+		assert.Equal(t, int64(1), probes.Load())
+	})
+
+	t.Run("unreachable dependency", func(t *testing.T) {
+		checker, _ := setupTestService(t, WithDependencies([]string{"http://127.0.0.1:1"}, 200*time.Millisecond, time.Minute))
+
+		readiness := checker.GetReadiness(context.Background())
+		assert.False(t, readiness.Ready)
+		assert.NotEmpty(t, readiness.Checks[1].Error)
+	})
+
+	t.Run("cancelled probes are not cached", func(t *testing.T) {
+		healthy.Store(true)
+		probes.Store(0)
+		checker, _ := setupTestService(t, WithDependencies([]string{dependency.URL}, time.Second, time.Minute))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		assert.False(t, checker.GetReadiness(ctx).Ready)
+
+		assert.True(t, checker.GetReadiness(context.Background()).Ready)
+		assert.Equal(t, int64(1), probes.Load())
+	})
+
+	t.Run("check transport layers don't apply", func(t *testing.T) {
+		var authorized atomic.Bool
+		guarded := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "" {
+				authorized.Store(true)
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		t.Cleanup(guarded.Close)
+
+		checker, _ := setupTestService(t,
+			WithDependencies([]string{guarded.URL}, time.Second, time.Minute),
+			WithBasicAuth(map[string]BasicAuth{"127.0.0.1": {Username: "checker", Password: "secret"}}),
+			WithConnectionMetrics(true),
+		)
+
+		assert.True(t, checker.GetReadiness(context.Background()).Ready)
+		assert.False(t, authorized.Load())
+		assert.Zero(t, checker.connStats.open.Load())
+	})
+}
+
+func TestURLChecker_GetBatchStatus_Stale(t *testing.T) {
+	checker, db := setupTestService(t, WithResultTTL(time.Hour))
+	ctx := context.Background()
+
+	old := time.Now().Add(-2 * time.Hour)
+	recent := time.Now().Add(-time.Minute)
+
+	require.NoError(t, db.CreateBatch(ctx, 1, models.BatchStatusCompleted, old))
+	_, err := db.CreateLink(ctx, "http://example.com/old", models.StatusAvailable, 1, &old)
+	require.NoError(t, err)
+	_, err = db.CreateLink(ctx, "http://example.com/recent", models.StatusAvailable, 1, &recent)
+	require.NoError(t, err)
+
+	require.NoError(t, db.CreateBatch(ctx, 2, models.BatchStatusCompleted, recent))
+	_, err = db.CreateLink(ctx, "http://example.com/recent", models.StatusAvailable, 2, &recent)
+	require.NoError(t, err)
+	_, err = db.CreateLink(ctx, "http://example.com/pending", models.StatusProcessing, 2, nil)
+	require.NoError(t, err)
+
+	status, err := checker.GetBatchStatus(ctx, 1, "")
+	require.NoError(t, err)
+	assert.Equal(t, 1, status.LinksNum)
+	assert.Len(t, status.Links, 2)
+	assert.True(t, status.Stale)
+
+	status, err = checker.GetBatchStatus(ctx, 2, "")
+	require.NoError(t, err)
+	assert.False(t, status.Stale)
+
+	_, err = checker.GetBatchStatus(ctx, 3, "")
+	assert.ErrorIs(t, err, ErrBatchNotFound)
+}
+
+func TestURLChecker_GetBatchStatus_Schemes(t *testing.T) {
+	checker, _ := setupTestService(t)
+	server := setupMockHTTPServer(t)
+	ctx := context.Background()
+
+	links := []string{
+		server.URL + "/ok",
+		strings.TrimPrefix(server.URL, "http://") + "/ok",
+		"https://127.0.0.1:1/external",
+		"HTTPS://127.0.0.1:1/other",
+		"ftp://files.example.com/archive",
+	}
+	response, err := checker.CheckLinks(ctx, links)
+	require.NoError(t, err)
+
+	status, err := checker.GetBatchStatus(ctx, response.BatchNum, "")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"http": 2, "https": 2, "ftp": 1}, status.Schemes)
+}
+
+func TestURLChecker_GetBatchStatus_StatusCodes(t *testing.T) {
+	checker, _ := setupTestService(t)
+	server := setupMockHTTPServer(t)
+	ctx := context.Background()
+
+	links := []string{server.URL + "/ok", server.URL + "/notfound", server.URL + "/error", "http://127.0.0.1:1/refused"}
+	response, err := checker.CheckLinks(ctx, links)
+	require.NoError(t, err)
+
+	status, err := checker.GetBatchStatus(ctx, response.BatchNum, "")
+	require.NoError(t, err)
+
+	codes := make(map[string]int, len(status.Links))
+	for _, link := range status.Links {
+		codes[link.URL] = link.StatusCode
+	}
+	assert.Equal(t, map[string]int{
+		server.URL + "/ok":           http.StatusOK,
+		server.URL + "/notfound":     http.StatusNotFound,
+		server.URL + "/error":        http.StatusInternalServerError,
+		"http://127.0.0.1:1/refused": 0,
+	}, codes)
+}
+
+func TestURLChecker_GetBatchStatus_StatusText(t *testing.T) {
+	checker, _ := setupTestService(t)
+	ctx := context.Background()
+
+	// net/http servers always send the standard reason phrase, so this one
+	// writes its status lines by hand
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				req, err := http.ReadRequest(bufio.NewReader(conn))
+				if err != nil {
+					return
+				}
+				statusLine := "200 OK"
+				if req.URL.Path == "/fishing" {
+					statusLine = "404 Gone Fishing"
+				}
+				fmt.Fprintf(conn, "HTTP/1.1 %s\r\nContent-Length: 0\r\nConnection: close\r\n\r\n", statusLine)
+			}()
+		}
+	}()
+	serverURL := "http://" + listener.Addr().String()
+
+	links := []string{serverURL + "/ok", serverURL + "/fishing", "http://127.0.0.1:1/refused"}
+	response, err := checker.CheckLinks(ctx, links)
+	require.NoError(t, err)
+
+	status, err := checker.GetBatchStatus(ctx, response.BatchNum, "")
+	require.NoError(t, err)
+
+	texts := make(map[string]string, len(status.Links))
+	for _, link := range status.Links {
+		texts[link.URL] = link.StatusText
+	}
+	assert.Equal(t, map[string]string{
+		serverURL + "/ok":            "200 OK",
+		serverURL + "/fishing":       "404 Gone Fishing",
+		"http://127.0.0.1:1/refused": "",
+	}, texts)
+}
+
+func TestURLChecker_GetBatchStatus_ResponseTime(t *testing.T) {
+	checker, _ := setupTestService(t)
+	ctx := context.Background()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delay := 50 * time.Millisecond
+		if r.URL.Path == "/hang" {
+			delay = 2 * time.Second
+		}
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	links := []string{server.URL + "/slow", server.URL + "/hang"}
+	response, err := checker.CheckLinksWithOptions(ctx, links, CheckOptions{Timeout: 200 * time.Millisecond})
+	require.NoError(t, err)
+
+	status, err := checker.GetBatchStatus(ctx, response.BatchNum, "")
+	require.NoError(t, err)
+	require.Len(t, status.Links, 2)
+
+	byURL := make(map[string]*models.Link, len(status.Links))
+	for _, link := range status.Links {
+		byURL[link.URL] = link
+	}
+
+	slow := byURL[server.URL+"/slow"]
+	assert.Equal(t, models.StatusAvailable, slow.Status)
+	assert.GreaterOrEqual(t, slow.ResponseTimeMs, int64(50))
+	assert.Less(t, slow.ResponseTimeMs, int64(200))
+
+	// a timed out check records the time until it gave up
+	hang := byURL[server.URL+"/hang"]
+	assert.Equal(t, models.StatusNotAvailable, hang.Status)
+	assert.Zero(t, hang.StatusCode)
+	assert.GreaterOrEqual(t, hang.ResponseTimeMs, int64(200))
+}
+
+func TestURLChecker_GetBatchStatus_TTLDisabled(t *testing.T) {
+	checker, db := setupTestService(t)
+	ctx := context.Background()
+
+	old := time.Now().Add(-24 * time.Hour)
+	require.NoError(t, db.CreateBatch(ctx, 1, models.BatchStatusCompleted, old))
+	_, err := db.CreateLink(ctx, "http://example.com", models.StatusAvailable, 1, &old)
+	require.NoError(t, err)
+
+	status, err := checker.GetBatchStatus(ctx, 1, "")
+	require.NoError(t, err)
+	assert.False(t, status.Stale)
+}
+
+func TestURLChecker_GetStatsTimeseries_BucketLimit(t *testing.T) {
+	checker, _ := setupTestService(t)
+	ctx := context.Background()
+
+	to := time.Date(2025, 12, 7, 0, 0, 0, 0, time.UTC)
+	for name, tc := range map[string]struct {
+		from   time.Time
+		bucket time.Duration
+	}{
+		"one bucket too many":  {to.Add(-(MaxTimeseriesBuckets + 1) * time.Hour), time.Hour},
+		"span past a Duration": {time.Date(1, 1, 1, 0, 0, 0, 0, time.UTC), time.Hour},
+	} {
+		_, err := checker.GetStatsTimeseries(ctx, tc.from, to, tc.bucket)
+		assert.ErrorIs(t, err, ErrTooManyTimeseriesBuckets, name)
+	}
+
+	// long buckets fit, though the cap times the bucket overflows a Duration
+	long := 150 * 24 * time.Hour
+	response, err := checker.GetStatsTimeseries(ctx, to.AddDate(-1, 0, 0), to, long)
+	require.NoError(t, err)
+	assert.Len(t, response.Buckets, 3)
+
+	response, err = checker.GetStatsTimeseries(ctx, to.Add(-MaxTimeseriesBuckets*time.Hour), to, time.Hour)
+	require.NoError(t, err)
+	assert.Len(t, response.Buckets, MaxTimeseriesBuckets)
+}
+
+// countingDriver is go-sqlite3 counting the SELECT statements it compiles,
+// and the batches columns they read, so a test can tell how many queries a
+// call issued and whether it loaded batches.
+const countingDriver = "sqlite3_counting"
+
+var (
+	selectStatements  atomic.Int64
+	batchColumnsReads atomic.Int64
+)
+
+func init() {
+	sql.Register(countingDriver, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			conn.RegisterAuthorizer(func(action int, table, column, _ string) int {
+				switch {
+				case action == sqlite3.SQLITE_SELECT:
+					selectStatements.Add(1)
+				case action == sqlite3.SQLITE_READ && table == "batches" && column != "":
+					batchColumnsReads.Add(1)
+				}
+				return sqlite3.SQLITE_OK
+			})
+			return nil
+		},
+	})
+}
+
+func resetStatementCounts() {
+	selectStatements.Store(0)
+	batchColumnsReads.Store(0)
+}
+
+func TestURLChecker_ListBatches(t *testing.T) {
+	checker, db := setupTestServiceWithDB(t, []database.Option{database.WithDriver(countingDriver)}, WithBatchListLimit(10))
+	ctx := context.Background()
+
+	for i := 1; i <= 120; i++ {
+		require.NoError(t, db.CreateBatch(ctx, i, models.BatchStatusCompleted, time.Now()))
+	}
+
+	// health counts the batches with one query instead of loading them
+	resetStatementCounts()
+	assert.Equal(t, 120, checker.GetHealthStatus(ctx)["batches"])
+	assert.Equal(t, int64(1), selectStatements.Load())
+	assert.Zero(t, batchColumnsReads.Load())
+
+	// a page is the total and one limited query, however many batches there are
+	resetStatementCounts()
+	page, err := checker.ListBatches(ctx, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), selectStatements.Load())
+	assert.Equal(t, 120, page.Total)
+	assert.Equal(t, 10, page.Limit)
+	require.Len(t, page.Batches, 10)
+	assert.Equal(t, 120, page.Batches[0].LinksNum)
+
+	page, err = checker.ListBatches(ctx, 25, 110)
+	require.NoError(t, err)
+	assert.Equal(t, 25, page.Limit)
+	require.Len(t, page.Batches, 10)
+	assert.Equal(t, 10, page.Batches[0].LinksNum)
+	assert.Equal(t, 1, page.Batches[9].LinksNum)
+}
+
+func TestURLChecker_BatchSource(t *testing.T) {
+	checker, db := setupTestService(t)
+	server := setupMockHTTPServer(t)
+	ctx := context.Background()
+
+	sources := []models.BatchSource{models.BatchSourceAPI, models.BatchSourceScheduled, models.BatchSourceCLI, models.BatchSourceAPI, ""}
+	batchNums := make([]int, len(sources))
+	for i, source := range sources {
+		response, err := checker.CheckLinksWithOptions(ctx, []string{fmt.Sprintf("%s/ok?n=%d", server.URL, i)}, CheckOptions{Source: source})
+		require.NoError(t, err)
+		batchNums[i] = response.BatchNum
+	}
+
+	for i, batchNum := range batchNums {
+		batch, err := db.GetBatch(ctx, batchNum)
+		require.NoError(t, err)
+		assert.Equal(t, sources[i], batch.Source)
+	}
+
+	page, err := checker.ListBatchesBySource(ctx, models.BatchSourceAPI, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 2, page.Total)
+	require.Len(t, page.Batches, 2)
+	assert.Equal(t, batchNums[3], page.Batches[0].LinksNum)
+	assert.Equal(t, batchNums[0], page.Batches[1].LinksNum)
+
+	page, err = checker.ListBatchesBySource(ctx, models.BatchSourceScheduled, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, page.Total)
+	require.Len(t, page.Batches, 1)
+	assert.Equal(t, batchNums[1], page.Batches[0].LinksNum)
+
+	page, err = checker.ListBatches(ctx, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, len(sources), page.Total)
+
+	source, err := ParseBatchSource(" Scheduled ")
+	require.NoError(t, err)
+	assert.Equal(t, models.BatchSourceScheduled, source)
+
+	_, err = ParseBatchSource("cron")
+	assert.Error(t, err)
+}
+
+// countingWriter counts the writes made to it.
+type countingWriter struct {
+	bytes.Buffer
+	writes int
+
+	// slots, when set, is a read slot channel; heldSlots is the most slots
+	// held during any write
+	slots     chan struct{}
+	heldSlots int
+
+	// onWrite, when set, runs before every write
+	onWrite func()
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	if w.slots != nil {
+		w.heldSlots = max(w.heldSlots, len(w.slots))
+	}
+	if w.onWrite != nil {
+		w.onWrite()
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestURLChecker_StreamBatches(t *testing.T) {
+	checker, db := setupTestService(t)
+	ctx := context.Background()
+
+	const count = 1000
+	now := time.Now()
+	for i := 1; i <= count; i++ {
+		require.NoError(t, db.InsertBatch(ctx, &models.Batch{LinksNum: i, Status: models.BatchStatusCompleted, CreatedAt: now, Source: models.BatchSourceAPI}))
+	}
+
+	out := countingWriter{slots: checker.readSlots}
+	require.NoError(t, checker.StreamBatches(ctx, &out, "", 0, 0))
+
+	var streamed models.BatchesResponse
+	require.NoError(t, json.Unmarshal(out.Bytes(), &streamed), "output must be valid JSON")
+	assert.Equal(t, count, streamed.Total)
+	require.Len(t, streamed.Batches, count)
+	// every batch is written on its own rather than as one encoded slice
+	assert.Greater(t, out.writes, count)
+	// and no read slot is held while writing to the client
+	assert.Zero(t, out.heldSlots)
+
+	listed, err := checker.ListBatches(ctx, count, 0)
+	require.NoError(t, err)
+	assert.Equal(t, listed.Batches, streamed.Batches)
+
+	out = countingWriter{}
+	require.NoError(t, checker.StreamBatches(ctx, &out, models.BatchSourceScheduled, 0, 0))
+	assert.JSONEq(t, `{"batches":[],"total":0,"limit":0,"offset":0}`, out.String())
+
+	out = countingWriter{}
+	require.NoError(t, checker.StreamBatches(ctx, &out, models.BatchSourceAPI, 2, 10))
+	require.NoError(t, json.Unmarshal(out.Bytes(), &streamed))
+	require.Len(t, streamed.Batches, 2)
+	assert.Equal(t, count-10, streamed.Batches[0].LinksNum)
+	assert.Equal(t, 2, streamed.Limit)
+	assert.Equal(t, 10, streamed.Offset)
+
+	// batches submitted mid-stream don't shift later pages onto ones already written
+	next := count
+	out = countingWriter{onWrite: func() {
+		next++
+		require.NoError(t, db.InsertBatch(ctx, &models.Batch{LinksNum: next, Status: models.BatchStatusCompleted, CreatedAt: now, Source: models.BatchSourceAPI}))
+	}}
+	require.NoError(t, checker.StreamBatches(ctx, &out, "", count, 0))
+	require.NoError(t, json.Unmarshal(out.Bytes(), &streamed))
+	require.Len(t, streamed.Batches, count)
+	seen := make(map[int]bool)
+	for _, batch := range streamed.Batches {
+		assert.False(t, seen[batch.LinksNum], "batch %d streamed twice", batch.LinksNum)
+		seen[batch.LinksNum] = true
+	}
+}
+
+func TestURLChecker_CheckLinks_MaxLinksPerHost(t *testing.T) {
+	checker, db := setupTestService(t, WithMaxLinksPerHost(5))
+	server := setupMockHTTPServer(t)
+	ctx := context.Background()
+
+	links := make([]string, 20)
+	for i := range links {
+		links[i] = fmt.Sprintf("%s/ok?n=%d", server.URL, i)
+	}
+	links = append(links, "http://other.invalid")
+
+	response, err := checker.CheckLinks(ctx, links)
+	require.NoError(t, err)
+
+	assert.Len(t, response.Links, 6)
+	assert.Contains(t, response.Links, "http://other.invalid")
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, string(models.StatusAvailable), response.Links[links[i]])
+	}
+
+	require.Len(t, response.Invalid, 15)
+	for i, invalid := range response.Invalid {
+		assert.Equal(t, links[i+5], invalid.URL)
+		assert.Contains(t, invalid.Reason, "too many links to host")
+	}
+
+	stored, err := db.GetLinksByBatchNum(ctx, response.LinksNum)
+	require.NoError(t, err)
+	assert.Len(t, stored, 6)
+}
+
+// notification is a message sent through a fakeNotifier.
+type notification struct {
+	subject     string
+	body        string
+	date        time.Time
+	attachments []Attachment
+}
+
+// fakeNotifier hands the notifications it is asked to send to the test.
+type fakeNotifier chan notification
+
+func (n fakeNotifier) Send(ctx context.Context, subject, body string, attachments []Attachment) error {
+	n <- notification{subject: subject, body: body, date: messageDateFrom(ctx), attachments: attachments}
+	return nil
+}
+
+func TestURLChecker_EmailReport(t *testing.T) {
+	notifier := make(fakeNotifier, 1)
+	clock := NewFakeClock(time.Date(2025, 12, 7, 15, 0, 0, 0, time.UTC))
+	checker, db := setupTestService(t, WithNotifier(notifier, false), WithClock(clock))
+	ctx := context.Background()
+
+	workerCtx, workerCancel := context.WithCancel(ctx)
+	defer workerCancel()
+	go checker.StartWorker(workerCtx)
+
+	require.NoError(t, db.CreateBatch(ctx, 1, models.BatchStatusCompleted, time.Now()))
+	_, err := db.CreateLink(ctx, "http://example.com", models.StatusAvailable, 1, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, checker.EmailReport(ctx, []int{1}))
+	sent := <-notifier
+	assert.Equal(t, DefaultReportTitle, sent.subject)
+	assert.Equal(t, clock.Now(), sent.date)
+	require.Len(t, sent.attachments, 1)
+	assert.Equal(t, "application/pdf", sent.attachments[0].ContentType)
+	assert.True(t, bytes.HasPrefix(sent.attachments[0].Data, []byte("%PDF")))
+
+	checker, _ = setupTestService(t)
+	assert.ErrorIs(t, checker.EmailReport(ctx, []int{1}), ErrEmailNotConfigured)
+}
+
+func TestURLChecker_NotifyBatchCompleted(t *testing.T) {
+	notifier := make(fakeNotifier, 1)
+	checker, _ := setupTestService(t, WithNotifier(notifier, true))
+	server := setupMockHTTPServer(t)
+	ctx := context.Background()
+
+	response, err := checker.CheckLinks(ctx, []string{server.URL + "/ok", server.URL + "/notfound"})
+	require.NoError(t, err)
+
+	select {
+	case sent := <-notifier:
+		assert.Equal(t, fmt.Sprintf("Batch %d completed", response.LinksNum), sent.subject)
+		assert.Contains(t, sent.body, "2 links checked, 1 available, 1 not available")
+		assert.Empty(t, sent.attachments)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no completion notification sent")
+	}
+
+	// a notifier only used for reports isn't told about completed batches
+	checker, _ = setupTestService(t, WithNotifier(notifier, false))
+	_, err = checker.CheckLinks(ctx, []string{server.URL + "/ok"})
+	require.NoError(t, err)
+
+	select {
+	case sent := <-notifier:
+		t.Fatalf("unexpected notification %q", sent.subject)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	assert.NoError(t, NopNotifier{}.Send(ctx, "subject", "body", nil))
+}
+
+func TestParseEmailRecipients(t *testing.T) {
+	recipients, err := ParseEmailRecipients(" ops@example.com, Dev Team <dev@example.com>,")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ops@example.com", "dev@example.com"}, recipients)
+
+	_, err = ParseEmailRecipients("ops@example.com,not-an-address")
+	assert.Error(t, err)
+
+	recipients, err = ParseEmailRecipients("")
+	require.NoError(t, err)
+	assert.Empty(t, recipients)
+}
+
+// serveSMTP accepts one SMTP session on listener and returns the message it
+// received.
+func serveSMTP(t *testing.T, listener net.Listener) <-chan string {
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		reply := func(line string) { fmt.Fprintf(conn, "%s\r\n", line) }
+		reply("220 localhost ready")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+			case cmd == "DATA":
+				reply("354 go ahead")
+				var data strings.Builder
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				received <- data.String()
+				reply("250 queued")
+			case cmd == "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+	return received
+}
+
+func TestSMTPNotifier_Send(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	received := serveSMTP(t, listener)
+
+	addr := listener.Addr().(*net.TCPAddr)
+	notifier, err := NewSMTPNotifier(SMTPConfig{Host: "127.0.0.1", Port: addr.Port, From: "checker@example.com", To: []string{"ops@example.com"}})
+	require.NoError(t, err)
+
+	pdfData := bytes.Repeat([]byte("%PDF-1.3 report "), 20)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	date := time.Date(2025, 12, 7, 15, 0, 0, 0, time.UTC)
+	err = notifier.Send(withMessageDate(ctx, date), "Weekly report", "See attached.",
+		[]Attachment{{Name: "report.pdf", ContentType: "application/pdf", Data: pdfData}})
+	require.NoError(t, err)
+
+	var raw string
+	select {
+	case raw = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(raw))
+	require.NoError(t, err)
+	assert.Equal(t, "checker@example.com", msg.Header.Get("From"))
+	assert.Equal(t, "ops@example.com", msg.Header.Get("To"))
+	sent, err := msg.Header.Date()
+	require.NoError(t, err)
+	assert.True(t, date.Equal(sent), "Date header %v, want the service clock's %v", sent, date)
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/mixed", mediaType)
+
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	body, err := parts.NextPart()
+	require.NoError(t, err)
+	text, err := io.ReadAll(body)
+	require.NoError(t, err)
+	assert.Equal(t, "See attached.", string(text))
+
+	attachment, err := parts.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "report.pdf", attachment.FileName())
+	assert.Equal(t, "application/pdf", attachment.Header.Get("Content-Type"))
+	encoded, err := io.ReadAll(attachment)
+	require.NoError(t, err)
+	decoded, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(encoded), "\r\n", ""))
+	require.NoError(t, err)
+	assert.Equal(t, pdfData, decoded)
+
+	_, err = NewSMTPNotifier(SMTPConfig{Host: "127.0.0.1", From: "not-an-address", To: []string{"ops@example.com"}})
+	assert.Error(t, err)
+	_, err = NewSMTPNotifier(SMTPConfig{Host: "127.0.0.1", From: "checker@example.com"})
+	assert.Error(t, err)
+}
+
+func TestSMTPNotifier_Send_Timeout(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	// a server that accepts the connection and never greets
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(io.Discard, conn)
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	notifier, err := NewSMTPNotifier(SMTPConfig{Host: "127.0.0.1", Port: addr.Port, From: "checker@example.com", To: []string{"ops@example.com"}, Timeout: 100 * time.Millisecond})
+	require.NoError(t, err)
+
+	start := time.Now()
+	err = notifier.Send(context.Background(), "Weekly report", "See attached.", nil)
+	require.Error(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+
+	notifier, err = NewSMTPNotifier(SMTPConfig{Host: "127.0.0.1", From: "checker@example.com", To: []string{"ops@example.com"}})
+	require.NoError(t, err)
+	assert.Equal(t, DefaultNotifyTimeout, notifier.config.Timeout)
+}
+
+func TestURLChecker_ChangeWebhook(t *testing.T) {
+	var mu sync.Mutex
+	var events []models.LinkStatusChange
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event models.LinkStatusChange
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(webhook.Close)
+
+	received := func() []models.LinkStatusChange {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]models.LinkStatusChange(nil), events...)
+	}
+
+	var down atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/flip" && down.Load() {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	checker, _ := setupTestService(t, WithChangeWebhook(webhook.URL, 0))
+	ctx := context.Background()
+
+	response, err := checker.CheckLinks(ctx, []string{server.URL + "/stable", server.URL + "/flip"})
+	require.NoError(t, err)
+
+	// a recheck that changes nothing sends nothing
+	_, err = checker.RecheckBatch(ctx, response.BatchNum)
+	require.NoError(t, err)
+
+	down.Store(true)
+	_, err = checker.RecheckBatch(ctx, response.BatchNum)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool { return len(received()) > 0 }, 5*time.Second, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+
+	got := received()
+	require.Len(t, got, 1)
+	assert.Equal(t, models.EventLinkStatusChanged, got[0].Event)
+	assert.Equal(t, server.URL+"/flip", got[0].URL)
+	assert.Equal(t, response.BatchNum, got[0].BatchNum)
+	assert.Equal(t, models.StatusAvailable, got[0].OldStatus)
+	assert.Equal(t, models.StatusNotAvailable, got[0].NewStatus)
+	assert.Equal(t, models.CheckSourceRecheck, got[0].CheckSource)
+}
+
+func TestURLChecker_RecheckBatch(t *testing.T) {
+	var healthy atomic.Bool
+	healthy.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/flaky" && !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	checker, db := setupTestService(t)
+	ctx := context.Background()
+
+	links := []string{server.URL + "/flaky", server.URL + "/stable"}
+	response, err := checker.CheckLinks(ctx, links)
+	require.NoError(t, err)
+	assert.Equal(t, string(models.StatusAvailable), response.Links[links[0]])
+
+	before, err := db.GetLinksByBatchNum(ctx, response.LinksNum)
+	require.NoError(t, err)
+	require.Len(t, before, 2)
+
+	healthy.Store(false)
+	time.Sleep(10 * time.Millisecond)
+
+	rechecked, err := checker.RecheckBatch(ctx, response.LinksNum)
+	require.NoError(t, err)
+	assert.Equal(t, response.LinksNum, rechecked.LinksNum)
+
+	after, err := db.GetLinksByBatchNum(ctx, response.LinksNum)
+	require.NoError(t, err)
+	require.Len(t, after, 2)
+	for i, link := range after {
+		assert.Equal(t, before[i].ID, link.ID)
+		assert.Equal(t, models.CheckSourceRecheck, link.CheckSource)
+		require.NotNil(t, link.Time)
+		assert.True(t, link.Time.After(*before[i].Time))
+	}
+	assert.Equal(t, models.StatusNotAvailable, after[0].Status)
+	assert.Equal(t, models.StatusAvailable, after[1].Status)
+
+	count, err := db.CountBatches(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	_, err = checker.RecheckBatch(ctx, 99)
+	assert.ErrorIs(t, err, ErrBatchNotFound)
+
+	require.NoError(t, db.CreateBatch(ctx, 2, models.BatchStatusProcessing, time.Now()))
+	_, err = checker.RecheckBatch(ctx, 2)
+	assert.ErrorIs(t, err, ErrBatchProcessing)
+}
+
+func TestCorrectScheme(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		changed  bool
+		wantErr  bool
+	}{
+		{input: "htp://example.com", expected: "http://example.com", changed: true},
+		{input: "https//example.com/path", expected: "https://example.com/path", changed: true},
+		{input: "http:/example.com", expected: "http://example.com", changed: true},
+		{input: "HTTPS:///example.com", expected: "https://example.com", changed: true},
+		{input: "htps://example.com", expected: "https://example.com", changed: true},
+		{input: "http://example.com", expected: "http://example.com"},
+		{input: "example.com", expected: "example.com"},
+		{input: "localhost:8080/health", expected: "localhost:8080/health"},
+		{input: "ftp://example.com", wantErr: true},
+		{input: "hxxp://example.com", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			corrected, changed, err := correctScheme(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, corrected)
+			assert.Equal(t, tt.changed, changed)
+		})
+	}
+}
+
+func TestURLChecker_CheckLinks_CorrectSchemes(t *testing.T) {
+	checker, db := setupTestService(t)
+	server := setupMockHTTPServer(t)
+	ctx := context.Background()
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	links := []string{"htp://" + host + "/ok", "http//" + host + "/ok?n=1", "gopher://" + host}
+
+	response, err := checker.CheckLinksWithOptions(ctx, links, CheckOptions{CorrectSchemes: true})
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{
+		links[0]: server.URL + "/ok",
+		links[1]: server.URL + "/ok?n=1",
+	}, response.Corrected)
+	assert.Equal(t, map[string]string{
+		server.URL + "/ok":     string(models.StatusAvailable),
+		server.URL + "/ok?n=1": string(models.StatusAvailable),
+	}, response.Links)
+	require.Len(t, response.Invalid, 1)
+	assert.Equal(t, links[2], response.Invalid[0].URL)
+	assert.Contains(t, response.Invalid[0].Reason, "unsupported scheme")
+
+	stored, err := db.GetLinksByBatchNum(ctx, response.LinksNum)
+	require.NoError(t, err)
+	assert.Len(t, stored, 2)
+
+	// without the option links are checked as submitted
+	response, err = checker.CheckLinksWithOptions(ctx, links[:1], CheckOptions{})
+	require.NoError(t, err)
+	assert.Nil(t, response.Corrected)
+	assert.Equal(t, string(models.StatusNotAvailable), response.Links[links[0]])
+
+	response, err = checker.CheckLinksWithOptions(ctx, links[2:], CheckOptions{CorrectSchemes: true})
+	require.NoError(t, err)
+	assert.Zero(t, response.LinksNum)
+	assert.Empty(t, response.Links)
+	assert.Len(t, response.Invalid, 1)
+}
+
+func TestURLChecker_CheckLinks_MethodPolicy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	link := server.URL + "/health"
+	ctx := context.Background()
+
+	t.Run("all", func(t *testing.T) {
+		checker, db := setupTestService(t)
+
+		response, err := checker.CheckLinksWithOptions(ctx, []string{link}, CheckOptions{Methods: []string{"get", "HEAD"}})
+		require.NoError(t, err)
+
+		assert.Equal(t, string(models.StatusNotAvailable), response.Links[link])
+		assert.Equal(t, map[string]models.LinkStatus{
+			"GET":  models.StatusAvailable,
+			"HEAD": models.StatusNotAvailable,
+		}, response.Methods[link])
+
+		batch, err := db.GetBatch(ctx, response.LinksNum)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"GET", "HEAD"}, batch.Methods)
+		assert.Equal(t, models.MethodPolicyAll, batch.MethodPolicy)
+	})
+
+	t.Run("any", func(t *testing.T) {
+		checker, _ := setupTestService(t)
+
+		response, err := checker.CheckLinksWithOptions(ctx, []string{link}, CheckOptions{
+			Methods:      []string{"GET", "HEAD"},
+			MethodPolicy: models.MethodPolicyAny,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, string(models.StatusAvailable), response.Links[link])
+		assert.Equal(t, models.StatusNotAvailable, response.Methods[link]["HEAD"])
+	})
+
+	t.Run("async results are stored", func(t *testing.T) {
+		checker, _ := setupTestService(t)
+		workerCtx, workerCancel := context.WithCancel(ctx)
+		defer workerCancel()
+		go checker.StartBatchWorker(workerCtx)
+
+		response, err := checker.CheckLinksWithOptions(ctx, []string{link}, CheckOptions{Async: true, Methods: []string{"GET", "HEAD"}})
+		require.NoError(t, err)
+		assert.Nil(t, response.Methods)
+
+		var status models.BatchStatusResponse
+		require.Eventually(t, func() bool {
+			status, err = checker.GetBatchStatus(ctx, response.LinksNum, "")
+			return err == nil && status.Status == models.BatchStatusCompleted
+		}, 5*time.Second, 10*time.Millisecond)
+
+		require.Len(t, status.Links, 1)
+		assert.Equal(t, map[string]models.LinkStatus{
+			"GET":  models.StatusAvailable,
+			"HEAD": models.StatusNotAvailable,
+		}, status.Links[0].Methods)
+	})
+
+	t.Run("service default", func(t *testing.T) {
+		checker, _ := setupTestService(t, WithMethodPolicy(models.MethodPolicyAny))
+
+		response, err := checker.CheckLinksWithOptions(ctx, []string{link}, CheckOptions{Methods: []string{"GET", "HEAD"}})
+		require.NoError(t, err)
+		assert.Equal(t, string(models.StatusAvailable), response.Links[link])
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		checker, _ := setupTestService(t)
+
+		_, err := checker.CheckLinksWithOptions(ctx, []string{link}, CheckOptions{Methods: []string{"DELETE"}})
+		assert.Error(t, err)
+
+		_, err = checker.CheckLinksWithOptions(ctx, []string{link}, CheckOptions{Methods: []string{"GET"}, MethodPolicy: "most"})
+		assert.Error(t, err)
+	})
+}
+
+func TestURLChecker_CheckLinks_DisableKeepAlive(t *testing.T) {
+	var connections atomic.Int64
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			connections.Add(1)
+		}
+	}
+	server.Start()
+	t.Cleanup(server.Close)
+
+	links := make([]string, 5)
+	for i := range links {
+		links[i] = fmt.Sprintf("%s/ping?n=%d", server.URL, i)
+	}
+	ctx := context.Background()
+
+	// runs first so no idle connection from an earlier check can be reused
+	t.Run("disabled", func(t *testing.T) {
+		checker, db := setupTestService(t, WithMaxActiveChecks(1))
+		connections.Store(0)
+
+		response, err := checker.CheckLinksWithOptions(ctx, links, CheckOptions{DisableKeepAlive: true})
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(links)), connections.Load())
+
+		batch, err := db.GetBatch(ctx, response.LinksNum)
+		require.NoError(t, err)
+		assert.True(t, batch.DisableKeepAlive)
+	})
+
+	t.Run("reuse", func(t *testing.T) {
+		checker, _ := setupTestService(t, WithMaxActiveChecks(1))
+		connections.Store(0)
+
+		_, err := checker.CheckLinks(ctx, links)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), connections.Load())
+	})
+}
+
+func TestURLChecker_CheckLinks_ServerName(t *testing.T) {
+	var serverNames []string
+	var authorized atomic.Int64
+	var mu sync.Mutex
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, _, ok := r.BasicAuth(); ok {
+			authorized.Add(1)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.TLS = &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			mu.Lock()
+			serverNames = append(serverNames, hello.ServerName)
+			mu.Unlock()
+			return nil, nil
+		},
+	}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	_, db := setupTestService(t)
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	// the test certificate is valid for example.com, so the override must
+	// also be what the certificate is verified against
+	checker := NewURLChecker(db, logger, server.Client(),
+		WithBasicAuth(map[string]BasicAuth{"127.0.0.1": {Username: "user", Password: "secret"}}))
+	ctx := context.Background()
+
+	response, err := checker.CheckLinksWithOptions(ctx, []string{server.URL + "/sni"}, CheckOptions{ServerName: "example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, string(models.StatusAvailable), response.Links[server.URL+"/sni"])
+
+	mu.Lock()
+	assert.Equal(t, []string{"example.com"}, serverNames)
+	serverNames = nil
+	mu.Unlock()
+	assert.Equal(t, int64(1), authorized.Load())
+
+	batch, err := db.GetBatch(ctx, response.LinksNum)
+	require.NoError(t, err)
+	assert.Equal(t, "example.com", batch.ServerName)
+
+	// without the override no server name is sent for an IP address host
+	_, err = checker.CheckLinks(ctx, []string{server.URL + "/plain"})
+	require.NoError(t, err)
+
+	mu.Lock()
+	assert.Equal(t, []string{""}, serverNames)
+	mu.Unlock()
+
+	_, err = checker.CheckLinksWithOptions(ctx, []string{server.URL}, CheckOptions{ServerName: "example.com:443"})
+	assert.Error(t, err)
+}
+
+func TestURLChecker_CheckLinks_DiscoverMethods(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			w.Header().Set("Allow", "GET, POST")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	checker, db := setupTestService(t)
+	ctx := context.Background()
+	link := server.URL + "/allow"
+
+	response, err := checker.CheckLinksWithOptions(ctx, []string{link}, CheckOptions{DiscoverMethods: true})
+	require.NoError(t, err)
+	assert.Equal(t, string(models.StatusAvailable), response.Links[link])
+	assert.Equal(t, map[string]string{link: "GET, POST"}, response.Allow)
+
+	batch, err := db.GetBatch(ctx, response.LinksNum)
+	require.NoError(t, err)
+	assert.True(t, batch.DiscoverMethods)
+
+	links, err := db.GetLinksByBatchNum(ctx, response.LinksNum)
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	assert.Equal(t, "GET, POST", links[0].Allow)
+
+	// discovery is opt-in
+	response, err = checker.CheckLinks(ctx, []string{server.URL + "/plain"})
+	require.NoError(t, err)
+	assert.Nil(t, response.Allow)
+
+	response, err = checker.CheckLinksWithOptions(ctx, []string{link}, CheckOptions{DiscoverMethods: true, Ephemeral: true})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{link: "GET, POST"}, response.Allow)
+}
+
+func TestURLChecker_CheckLinks_SchemeNotAllowed(t *testing.T) {
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	checker, db := setupTestService(t)
+	ctx := context.Background()
+
+	rejected := []string{"file:///etc/passwd", "data:text/plain;base64,aGVsbG8=", "ftp://" + server.Listener.Addr().String() + "/pub"}
+	response, err := checker.CheckLinks(ctx, append([]string{server.URL}, rejected...))
+	require.NoError(t, err)
+	assert.Equal(t, string(models.StatusAvailable), response.Links[server.URL])
+	for _, link := range rejected {
+		assert.Equal(t, string(models.StatusNotAvailable), response.Links[link], link)
+	}
+	assert.Equal(t, int64(1), requests.Load())
+
+	links, err := db.GetLinksByBatchNum(ctx, response.LinksNum)
+	require.NoError(t, err)
+	for _, link := range links {
+		if link.URL == server.URL {
+			assert.Empty(t, link.Error)
+			continue
+		}
+		assert.Equal(t, SchemeNotAllowedNote, link.Error, link.URL)
+	}
+
+	// host:port links have no scheme and are checked as http
+	response, err = checker.CheckLinks(ctx, []string{server.Listener.Addr().String()})
+	require.NoError(t, err)
+	assert.Equal(t, string(models.StatusAvailable), response.Links[server.Listener.Addr().String()])
+}
+
+func TestURLChecker_WithAllowedSchemes(t *testing.T) {
+	checker, _ := setupTestService(t, WithAllowedSchemes([]string{"HTTPS", " ftp:// "}))
+
+	assert.True(t, checker.schemeAllowed("https://example.com"))
+	assert.True(t, checker.schemeAllowed("FTP://example.com/pub"))
+	assert.False(t, checker.schemeAllowed("http://example.com"))
+	assert.False(t, checker.schemeAllowed("example.com"))
+	assert.False(t, checker.schemeAllowed("file:///etc/passwd"))
+
+	// an empty list keeps the default
+	checker, _ = setupTestService(t, WithAllowedSchemes([]string{""}))
+	assert.True(t, checker.schemeAllowed("example.com"))
+	assert.True(t, checker.schemeAllowed("localhost:8080/path"))
+	assert.False(t, checker.schemeAllowed("ftp://example.com"))
+}
+
+func TestURLChecker_ExpiryWorker(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	checker, db := setupTestService(t, WithExpiryPollInterval(10*time.Millisecond))
+	ctx := context.Background()
+
+	expiring, err := checker.CheckLinksWithOptions(ctx, []string{server.URL + "/expiring"}, CheckOptions{ExpiresIn: 50 * time.Millisecond})
+	require.NoError(t, err)
+	kept, err := checker.CheckLinks(ctx, []string{server.URL + "/kept"})
+	require.NoError(t, err)
+
+	batch, err := db.GetBatch(ctx, expiring.LinksNum)
+	require.NoError(t, err)
+	require.NotNil(t, batch.ExpiresAt)
+
+	workerCtx, workerCancel := context.WithCancel(context.Background())
+	defer workerCancel()
+	go checker.StartExpiryWorker(workerCtx)
+
+	require.Eventually(t, func() bool {
+		_, err := db.GetBatch(ctx, expiring.LinksNum)
+		return errors.Is(err, database.ErrBatchNotFound)
+	}, 2*time.Second, 10*time.Millisecond)
+
+	links, err := db.GetLinksByBatchNum(ctx, expiring.LinksNum)
+	require.NoError(t, err)
+	assert.Empty(t, links)
+
+	batch, err = db.GetBatch(ctx, kept.LinksNum)
+	require.NoError(t, err)
+	assert.Nil(t, batch.ExpiresAt)
+
+	_, err = checker.CheckLinksWithOptions(ctx, []string{server.URL}, CheckOptions{ExpiresIn: time.Minute, Ephemeral: true})
+	assert.Error(t, err)
+}
+
+func TestURLChecker_CheckLinks_MinSuccessRatio(t *testing.T) {
+	checker, db := setupTestService(t, WithMinSuccessRatio(0.5))
+	server := setupMockHTTPServer(t)
+	ctx := context.Background()
+
+	// one of three links is available, below the ratio
+	response, err := checker.CheckLinks(ctx, []string{server.URL + "/ok", server.URL + "/notfound", server.URL + "/error"})
+	require.NoError(t, err)
+
+	batch, err := db.GetBatch(ctx, response.LinksNum)
+	require.NoError(t, err)
+	assert.Equal(t, models.BatchStatusDegraded, batch.Status)
+
+	// exactly at the ratio is not degraded
+	response, err = checker.CheckLinks(ctx, []string{server.URL + "/ok", server.URL + "/notfound"})
+	require.NoError(t, err)
+
+	batch, err = db.GetBatch(ctx, response.LinksNum)
+	require.NoError(t, err)
+	assert.Equal(t, models.BatchStatusCompleted, batch.Status)
+
+	listing, err := checker.ListBatches(ctx, 0, 0)
+	require.NoError(t, err)
+	require.Len(t, listing.Batches, 2)
+	assert.Equal(t, models.BatchStatusDegraded, listing.Batches[1].Status)
+
+	// disabled by default
+	checker, db = setupTestService(t)
+	response, err = checker.CheckLinks(ctx, []string{server.URL + "/notfound"})
+	require.NoError(t, err)
+
+	batch, err = db.GetBatch(ctx, response.LinksNum)
+	require.NoError(t, err)
+	assert.Equal(t, models.BatchStatusCompleted, batch.Status)
+}
+
+func TestURLChecker_MinSuccessRatio_Recovery(t *testing.T) {
+	var healthy atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/flaky" && !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	ctx := context.Background()
+
+	t.Run("recheck", func(t *testing.T) {
+		healthy.Store(false)
+		checker, db := setupTestService(t, WithMinSuccessRatio(1))
+
+		response, err := checker.CheckLinks(ctx, []string{server.URL + "/flaky", server.URL + "/stable"})
+		require.NoError(t, err)
+		batch, err := db.GetBatch(ctx, response.LinksNum)
+		require.NoError(t, err)
+		require.Equal(t, models.BatchStatusDegraded, batch.Status)
+
+		healthy.Store(true)
+		time.Sleep(10 * time.Millisecond)
+		rechecked, err := checker.RecheckBatch(ctx, response.LinksNum)
+		require.NoError(t, err)
+		assert.Equal(t, models.BatchStatusCompleted, rechecked.Status)
+
+		batch, err = db.GetBatch(ctx, response.LinksNum)
+		require.NoError(t, err)
+		assert.Equal(t, models.BatchStatusCompleted, batch.Status)
+
+		// and degrades again when the link fails on the next recheck
+		healthy.Store(false)
+		time.Sleep(10 * time.Millisecond)
+		_, err = checker.RecheckBatch(ctx, response.LinksNum)
+		require.NoError(t, err)
+		batch, err = db.GetBatch(ctx, response.LinksNum)
+		require.NoError(t, err)
+		assert.Equal(t, models.BatchStatusDegraded, batch.Status)
+	})
+
+	t.Run("retry", func(t *testing.T) {
+		healthy.Store(true)
+		checker, db := setupTestService(t, WithMinSuccessRatio(1))
+
+		next := time.Now()
+		require.NoError(t, db.InsertBatch(ctx, &models.Batch{
+			LinksNum:    1,
+			Status:      models.BatchStatusDegraded,
+			CreatedAt:   time.Now(),
+			RetryCount:  1,
+			NextRetryAt: &next,
+		}))
+		_, err := db.CreateLink(ctx, server.URL+"/flaky", models.StatusNotAvailable, 1, &next)
+		require.NoError(t, err)
+		_, err = db.CreateLink(ctx, server.URL+"/stable", models.StatusAvailable, 1, &next)
+		require.NoError(t, err)
+
+		batch, err := db.GetBatch(ctx, 1)
+		require.NoError(t, err)
+		checker.retryBatch(ctx, batch)
+
+		batch, err = db.GetBatch(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, models.BatchStatusCompleted, batch.Status)
+	})
+}
+
+func TestURLChecker_CheckLinks_Cookies(t *testing.T) {
+	const secret = "s3cr3t-session-value"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie("session")
+		if err != nil || cookie.Value != secret {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	checker, _ := setupTestService(t)
+	checker.logger.SetLevel(logrus.DebugLevel)
+	hook := logtest.NewLocal(checker.logger)
+	ctx := context.Background()
+	link := server.URL + "/account"
+
+	response, err := checker.CheckLinks(ctx, []string{link})
+	require.NoError(t, err)
+	assert.Equal(t, string(models.StatusNotAvailable), response.Links[link])
+
+	cookies := []models.Cookie{{Name: "session", Value: secret}}
+	response, err = checker.CheckLinksWithOptions(ctx, []string{link}, CheckOptions{Cookies: cookies})
+	require.NoError(t, err)
+	assert.Equal(t, string(models.StatusAvailable), response.Links[link])
+	cookieBatch := response.LinksNum
+
+	// a submission without cookies never gets the results seen with them
+	response, err = checker.CheckLinks(ctx, []string{link})
+	require.NoError(t, err)
+	assert.NotEqual(t, cookieBatch, response.LinksNum)
+	assert.Equal(t, string(models.StatusNotAvailable), response.Links[link])
+
+	response, err = checker.CheckLinksWithOptions(ctx, []string{link}, CheckOptions{Cookies: cookies, Ephemeral: true})
+	require.NoError(t, err)
+	assert.Equal(t, string(models.StatusAvailable), response.Links[link])
+
+	_, err = checker.CheckLinksWithOptions(ctx, []string{link}, CheckOptions{Cookies: cookies, RetryCount: 1})
+	assert.Error(t, err)
+
+	_, err = checker.CheckLinksWithOptions(ctx, []string{link}, CheckOptions{Cookies: []models.Cookie{{Name: "bad name", Value: secret}}})
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), secret)
+
+	require.NotEmpty(t, hook.AllEntries())
+	for _, entry := range hook.AllEntries() {
+		line, err := entry.String()
+		require.NoError(t, err)
+		assert.NotContains(t, line, secret)
+	}
+}
+
+func TestURLChecker_MaxBatches(t *testing.T) {
+	checker, db := setupTestService(t, WithMaxBatches(2))
+	server := setupMockHTTPServer(t)
+	ctx := context.Background()
+
+	var batchNums []int
+	for i := 0; i < 4; i++ {
+		response, err := checker.CheckLinks(ctx, []string{fmt.Sprintf("%s/ok?n=%d", server.URL, i)})
+		require.NoError(t, err)
+		batchNums = append(batchNums, response.LinksNum)
+	}
+
+	for _, batchNum := range batchNums[:2] {
+		_, err := db.GetBatch(ctx, batchNum)
+		assert.ErrorIs(t, err, database.ErrBatchNotFound)
+
+		links, err := db.GetLinksByBatchNum(ctx, batchNum)
+		require.NoError(t, err)
+		assert.Empty(t, links)
+	}
+
+	for _, batchNum := range batchNums[2:] {
+		batch, err := db.GetBatch(ctx, batchNum)
+		require.NoError(t, err)
+		assert.Equal(t, models.BatchStatusCompleted, batch.Status)
+	}
+
+	count, err := db.CountBatches(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestURLChecker_FallbackUserAgents(t *testing.T) {
+	const browserAgent = "Mozilla/5.0 (X11; Linux x86_64)"
+
+	var mu sync.Mutex
+	var agents []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		agents = append(agents, r.UserAgent())
+		mu.Unlock()
+
+		if r.UserAgent() != browserAgent {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	t.Run("opt-in", func(t *testing.T) {
+		checker, _ := setupTestService(t)
+
+		response, err := checker.CheckLinks(context.Background(), []string{server.URL + "/default"})
+		require.NoError(t, err)
+		assert.Equal(t, string(models.StatusNotAvailable), response.Links[server.URL+"/default"])
+		assert.Empty(t, response.UserAgents)
+	})
+
+	t.Run("falls back in order", func(t *testing.T) {
+		checker, db := setupTestService(t, WithFallbackUserAgents([]string{"Blocked/1.0", browserAgent, "Unused/1.0"}))
+		link := server.URL + "/fallback"
+
+		mu.Lock()
+		agents = nil
+		mu.Unlock()
+
+		response, err := checker.CheckLinks(context.Background(), []string{link})
+		require.NoError(t, err)
+		assert.Equal(t, string(models.StatusAvailable), response.Links[link])
+		assert.Equal(t, map[string]string{link: browserAgent}, response.UserAgents)
+
+		mu.Lock()
+		assert.Equal(t, []string{DefaultUserAgent, "Blocked/1.0", browserAgent}, agents)
+		mu.Unlock()
+
+		links, err := db.GetLinksByBatchNum(context.Background(), response.BatchNum)
+		require.NoError(t, err)
+		require.Len(t, links, 1)
+		assert.Equal(t, browserAgent, links[0].UserAgent)
+	})
+}
+
+func TestURLChecker_HeadFirst(t *testing.T) {
+	const checkAgent = "Head-Test/1.0"
+
+	var mu sync.Mutex
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.URL.Path+" "+r.UserAgent())
+		mu.Unlock()
+
+		switch {
+		case r.URL.Path == "/no-head" && r.Method == http.MethodHead:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		case r.URL.Path == "/unimplemented" && r.Method == http.MethodHead:
+			w.WriteHeader(http.StatusNotImplemented)
+		case r.URL.Path == "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer server.Close()
+
+	checker, _ := setupTestService(t, WithHeadFirst(true))
+	ctx := withUserAgent(context.Background(), checkAgent)
+
+	tests := []struct {
+		path     string
+		status   models.LinkStatus
+		code     int
+		requests []string
+	}{
+		{"/ok", models.StatusAvailable, http.StatusOK, []string{"HEAD /ok " + checkAgent}},
+		{"/missing", models.StatusNotAvailable, http.StatusNotFound, []string{"HEAD /missing " + checkAgent}},
+		{"/no-head", models.StatusAvailable, http.StatusOK, []string{"HEAD /no-head " + checkAgent, "GET /no-head " + checkAgent}},
+		{"/unimplemented", models.StatusAvailable, http.StatusOK, []string{"HEAD /unimplemented " + checkAgent, "GET /unimplemented " + checkAgent}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			mu.Lock()
+			requests = nil
+			mu.Unlock()
+
+			status, code := checker.checkURLAvailability(ctx, server.URL+tt.path, 0)
+			assert.Equal(t, tt.status, status)
+			assert.Equal(t, tt.code, code)
+
+			mu.Lock()
+			assert.Equal(t, tt.requests, requests)
+			mu.Unlock()
+		})
+	}
+}
+
+func TestURLChecker_DebugMetadata(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Served-By", "mock")
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "server-secret"})
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	cookies := []models.Cookie{{Name: "session", Value: "client-secret"}}
+
+	checkedLink := func(t *testing.T, checker *URLChecker, db *database.Database, path string) *models.Link {
+		t.Helper()
+
+		response, err := checker.CheckLinksWithOptions(ctx, []string{server.URL + path}, CheckOptions{Cookies: cookies})
+		require.NoError(t, err)
+
+		links, err := db.GetLinksByBatchNum(ctx, response.BatchNum)
+		require.NoError(t, err)
+		require.Len(t, links, 1)
+		assert.Nil(t, links[0].Debug, "debug metadata is only read for a single link")
+
+		link, err := checker.GetLink(ctx, links[0].ID)
+		require.NoError(t, err)
+		return link
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		checker, db := setupTestService(t)
+
+		link := checkedLink(t, checker, db, "/disabled")
+		assert.Nil(t, link.Debug)
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		checker, db := setupTestService(t, WithDebugMetadata(16384))
+
+		link := checkedLink(t, checker, db, "/enabled")
+		require.NotNil(t, link.Debug)
+		assert.Equal(t, "GET", link.Debug.Method)
+		assert.Equal(t, server.URL+"/enabled", link.Debug.URL)
+		assert.Equal(t, "HTTP/1.1 200 OK", link.Debug.Status)
+		assert.Equal(t, []string{DefaultUserAgent}, link.Debug.RequestHeaders["User-Agent"])
+		assert.Equal(t, []string{"[redacted]"}, link.Debug.RequestHeaders["Cookie"])
+		assert.Equal(t, []string{"mock"}, link.Debug.ResponseHeaders["X-Served-By"])
+		assert.Equal(t, []string{"[redacted]"}, link.Debug.ResponseHeaders["Set-Cookie"])
+		assert.False(t, link.Debug.Truncated)
+
+		encoded, err := json.Marshal(link.Debug)
+		require.NoError(t, err)
+		assert.NotContains(t, string(encoded), "secret")
+	})
+
+	t.Run("over the size limit", func(t *testing.T) {
+		checker, db := setupTestService(t, WithDebugMetadata(64))
+
+		link := checkedLink(t, checker, db, "/truncated")
+		require.NotNil(t, link.Debug)
+		assert.True(t, link.Debug.Truncated)
+		assert.Equal(t, "HTTP/1.1 200 OK", link.Debug.Status)
+		assert.Nil(t, link.Debug.RequestHeaders)
+		assert.Nil(t, link.Debug.ResponseHeaders)
+	})
+}
+
+func TestURLChecker_FakeClock(t *testing.T) {
+	start := time.Date(2025, 12, 7, 12, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	checker, _ := setupTestService(t, WithClock(clock), WithResultTTL(time.Hour))
+	server := setupMockHTTPServer(t)
+	ctx := context.Background()
+
+	response, err := checker.CheckLinksWithOptions(ctx, []string{server.URL + "/ok"}, CheckOptions{ExpiresIn: 2 * time.Hour})
+	require.NoError(t, err)
+	batchNum := response.BatchNum
+
+	status, err := checker.GetBatchStatus(ctx, batchNum, "")
+	require.NoError(t, err)
+	assert.True(t, status.Batch.CreatedAt.Equal(start))
+	require.NotNil(t, status.Batch.ExpiresAt)
+	assert.True(t, status.Batch.ExpiresAt.Equal(start.Add(2*time.Hour)))
+	require.Len(t, status.Links, 1)
+	require.NotNil(t, status.Links[0].Time)
+	assert.True(t, status.Links[0].Time.Equal(start))
+	assert.False(t, status.Stale)
+	assert.Equal(t, start.Unix(), checker.GetCurrentTimestamp())
+
+	// exactly at the TTL the result is still fresh
+	clock.Advance(time.Hour)
+	status, err = checker.GetBatchStatus(ctx, batchNum, "")
+	require.NoError(t, err)
+	assert.False(t, status.Stale)
+
+	clock.Advance(time.Second)
+	status, err = checker.GetBatchStatus(ctx, batchNum, "")
+	require.NoError(t, err)
+	assert.True(t, status.Stale)
+
+	checker.deleteExpiredBatches(ctx)
+	_, err = checker.GetBatchStatus(ctx, batchNum, "")
+	require.NoError(t, err, "the batch expires two hours after it was created")
+
+	clock.Set(start.Add(2*time.Hour + time.Second))
+	checker.deleteExpiredBatches(ctx)
+	_, err = checker.GetBatchStatus(ctx, batchNum, "")
+	assert.ErrorIs(t, err, ErrBatchNotFound)
+}
+
+func TestParseStatusOverrides(t *testing.T) {
+	overrides, err := ParseStatusOverrides("example.com=403, example.com=451,Docs.example.org=401")
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]int{
+		"example.com":      {403, 451},
+		"Docs.example.org": {401},
+	}, overrides)
+
+	overrides, err = ParseStatusOverrides("")
+	require.NoError(t, err)
+	assert.Empty(t, overrides)
+
+	for _, value := range []string{"example.com", "=403", "example.com=forbidden", "example.com=99", "example.com=600"} {
+		_, err := ParseStatusOverrides(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestURLChecker_StatusOverrides(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	t.Cleanup(server.Close)
+
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	// the same server under a second host name
+	otherHost := "http://localhost:" + serverURL.Port()
+
+	checker, _ := setupTestService(t, WithStatusOverrides(map[string][]int{"127.0.0.1": {http.StatusForbidden}}))
+	ctx := context.Background()
+
+	assert.Equal(t, models.StatusAvailable, statusOf(checker.checkURLAvailability(ctx, server.URL+"/bots-refused", 0)))
+	assert.Equal(t, models.StatusNotAvailable, statusOf(checker.checkURLAvailability(ctx, otherHost+"/bots-refused", 0)))
+
+	unlisted, _ := setupTestService(t, WithStatusOverrides(map[string][]int{"127.0.0.1": {http.StatusUnauthorized}}))
+	assert.Equal(t, models.StatusNotAvailable, statusOf(unlisted.checkURLAvailability(ctx, server.URL+"/bots-refused", 0)))
+}
+
+func TestParseCheckProfiles(t *testing.T) {
+	profiles, err := ParseCheckProfiles([]byte(`{
+		"aggressive": {"timeout": "2s"},
+		"patient": {"timeout": "30s", "user_agent": " Patient/1.0 ", "retry_count": 3, "retry_delay": "1m"}
+	}`))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]CheckProfile{
+		"aggressive": {Timeout: 2 * time.Second},
+		"patient":    {Timeout: 30 * time.Second, UserAgent: "Patient/1.0", RetryCount: 3, RetryDelay: time.Minute},
+	}, profiles)
+
+	for _, data := range []string{
+		`[]`,
+		`{"x": {"timeout": "soon"}}`,
+		`{"x": {"timeout": "-1s"}}`,
+		`{"x": {"retry_delay": "1"}}`,
+		`{"x": {"retry_count": 11}}`,
+		`{"": {}}`,
+	} {
+		_, err := ParseCheckProfiles([]byte(data))
+		assert.Error(t, err, data)
+	}
+}
+
+func TestURLChecker_CheckProfiles(t *testing.T) {
+	var mu sync.Mutex
+	var agents []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		agents = append(agents, r.UserAgent())
+		mu.Unlock()
+
+		time.Sleep(200 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	checker, db := setupTestService(t, WithCheckProfiles(map[string]CheckProfile{
+		"aggressive": {Timeout: 50 * time.Millisecond},
+		"patient":    {Timeout: 5 * time.Second, UserAgent: "Patient/1.0"},
+	}))
+	ctx := context.Background()
+
+	aggressive, err := checker.CheckLinksWithOptions(ctx, []string{server.URL + "/aggressive"}, CheckOptions{Profile: "aggressive"})
+	require.NoError(t, err)
+	assert.Equal(t, string(models.StatusNotAvailable), aggressive.Links[server.URL+"/aggressive"])
+
+	batch, err := db.GetBatch(ctx, aggressive.BatchNum)
+	require.NoError(t, err)
+	assert.Equal(t, "aggressive", batch.Profile)
+	assert.Equal(t, int64(50), batch.TimeoutMs)
+
+	patient, err := checker.CheckLinksWithOptions(ctx, []string{server.URL + "/patient"}, CheckOptions{Profile: "patient"})
+	require.NoError(t, err)
+	assert.Equal(t, string(models.StatusAvailable), patient.Links[server.URL+"/patient"])
+
+	mu.Lock()
+	assert.Equal(t, []string{DefaultUserAgent, "Patient/1.0"}, agents)
+	mu.Unlock()
+
+	// a timeout given with the request wins over the profile's
+	overridden, err := checker.CheckLinksWithOptions(ctx, []string{server.URL + "/overridden"}, CheckOptions{Profile: "aggressive", Timeout: 5 * time.Second})
+	require.NoError(t, err)
+	assert.Equal(t, string(models.StatusAvailable), overridden.Links[server.URL+"/overridden"])
+
+	_, err = checker.CheckLinksWithOptions(ctx, []string{server.URL}, CheckOptions{Profile: "unknown"})
+	assert.ErrorIs(t, err, ErrUnknownProfile)
+}
+
+func TestURLChecker_CheckLinks_Dedup(t *testing.T) {
+	server := setupMockHTTPServer(t)
+	ctx := context.Background()
+	first := server.URL + "/ok?a=1"
+	second := server.URL + "/ok?a=2"
+
+	tests := []struct {
+		mode       models.DedupMode
+		links      []string
+		duplicates map[string]string
+	}{
+		{"", []string{first, second}, nil},
+		{models.DedupFull, []string{first, second}, nil},
+		{models.DedupIgnoreQuery, []string{first}, map[string]string{second: first}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			checker, db := setupTestService(t)
+
+			response, err := checker.CheckLinksWithOptions(ctx, []string{first, second}, CheckOptions{Dedup: tt.mode})
+			require.NoError(t, err)
+			assert.Len(t, response.Links, len(tt.links))
+			assert.Equal(t, tt.duplicates, response.Duplicates)
+
+			links, err := db.GetLinksByBatchNum(ctx, response.BatchNum)
+			require.NoError(t, err)
+			var urls []string
+			for _, link := range links {
+				urls = append(urls, link.URL)
+			}
+			assert.Equal(t, tt.links, urls)
+		})
+	}
+
+	t.Run("full merges identical links", func(t *testing.T) {
+		checker, _ := setupTestService(t)
+		withoutScheme := strings.TrimPrefix(first, "http://")
+
+		response, err := checker.CheckLinksWithOptions(ctx, []string{first, withoutScheme, second}, CheckOptions{Dedup: models.DedupFull})
+		require.NoError(t, err)
+		assert.Len(t, response.Links, 2)
+		assert.Equal(t, map[string]string{withoutScheme: first}, response.Duplicates)
+	})
+
+	t.Run("unknown mode", func(t *testing.T) {
+		checker, _ := setupTestService(t)
+		_, err := checker.CheckLinksWithOptions(ctx, []string{first}, CheckOptions{Dedup: "host"})
+		assert.Error(t, err)
+	})
+}
+
+// panickingTransport panics for requests to /panic, standing in for a bug in
+// check code.
+type panickingTransport struct {
+	base http.RoundTripper
+}
+
+func (t panickingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Path == "/panic" {
+		panic("unexpected check state")
+	}
+	return t.base.RoundTrip(req)
+}
+
+func TestURLChecker_CheckPanicRecovered(t *testing.T) {
+	checker, db := setupTestService(t)
+	server := setupMockHTTPServer(t)
+	checker.wrapTransport(func(base http.RoundTripper) http.RoundTripper {
+		return panickingTransport{base: base}
+	})
+	ctx := context.Background()
+
+	response, err := checker.CheckLinks(ctx, []string{server.URL + "/ok", server.URL + "/panic"})
+	require.NoError(t, err)
+	assert.Equal(t, string(models.StatusAvailable), response.Links[server.URL+"/ok"])
+	assert.Equal(t, string(models.StatusError), response.Links[server.URL+"/panic"])
+
+	links, err := db.GetLinksByBatchNum(ctx, response.BatchNum)
+	require.NoError(t, err)
+	require.Len(t, links, 2)
+	assert.Equal(t, models.StatusError, links[1].Status)
+	assert.Equal(t, CheckPanicNote, links[1].Error)
+
+	batch, err := db.GetBatch(ctx, response.BatchNum)
+	require.NoError(t, err)
+	assert.NotEqual(t, models.BatchStatusProcessing, batch.Status)
+
+	// the service keeps working after the panic
+	ephemeral, err := checker.CheckLinksWithOptions(ctx, []string{server.URL + "/panic"}, CheckOptions{Ephemeral: true})
+	require.NoError(t, err)
+	assert.Equal(t, string(models.StatusError), ephemeral.Links[server.URL+"/panic"])
 }
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"sync"
+)
+
+// sharedChecks lets concurrent checks of the same URL, e.g. from batches
+// submitted at the same time, share one request and its result.
+type sharedChecks struct {
+	mu      sync.Mutex
+	flights map[string]*checkFlight
+}
+
+// checkFlight is a check in progress that others may wait for.
+type checkFlight struct {
+	done   chan struct{}
+	result guardedResult
+	// failed is set when the check was cancelled or panicked, so its result
+	// isn't one the waiting checks should use
+	failed bool
+}
+
+func newSharedChecks() *sharedChecks {
+	return &sharedChecks{flights: make(map[string]*checkFlight)}
+}
+
+// do runs check for key unless a check for the same key is in flight, in
+// which case it waits for that check's result instead. It reports whether the
+// result came from another check, and returns ctx's error with no result when
+// ctx is done before the check it waits for.
+func (s *sharedChecks) do(ctx context.Context, key string, check func() guardedResult) (guardedResult, bool, error) {
+	s.mu.Lock()
+	if flight, ok := s.flights[key]; ok {
+		s.mu.Unlock()
+
+		select {
+		case <-flight.done:
+			if !flight.failed {
+				return flight.result, true, nil
+			}
+		case <-ctx.Done():
+			return guardedResult{}, false, ctx.Err()
+		}
+		return check(), false, nil
+	}
+
+	flight := &checkFlight{done: make(chan struct{}), failed: true}
+	s.flights[key] = flight
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.flights, key)
+		s.mu.Unlock()
+		close(flight.done)
+	}()
+
+	flight.result = check()
+	flight.failed = ctx.Err() != nil
+	return flight.result, false, nil
+}
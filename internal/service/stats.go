@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"url-checker/internal/models"
+)
+
+const (
+	DefaultTimeseriesBucket = time.Hour
+	DefaultTimeseriesWindow = 24 * time.Hour
+
+	// MaxTimeseriesBuckets caps how many buckets one request may ask for.
+	MaxTimeseriesBuckets = 1000
+
+	DefaultStatsTop = 10
+	MaxStatsTop     = 100
+)
+
+// ErrTooManyTimeseriesBuckets is returned for a timeseries range that spans
+// more than MaxTimeseriesBuckets buckets.
+var ErrTooManyTimeseriesBuckets = errors.New("the range spans too many buckets")
+
+// GetStats returns the top hosts with the most broken links.
+func (urlchecker *URLChecker) GetStats(ctx context.Context, top int) (models.StatsResponse, error) {
+	if err := urlchecker.acquireReadSlot(ctx); err != nil {
+		return models.StatsResponse{}, err
+	}
+	defer urlchecker.releaseReadSlot()
+
+	hosts, err := urlchecker.db.TopBrokenHosts(ctx, top)
+	if err != nil {
+		return models.StatsResponse{}, fmt.Errorf("failed to get broken hosts: %w", err)
+	}
+
+	return models.StatsResponse{
+		Top:            top,
+		TopBrokenHosts: hosts,
+	}, nil
+}
+
+// GetStatsTimeseries counts available and broken link checks per bucket
+// between from and to, by the time each check finished. from is rounded down
+// to a bucket boundary and every bucket up to to is returned, empty or not.
+// A range of more than MaxTimeseriesBuckets buckets returns
+// ErrTooManyTimeseriesBuckets.
+func (urlchecker *URLChecker) GetStatsTimeseries(ctx context.Context, from, to time.Time, bucket time.Duration) (models.StatsTimeseries, error) {
+	if bucket <= 0 {
+		return models.StatsTimeseries{}, fmt.Errorf("invalid bucket %s", bucket)
+	}
+	from = from.Truncate(bucket)
+	if timeseriesBuckets(from, to, bucket) > MaxTimeseriesBuckets {
+		return models.StatsTimeseries{}, ErrTooManyTimeseriesBuckets
+	}
+
+	if err := urlchecker.acquireReadSlot(ctx); err != nil {
+		return models.StatsTimeseries{}, err
+	}
+	defer urlchecker.releaseReadSlot()
+
+	counts, err := urlchecker.db.CountChecksByBucket(ctx, from, to, bucket)
+	if err != nil {
+		return models.StatsTimeseries{}, fmt.Errorf("failed to get check counts: %w", err)
+	}
+
+	buckets := []models.StatsBucket{}
+	for index, start := 0, from; start.Before(to); index, start = index+1, start.Add(bucket) {
+		if b, ok := counts[index]; ok {
+			buckets = append(buckets, *b)
+			continue
+		}
+		buckets = append(buckets, models.StatsBucket{Start: start})
+	}
+
+	return models.StatsTimeseries{
+		From:    from,
+		To:      to,
+		Bucket:  bucket.String(),
+		Buckets: buckets,
+	}, nil
+}
+
+// timeseriesBuckets is the number of buckets from from up to to. It divides
+// rather than multiplying or rounding up by adding, which would overflow for
+// long buckets, and counts a span too long for a Duration as unbounded.
+func timeseriesBuckets(from, to time.Time, bucket time.Duration) int64 {
+	span := to.Sub(from)
+	if span <= 0 {
+		return 0
+	}
+	if span == math.MaxInt64 {
+		return math.MaxInt64
+	}
+
+	buckets := int64(span / bucket)
+	if span%bucket != 0 {
+		buckets++
+	}
+	return buckets
+}
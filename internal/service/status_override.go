@@ -0,0 +1,42 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ParseStatusOverrides parses a comma-separated list of host=status pairs. A
+// host may be listed more than once to override several statuses.
+func ParseStatusOverrides(value string) (map[string][]int, error) {
+	overrides := make(map[string][]int)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		host, code, ok := strings.Cut(entry, "=")
+		host = strings.TrimSpace(host)
+		if !ok || host == "" {
+			return nil, fmt.Errorf("expected host=status, got %q", entry)
+		}
+		status, err := strconv.Atoi(strings.TrimSpace(code))
+		if err != nil || status < 100 || status > 599 {
+			return nil, fmt.Errorf("invalid status %q for host %s", code, host)
+		}
+
+		overrides[host] = append(overrides[host], status)
+	}
+	return overrides, nil
+}
+
+// statusOverridden reports whether a response counts as available because
+// its status is overridden for the host that answered it.
+func (urlchecker *URLChecker) statusOverridden(resp *http.Response) bool {
+	if len(urlchecker.statusOverrides) == 0 || resp.Request == nil {
+		return false
+	}
+	return urlchecker.statusOverrides[strings.ToLower(resp.Request.URL.Hostname())][resp.StatusCode]
+}
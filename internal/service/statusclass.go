@@ -0,0 +1,59 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"url-checker/internal/models"
+)
+
+// Status classes of links that have no status code to group them by.
+const (
+	StatusClassError      = "error"
+	StatusClassProcessing = "processing"
+)
+
+// statusClassOrder is the order a grouped report lists the classes in.
+var statusClassOrder = []string{"2xx", "3xx", "4xx", "5xx", StatusClassError, StatusClassProcessing}
+
+// ParseReportGrouping validates a report grouping name. An empty name is
+// allowed and means links are not grouped.
+func ParseReportGrouping(value string) (models.ReportGrouping, error) {
+	switch grouping := models.ReportGrouping(strings.ToLower(strings.TrimSpace(value))); grouping {
+	case "", models.ReportGroupByStatusClass:
+		return grouping, nil
+	default:
+		return "", fmt.Errorf("unknown report grouping %q, expected status_class", value)
+	}
+}
+
+// statusClass is the class of a link's status code, such as 2xx. Links that
+// got no response, or no code in the 2xx-5xx range, are errors.
+func statusClass(link *models.Link) string {
+	switch {
+	case link.Status == models.StatusProcessing:
+		return StatusClassProcessing
+	case link.StatusCode >= 200 && link.StatusCode < 600:
+		return fmt.Sprintf("%dxx", link.StatusCode/100)
+	default:
+		return StatusClassError
+	}
+}
+
+// groupByStatusClass splits links into their status classes, in class order
+// and keeping the order of the links within each. Empty classes are left out.
+func groupByStatusClass(links []*models.Link) []models.StatusClassGroup {
+	byClass := make(map[string][]*models.Link)
+	for _, link := range links {
+		class := statusClass(link)
+		byClass[class] = append(byClass[class], link)
+	}
+
+	var groups []models.StatusClassGroup
+	for _, class := range statusClassOrder {
+		if classLinks := byClass[class]; len(classLinks) > 0 {
+			groups = append(groups, models.StatusClassGroup{StatusClass: class, Count: len(classLinks), Links: classLinks})
+		}
+	}
+	return groups
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"url-checker/internal/models"
+)
+
+const (
+	DefaultTransientRetries    = 3
+	DefaultTransientRetryDelay = 200 * time.Millisecond
+)
+
+// transientFailure reports whether a failed check may succeed when repeated:
+// the request got no response, e.g. the connection failed, or a 5xx one.
+func transientFailure(code int) bool {
+	return code == 0 || code >= 500
+}
+
+// fetchWithRetries is fetchAvailability repeated on transient failures, up to
+// the configured number of retries, doubling the delay before each. Invalid
+// links are not retried, and retrying stops as soon as ctx is cancelled.
+//
+// The caller's check slot stays taken while waiting, so with the defaults a
+// link that keeps failing holds it for 200+400+800ms = 1.4s of delays on top
+// of its four requests.
+func (urlchecker *URLChecker) fetchWithRetries(ctx context.Context, rawURL string, timeout time.Duration) (models.LinkStatus, int) {
+	status, code := urlchecker.fetchAvailability(ctx, rawURL, timeout)
+	if urlchecker.transientRetries == 0 {
+		return status, code
+	}
+	if _, err := requestURL(rawURL); err != nil {
+		return status, code
+	}
+
+	delay := urlchecker.transientRetryDelay
+	for retry := 1; retry <= urlchecker.transientRetries && status == models.StatusNotAvailable && transientFailure(code); retry++ {
+		select {
+		case <-urlchecker.clock.After(delay):
+		case <-ctx.Done():
+			return status, code
+		}
+
+		urlchecker.logger.Infof("Retrying %s after a transient failure with status %d (retry %d of %d)", rawURL, code, retry, urlchecker.transientRetries)
+		status, code = urlchecker.fetchAvailability(ctx, rawURL, timeout)
+		delay *= 2
+	}
+	return status, code
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// closeConnTransport disables keep-alive for listed hosts. Some legacy servers
+// mishandle persistent connections and answer with stale responses.
+type closeConnTransport struct {
+	base  http.RoundTripper
+	hosts map[string]struct{}
+}
+
+func (t *closeConnTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if _, ok := t.hosts[strings.ToLower(req.URL.Hostname())]; ok {
+		req = req.Clone(req.Context())
+		req.Close = true
+	}
+	return t.base.RoundTrip(req)
+}
+
+type keepAliveKey struct{}
+
+// withoutKeepAlive marks checks made with ctx to use a fresh connection each,
+// so their timing includes connection setup.
+func withoutKeepAlive(ctx context.Context) context.Context {
+	return context.WithValue(ctx, keepAliveKey{}, false)
+}
+
+func keepAliveDisabled(ctx context.Context) bool {
+	enabled, ok := ctx.Value(keepAliveKey{}).(bool)
+	return ok && !enabled
+}
+
+// CheckHeader is an extra header sent with every check so monitored servers
+// can recognize the checker's traffic.
+type CheckHeader struct {
+	Name  string
+	Value string
+}
+
+// ParseCheckHeader parses a "Name: value" header. An empty string means no
+// header.
+func ParseCheckHeader(value string) (CheckHeader, error) {
+	if strings.TrimSpace(value) == "" {
+		return CheckHeader{}, nil
+	}
+
+	name, headerValue, ok := strings.Cut(value, ":")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" || strings.ContainsAny(name, " \t") {
+		return CheckHeader{}, fmt.Errorf("expected \"Name: value\"")
+	}
+
+	return CheckHeader{Name: name, Value: strings.TrimSpace(headerValue)}, nil
+}
+
+// BasicAuth is a username and password sent to a host that requires HTTP basic auth.
+type BasicAuth struct {
+	Username string
+	Password string
+}
+
+// ParseBasicAuth parses a comma-separated list of host=username:password pairs.
+func ParseBasicAuth(value string) (map[string]BasicAuth, error) {
+	creds := make(map[string]BasicAuth)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		host, userinfo, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(host) == "" {
+			return nil, fmt.Errorf("expected host=username:password")
+		}
+		username, password, ok := strings.Cut(userinfo, ":")
+		if !ok || username == "" {
+			return nil, fmt.Errorf("expected username:password for host %s", host)
+		}
+
+		creds[strings.TrimSpace(host)] = BasicAuth{Username: username, Password: password}
+	}
+	return creds, nil
+}
+
+// basicAuthTransport adds configured credentials to requests for matching
+// hosts, so they never have to appear in submitted URLs or logs.
+type basicAuthTransport struct {
+	base  http.RoundTripper
+	creds map[string]BasicAuth
+}
+
+func (t *basicAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if auth, ok := t.creds[strings.ToLower(req.URL.Hostname())]; ok && req.Header.Get("Authorization") == "" {
+		req = req.Clone(req.Context())
+		req.SetBasicAuth(auth.Username, auth.Password)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// wrapTransport returns a copy of the checker's client using the transport
+// built by wrap, leaving the caller's client untouched.
+func (urlchecker *URLChecker) wrapTransport(wrap func(http.RoundTripper) http.RoundTripper) {
+	base := urlchecker.httpClient.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	client := *urlchecker.httpClient
+	client.Transport = wrap(base)
+	urlchecker.httpClient = &client
+	urlchecker.transportLayers = append(urlchecker.transportLayers, wrap)
+}
+
+type serverNameKey struct{}
+
+// withServerName makes TLS checks made with ctx send name as the server name
+// (SNI) instead of the request host.
+func withServerName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, serverNameKey{}, name)
+}
+
+func serverNameFrom(ctx context.Context) string {
+	name, _ := ctx.Value(serverNameKey{}).(string)
+	return name
+}
+
+// ValidateServerName accepts an empty name or a bare host name to send as the
+// TLS server name.
+func ValidateServerName(name string) error {
+	if name == "" {
+		return nil
+	}
+	if strings.ContainsAny(name, ":/@ \t") {
+		return fmt.Errorf("invalid server name %q, expected a bare host name", name)
+	}
+	return nil
+}
+
+// clientWithServerName returns a client whose TLS connections send name as
+// the server name. The TLS config belongs to the transport, so each call gets
+// its own transport, rebuilt from the checker's root transport with the same
+// layers on top. It doesn't keep connections alive, so nothing outlives the
+// request.
+func (urlchecker *URLChecker) clientWithServerName(name string) (*http.Client, error) {
+	root := urlchecker.rootTransport
+	if root == nil {
+		root = http.DefaultTransport
+	}
+
+	base, ok := root.(*http.Transport)
+	if !ok {
+		return nil, fmt.Errorf("server name override needs an *http.Transport, got %T", root)
+	}
+
+	transport := base.Clone()
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	transport.TLSClientConfig.ServerName = name
+	transport.DisableKeepAlives = true
+
+	var rt http.RoundTripper = transport
+	for _, wrap := range urlchecker.transportLayers {
+		rt = wrap(rt)
+	}
+
+	client := *urlchecker.httpClient
+	client.Transport = rt
+	return &client, nil
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"url-checker/internal/models"
+)
+
+// DefaultUserAgent is sent with every check unless a fallback agent is tried.
+const DefaultUserAgent = "URL-Checker/1.0"
+
+type userAgentKey struct{}
+
+type usedUserAgentKey struct{}
+
+func withUserAgent(ctx context.Context, agent string) context.Context {
+	return context.WithValue(ctx, userAgentKey{}, agent)
+}
+
+func userAgentFrom(ctx context.Context) string {
+	if agent, _ := ctx.Value(userAgentKey{}).(string); agent != "" {
+		return agent
+	}
+	return DefaultUserAgent
+}
+
+// recordingUserAgent makes checks made with ctx store the fallback user agent
+// that got a link through in used.
+func recordingUserAgent(ctx context.Context, used *string) context.Context {
+	return context.WithValue(ctx, usedUserAgentKey{}, used)
+}
+
+func recordUserAgent(ctx context.Context, agent string) {
+	if used, ok := ctx.Value(usedUserAgentKey{}).(*string); ok {
+		*used = agent
+	}
+}
+
+// userAgentList trims agents and drops empty entries.
+func userAgentList(agents []string) []string {
+	var list []string
+	for _, agent := range agents {
+		if agent = strings.TrimSpace(agent); agent != "" {
+			list = append(list, agent)
+		}
+	}
+	return list
+}
+
+// fetchWithFallbackAgents requests a URL that refused the default user agent
+// with each fallback agent in turn, stopping at the first that gets through.
+// The code is that of the last response received.
+func (urlchecker *URLChecker) fetchWithFallbackAgents(ctx context.Context, method, rawURL string) (models.LinkStatus, int) {
+	code := http.StatusForbidden
+	for _, agent := range urlchecker.fallbackUserAgents {
+		resp, err := urlchecker.fetch(withUserAgent(ctx, agent), method, rawURL)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		resp.Body.Close()
+		code = resp.StatusCode
+
+		if resp.StatusCode >= 200 && resp.StatusCode < 400 {
+			urlchecker.logger.Infof("%s %s got through with fallback user agent %q", method, rawURL, agent)
+			recordUserAgent(ctx, agent)
+			return models.StatusAvailable, code
+		}
+		if resp.StatusCode != http.StatusForbidden {
+			break
+		}
+	}
+
+	return models.StatusNotAvailable, code
+}
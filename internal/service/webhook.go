@@ -0,0 +1,77 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"url-checker/internal/models"
+)
+
+const DefaultWebhookTimeout = 5 * time.Second
+
+// changeWebhook receives an event whenever a re-check changes the status of a
+// link. It has its own client, so events don't go through the check
+// transport with its credentials and headers.
+type changeWebhook struct {
+	url    string
+	client *http.Client
+}
+
+// notifyStatusChange posts a status change event in the background when a
+// change webhook is configured and the status actually changed. Failed
+// deliveries are logged and not retried.
+func (urlchecker *URLChecker) notifyStatusChange(link *models.Link, previous models.LinkStatus) {
+	webhook := urlchecker.changeWebhook
+	if webhook == nil || link.Status == previous {
+		return
+	}
+
+	event := models.LinkStatusChange{
+		Event:       models.EventLinkStatusChanged,
+		LinkID:      link.ID,
+		URL:         link.URL,
+		BatchNum:    link.BatchNum,
+		OldStatus:   previous,
+		NewStatus:   link.Status,
+		CheckSource: link.CheckSource,
+		ChangedAt:   urlchecker.clock.Now(),
+	}
+
+	go func() {
+		if err := webhook.post(event); err != nil {
+			urlchecker.logger.Warnf("Failed to deliver status change of link %d to webhook: %v", link.ID, err)
+		}
+	}()
+}
+
+func (webhook *changeWebhook) post(event models.LinkStatusChange) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), webhook.client.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", DefaultUserAgent)
+
+	resp, err := webhook.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}